@@ -7,6 +7,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"math"
 	"strings"
 
 	moov "github.com/moov-io/go-client/client"
@@ -66,8 +67,9 @@ func createMicroDepositAccount(ctx context.Context, api *moov.APIClient, u *user
 	return createAccount(ctx, api, u, "micro-deposit origination", "123")
 }
 
-// Verify accountID and Transaction exist of a given amount (used to double check transfers).
-func checkTransactions(ctx context.Context, api *moov.APIClient, accountID string, u *user, amount string) error {
+// checkTransactions returns an error unless a transaction line for amount with purpose (e.g. ACHDebit)
+// was posted to accountID.
+func checkTransactions(ctx context.Context, api *moov.APIClient, accountID string, u *user, amount string, purpose string) error {
 	opts := &moov.GetAccountTransactionsOpts{
 		Limit: optional.NewFloat32(25),
 	}
@@ -81,16 +83,27 @@ func checkTransactions(ctx context.Context, api *moov.APIClient, accountID strin
 	if err != nil {
 		return fmt.Errorf("accounts: GetAccountTransactions: %v", err)
 	}
+	cents, err := parseAmount(amount)
+	if err != nil {
+		return fmt.Errorf("accounts: %v", err)
+	}
+	var wrongPurpose string
 	for i := range transactions {
 		for j := range transactions[i].Lines {
 			// match transaction against posted ones on the account
 			line := transactions[i].Lines[j]
-			if v := fmt.Sprintf("USD %.2f", float32(line.Amount)/100.0); line.AccountID == accountID && v == amount {
-				return nil // Matched Transaction
+			if line.AccountID == accountID && int(math.Round(float64(line.Amount))) == cents {
+				if strings.EqualFold(line.Purpose, purpose) {
+					return nil // Matched Transaction
+				}
+				wrongPurpose = line.Purpose
 			}
 		}
 	}
-	return fmt.Errorf("accounts: unable to find %q transaction for account=%s", amount, accountID)
+	if wrongPurpose != "" {
+		return fmt.Errorf("accounts: found %q transaction for account=%s as %s, expected %s", amount, accountID, wrongPurpose, purpose)
+	}
+	return fmt.Errorf("accounts: unable to find %q %s transaction for account=%s", amount, purpose, accountID)
 }
 
 func getMicroDepositsTransactions(ctx context.Context, api *moov.APIClient, accountID string, u *user) ([]*moov.Transaction, error) {
@@ -0,0 +1,700 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+)
+
+var (
+	flagACHFiles = flag.Bool("ach.files", false, "Upload ACH files in several SEC codes to /v1/ach/files and compare each response against a local parse")
+)
+
+// achFilesSECCodes are the SEC codes of the files uploaded with -ach.files. TEL files only have debits
+// as NACHA only allows TEL debits, the others mix credits and debits so they can be segmented.
+var achFilesSECCodes = []string{ach.CCD, ach.IAT, ach.PPD, ach.TEL, ach.WEB}
+
+// checkACHFiles builds a file for each of achFilesSECCodes and runs it through the ACH Files API.
+// Files are uploaded alternating between NACHA and JSON bodies, then read back, validated, downloaded,
+// given an extra batch which is removed again, segmented and deleted. Everything returned is compared
+// against ach.NewReader's parse of the same file. Each call is a step of the "ach-files" suite.
+func checkACHFiles(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+
+	suite := report.newSuite("ach-files")
+	conf.HTTPClient.Transport = suite.wrap(conf.HTTPClient.Transport)
+	api := &achFilesAPI{ctx: ctx, conf: conf}
+
+	for i, secCode := range achFilesSECCodes {
+		if err := checkACHFile(api, suite, secCode, i%2 == 1); err != nil {
+			return fmt.Errorf("%s file: %v", secCode, err)
+		}
+	}
+	log.Printf("SUCCESS: ACH Files API handled %s files", strings.Join(achFilesSECCodes, ", "))
+	return nil
+}
+
+// checkACHFile uploads a file of secCode (as JSON or NACHA) and checks each ACH Files API call for it.
+func checkACHFile(api *achFilesAPI, suite *suiteResult, secCode string, asJSON bool) error {
+	built, err := newACHFilesFile(secCode)
+	if err != nil {
+		return fmt.Errorf("building file: %v", err)
+	}
+	contents, err := writeACHFile(built)
+	if err != nil {
+		return err
+	}
+	local, err := readACHFile(contents)
+	if err != nil {
+		return fmt.Errorf("local parse: %v", err)
+	}
+	step := func(name string, f func() error) error {
+		return suite.step(fmt.Sprintf("%s %s", secCode, name), f)
+	}
+
+	var fileID string
+	err = step("create", func() (err error) {
+		body, contentType := []byte(contents), "text/plain"
+		if asJSON {
+			contentType = "application/json"
+			if body, err = json.Marshal(built); err != nil {
+				return err
+			}
+		}
+		fileID, err = api.createFile(body, contentType)
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("create: %v", err)
+	}
+
+	err = step("get", func() error {
+		file, err := api.getFile(fileID)
+		if err != nil {
+			return err
+		}
+		return compareACHFiles(local, file)
+	})
+	if err != nil {
+		return fmt.Errorf("get: %v", err)
+	}
+
+	err = step("validate", func() error {
+		return api.validateFile(fileID)
+	})
+	if err != nil {
+		return fmt.Errorf("validate: %v", err)
+	}
+
+	err = step("contents", func() error {
+		file, err := api.getContents(fileID)
+		if err != nil {
+			return err
+		}
+		return compareACHFiles(local, file)
+	})
+	if err != nil {
+		return fmt.Errorf("contents: %v", err)
+	}
+
+	// IAT batches can't be managed through /batches
+	if secCode != ach.IAT {
+		err = step("batches", func() error {
+			return checkACHFileBatches(api, fileID, contents)
+		})
+		if err != nil {
+			return fmt.Errorf("batches: %v", err)
+		}
+	}
+
+	var segmented []string
+	if secCode != ach.TEL {
+		err = step("segment", func() (err error) {
+			segmented, err = checkSegmentFile(api, fileID, contents)
+			return
+		})
+		if err != nil {
+			return fmt.Errorf("segment: %v", err)
+		}
+	}
+
+	err = step("delete", func() error {
+		for _, id := range append([]string{fileID}, segmented...) {
+			if err := api.deleteFile(id); err != nil {
+				return err
+			}
+			if _, err := api.getFile(id); !isNotFound(err) {
+				return fmt.Errorf("file %s wasn't deleted: %v", id, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("delete: %v", err)
+	}
+	return nil
+}
+
+// checkACHFileBatches lists the batches of fileID, adds a batch and reads it back, then deletes it. The
+// file's contents need to match contents again once it's deleted.
+func checkACHFileBatches(api *achFilesAPI, fileID string, contents string) error {
+	local, err := readACHFile(contents)
+	if err != nil {
+		return err
+	}
+	batches, err := api.getBatches(fileID)
+	if err != nil {
+		return err
+	}
+	if len(batches) != len(local.Batches) {
+		return fmt.Errorf("got %d batches, expected %d", len(batches), len(local.Batches))
+	}
+	for i := range batches {
+		if err := compareACHBatches(local.Batches[i], batches[i]); err != nil {
+			return fmt.Errorf("batch #%d: %v", i+1, err)
+		}
+	}
+
+	// Add a batch like the file's first one with its own ID and entries
+	batch, err := newACHFilesBatch(local.Batches[0].GetHeader().StandardEntryClassCode, len(local.Batches)+1)
+	if err != nil {
+		return err
+	}
+	batch.SetID(generateID())
+	batch.GetHeader().ID = batch.ID() // the ACH service reads the batch's ID from its header
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	batchID, err := api.addBatch(fileID, body)
+	if err != nil {
+		return err
+	}
+	if batchID != batch.ID() {
+		return fmt.Errorf("added batch %s, expected %s", batchID, batch.ID())
+	}
+	got, err := api.getBatch(fileID, batchID)
+	if err != nil {
+		return err
+	}
+	if err := compareACHBatches(batch, got); err != nil {
+		return fmt.Errorf("added batch: %v", err)
+	}
+
+	// The ACH service stores added batches as a plain ach.Batch which its writer rejects, so the file's
+	// contents can't be downloaded until the batch is deleted. The batch needs to be listed though.
+	if batches, err = api.getBatches(fileID); err != nil {
+		return err
+	}
+	if len(batches) != len(local.Batches)+1 {
+		return fmt.Errorf("got %d batches after adding one, expected %d", len(batches), len(local.Batches)+1)
+	}
+
+	if err := api.deleteBatch(fileID, batchID); err != nil {
+		return err
+	}
+	if _, err := api.getBatch(fileID, batchID); !isNotFound(err) {
+		return fmt.Errorf("batch %s wasn't deleted: %v", batchID, err)
+	}
+	file, err := api.getContents(fileID)
+	if err != nil {
+		return err
+	}
+	if err := compareACHFiles(local, file); err != nil {
+		return fmt.Errorf("contents after deleting batch: %v", err)
+	}
+	return nil
+}
+
+// checkSegmentFile segments fileID into credit and debit files and compares each with segmenting a
+// local parse of contents. The IDs of the segmented files are returned.
+func checkSegmentFile(api *achFilesAPI, fileID string, contents string) ([]string, error) {
+	local, err := readACHFile(contents)
+	if err != nil {
+		return nil, err
+	}
+	creditFile, debitFile, err := local.SegmentFile(ach.NewSegmentFileConfiguration())
+	if err != nil {
+		return nil, fmt.Errorf("local segment: %v", err)
+	}
+	creditFileID, debitFileID, err := api.segmentFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, segment := range []struct {
+		name     string
+		id       string
+		expected *ach.File
+	}{
+		{"credit", creditFileID, creditFile},
+		{"debit", debitFileID, debitFile},
+	} {
+		if len(segment.expected.Batches) == 0 && len(segment.expected.IATBatches) == 0 {
+			if segment.id != "" {
+				return ids, fmt.Errorf("got %s file %s without any %ss", segment.name, segment.id, segment.name)
+			}
+			continue
+		}
+		if segment.id == "" {
+			return ids, fmt.Errorf("no %s file", segment.name)
+		}
+		ids = append(ids, segment.id)
+		file, err := api.getContents(segment.id)
+		if err != nil {
+			return ids, fmt.Errorf("%s file: %v", segment.name, err)
+		}
+		if err := compareACHFiles(segment.expected, file); err != nil {
+			return ids, fmt.Errorf("%s file: %v", segment.name, err)
+		}
+	}
+	return ids, nil
+}
+
+// achFilesAPI makes ACH Files API calls with the configuration's headers. The go-client models don't
+// match the ACH service's responses (which wrap objects like {"file": ..}), so responses are decoded
+// with moov-io/ach instead.
+type achFilesAPI struct {
+	ctx  context.Context
+	conf *moov.Configuration
+}
+
+// achFilesError is a non-2xx response from the ACH Files API.
+type achFilesError struct {
+	status int
+	body   string
+}
+
+func (e *achFilesError) Error() string {
+	return fmt.Sprintf("HTTP status %d: %s", e.status, e.body)
+}
+
+func isNotFound(err error) bool {
+	var apiErr *achFilesError
+	return errors.As(err, &apiErr) && apiErr.status == http.StatusNotFound
+}
+
+// do makes a request to path (under /v1/ach) and returns the response body. If out is non-nil the body is
+// decoded into it as JSON. Responses with an "error" need it to be null.
+func (api *achFilesAPI) do(method, path, contentType string, body []byte, out interface{}) ([]byte, error) {
+	req, err := http.NewRequest(method, api.conf.BasePath+"/v1/ach"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(api.ctx)
+	for k, v := range api.conf.DefaultHeader {
+		req.Header.Set(k, v)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("User-Agent", api.conf.UserAgent)
+
+	resp, err := api.conf.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &achFilesError{status: resp.StatusCode, body: strings.TrimSpace(string(bs))}
+	}
+	if err := checkCORSHeaders(resp); err != nil {
+		return nil, err
+	}
+	if out != nil {
+		var wrapper struct {
+			Error *string `json:"error"`
+		}
+		if err := json.Unmarshal(bs, &wrapper); err != nil {
+			return nil, fmt.Errorf("decoding %s response: %v", path, err)
+		}
+		if wrapper.Error != nil {
+			return nil, fmt.Errorf("%s returned error: %s", path, *wrapper.Error)
+		}
+		if err := json.Unmarshal(bs, out); err != nil {
+			return nil, fmt.Errorf("decoding %s response: %v", path, err)
+		}
+	}
+	return bs, nil
+}
+
+func (api *achFilesAPI) createFile(body []byte, contentType string) (string, error) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if _, err := api.do("POST", "/files/create", contentType, body, &resp); err != nil {
+		return "", err
+	}
+	if resp.ID == "" {
+		return "", errors.New("no file ID returned")
+	}
+	return resp.ID, nil
+}
+
+func (api *achFilesAPI) getFile(fileID string) (*ach.File, error) {
+	var resp struct {
+		File json.RawMessage `json:"file"`
+	}
+	if _, err := api.do("GET", "/files/"+fileID, "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return ach.FileFromJSON(resp.File)
+}
+
+func (api *achFilesAPI) validateFile(fileID string) error {
+	var resp struct{}
+	_, err := api.do("GET", "/files/"+fileID+"/validate", "", nil, &resp)
+	return err
+}
+
+func (api *achFilesAPI) getContents(fileID string) (*ach.File, error) {
+	bs, err := api.do("GET", "/files/"+fileID+"/contents", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) == 0 {
+		// The ACH service responds with an empty 200 when it can't write the file
+		return nil, fmt.Errorf("file %s has no contents", fileID)
+	}
+	return readACHFile(string(bs))
+}
+
+func (api *achFilesAPI) getBatches(fileID string) ([]*ach.Batch, error) {
+	var resp struct {
+		Batches []*ach.Batch `json:"batches"`
+	}
+	if _, err := api.do("GET", "/files/"+fileID+"/batches", "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Batches, nil
+}
+
+func (api *achFilesAPI) getBatch(fileID, batchID string) (*ach.Batch, error) {
+	var resp struct {
+		Batch *ach.Batch `json:"batch"`
+	}
+	if _, err := api.do("GET", "/files/"+fileID+"/batches/"+batchID, "", nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Batch == nil {
+		return nil, fmt.Errorf("batch %s not returned", batchID)
+	}
+	return resp.Batch, nil
+}
+
+func (api *achFilesAPI) addBatch(fileID string, body []byte) (string, error) {
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if _, err := api.do("POST", "/files/"+fileID+"/batches", "application/json", body, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (api *achFilesAPI) deleteBatch(fileID, batchID string) error {
+	_, err := api.do("DELETE", "/files/"+fileID+"/batches/"+batchID, "", nil, nil)
+	return err
+}
+
+func (api *achFilesAPI) segmentFile(fileID string) (string, string, error) {
+	var resp struct {
+		CreditFileID string `json:"creditFileID"`
+		DebitFileID  string `json:"debitFileID"`
+	}
+	if _, err := api.do("POST", "/files/"+fileID+"/segment", "application/json", nil, &resp); err != nil {
+		return "", "", err
+	}
+	return resp.CreditFileID, resp.DebitFileID, nil
+}
+
+func (api *achFilesAPI) deleteFile(fileID string) error {
+	_, err := api.do("DELETE", "/files/"+fileID, "", nil, nil)
+	return err
+}
+
+// newACHFilesFile returns a file from defaultRoutingNumber to 231380104 with one batch of secCode.
+func newACHFilesFile(secCode string) (*ach.File, error) {
+	now := time.Now()
+	fh := ach.NewFileHeader()
+	fh.ImmediateOrigin = defaultRoutingNumber
+	fh.ImmediateOriginName = "Moov Bank"
+	fh.ImmediateDestination = "231380104"
+	fh.ImmediateDestinationName = "Moov Bank"
+	fh.FileCreationDate = now.Format("060102")
+	fh.FileCreationTime = now.Format("1504")
+
+	file := ach.NewFile()
+	file.SetHeader(fh)
+	if secCode == ach.IAT {
+		batch := newACHFilesIATBatch()
+		if err := batch.Create(); err != nil {
+			return nil, err
+		}
+		file.AddIATBatch(batch)
+	} else {
+		batch, err := newACHFilesBatch(secCode, 1)
+		if err != nil {
+			return nil, err
+		}
+		file.AddBatch(batch)
+	}
+	if err := file.Create(); err != nil {
+		return nil, err
+	}
+	return file, file.Validate()
+}
+
+// newACHFilesBatch returns a batch of secCode with a credit and a debit entry, or two debits for TEL.
+func newACHFilesBatch(secCode string, batchNumber int) (ach.Batcher, error) {
+	first, last := name()
+
+	bh := ach.NewBatchHeader()
+	bh.ServiceClassCode = ach.MixedDebitsAndCredits
+	bh.CompanyName = "Moov Bank"
+	bh.CompanyIdentification = "123456789"
+	bh.StandardEntryClassCode = secCode
+	bh.CompanyEntryDescription = "apitest"
+	bh.EffectiveEntryDate = time.Now().AddDate(0, 0, 1).Format("060102")
+	bh.ODFIIdentification = defaultRoutingNumber[:8]
+	bh.BatchNumber = batchNumber
+
+	batch, err := ach.NewBatch(bh)
+	if err != nil {
+		return nil, err
+	}
+	for i, code := range []int{ach.CheckingCredit, ach.SavingsDebit} {
+		ed := ach.NewEntryDetail()
+		ed.TransactionCode = code
+		if secCode == ach.TEL {
+			ed.TransactionCode = ach.CheckingDebit + 10*i
+		}
+		ed.SetRDFI("231380104")
+		ed.DFIAccountNumber = fmt.Sprintf("%d", 100000000+randSource.Int63()%900000000)
+		ed.Amount = int(1 + randSource.Int63()%25000)
+		ed.IdentificationNumber = fmt.Sprintf("%d", randSource.Int63()%1000000)
+		ed.IndividualName = fmt.Sprintf("%s %s", first, last)
+		ed.SetTraceNumber(bh.ODFIIdentification, batchNumber*10+i+1)
+		ed.Category = ach.CategoryForward
+		switch secCode {
+		case ach.TEL, ach.WEB:
+			ed.DiscretionaryData = "S"
+		case ach.CCD, ach.PPD:
+			addenda := ach.NewAddenda05()
+			addenda.PaymentRelatedInformation = fmt.Sprintf("apitest %s entry %d", secCode, i+1)
+			addenda.SequenceNumber = 1
+			addenda.EntryDetailSequenceNumber = i + 1
+			ed.AddAddenda05(addenda)
+			ed.AddendaRecordIndicator = 1
+		}
+		batch.AddEntry(ed)
+	}
+	if err := batch.Create(); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// newACHFilesIATBatch returns an IAT batch with a credit and a debit entry.
+func newACHFilesIATBatch() ach.IATBatch {
+	first, last := name()
+
+	bh := ach.NewIATBatchHeader()
+	bh.ServiceClassCode = ach.MixedDebitsAndCredits
+	bh.ForeignExchangeIndicator = "FF"
+	bh.ForeignExchangeReferenceIndicator = 3
+	bh.ISODestinationCountryCode = "US"
+	bh.OriginatorIdentification = "123456789"
+	bh.StandardEntryClassCode = ach.IAT
+	bh.CompanyEntryDescription = "apitest"
+	bh.ISOOriginatingCurrencyCode = "CAD"
+	bh.ISODestinationCurrencyCode = "USD"
+	bh.ODFIIdentification = defaultRoutingNumber[:8]
+	bh.EffectiveEntryDate = time.Now().AddDate(0, 0, 1).Format("060102")
+
+	batch := ach.NewIATBatch(bh)
+	for i, code := range []int{ach.CheckingCredit, ach.CheckingDebit} {
+		ed := ach.NewIATEntryDetail()
+		ed.TransactionCode = code
+		ed.SetRDFI("231380104")
+		ed.AddendaRecords = 7
+		ed.DFIAccountNumber = fmt.Sprintf("%d", 100000000+randSource.Int63()%900000000)
+		ed.Amount = int(1 + randSource.Int63()%25000)
+		ed.SetTraceNumber(bh.ODFIIdentification, i+1)
+		ed.Category = ach.CategoryForward
+
+		ed.Addenda10 = ach.NewAddenda10()
+		ed.Addenda10.TransactionTypeCode = "ANN"
+		ed.Addenda10.ForeignPaymentAmount = ed.Amount
+		ed.Addenda10.Name = fmt.Sprintf("%s %s", first, last)
+		ed.Addenda10.EntryDetailSequenceNumber = i + 1
+
+		ed.Addenda11 = ach.NewAddenda11()
+		ed.Addenda11.OriginatorName = "Moov Bank"
+		ed.Addenda11.OriginatorStreetAddress = "123 1st St"
+		ed.Addenda11.EntryDetailSequenceNumber = i + 1
+
+		ed.Addenda12 = ach.NewAddenda12()
+		ed.Addenda12.OriginatorCityStateProvince = "Toronto*ON\\"
+		ed.Addenda12.OriginatorCountryPostalCode = "CA*M5H2N2\\"
+		ed.Addenda12.EntryDetailSequenceNumber = i + 1
+
+		ed.Addenda13 = ach.NewAddenda13()
+		ed.Addenda13.ODFIName = "Moov Bank"
+		ed.Addenda13.ODFIIDNumberQualifier = "01"
+		ed.Addenda13.ODFIIdentification = defaultRoutingNumber
+		ed.Addenda13.ODFIBranchCountryCode = "CA"
+		ed.Addenda13.EntryDetailSequenceNumber = i + 1
+
+		ed.Addenda14 = ach.NewAddenda14()
+		ed.Addenda14.RDFIName = "Moov Bank"
+		ed.Addenda14.RDFIIDNumberQualifier = "01"
+		ed.Addenda14.RDFIIdentification = "231380104"
+		ed.Addenda14.RDFIBranchCountryCode = "US"
+		ed.Addenda14.EntryDetailSequenceNumber = i + 1
+
+		ed.Addenda15 = ach.NewAddenda15()
+		ed.Addenda15.ReceiverIDNumber = fmt.Sprintf("%d", randSource.Int63()%1000000)
+		ed.Addenda15.ReceiverStreetAddress = "123 1st St"
+		ed.Addenda15.EntryDetailSequenceNumber = i + 1
+
+		ed.Addenda16 = ach.NewAddenda16()
+		ed.Addenda16.ReceiverCityStateProvince = "Anytown*CA\\"
+		ed.Addenda16.ReceiverCountryPostalCode = "US*90301\\"
+		ed.Addenda16.EntryDetailSequenceNumber = i + 1
+
+		batch.AddEntry(ed)
+	}
+	return batch
+}
+
+func writeACHFile(file *ach.File) (string, error) {
+	var buf bytes.Buffer
+	if err := ach.NewWriter(&buf).Write(file); err != nil {
+		return "", fmt.Errorf("writing file: %v", err)
+	}
+	return buf.String(), nil
+}
+
+func readACHFile(contents string) (*ach.File, error) {
+	file, err := ach.NewReader(strings.NewReader(contents)).Read()
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// compareACHFiles returns an error listing the fields of got which are different from expected. IDs and
+// creation times aren't compared as the ACH service sets its own.
+func compareACHFiles(expected, got *ach.File) error {
+	var diffs []string
+	check := func(field string, expected, actual interface{}) {
+		if e, ok := expected.(string); ok {
+			expected = strings.TrimSpace(e)
+			actual = strings.TrimSpace(actual.(string))
+		}
+		if expected != actual {
+			diffs = append(diffs, fmt.Sprintf("%s is %v, expected %v", field, actual, expected))
+		}
+	}
+	check("immediateOrigin", expected.Header.ImmediateOrigin, got.Header.ImmediateOrigin)
+	check("immediateOriginName", expected.Header.ImmediateOriginName, got.Header.ImmediateOriginName)
+	check("immediateDestination", expected.Header.ImmediateDestination, got.Header.ImmediateDestination)
+	check("immediateDestinationName", expected.Header.ImmediateDestinationName, got.Header.ImmediateDestinationName)
+	check("batches", len(expected.Batches), len(got.Batches))
+	check("IATBatches", len(expected.IATBatches), len(got.IATBatches))
+	check("entryAddendaCount", expected.Control.EntryAddendaCount, got.Control.EntryAddendaCount)
+	check("entryHash", expected.Control.EntryHash, got.Control.EntryHash)
+	check("totalDebit", expected.Control.TotalDebitEntryDollarAmountInFile, got.Control.TotalDebitEntryDollarAmountInFile)
+	check("totalCredit", expected.Control.TotalCreditEntryDollarAmountInFile, got.Control.TotalCreditEntryDollarAmountInFile)
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+
+	for i := range expected.Batches {
+		if err := compareACHBatches(expected.Batches[i], got.Batches[i]); err != nil {
+			return fmt.Errorf("batch #%d: %v", i+1, err)
+		}
+	}
+	for i := range expected.IATBatches {
+		e, g := expected.IATBatches[i], got.IATBatches[i]
+		check("standardEntryClassCode", e.Header.StandardEntryClassCode, g.Header.StandardEntryClassCode)
+		check("originatorIdentification", e.Header.OriginatorIdentification, g.Header.OriginatorIdentification)
+		check("entries", len(e.Entries), len(g.Entries))
+		for j := 0; j < len(e.Entries) && j < len(g.Entries); j++ {
+			field := fmt.Sprintf("IAT batch #%d entry #%d ", i+1, j+1)
+			check(field+"transactionCode", e.Entries[j].TransactionCode, g.Entries[j].TransactionCode)
+			check(field+"amount", e.Entries[j].Amount, g.Entries[j].Amount)
+			check(field+"DFIAccountNumber", e.Entries[j].DFIAccountNumber, g.Entries[j].DFIAccountNumber)
+			check(field+"traceNumber", e.Entries[j].TraceNumber, g.Entries[j].TraceNumber)
+			if e.Entries[j].Addenda10 != nil && g.Entries[j].Addenda10 != nil {
+				check(field+"receiverName", e.Entries[j].Addenda10.Name, g.Entries[j].Addenda10.Name)
+			}
+		}
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// compareACHBatches returns an error listing the header and entry fields of got which are different from expected.
+func compareACHBatches(expected, got ach.Batcher) error {
+	var diffs []string
+	check := func(field string, expected, actual interface{}) {
+		if e, ok := expected.(string); ok {
+			expected = strings.TrimSpace(e)
+			actual = strings.TrimSpace(actual.(string))
+		}
+		if expected != actual {
+			diffs = append(diffs, fmt.Sprintf("%s is %v, expected %v", field, actual, expected))
+		}
+	}
+	eh, gh := expected.GetHeader(), got.GetHeader()
+	check("serviceClassCode", eh.ServiceClassCode, gh.ServiceClassCode)
+	check("standardEntryClassCode", eh.StandardEntryClassCode, gh.StandardEntryClassCode)
+	check("companyIdentification", eh.CompanyIdentification, gh.CompanyIdentification)
+	check("companyEntryDescription", eh.CompanyEntryDescription, gh.CompanyEntryDescription)
+	check("effectiveEntryDate", eh.EffectiveEntryDate, gh.EffectiveEntryDate)
+
+	ee, ge := expected.GetEntries(), got.GetEntries()
+	check("entries", len(ee), len(ge))
+	for i := 0; i < len(ee) && i < len(ge); i++ {
+		field := fmt.Sprintf("entry #%d ", i+1)
+		check(field+"transactionCode", ee[i].TransactionCode, ge[i].TransactionCode)
+		check(field+"amount", ee[i].Amount, ge[i].Amount)
+		check(field+"RDFIIdentification", ee[i].RDFIIdentification, ge[i].RDFIIdentification)
+		check(field+"DFIAccountNumber", ee[i].DFIAccountNumber, ge[i].DFIAccountNumber)
+		check(field+"individualName", ee[i].IndividualName, ge[i].IndividualName)
+		check(field+"traceNumber", ee[i].TraceNumber, ge[i].TraceNumber)
+		check(field+"addenda05", len(ee[i].Addenda05), len(ge[i].Addenda05))
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/ach"
+	achserver "github.com/moov-io/ach/server"
+	moov "github.com/moov-io/go-client/client"
+
+	kitlog "github.com/go-kit/kit/log"
+)
+
+func TestACHFiles__newACHFilesFile(t *testing.T) {
+	for _, secCode := range achFilesSECCodes {
+		file, err := newACHFilesFile(secCode)
+		if err != nil {
+			t.Fatalf("%s: %v", secCode, err)
+		}
+		contents, err := writeACHFile(file)
+		if err != nil {
+			t.Fatalf("%s: %v", secCode, err)
+		}
+		parsed, err := readACHFile(contents)
+		if err != nil {
+			t.Fatalf("%s: %v", secCode, err)
+		}
+		if err := compareACHFiles(file, parsed); err != nil {
+			t.Errorf("%s: %v", secCode, err)
+		}
+	}
+}
+
+func TestACHFiles__compareACHFiles(t *testing.T) {
+	file, err := newACHFilesFile(ach.PPD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, _ := writeACHFile(file)
+	other, _ := readACHFile(contents)
+	other.Batches[0].GetEntries()[1].Amount++
+	if err := other.Batches[0].Create(); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Create(); err != nil {
+		t.Fatal(err)
+	}
+	err = compareACHFiles(file, other)
+	if err == nil || !strings.Contains(err.Error(), "totalDebit") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Entries are compared when the totals match
+	other, _ = readACHFile(contents)
+	other.Batches[0].GetEntries()[0].IndividualName = "Jane Doe"
+	err = compareACHFiles(file, other)
+	if err == nil || !strings.Contains(err.Error(), "entry #1 individualName") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestACHFiles__checkACHFile(t *testing.T) {
+	repo := achserver.NewRepositoryInMemory(0, kitlog.NewNopLogger())
+	handler := achserver.MakeHTTPHandler(achserver.NewService(repo), repo, kitlog.NewNopLogger())
+	server := httptest.NewServer(http.StripPrefix("/v1/ach", handler))
+	defer server.Close()
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = server.URL
+	conf.HTTPClient = server.Client()
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	api := &achFilesAPI{ctx: context.Background(), conf: conf}
+
+	suite := newRunReport().newSuite("ach-files")
+	for i, secCode := range achFilesSECCodes {
+		if err := checkACHFile(api, suite, secCode, i%2 == 1); err != nil {
+			t.Errorf("%s: %v", secCode, err)
+		}
+	}
+	if len(repo.FindAllFiles()) != 0 {
+		t.Errorf("files weren't deleted: %d", len(repo.FindAllFiles()))
+	}
+	if _, err := api.getFile("missing"); !isNotFound(err) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+var (
+	flagBatch          = flag.Bool("batch", false, "Create transfers in one call to /v1/ach/transfers/batch and verify a batch with invalid transfers is rejected")
+	flagBatchSize      = flag.Int("batch.size", 10, "How many transfers to create with -batch")
+	flagBatchReceivers = flag.Int("batch.receivers", 3, "How many receivers the -batch transfers are spread across")
+)
+
+// checkBatchTransfers creates -batch.size transfers across -batch.receivers receivers in one call and
+// reads each back. It then sends a batch with invalid transfers, which needs to be rejected without
+// creating any of its valid transfers. The created transfers are added to iter so they're verified in
+// the merged files. Each check is a step of the "batch" suite.
+func checkBatchTransfers(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+	api := moov.NewAPIClient(conf)
+
+	suite := report.newSuite("batch")
+
+	receivers := []moov.Receiver{iter.receiver}
+	err := suite.step("createReceivers", func() error {
+		for len(receivers) < *flagBatchReceivers {
+			receiver, err := createReceiver(ctx, api, iter.user, iter.featureFlags, iter.receiverDepository.ID)
+			if err != nil {
+				return err
+			}
+			if !iter.featureFlags.CustomersCallsDisabled {
+				if err := attemptCustomerApproval(ctx, *flagCustomersAdminAddress, receiver.CustomerID); err != nil {
+					return err
+				}
+			}
+			receivers = append(receivers, receiver)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("batch receivers: %v", err)
+	}
+
+	reqs := newBatchTransferRequests(iter, receivers, *flagBatchSize)
+	var transfers []moov.Transfer
+	err = suite.step("addTransfers", func() (err error) {
+		transfers, err = addBatchTransfers(ctx, api, iter.userID, reqs)
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("batch transfers: %v", err)
+	}
+	log.Printf("SUCCESS: Created %d transfers in one batch", len(transfers))
+
+	err = suite.step("getTransfers", func() error {
+		return getBatchTransfers(ctx, api, iter.userID, transfers)
+	})
+	if err != nil {
+		return fmt.Errorf("batch transfers: %v", err)
+	}
+
+	err = suite.step("partialFailure", func() error {
+		return checkBatchPartialFailure(ctx, api, iter, receivers)
+	})
+	if err != nil {
+		return fmt.Errorf("batch with invalid transfers: %v", err)
+	}
+	log.Println("SUCCESS: batch with invalid transfers was rejected without creating any of them")
+
+	iter.transfers = append(iter.transfers, transfers...)
+	return nil
+}
+
+// newBatchTransferRequests returns size transfers spread across receivers and each transfer kind of
+// -ach.type and -transfer.type.
+func newBatchTransferRequests(iter *iteration, receivers []moov.Receiver, size int) []moov.CreateTransfer {
+	secCodes, _ := parseACHTypes(*flagACHType)
+	types, _ := parseTransferTypes(*flagTransferType)
+	kinds := transferKinds(secCodes, types)
+
+	reqs := make([]moov.CreateTransfer, 0, size)
+	for i := 0; i < size; i++ {
+		receiver := receivers[i%len(receivers)]
+		reqs = append(reqs, newTransferRequest(receiver, iter.originator, amount(), kinds[i%len(kinds)]))
+	}
+	return reqs
+}
+
+// addBatchTransfers creates reqs in one call and checks a Transfer was returned for each, in order.
+func addBatchTransfers(ctx context.Context, api *moov.APIClient, userID string, reqs []moov.CreateTransfer) ([]moov.Transfer, error) {
+	transfers, resp, err := api.TransfersApi.AddTransfers(ctx, userID, reqs, &moov.AddTransfersOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+	if resp != nil {
+		resp.Body.Close()
+		if err := checkCORSHeaders(resp); err != nil {
+			return nil, fmt.Errorf("add transfers: %v", err)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("problem creating %d transfers: %v", len(reqs), describeAPIError(err))
+	}
+	if len(transfers) != len(reqs) {
+		return nil, fmt.Errorf("created %d transfers, but sent %d", len(transfers), len(reqs))
+	}
+	for i := range transfers {
+		if transfers[i].ID == "" {
+			return nil, fmt.Errorf("transfer %d has no ID", i)
+		}
+		if err := compareTransfer(reqs[i], transfers[i]); err != nil {
+			return nil, fmt.Errorf("transfer %d: %v", i, err)
+		}
+	}
+	return transfers, nil
+}
+
+// compareTransfer returns an error if xfer doesn't match the request it was created from.
+func compareTransfer(req moov.CreateTransfer, xfer moov.Transfer) error {
+	var diffs []string
+	check := func(field, expected, actual string) {
+		if !strings.EqualFold(expected, actual) {
+			diffs = append(diffs, fmt.Sprintf("%s is %q, expected %q", field, actual, expected))
+		}
+	}
+	check("amount", req.Amount, xfer.Amount)
+	check("transferType", req.TransferType, xfer.TransferType)
+	check("standardEntryClassCode", req.StandardEntryClassCode, xfer.StandardEntryClassCode)
+	check("originator", req.Originator, xfer.Originator)
+	check("receiver", req.Receiver, xfer.Receiver)
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// getBatchTransfers reads each of transfers and compares them to what was returned when they were created.
+func getBatchTransfers(ctx context.Context, api *moov.APIClient, userID string, transfers []moov.Transfer) error {
+	for i := range transfers {
+		xfer, resp, err := api.TransfersApi.GetTransferByID(ctx, transfers[i].ID, userID, nil)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("problem reading transfer %s: %v", transfers[i].ID, describeAPIError(err))
+		}
+		req := moov.CreateTransfer{
+			Amount:                 transfers[i].Amount,
+			TransferType:           transfers[i].TransferType,
+			StandardEntryClassCode: transfers[i].StandardEntryClassCode,
+			Originator:             transfers[i].Originator,
+			Receiver:               transfers[i].Receiver,
+		}
+		if xfer.ID != transfers[i].ID {
+			return fmt.Errorf("read transfer %s, but got %s", transfers[i].ID, xfer.ID)
+		}
+		if err := compareTransfer(req, xfer); err != nil {
+			return fmt.Errorf("transfer %s: %v", xfer.ID, err)
+		}
+	}
+	return nil
+}
+
+// checkBatchPartialFailure sends a batch of valid transfers mixed with invalid ones. The batch needs
+// to be rejected with a 4xx Error body and none of its transfers can be created.
+func checkBatchPartialFailure(ctx context.Context, api *moov.APIClient, iter *iteration, receivers []moov.Receiver) error {
+	reqs := newBatchTransferRequests(iter, receivers, 4)
+	reqs[1].Amount = "USD -12.34"
+	reqs[3].Receiver = generateID() // doesn't exist
+
+	before, err := countTransfers(ctx, api, iter.userID)
+	if err != nil {
+		return err
+	}
+	_, resp, err := api.TransfersApi.AddTransfers(ctx, iter.userID, reqs, &moov.AddTransfersOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err == nil {
+		return errors.New("batch with invalid transfers was accepted")
+	}
+	if resp == nil {
+		return err
+	}
+	if resp.StatusCode < 400 || resp.StatusCode > 499 {
+		return fmt.Errorf("got HTTP status %s, expected 4xx: %v", resp.Status, describeAPIError(err))
+	}
+	if e, ok := err.(moov.GenericOpenAPIError); ok {
+		if err := checkErrorBody(resp.Header, e.Body()); err != nil {
+			return err
+		}
+	}
+	after, err := countTransfers(ctx, api, iter.userID)
+	if err != nil {
+		return err
+	}
+	if after != before {
+		return fmt.Errorf("rejected batch created %d transfers", after-before)
+	}
+	return nil
+}
+
+func countTransfers(ctx context.Context, api *moov.APIClient, userID string) (int, error) {
+	transfers, resp, err := api.TransfersApi.GetTransfers(ctx, userID, &moov.GetTransfersOpts{
+		Limit: optional.NewInt32(idempotencyLimit),
+	})
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("counting transfers: %v", describeAPIError(err))
+	}
+	return len(transfers), nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestBatch__newBatchTransferRequests(t *testing.T) {
+	iter := &iteration{
+		originator: moov.Originator{ID: "orig", DefaultDepository: "origDep"},
+	}
+	receivers := []moov.Receiver{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	reqs := newBatchTransferRequests(iter, receivers, 7)
+	if len(reqs) != 7 {
+		t.Fatalf("got %d transfers", len(reqs))
+	}
+	for i := range reqs {
+		if reqs[i].Receiver != receivers[i%3].ID || reqs[i].Originator != "orig" {
+			t.Errorf("transfer %d: %#v", i, reqs[i])
+		}
+	}
+}
+
+func TestBatch__compareTransfer(t *testing.T) {
+	req := moov.CreateTransfer{
+		TransferType:           "Push",
+		Amount:                 "USD 12.34",
+		Originator:             "orig",
+		Receiver:               "receiver",
+		StandardEntryClassCode: "PPD",
+	}
+	xfer := moov.Transfer{
+		TransferType:           "push",
+		Amount:                 "USD 12.34",
+		Originator:             "orig",
+		Receiver:               "receiver",
+		StandardEntryClassCode: "PPD",
+	}
+	if err := compareTransfer(req, xfer); err != nil {
+		t.Error(err)
+	}
+
+	xfer.Amount = "USD 1.23"
+	xfer.Receiver = "other"
+	err := compareTransfer(req, xfer)
+	if err == nil || err.Error() != `amount is "USD 1.23", expected "USD 12.34", receiver is "other", expected "receiver"` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
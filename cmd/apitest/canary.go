@@ -0,0 +1,287 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/moov-io/base"
+	"github.com/moov-io/base/admin"
+)
+
+var (
+	flagCanary                 = flag.Bool("canary", false, "Continuously run the apitest flow and serve run status on the admin server")
+	flagCanaryInterval         = flag.Duration("canary.interval", 5*time.Minute, "Duration to wait between canary runs")
+	flagCanaryHistory          = flag.Int("canary.history", 100, "How many canary runs to keep for the admin endpoints")
+	flagCanaryFailureThreshold = flag.Int("canary.failure-threshold", 3, "Fail /ready once this many consecutive canary runs have failed")
+)
+
+// canaryRun is the outcome of one iterate() call in canary mode.
+type canaryRun struct {
+	Started         time.Time     `json:"started"`
+	DurationSeconds float64       `json:"durationSeconds"`
+	Passed          bool          `json:"passed"`
+	RequestID       string        `json:"requestID"`
+	Steps           []*stepResult `json:"steps"`
+}
+
+// failure returns the first failed step of a run, if any.
+func (run *canaryRun) failure() *stepResult {
+	for i := range run.Steps {
+		if run.Steps[i].Error != "" {
+			return run.Steps[i]
+		}
+	}
+	return nil
+}
+
+// canaryHistory keeps the most recent canary runs, oldest first.
+type canaryHistory struct {
+	mu   sync.RWMutex
+	runs []*canaryRun
+	max  int
+
+	// startupErr is why apitest's startup checks failed, kept until a run passes
+	startupErr error
+}
+
+func newCanaryHistory(max int) *canaryHistory {
+	if max <= 0 {
+		max = 1
+	}
+	return &canaryHistory{max: max}
+}
+
+func (h *canaryHistory) add(run *canaryRun) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runs = append(h.runs, run)
+	if n := len(h.runs) - h.max; n > 0 {
+		h.runs = h.runs[n:]
+	}
+	if run.Passed {
+		h.startupErr = nil
+	}
+}
+
+func (h *canaryHistory) setStartupError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.startupErr = err
+}
+
+func (h *canaryHistory) list() []*canaryRun {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := make([]*canaryRun, len(h.runs))
+	copy(out, h.runs)
+	return out
+}
+
+func (h *canaryHistory) last() *canaryRun {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.runs) == 0 {
+		return nil
+	}
+	return h.runs[len(h.runs)-1]
+}
+
+// readinessCheck returns an error once the last threshold runs have all failed, or while the
+// startup checks have failed and no run has passed since.
+func (h *canaryHistory) readinessCheck(threshold int) func() error {
+	return func() error {
+		h.mu.RLock()
+		startupErr := h.startupErr
+		h.mu.RUnlock()
+		if startupErr != nil {
+			return fmt.Errorf("startup failed: %v", startupErr)
+		}
+
+		runs := h.list()
+		if threshold <= 0 || len(runs) < threshold {
+			return nil
+		}
+		for _, run := range runs[len(runs)-threshold:] {
+			if run.Passed {
+				return nil
+			}
+		}
+		return fmt.Errorf("last %d canary runs failed", threshold)
+	}
+}
+
+type stepLatency struct {
+	Count       int     `json:"count"`
+	Failures    int     `json:"failures"`
+	MinSeconds  float64 `json:"minSeconds"`
+	AvgSeconds  float64 `json:"avgSeconds"`
+	P95Seconds  float64 `json:"p95Seconds"`
+	MaxSeconds  float64 `json:"maxSeconds"`
+	LastSeconds float64 `json:"lastSeconds"`
+}
+
+// latencies summarizes each step's duration across every run in the history.
+func (h *canaryHistory) latencies() map[string]*stepLatency {
+	durations := make(map[string][]float64)
+	out := make(map[string]*stepLatency)
+	for _, run := range h.list() {
+		for _, step := range run.Steps {
+			lat, exists := out[step.Name]
+			if !exists {
+				lat = &stepLatency{}
+				out[step.Name] = lat
+			}
+			lat.Count++
+			if step.Error != "" {
+				lat.Failures++
+			}
+			lat.LastSeconds = step.DurationSeconds
+			durations[step.Name] = append(durations[step.Name], step.DurationSeconds)
+		}
+	}
+	for name, ds := range durations {
+		sort.Float64s(ds)
+		var total float64
+		for i := range ds {
+			total += ds[i]
+		}
+		lat := out[name]
+		lat.MinSeconds = ds[0]
+		lat.MaxSeconds = ds[len(ds)-1]
+		lat.AvgSeconds = total / float64(len(ds))
+		lat.P95Seconds = ds[(len(ds)*95-1)/100]
+	}
+	return out
+}
+
+// addHandlers registers the canary endpoints on our admin server.
+//
+//	GET /canary/last       the most recent run with each step
+//	GET /canary/runs       pass/fail history of recent runs
+//	GET /canary/latencies  per-step latency summary across recent runs
+//
+// '/ready' also fails once -canary.failure-threshold runs in a row have failed.
+func (h *canaryHistory) addHandlers(svc *admin.Server, threshold int) {
+	svc.AddHandler("/canary/last", h.lastHandler)
+	svc.AddHandler("/canary/runs", h.runsHandler)
+	svc.AddHandler("/canary/latencies", h.latenciesHandler)
+	svc.AddReadinessCheck("canary", h.readinessCheck(threshold))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *canaryHistory) lastHandler(w http.ResponseWriter, r *http.Request) {
+	run := h.last()
+	if run == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, run)
+}
+
+type canaryRunSummary struct {
+	Started         time.Time `json:"started"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	Passed          bool      `json:"passed"`
+	FailedStep      string    `json:"failedStep,omitempty"`
+	Error           string    `json:"error,omitempty"`
+}
+
+func (h *canaryHistory) runsHandler(w http.ResponseWriter, r *http.Request) {
+	var out struct {
+		Passed int                `json:"passed"`
+		Failed int                `json:"failed"`
+		Runs   []canaryRunSummary `json:"runs"`
+	}
+	out.Runs = make([]canaryRunSummary, 0)
+	for _, run := range h.list() {
+		summary := canaryRunSummary{
+			Started:         run.Started,
+			DurationSeconds: run.DurationSeconds,
+			Passed:          run.Passed,
+		}
+		if run.Passed {
+			out.Passed++
+		} else {
+			out.Failed++
+		}
+		if step := run.failure(); step != nil {
+			summary.FailedStep = step.Name
+			summary.Error = step.Error
+		}
+		out.Runs = append(out.Runs, summary)
+	}
+	writeJSON(w, out)
+}
+
+func (h *canaryHistory) latenciesHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.latencies())
+}
+
+// runCanary pings every app and calls iterate() every -canary.interval until the process is stopped.
+// startupErr is a failure of apitest's own startup ping, which fails '/ready' until a run passes.
+func runCanary(ctx context.Context, adminServer *admin.Server, startupErr error) {
+	history := newCanaryHistory(*flagCanaryHistory)
+	history.setStartupError(startupErr)
+	history.addHandlers(adminServer, *flagCanaryFailureThreshold)
+
+	log.Printf("INFO: starting canary, running every %v", *flagCanaryInterval)
+
+	ticker := time.NewTicker(*flagCanaryInterval)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		// Canary runs aren't kept in our JUnit / JSON reports, otherwise they would grow forever.
+		suite := &suiteResult{
+			Name:    fmt.Sprintf("canary %d", n),
+			Started: time.Now(),
+		}
+		requestID := base.ID()
+		var iter *iteration
+		err := suite.step("pingApps", func() error {
+			return pingApps(ctx, requestID)
+		})
+		if err == nil {
+			iter = iterate(ctx, requestID, suite)
+		} else {
+			log.Printf("ERROR: %v", err)
+		}
+
+		run := &canaryRun{
+			Started:         suite.Started,
+			DurationSeconds: time.Since(suite.Started).Seconds(),
+			Passed:          err == nil && iter != nil && !suite.failed(),
+			RequestID:       requestID,
+			Steps:           suite.copy().Steps,
+		}
+		history.add(run)
+		if run.Passed {
+			log.Printf("SUCCESS: canary run %d passed in %.2fs", n, run.DurationSeconds)
+		} else {
+			log.Printf("FAILURE: canary run %d failed in %.2fs", n, run.DurationSeconds)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func canaryTestRun(passed bool, seconds float64) *canaryRun {
+	run := &canaryRun{
+		Started:         time.Now(),
+		DurationSeconds: seconds,
+		Passed:          passed,
+		Steps: []*stepResult{
+			{Name: "createUser", DurationSeconds: seconds},
+		},
+	}
+	if !passed {
+		run.Steps = append(run.Steps, &stepResult{Name: "createTransfer", Error: "bad thing"})
+	}
+	return run
+}
+
+func TestCanary__history(t *testing.T) {
+	h := newCanaryHistory(3)
+	if h.last() != nil {
+		t.Error("expected no runs")
+	}
+	for i := 0; i < 5; i++ {
+		h.add(canaryTestRun(true, float64(i)))
+	}
+	runs := h.list()
+	if len(runs) != 3 {
+		t.Fatalf("got %d runs", len(runs))
+	}
+	if runs[0].DurationSeconds != 2 || h.last().DurationSeconds != 4 {
+		t.Errorf("unexpected runs: first=%v last=%v", runs[0].DurationSeconds, h.last().DurationSeconds)
+	}
+}
+
+func TestCanary__readinessCheck(t *testing.T) {
+	h := newCanaryHistory(10)
+	check := h.readinessCheck(2)
+
+	if err := check(); err != nil {
+		t.Errorf("no runs should be ready: %v", err)
+	}
+	h.add(canaryTestRun(false, 1))
+	if err := check(); err != nil {
+		t.Errorf("one failure should be ready: %v", err)
+	}
+	h.add(canaryTestRun(false, 1))
+	if err := check(); err == nil {
+		t.Error("expected error")
+	}
+	h.add(canaryTestRun(true, 1))
+	if err := check(); err != nil {
+		t.Errorf("passing run should be ready: %v", err)
+	}
+}
+
+func TestCanary__latencies(t *testing.T) {
+	h := newCanaryHistory(10)
+	h.add(canaryTestRun(true, 1.0))
+	h.add(canaryTestRun(true, 3.0))
+	h.add(canaryTestRun(false, 2.0))
+
+	lat := h.latencies()
+	user := lat["createUser"]
+	if user == nil || user.Count != 3 {
+		t.Fatalf("unexpected latencies: %#v", lat)
+	}
+	if user.MinSeconds != 1.0 || user.MaxSeconds != 3.0 || user.AvgSeconds != 2.0 || user.LastSeconds != 2.0 {
+		t.Errorf("unexpected createUser latency: %#v", user)
+	}
+	if tx := lat["createTransfer"]; tx == nil || tx.Failures != 1 {
+		t.Errorf("unexpected createTransfer latency: %#v", tx)
+	}
+}
+
+func TestCanary__handlers(t *testing.T) {
+	h := newCanaryHistory(10)
+
+	w := httptest.NewRecorder()
+	h.lastHandler(w, httptest.NewRequest("GET", "/canary/last", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("bogus HTTP status: %d", w.Code)
+	}
+
+	h.add(canaryTestRun(true, 1))
+	h.add(canaryTestRun(false, 2))
+
+	w = httptest.NewRecorder()
+	h.lastHandler(w, httptest.NewRequest("GET", "/canary/last", nil))
+	var run canaryRun
+	if err := json.NewDecoder(w.Body).Decode(&run); err != nil {
+		t.Fatal(err)
+	}
+	if run.Passed || len(run.Steps) != 2 {
+		t.Errorf("unexpected run: %#v", run)
+	}
+
+	w = httptest.NewRecorder()
+	h.runsHandler(w, httptest.NewRequest("GET", "/canary/runs", nil))
+	var runs struct {
+		Passed int                `json:"passed"`
+		Failed int                `json:"failed"`
+		Runs   []canaryRunSummary `json:"runs"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&runs); err != nil {
+		t.Fatal(err)
+	}
+	if runs.Passed != 1 || runs.Failed != 1 || len(runs.Runs) != 2 {
+		t.Errorf("unexpected runs: %#v", runs)
+	}
+	if runs.Runs[1].FailedStep != "createTransfer" {
+		t.Errorf("unexpected failed step: %#v", runs.Runs[1])
+	}
+}
+
+func TestCanary__startupError(t *testing.T) {
+	h := newCanaryHistory(10)
+	check := h.readinessCheck(2)
+
+	h.setStartupError(errors.New("failed to ping paygate"))
+	if err := check(); err == nil || !strings.Contains(err.Error(), "paygate") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	h.add(canaryTestRun(false, 1))
+	if err := check(); err == nil {
+		t.Error("expected error")
+	}
+	h.add(canaryTestRun(true, 1))
+	if err := check(); err != nil {
+		t.Errorf("passing run should be ready: %v", err)
+	}
+}
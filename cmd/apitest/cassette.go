@@ -0,0 +1,72 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/moov-io/api/cmd/apitest/local"
+)
+
+var (
+	flagRecord = flag.String("record", "", "Record every HTTP request and response, with secrets redacted, into the given cassette file")
+	flagReplay = flag.String("replay", "", "Replay HTTP responses from the given cassette file instead of calling Moov services")
+
+	recordedCassette *local.Cassette
+	cassetteReplayer *local.Replayer
+)
+
+// setupCassette reads -replay's cassette or starts recording for -record. Our admin and
+// security HTTP clients are wrapped as well so their calls are captured.
+func setupCassette() error {
+	if *flagRecord != "" && *flagReplay != "" {
+		return errors.New("-record and -replay can't be used together")
+	}
+	if *flagReplay != "" {
+		cassette, err := local.ReadCassette(*flagReplay)
+		if err != nil {
+			return err
+		}
+		cassetteReplayer = local.NewReplayer(cassette)
+		log.Printf("INFO: replaying %d HTTP responses from %s", len(cassette.Interactions), *flagReplay)
+	}
+	if *flagRecord != "" {
+		recordedCassette = &local.Cassette{}
+		log.Printf("INFO: recording HTTP requests into %s", *flagRecord)
+	}
+	adminHTTPClient.Transport = wrapCassette(adminHTTPClient.Transport)
+	httpClient.Transport = wrapCassette(httpClient.Transport)
+	return nil
+}
+
+// wrapCassette returns an http.RoundTripper which records or replays requests if -record or
+// -replay were given, otherwise underlying is returned.
+func wrapCassette(underlying http.RoundTripper) http.RoundTripper {
+	if cassetteReplayer != nil {
+		return cassetteReplayer
+	}
+	if recordedCassette != nil {
+		if underlying == nil {
+			underlying = http.DefaultTransport
+		}
+		return &local.Recorder{
+			Underlying: underlying,
+			Cassette:   recordedCassette,
+		}
+	}
+	return underlying
+}
+
+func saveCassette() {
+	if recordedCassette == nil {
+		return
+	}
+	if err := recordedCassette.Save(*flagRecord); err != nil {
+		log.Printf("ERROR: saving cassette: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/moov-io/api/cmd/apitest/contract"
+)
+
+var (
+	flagContract = flag.String("contract", "", "Validate responses against comma separated OpenAPI specs (e.g. openapi.yaml,openapiv2.yaml)")
+
+	contractSpec       *contract.Spec
+	contractSuite      *suiteResult
+	contractViolations int64
+
+	// loadedSpecs are cached by their comma separated locations
+	loadedSpecs = make(map[string]*contract.Spec)
+)
+
+// loadSpec reads comma separated OpenAPI specs, which can be shared by -contract and -coverage.
+func loadSpec(locations string) (*contract.Spec, error) {
+	if spec, exists := loadedSpecs[locations]; exists {
+		return spec, nil
+	}
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	spec, err := contract.Load(client, strings.Split(locations, ",")...)
+	if err != nil {
+		return nil, fmt.Errorf("reading OpenAPI specs: %v", err)
+	}
+	loadedSpecs[locations] = spec
+	return spec, nil
+}
+
+// checkSpecFiles returns an error naming flagName when a local file of the comma separated locations
+// doesn't exist. Relative paths are read from the working directory, which is where apitest's Docker
+// image has our specs.
+func checkSpecFiles(flagName, locations string) error {
+	for _, location := range strings.Split(locations, ",") {
+		if idx := strings.Index(location, "#"); idx >= 0 {
+			location = location[:idx]
+		}
+		if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+			continue
+		}
+		if _, err := os.Stat(location); os.IsNotExist(err) {
+			return fmt.Errorf("%s doesn't exist, set -%s to its path", location, flagName)
+		}
+	}
+	return nil
+}
+
+// setupContract reads the -contract OpenAPI specs. Each violation is reported as a failed
+// step in the "contract" suite.
+func setupContract() error {
+	if *flagContract == "" {
+		return nil
+	}
+	spec, err := loadSpec(*flagContract)
+	if err != nil {
+		return err
+	}
+	contractSpec = spec
+	contractSuite = report.newSuite("contract")
+	log.Printf("INFO: validating responses against %s", *flagContract)
+	return nil
+}
+
+// wrapContract returns an http.RoundTripper which validates responses if -contract was given,
+// otherwise underlying is returned.
+func wrapContract(underlying http.RoundTripper) http.RoundTripper {
+	if contractSpec == nil {
+		return underlying
+	}
+	return &contract.Transport{
+		Underlying: underlying,
+		Spec:       contractSpec,
+		Report:     reportViolations,
+	}
+}
+
+func reportViolations(req *http.Request, violations []contract.Violation) {
+	for i := range violations {
+		v := violations[i]
+		atomic.AddInt64(&contractViolations, 1)
+		log.Printf("ERROR: OpenAPI contract violation (%s %s): %v", req.Method, req.URL.Path, v)
+		contractSuite.step(v.OperationID, func() error {
+			return v
+		})
+	}
+}
+
+// checkContract fails apitest if any response didn't match our OpenAPI specs.
+func checkContract() {
+	if n := atomic.LoadInt64(&contractViolations); n > 0 {
+		fatalf("FAILURE: found %d OpenAPI contract violations", n)
+	}
+	if contractSpec != nil {
+		log.Println("SUCCESS: all responses matched our OpenAPI specs")
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package contract
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/moov-io/api/cmd/apitest/local"
+)
+
+// Coverage records which of a Spec's operations were called and the status codes they returned.
+type Coverage struct {
+	spec *Spec
+
+	mu           sync.Mutex
+	statuses     map[*Operation]map[int]int
+	undocumented map[string]int // "METHOD /normalized/path" to count
+}
+
+// NewCoverage returns an empty Coverage of spec's operations.
+func NewCoverage(spec *Spec) *Coverage {
+	return &Coverage{
+		spec:         spec,
+		statuses:     make(map[*Operation]map[int]int),
+		undocumented: make(map[string]int),
+	}
+}
+
+// Record marks the operation for method and path as covered with statusCode.
+func (c *Coverage) Record(method, path string, statusCode int) {
+	op := c.spec.Find(method, path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if op == nil {
+		c.undocumented[strings.ToUpper(method)+" "+local.NormalizePath(path)]++
+		return
+	}
+	if c.statuses[op] == nil {
+		c.statuses[op] = make(map[int]int)
+	}
+	c.statuses[op][statusCode]++
+}
+
+// Wrap returns an http.RoundTripper which records each response. Requests need to use their
+// production paths, like Transport.
+func (c *Coverage) Wrap(underlying http.RoundTripper) http.RoundTripper {
+	return &coverageTransport{
+		coverage:   c,
+		underlying: underlying,
+	}
+}
+
+type coverageTransport struct {
+	coverage   *Coverage
+	underlying http.RoundTripper
+}
+
+func (t *coverageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// local.Transport rewrites req.URL in place, so record the production path from before
+	method, path := req.Method, req.URL.Path
+	resp, err := t.underlying.RoundTrip(req)
+	if resp != nil && method != http.MethodOptions {
+		t.coverage.Record(method, path, resp.StatusCode)
+	}
+	return resp, err
+}
+
+// CoverageReport summarizes which operations were covered, overall and for each Moov app.
+type CoverageReport struct {
+	CoverageSummary
+
+	Groups       []CoverageGroup     `json:"groups"`
+	Operations   []OperationCoverage `json:"operations"`
+	Undocumented map[string]int      `json:"undocumented,omitempty"`
+}
+
+// CoverageSummary is how many operations were covered.
+type CoverageSummary struct {
+	Covered int     `json:"covered"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+func (s *CoverageSummary) add(covered bool) {
+	s.Total++
+	if covered {
+		s.Covered++
+	}
+	s.Percent = 100.0 * float64(s.Covered) / float64(s.Total)
+}
+
+// CoverageGroup is the coverage of one Moov app (see Operation.Group).
+type CoverageGroup struct {
+	Name string `json:"name"`
+	CoverageSummary
+}
+
+// OperationCoverage shows if an operation was called and which status codes it returned.
+type OperationCoverage struct {
+	ID     string `json:"operationId"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Group  string `json:"group"`
+
+	Covered bool `json:"covered"`
+
+	// StatusCodes is how many responses of each status code were seen
+	StatusCodes map[string]int `json:"statusCodes,omitempty"`
+}
+
+// Report returns the covered and uncovered operations sorted by path and method.
+func (c *Coverage) Report() CoverageReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out CoverageReport
+	for _, op := range c.spec.Operations() {
+		oc := OperationCoverage{
+			ID:      op.ID,
+			Method:  op.Method,
+			Path:    op.Path,
+			Group:   op.Group(),
+			Covered: len(c.statuses[op]) > 0,
+		}
+		for code, n := range c.statuses[op] {
+			if oc.StatusCodes == nil {
+				oc.StatusCodes = make(map[string]int)
+			}
+			oc.StatusCodes[strconv.Itoa(code)] = n
+		}
+		out.Operations = append(out.Operations, oc)
+	}
+	sort.Slice(out.Operations, func(i, j int) bool {
+		if out.Operations[i].Path == out.Operations[j].Path {
+			return out.Operations[i].Method < out.Operations[j].Method
+		}
+		return out.Operations[i].Path < out.Operations[j].Path
+	})
+
+	groups := make(map[string]*CoverageGroup)
+	for _, oc := range out.Operations {
+		out.add(oc.Covered)
+		g, exists := groups[oc.Group]
+		if !exists {
+			g = &CoverageGroup{Name: oc.Group}
+			groups[oc.Group] = g
+		}
+		g.add(oc.Covered)
+	}
+	for _, g := range groups {
+		out.Groups = append(out.Groups, *g)
+	}
+	sort.Slice(out.Groups, func(i, j int) bool {
+		return out.Groups[i].Name < out.Groups[j].Name
+	})
+
+	if len(c.undocumented) > 0 {
+		out.Undocumented = make(map[string]int, len(c.undocumented))
+		for k, v := range c.undocumented {
+			out.Undocumented[k] = v
+		}
+	}
+	return out
+}
+
+// WriteText writes a human readable version of the report.
+func (r CoverageReport) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "API coverage: %d of %d operations (%.1f%%)\n\n", r.Covered, r.Total, r.Percent)
+	fmt.Fprintln(tw, "GROUP\tCOVERED\tTOTAL\tPERCENT")
+	for _, g := range r.Groups {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\n", g.Name, g.Covered, g.Total, g.Percent)
+	}
+
+	fmt.Fprintln(tw, "\nOPERATION\tMETHOD\tPATH\tSTATUS CODES")
+	for _, oc := range r.Operations {
+		status := "-"
+		if oc.Covered {
+			codes := make([]string, 0, len(oc.StatusCodes))
+			for code, n := range oc.StatusCodes {
+				codes = append(codes, fmt.Sprintf("%s x%d", code, n))
+			}
+			sort.Strings(codes)
+			status = strings.Join(codes, ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", oc.ID, oc.Method, oc.Path, status)
+	}
+
+	if len(r.Undocumented) > 0 {
+		fmt.Fprintln(tw, "\nUNDOCUMENTED\tCALLS")
+		keys := make([]string, 0, len(r.Undocumented))
+		for k := range r.Undocumented {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(tw, "%s\t%d\n", k, r.Undocumented[k])
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package contract
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/api/cmd/apitest/local"
+)
+
+func TestCoverage(t *testing.T) {
+	spec := loadTestSpec(t)
+	coverage := NewCoverage(spec)
+
+	coverage.Record("GET", "/v1/widgets", http.StatusOK)
+	coverage.Record("GET", "/v1/widgets", http.StatusOK)
+	coverage.Record("GET", "/v1/widgets", http.StatusBadRequest)
+	coverage.Record("GET", "/v1/widgets/a3b1c9", http.StatusNotFound)
+	coverage.Record("GET", "/v1/gadgets/a3b1c9", http.StatusOK)
+
+	r := coverage.Report()
+	if r.Covered != 2 || r.Total != 5 || r.Percent != 40.0 {
+		t.Errorf("unexpected summary: %#v", r.CoverageSummary)
+	}
+	if len(r.Groups) != 1 || r.Groups[0].Name != "widgets" || r.Groups[0].Covered != 2 {
+		t.Errorf("unexpected groups: %#v", r.Groups)
+	}
+	for _, oc := range r.Operations {
+		switch oc.ID {
+		case "getWidgets":
+			if !oc.Covered || oc.StatusCodes["200"] != 2 || oc.StatusCodes["400"] != 1 {
+				t.Errorf("unexpected coverage: %#v", oc)
+			}
+		case "getWidget":
+			if !oc.Covered || oc.StatusCodes["404"] != 1 {
+				t.Errorf("unexpected coverage: %#v", oc)
+			}
+		default:
+			if oc.Covered {
+				t.Errorf("%s shouldn't be covered", oc.ID)
+			}
+		}
+	}
+	if n := r.Undocumented["GET /v1/gadgets/{id}"]; n != 1 {
+		t.Errorf("unexpected undocumented calls: %#v", r.Undocumented)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "API coverage: 2 of 5 operations (40.0%)") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "200 x2, 400 x1") {
+		t.Errorf("unexpected report:\n%s", buf.String())
+	}
+}
+
+func TestCoverage__Wrap(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer svc.Close()
+
+	coverage := NewCoverage(loadTestSpec(t))
+	client := &http.Client{
+		Transport: coverage.Wrap(svc.Client().Transport),
+	}
+	resp, err := client.Post(svc.URL+"/v1/widgets/create", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	r := coverage.Report()
+	if r.Covered != 1 {
+		t.Errorf("unexpected summary: %#v", r.CoverageSummary)
+	}
+}
+
+func TestCoverage__WrapLocal(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer svc.Close()
+
+	// -local sends /v1/widgets/create to /create, which still covers createWidget
+	coverage := NewCoverage(loadTestSpec(t))
+	client := &http.Client{
+		Transport: coverage.Wrap(&local.Transport{
+			Underlying: svc.Client().Transport,
+			Routes:     []local.Route{{Prefix: "widgets", Host: strings.TrimPrefix(svc.URL, "http://")}},
+		}),
+	}
+	resp, err := client.Post("https://api.moov.io/v1/widgets/create", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	r := coverage.Report()
+	if r.Covered != 1 || len(r.Undocumented) != 0 {
+		t.Errorf("unexpected report: %#v", r)
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package contract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Violation is a difference between an HTTP response and its OpenAPI operation.
+type Violation struct {
+	OperationID string
+
+	// Pointer is the JSON pointer (RFC 6901) into the response body which mismatched. It's
+	// empty for the whole body and problems with the status code or headers.
+	Pointer string
+
+	Message string
+}
+
+func (v Violation) Error() string {
+	if v.Pointer == "" {
+		return fmt.Sprintf("%s: %s", v.OperationID, v.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.OperationID, v.Pointer, v.Message)
+}
+
+// Validate checks the status code, required headers and body of a response against op.
+func (s *Spec) Validate(op *Operation, statusCode int, header http.Header, body []byte) []Violation {
+	v := &validator{
+		loader:      s.loader,
+		operationID: op.ID,
+	}
+
+	responses, err := s.loader.resolve(op.responses)
+	if err != nil {
+		v.add("", "reading responses: %v", err)
+		return v.violations
+	}
+	raw, ok := findResponse(asMap(responses.v), statusCode)
+	if !ok {
+		v.add("", "undocumented HTTP status %d", statusCode)
+		return v.violations
+	}
+	response, err := s.loader.resolve(node{doc: responses.doc, v: raw})
+	if err != nil {
+		v.add("", "reading response: %v", err)
+		return v.violations
+	}
+	v.headers(response, header)
+	v.body(response, header.Get("Content-Type"), body)
+	return v.violations
+}
+
+// Schema is one schema object read from an OpenAPI document, e.g. the shared Error schema.
+type Schema struct {
+	loader *loader
+	node   node
+	name   string
+}
+
+// LoadSchema reads the schema at ref, a file path or URL with a JSON pointer fragment (e.g.
+// openapi-common.yaml#/components/schemas/Error). client defaults to http.DefaultClient.
+func LoadSchema(client *http.Client, ref string) (*Schema, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	idx := strings.Index(ref, "#")
+	if idx < 0 {
+		return nil, fmt.Errorf("schema %s is missing a JSON pointer", ref)
+	}
+	location, err := absLocation(ref[:idx])
+	if err != nil {
+		return nil, err
+	}
+	l := &loader{
+		client: client,
+		docs:   make(map[string]interface{}),
+	}
+	n, err := l.follow(location, ref[idx:])
+	if err != nil {
+		return nil, err
+	}
+	if asMap(n.v) == nil {
+		return nil, fmt.Errorf("%s isn't a schema", ref)
+	}
+	return &Schema{
+		loader: l,
+		node:   n,
+		name:   path.Base(ref[idx+1:]),
+	}, nil
+}
+
+// Validate checks a JSON body against the schema. Violations use the schema's name (e.g. Error)
+// as their OperationID.
+func (s *Schema) Validate(body []byte) []Violation {
+	v := &validator{
+		loader:      s.loader,
+		operationID: s.name,
+	}
+	v.json(s.node, body)
+	return v.violations
+}
+
+// findResponse returns the response for an exact status code, its range (e.g. 2XX) or the default.
+func findResponse(responses map[string]interface{}, statusCode int) (interface{}, bool) {
+	if r, ok := responses[strconv.Itoa(statusCode)]; ok {
+		return r, true
+	}
+	for k, r := range responses {
+		if strings.EqualFold(k, fmt.Sprintf("%dXX", statusCode/100)) {
+			return r, true
+		}
+	}
+	r, ok := responses["default"]
+	return r, ok
+}
+
+type validator struct {
+	loader      *loader
+	operationID string
+	violations  []Violation
+}
+
+func (v *validator) add(pointer string, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{
+		OperationID: v.operationID,
+		Pointer:     pointer,
+		Message:     fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) headers(response node, header http.Header) {
+	headers := asMap(asMap(response.v)["headers"])
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h, err := v.loader.resolve(node{doc: response.doc, v: headers[name]})
+		if err != nil {
+			v.add("", "reading header %s: %v", name, err)
+			continue
+		}
+		if required, _ := asMap(h.v)["required"].(bool); required && header.Get(name) == "" {
+			v.add("", "missing required header %s", name)
+		}
+	}
+}
+
+func (v *validator) body(response node, contentType string, body []byte) {
+	content := asMap(asMap(response.v)["content"])
+	if len(content) == 0 {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	media, ok := content[mediaType]
+	if !ok {
+		if !strings.Contains(mediaType, "json") {
+			return // only JSON bodies are checked
+		}
+		if media, ok = content["application/json"]; !ok {
+			return
+		}
+	}
+	schema, ok := asMap(media)["schema"]
+	if !ok || !strings.Contains(mediaType, "json") {
+		return
+	}
+
+	v.json(node{doc: response.doc, v: schema}, body)
+}
+
+// json decodes body and validates it against the schema n.
+func (v *validator) json(n node, body []byte) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		v.add("", "empty response body")
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		v.add("", "invalid JSON response: %v", err)
+		return
+	}
+	v.schema(n, value, "")
+}
+
+// schema validates value against an OpenAPI schema object, pointer is value's location in the body.
+func (v *validator) schema(n node, value interface{}, pointer string) {
+	n, err := v.loader.resolve(n)
+	if err != nil {
+		v.add(pointer, "reading schema: %v", err)
+		return
+	}
+	schema := asMap(n.v)
+	if schema == nil {
+		return
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); !nullable && schemaType(schema) != "" {
+			v.add(pointer, "unexpected null")
+		}
+		return
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for i := range all {
+			v.schema(node{doc: n.doc, v: all[i]}, value, pointer)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		if v.matching(n.doc, anyOf, value, pointer) == 0 {
+			v.add(pointer, "doesn't match any anyOf schema")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if count := v.matching(n.doc, oneOf, value, pointer); count != 1 {
+			v.add(pointer, "matches %d oneOf schemas", count)
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && !inEnum(enum, value) {
+		v.add(pointer, "%v is not one of %v", value, enum)
+	}
+
+	switch typ := schemaType(schema); typ {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			v.add(pointer, "expected object, got %s", jsonType(value))
+			return
+		}
+		v.object(n, schema, obj, pointer)
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			v.add(pointer, "expected array, got %s", jsonType(value))
+			return
+		}
+		if items, ok := schema["items"]; ok {
+			for i := range arr {
+				v.schema(node{doc: n.doc, v: items}, arr[i], fmt.Sprintf("%s/%d", pointer, i))
+			}
+		}
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			v.add(pointer, "expected string, got %s", jsonType(value))
+			return
+		}
+		if format, _ := schema["format"].(string); format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				v.add(pointer, "invalid date-time %q", s)
+			}
+		}
+
+	case "integer":
+		num, ok := value.(json.Number)
+		if !ok {
+			v.add(pointer, "expected integer, got %s", jsonType(value))
+			return
+		}
+		if _, err := num.Int64(); err != nil {
+			v.add(pointer, "expected integer, got %s", num)
+		}
+
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			v.add(pointer, "expected number, got %s", jsonType(value))
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.add(pointer, "expected boolean, got %s", jsonType(value))
+		}
+	}
+}
+
+func (v *validator) object(n node, schema map[string]interface{}, obj map[string]interface{}, pointer string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for i := range required {
+			name := fmt.Sprintf("%v", required[i])
+			if _, exists := obj[name]; !exists {
+				v.add(pointer+"/"+escape(name), "missing required property")
+			}
+		}
+	}
+
+	properties := asMap(schema["properties"])
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child := pointer + "/" + escape(name)
+		if prop, ok := properties[name]; ok {
+			v.schema(node{doc: n.doc, v: prop}, obj[name], child)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.add(child, "unexpected property")
+			}
+		case map[string]interface{}:
+			v.schema(node{doc: n.doc, v: additional}, obj[name], child)
+		}
+	}
+}
+
+// matching returns how many schemas value is valid against.
+func (v *validator) matching(doc string, schemas []interface{}, value interface{}, pointer string) int {
+	count := 0
+	for i := range schemas {
+		sub := &validator{
+			loader:      v.loader,
+			operationID: v.operationID,
+		}
+		sub.schema(node{doc: doc, v: schemas[i]}, value, pointer)
+		if len(sub.violations) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func schemaType(schema map[string]interface{}) string {
+	if typ, ok := schema["type"].(string); ok {
+		return typ
+	}
+	if _, ok := schema["properties"]; ok {
+		return "object"
+	}
+	if _, ok := schema["items"]; ok {
+		return "array"
+	}
+	return ""
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for i := range enum {
+		if fmt.Sprintf("%v", enum[i]) == fmt.Sprintf("%v", value) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
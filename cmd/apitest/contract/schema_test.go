@@ -0,0 +1,131 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package contract
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func jsonHeader() http.Header {
+	h := make(http.Header)
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	return h
+}
+
+func TestSpec__Validate(t *testing.T) {
+	spec := loadTestSpec(t)
+	getWidget := spec.Find("GET", "/v1/widgets/foo")
+
+	cases := []struct {
+		body     string
+		pointers []string
+	}{
+		{`{"id": "foo", "status": "ready"}`, nil},
+		{`{"id": "foo", "status": "ready", "size": 12, "created": "2020-04-10T12:00:00Z", "owner": null, "extra": true}`, nil},
+		{`{"id": "foo", "status": "ready", "owner": {"name": "jane"}, "parts": [{"name": "a"}]}`, nil},
+		{`{"id": "foo"}`, []string{"/status"}},
+		{`{"id": 1, "status": "lost"}`, []string{"/id", "/status"}},
+		{`{"id": "foo", "status": "ready", "size": 1.5, "created": "yesterday"}`, []string{"/created", "/size"}},
+		{`{"id": "foo", "status": "ready", "owner": {}, "parts": [{"name": 1}]}`, []string{"/owner/name", "/parts/0/name"}},
+		{`[]`, []string{""}},
+		{``, []string{""}},
+	}
+	for i := range cases {
+		violations := spec.Validate(getWidget, http.StatusOK, jsonHeader(), []byte(cases[i].body))
+		if len(violations) != len(cases[i].pointers) {
+			t.Errorf("%s: unexpected violations: %#v", cases[i].body, violations)
+			continue
+		}
+		for j := range violations {
+			if violations[j].OperationID != "getWidget" {
+				t.Errorf("unexpected operationID: %#v", violations[j])
+			}
+			if violations[j].Pointer != cases[i].pointers[j] {
+				t.Errorf("%s: got %q, expected %q", cases[i].body, violations[j].Pointer, cases[i].pointers[j])
+			}
+		}
+	}
+}
+
+func TestSpec__ValidateStatusAndHeaders(t *testing.T) {
+	spec := loadTestSpec(t)
+	getWidgets := spec.Find("GET", "/v1/widgets")
+
+	// missing X-Total-Count
+	violations := spec.Validate(getWidgets, http.StatusOK, jsonHeader(), []byte(`[]`))
+	if len(violations) != 1 || violations[0].Message != "missing required header X-Total-Count" {
+		t.Errorf("unexpected violations: %#v", violations)
+	}
+
+	// default response with an Error from common.yaml
+	violations = spec.Validate(getWidgets, http.StatusBadRequest, jsonHeader(), []byte(`{"error": "bad"}`))
+	if len(violations) != 0 {
+		t.Errorf("unexpected violations: %#v", violations)
+	}
+	violations = spec.Validate(getWidgets, http.StatusBadRequest, jsonHeader(), []byte(`{"message": "bad"}`))
+	if len(violations) != 1 || violations[0].Pointer != "/error" {
+		t.Errorf("unexpected violations: %#v", violations)
+	}
+
+	// undocumented status
+	createWidget := spec.Find("POST", "/v1/widgets/create")
+	violations = spec.Validate(createWidget, http.StatusOK, jsonHeader(), []byte(`{"id": "foo", "status": "ready"}`))
+	if len(violations) != 1 || violations[0].Message != "undocumented HTTP status 200" {
+		t.Errorf("unexpected violations: %#v", violations)
+	}
+	if err := violations[0].Error(); err != "createWidget: undocumented HTTP status 200" {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// text/plain isn't checked
+	ping := spec.Find("GET", "/v1/widgets/ping")
+	h := make(http.Header)
+	h.Set("Content-Type", "text/plain")
+	if violations := spec.Validate(ping, http.StatusOK, h, []byte("PONG")); len(violations) != 0 {
+		t.Errorf("unexpected violations: %#v", violations)
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	schema, err := LoadSchema(nil, filepath.Join("testdata", "common.yaml")+"#/components/schemas/Error")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		body     string
+		pointers []string
+	}{
+		{`{"error": "invalid amount"}`, nil},
+		{`{}`, []string{"/error"}},
+		{`{"error": 1}`, []string{"/error"}},
+		{`[]`, []string{""}},
+		{`not json`, []string{""}},
+	}
+	for i := range cases {
+		violations := schema.Validate([]byte(cases[i].body))
+		if len(violations) != len(cases[i].pointers) {
+			t.Errorf("%s: unexpected violations: %#v", cases[i].body, violations)
+			continue
+		}
+		for j := range violations {
+			if violations[j].OperationID != "Error" {
+				t.Errorf("unexpected operationID: %#v", violations[j])
+			}
+			if violations[j].Pointer != cases[i].pointers[j] {
+				t.Errorf("%s: got %q, expected %q", cases[i].body, violations[j].Pointer, cases[i].pointers[j])
+			}
+		}
+	}
+
+	if _, err := LoadSchema(nil, filepath.Join("testdata", "common.yaml")); err == nil {
+		t.Error("expected error") // no pointer
+	}
+	if _, err := LoadSchema(nil, filepath.Join("testdata", "common.yaml")+"#/components/schemas/Missing"); err == nil {
+		t.Error("expected error")
+	}
+}
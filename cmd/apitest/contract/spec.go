@@ -0,0 +1,357 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+// Package contract validates HTTP responses against the OpenAPI specifications in this repository
+// (openapi.yaml and openapiv2.yaml) and records which of their operations were covered.
+//
+// Only the parts of OpenAPI 3 used by Moov's specs are supported. $ref's are resolved across
+// files and remote URLs (e.g. raw.githubusercontent.com) as they're needed.
+package contract
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Spec is a set of OpenAPI operations read from one or more documents.
+type Spec struct {
+	loader     *loader
+	operations []*Operation
+}
+
+// Operation is one method and path template (e.g. GET /v1/ach/files/{fileID}) from a Spec.
+type Operation struct {
+	ID     string
+	Method string
+	Path   string
+
+	segments  []string
+	responses node
+}
+
+// Load reads each OpenAPI document at locations (file paths or URLs) and resolves their path items.
+// client is used to read remote documents and defaults to http.DefaultClient.
+func Load(client *http.Client, locations ...string) (*Spec, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	spec := &Spec{
+		loader: &loader{
+			client: client,
+			docs:   make(map[string]interface{}),
+		},
+	}
+	for _, location := range locations {
+		if err := spec.add(location); err != nil {
+			return nil, err
+		}
+	}
+	if len(spec.operations) == 0 {
+		return nil, errors.New("no OpenAPI operations found")
+	}
+	// Prefer operations with more literal segments (e.g. /files/create over /files/{fileID})
+	sort.SliceStable(spec.operations, func(i, j int) bool {
+		return literals(spec.operations[i].segments) > literals(spec.operations[j].segments)
+	})
+	return spec, nil
+}
+
+func (s *Spec) add(location string) error {
+	location, err := absLocation(location)
+	if err != nil {
+		return err
+	}
+	doc, err := s.loader.document(location)
+	if err != nil {
+		return err
+	}
+	paths, _ := asMap(doc)["paths"].(map[string]interface{})
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	sort.Strings(names)
+	for _, path := range names {
+		item, err := s.loader.resolve(node{doc: location, v: paths[path]})
+		if err != nil {
+			return fmt.Errorf("path %s: %v", path, err)
+		}
+		itemMap := asMap(item.v)
+		for _, method := range methods {
+			raw, ok := itemMap[method]
+			if !ok {
+				continue
+			}
+			if s.exists(method, path) {
+				continue // already defined by an earlier document
+			}
+			op := asMap(raw)
+			id, _ := op["operationId"].(string)
+			if id == "" {
+				id = fmt.Sprintf("%s %s", strings.ToUpper(method), path)
+			}
+			s.operations = append(s.operations, &Operation{
+				ID:        id,
+				Method:    strings.ToUpper(method),
+				Path:      path,
+				segments:  strings.Split(strings.Trim(path, "/"), "/"),
+				responses: node{doc: item.doc, v: op["responses"]},
+			})
+		}
+	}
+	return nil
+}
+
+// Operations returns every operation in the Spec.
+func (s *Spec) Operations() []*Operation {
+	return append([]*Operation(nil), s.operations...)
+}
+
+func (s *Spec) exists(method, path string) bool {
+	for _, op := range s.operations {
+		if op.Method == strings.ToUpper(method) && op.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the Operation for a request's method and path or nil if the Spec has none.
+func (s *Spec) Find(method, path string) *Operation {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for _, op := range s.operations {
+		if op.Method == strings.ToUpper(method) && op.matches(parts) {
+			return op
+		}
+	}
+	return nil
+}
+
+// Group is the Moov app serving an operation, e.g. "ach" for /v1/ach/files
+func (op *Operation) Group() string {
+	segments := op.segments
+	if len(segments) > 1 && strings.HasPrefix(segments[0], "v") {
+		segments = segments[1:]
+	}
+	return segments[0]
+}
+
+func (op *Operation) matches(parts []string) bool {
+	if len(parts) != len(op.segments) {
+		return false
+	}
+	for i := range parts {
+		if isParam(op.segments[i]) {
+			if parts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if !strings.EqualFold(parts[i], op.segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+func literals(segments []string) int {
+	n := 0
+	for i := range segments {
+		if !isParam(segments[i]) {
+			n++
+		}
+	}
+	return n
+}
+
+// node is a value from an OpenAPI document along with the document it came from, which is
+// needed to resolve relative $ref's.
+type node struct {
+	doc string
+	v   interface{}
+}
+
+// loader reads and caches OpenAPI documents.
+type loader struct {
+	client *http.Client
+
+	mu   sync.Mutex
+	docs map[string]interface{}
+}
+
+func (l *loader) document(location string) (interface{}, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if doc, exists := l.docs[location]; exists {
+		return doc, nil
+	}
+	var bs []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		bs, err = l.fetch(location)
+	} else {
+		bs, err = ioutil.ReadFile(location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %v", location, err)
+	}
+	var raw interface{}
+	if err := yaml.Unmarshal(bs, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", location, err)
+	}
+	doc := normalize(raw)
+	l.docs[location] = doc
+	return doc, nil
+}
+
+func (l *loader) fetch(location string) ([]byte, error) {
+	resp, err := l.client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bogus HTTP status: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// resolve follows $ref's until n is a concrete value.
+func (l *loader) resolve(n node) (node, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := asMap(n.v)["$ref"].(string)
+		if !ok {
+			return n, nil
+		}
+		next, err := l.follow(n.doc, ref)
+		if err != nil {
+			return n, err
+		}
+		n = next
+	}
+	return n, errors.New("too many nested $ref's")
+}
+
+func (l *loader) follow(base, ref string) (node, error) {
+	location, pointer := ref, ""
+	if idx := strings.Index(ref, "#"); idx >= 0 {
+		location, pointer = ref[:idx], ref[idx+1:]
+	}
+	if location == "" {
+		location = base
+	} else {
+		var err error
+		if location, err = relativeLocation(base, location); err != nil {
+			return node{}, err
+		}
+	}
+	doc, err := l.document(location)
+	if err != nil {
+		return node{}, err
+	}
+	v, err := lookup(doc, pointer)
+	if err != nil {
+		return node{}, fmt.Errorf("$ref %s: %v", ref, err)
+	}
+	return node{doc: location, v: v}, nil
+}
+
+// lookup walks a JSON pointer (RFC 6901) which might also be URL encoded (e.g. ~1files~1%7BfileID%7D)
+func lookup(doc interface{}, pointer string) (interface{}, error) {
+	if decoded, err := url.PathUnescape(pointer); err == nil {
+		pointer = decoded
+	}
+	if pointer == "" || pointer == "/" {
+		return doc, nil
+	}
+	v := doc
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			next, exists := vv[token]
+			if !exists {
+				return nil, fmt.Errorf("%s not found", pointer)
+			}
+			v = next
+		case []interface{}:
+			var idx int
+			if _, err := fmt.Sscanf(token, "%d", &idx); err != nil || idx < 0 || idx >= len(vv) {
+				return nil, fmt.Errorf("%s not found", pointer)
+			}
+			v = vv[idx]
+		default:
+			return nil, fmt.Errorf("%s not found", pointer)
+		}
+	}
+	return v, nil
+}
+
+func absLocation(location string) (string, error) {
+	if strings.Contains(location, "://") {
+		return location, nil
+	}
+	return filepath.Abs(location)
+}
+
+func relativeLocation(base, location string) (string, error) {
+	if strings.Contains(location, "://") {
+		return location, nil
+	}
+	if strings.Contains(base, "://") {
+		b, err := url.Parse(base)
+		if err != nil {
+			return "", err
+		}
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", err
+		}
+		return b.ResolveReference(u).String(), nil
+	}
+	if filepath.IsAbs(location) {
+		return location, nil
+	}
+	return filepath.Join(filepath.Dir(base), location), nil
+}
+
+// normalize converts the map[interface{}]interface{} values from yaml.v2 into map[string]interface{}
+func normalize(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(vv))
+		for k, v := range vv {
+			out[fmt.Sprintf("%v", k)] = normalize(v)
+		}
+		return out
+	case []interface{}:
+		for i := range vv {
+			vv[i] = normalize(vv[i])
+		}
+		return vv
+	default:
+		return v
+	}
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package contract
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func loadTestSpec(t *testing.T) *Spec {
+	t.Helper()
+
+	spec, err := Load(nil, filepath.Join("testdata", "api.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+func TestSpec__Find(t *testing.T) {
+	spec := loadTestSpec(t)
+
+	cases := []struct {
+		method, path string
+		expected     string
+	}{
+		{"GET", "/v1/widgets", "getWidgets"},
+		{"GET", "/v1/widgets/", "getWidgets"},
+		{"POST", "/v1/widgets/create", "createWidget"},
+		{"GET", "/v1/widgets/foo", "getWidget"},
+		{"delete", "/v1/widgets/foo", "deleteWidget"},
+		{"GET", "/v1/widgets/ping", "pingWidgets"}, // $ref to another file, preferred over {widgetID}
+	}
+	for i := range cases {
+		op := spec.Find(cases[i].method, cases[i].path)
+		if op == nil {
+			t.Errorf("%s %s: no operation found", cases[i].method, cases[i].path)
+			continue
+		}
+		if op.ID != cases[i].expected {
+			t.Errorf("%s %s: got %s", cases[i].method, cases[i].path, op.ID)
+		}
+	}
+
+	if op := spec.Find("PUT", "/v1/widgets/foo"); op != nil {
+		t.Errorf("unexpected operation: %#v", op)
+	}
+	if op := spec.Find("GET", "/v1/widgets/foo/bar"); op != nil {
+		t.Errorf("unexpected operation: %#v", op)
+	}
+}
+
+func TestSpec__remoteRef(t *testing.T) {
+	svc := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer svc.Close()
+
+	dir, err := ioutil.TempDir("", "contract")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "openapi.yaml")
+	body := fmt.Sprintf(`openapi: 3.0.2
+paths:
+  /v1/widgets/{widgetID}:
+    $ref: '%s/api.yaml#/paths/~1v1~1widgets~1%%7BwidgetID%%7D'
+`, svc.URL)
+	if err := ioutil.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := Load(svc.Client(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := spec.Find("GET", "/v1/widgets/foo")
+	if op == nil || op.ID != "getWidget" {
+		t.Fatalf("unexpected operation: %#v", op)
+	}
+
+	// The Widget schema is resolved from the remote document
+	violations := spec.Validate(op, http.StatusOK, jsonHeader(), []byte(`{"id": "foo"}`))
+	if len(violations) != 1 || violations[0].Pointer != "/status" {
+		t.Errorf("unexpected violations: %#v", violations)
+	}
+}
+
+func TestLoad__errors(t *testing.T) {
+	if _, err := Load(nil, filepath.Join("testdata", "missing.yaml")); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := Load(nil); err == nil {
+		t.Error("expected error") // no operations
+	}
+}
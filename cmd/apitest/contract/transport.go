@@ -0,0 +1,62 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package contract
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper which validates every response against its Spec operation.
+//
+// Requests need to use their production paths (e.g. /v1/ach/transfers) so Transport needs to
+// wrap local.Transport rather than be wrapped by it.
+type Transport struct {
+	Underlying http.RoundTripper
+	Spec       *Spec
+
+	// Report is called with the violations of each response. Responses which match their
+	// operation aren't reported.
+	Report func(req *http.Request, violations []Violation)
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Underlying == nil {
+		return nil, errors.New("nil underlying Transport")
+	}
+	// local.Transport rewrites req.URL in place, so send a copy to keep the production path
+	resp, err := t.Underlying.RoundTrip(req.Clone(req.Context()))
+	if err != nil || resp == nil || req.Method == http.MethodOptions {
+		return resp, err // CORS preflight requests aren't in our specs
+	}
+
+	op := t.Spec.Find(req.Method, req.URL.Path)
+	if op == nil {
+		t.report(req, []Violation{{
+			OperationID: req.Method + " " + req.URL.Path,
+			Message:     "no OpenAPI operation found",
+		}})
+		return resp, nil
+	}
+
+	// Read the body so we can validate it and still return it
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	t.report(req, t.Spec.Validate(op, resp.StatusCode, resp.Header, body))
+	return resp, nil
+}
+
+func (t *Transport) report(req *http.Request, violations []Violation) {
+	if len(violations) > 0 && t.Report != nil {
+		t.Report(req, violations)
+	}
+}
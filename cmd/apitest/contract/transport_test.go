@@ -0,0 +1,106 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package contract
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/api/cmd/apitest/local"
+)
+
+func TestTransport(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "foo"}`))
+	}))
+	defer svc.Close()
+
+	var reported []Violation
+	client := &http.Client{
+		Transport: &Transport{
+			Underlying: svc.Client().Transport,
+			Spec:       loadTestSpec(t),
+			Report: func(req *http.Request, violations []Violation) {
+				reported = append(reported, violations...)
+			},
+		},
+	}
+
+	resp, err := client.Get(svc.URL + "/v1/widgets/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(bs) != `{"id": "foo"}` {
+		t.Errorf("unexpected body: %q", string(bs))
+	}
+	if len(reported) != 1 || reported[0].Error() != "getWidget: /status: missing required property" {
+		t.Errorf("unexpected violations: %#v", reported)
+	}
+
+	// undocumented route
+	reported = nil
+	resp, err = client.Get(svc.URL + "/v1/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(reported) != 1 || reported[0].OperationID != "GET /v1/other" {
+		t.Errorf("unexpected violations: %#v", reported)
+	}
+
+	// CORS preflight requests are skipped
+	reported = nil
+	req, _ := http.NewRequest("OPTIONS", svc.URL+"/v1/widgets/foo", nil)
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(reported) != 0 {
+		t.Errorf("unexpected violations: %#v", reported)
+	}
+}
+
+func TestTransport__local(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/foo" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "foo", "status": "ready"}`))
+	}))
+	defer svc.Close()
+
+	var reported []Violation
+	client := &http.Client{
+		Transport: &Transport{
+			Underlying: &local.Transport{
+				Underlying: svc.Client().Transport,
+				Routes:     []local.Route{{Prefix: "widgets", Host: strings.TrimPrefix(svc.URL, "http://")}},
+			},
+			Spec: loadTestSpec(t),
+			Report: func(req *http.Request, violations []Violation) {
+				reported = append(reported, violations...)
+			},
+		},
+	}
+
+	// -local sends /v1/widgets/foo to /foo, which is still validated as getWidget
+	resp, err := client.Get("https://api.moov.io/v1/widgets/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(reported) != 0 {
+		t.Errorf("status=%d violations=%#v", resp.StatusCode, reported)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContract__checkSpecFiles(t *testing.T) {
+	if err := checkSpecFiles("coverage.specs", "../../openapi.yaml,https://example.com/openapi.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSpecFiles("negative.schema", "../../openapi-common.yaml#/components/schemas/Error"); err != nil {
+		t.Fatal(err)
+	}
+	err := checkSpecFiles("coverage.specs", "../../openapi.yaml,missing.yaml")
+	if err == nil || err.Error() != "missing.yaml doesn't exist, set -coverage.specs to its path" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := checkSpecFiles("negative.schema", "missing.yaml#/Error"); err == nil || !strings.Contains(err.Error(), "-negative.schema") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/moov-io/api/cmd/apitest/contract"
+)
+
+var (
+	flagCoverage      = flag.String("coverage", "", "Write which OpenAPI operations were called to the given file, as JSON if it ends in .json otherwise text")
+	flagCoverageSpecs = flag.String("coverage.specs", "openapi.yaml,openapiv2.yaml", "Comma separated OpenAPI specs to measure -coverage against")
+
+	coverage *contract.Coverage
+)
+
+// setupCoverage starts recording which operations of -coverage.specs are called.
+func setupCoverage() error {
+	if *flagCoverage == "" {
+		return nil
+	}
+	if err := checkSpecFiles("coverage.specs", *flagCoverageSpecs); err != nil {
+		return err
+	}
+	spec, err := loadSpec(*flagCoverageSpecs)
+	if err != nil {
+		return err
+	}
+	coverage = contract.NewCoverage(spec)
+	log.Printf("INFO: recording API coverage of %s", *flagCoverageSpecs)
+	return nil
+}
+
+// wrapCoverage returns an http.RoundTripper which records each response if -coverage was given,
+// otherwise underlying is returned.
+func wrapCoverage(underlying http.RoundTripper) http.RoundTripper {
+	if coverage == nil {
+		return underlying
+	}
+	return coverage.Wrap(underlying)
+}
+
+// writeCoverage saves the -coverage report if it was requested.
+func writeCoverage() {
+	if coverage == nil {
+		return
+	}
+	r := coverage.Report()
+	if err := writeCoverageFile(*flagCoverage, r); err != nil {
+		log.Printf("ERROR: writing coverage report: %v", err)
+		return
+	}
+	log.Printf("INFO: API coverage %d of %d operations (%.1f%%), see %s", r.Covered, r.Total, r.Percent, *flagCoverage)
+}
+
+func writeCoverageFile(path string, r contract.CoverageReport) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(path, ".json") {
+		enc := json.NewEncoder(fd)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(r)
+	} else {
+		err = r.WriteText(fd)
+	}
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
@@ -0,0 +1,435 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
+)
+
+var (
+	flagICL = flag.Bool("icl", false, "Create Image Cash Letter files with checks in /v1/imagecashletter/files, add and remove a cash letter and download their X9 contents")
+)
+
+// checkICL creates an Image Cash Letter file with one cash letter of two bundles, then reads it back,
+// lists, validates and downloads it. A second cash letter is added and deleted again before the file is
+// deleted. The control records of each response and the X9 contents need to match the checks we sent.
+// Each call is a step of the "icl" suite.
+func checkICL(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+
+	suite := report.newSuite("icl")
+	conf.HTTPClient.Transport = suite.wrap(conf.HTTPClient.Transport)
+	api := moov.NewAPIClient(conf)
+
+	if err := checkICLFile(ctx, api, suite); err != nil {
+		return err
+	}
+	log.Println("SUCCESS: Image Cash Letter files were created, updated and downloaded")
+	return nil
+}
+
+func checkICLFile(ctx context.Context, api *moov.APIClient, suite *suiteResult) error {
+	now := time.Now()
+	req := newICLFile(now, newICLCashLetter(now, "1", 2, 3))
+
+	var fileID string
+	err := suite.step("create", func() error {
+		file, resp, err := api.ImageCashLetterFilesApi.CreateICLFile(ctx, req, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		fileID = file.ID
+		if fileID == "" {
+			return errors.New("no file ID returned")
+		}
+		return compareICLFile(req.FileHeader, req.CashLetters, file)
+	})
+	if err != nil {
+		return fmt.Errorf("create: %v", err)
+	}
+
+	err = suite.step("get", func() error {
+		file, resp, err := api.ImageCashLetterFilesApi.GetICLFileByID(ctx, fileID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		return compareICLFile(req.FileHeader, req.CashLetters, file)
+	})
+	if err != nil {
+		return fmt.Errorf("get: %v", err)
+	}
+
+	err = suite.step("list", func() error {
+		files, resp, err := api.ImageCashLetterFilesApi.GetICLFiles(ctx, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		for i := range files {
+			if files[i].ID == fileID {
+				return nil
+			}
+		}
+		return fmt.Errorf("file %s not listed", fileID)
+	})
+	if err != nil {
+		return fmt.Errorf("list: %v", err)
+	}
+
+	err = suite.step("validate", func() error {
+		_, resp, err := api.ImageCashLetterFilesApi.ValidateICLFile(ctx, fileID, nil)
+		return checkAPIResponse(resp, err)
+	})
+	if err != nil {
+		return fmt.Errorf("validate: %v", err)
+	}
+
+	err = suite.step("contents", func() error {
+		return checkICLContents(ctx, api, fileID, req.FileHeader, req.CashLetters)
+	})
+	if err != nil {
+		return fmt.Errorf("contents: %v", err)
+	}
+
+	// Add a second cash letter and remove it again
+	cashLetter := newICLCashLetter(now, "2", 1, 2)
+	cashLetters := append(append([]moov.CashLetter(nil), req.CashLetters...), cashLetter)
+	err = suite.step("add cash letter", func() error {
+		resp, err := api.ImageCashLetterFilesApi.AddICLToFile(ctx, fileID, cashLetter, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		file, resp, err := api.ImageCashLetterFilesApi.GetICLFileByID(ctx, fileID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		if err := compareICLFile(req.FileHeader, cashLetters, file); err != nil {
+			return err
+		}
+		return checkICLContents(ctx, api, fileID, req.FileHeader, cashLetters)
+	})
+	if err != nil {
+		return fmt.Errorf("add cash letter: %v", err)
+	}
+
+	err = suite.step("delete cash letter", func() error {
+		resp, err := api.ImageCashLetterFilesApi.DeleteICLFromFile(ctx, fileID, cashLetter.CashLetterHeader.ID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		file, resp, err := api.ImageCashLetterFilesApi.GetICLFileByID(ctx, fileID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		if err := compareICLFile(req.FileHeader, req.CashLetters, file); err != nil {
+			return err
+		}
+		return checkICLContents(ctx, api, fileID, req.FileHeader, req.CashLetters)
+	})
+	if err != nil {
+		return fmt.Errorf("delete cash letter: %v", err)
+	}
+
+	err = suite.step("delete", func() error {
+		resp, err := api.ImageCashLetterFilesApi.DeleteICLFile(ctx, fileID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		_, resp, err = api.ImageCashLetterFilesApi.GetICLFileByID(ctx, fileID, nil)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if resp == nil || resp.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("file %s wasn't deleted: %v", fileID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("delete: %v", err)
+	}
+	return nil
+}
+
+// checkICLContents downloads the X9 contents of fileID and compares its records with header and cashLetters.
+func checkICLContents(ctx context.Context, api *moov.APIClient, fileID string, header moov.IclFileHeader, cashLetters []moov.CashLetter) error {
+	contents, resp, err := api.ImageCashLetterFilesApi.GetICLFileContents(ctx, fileID, nil)
+	if err := checkAPIResponse(resp, err); err != nil {
+		return err
+	}
+	records, err := readX9Records([]byte(contents))
+	if err != nil {
+		return err
+	}
+	return compareX9Records(header, cashLetters, records)
+}
+
+// newICLFile returns a test file with the given cash letters. Routing numbers are the same as -ach.files.
+func newICLFile(now time.Time, cashLetters ...moov.CashLetter) moov.CreateIclFile {
+	return moov.CreateIclFile{
+		FileHeader: moov.IclFileHeader{
+			StandardLevel:            "35",
+			TestFileIndicator:        "T",
+			ImmediateDestination:     "231380104",
+			ImmediateOrigin:          defaultRoutingNumber,
+			FileCreationDate:         now,
+			FileCreationTime:         now.Format("1504"),
+			ResendIndicator:          "N",
+			ImmediateDestinationName: "Citadel",
+			ImmediateOriginName:      "Wells Fargo",
+			CountryCode:              "US",
+		},
+		CashLetters: cashLetters,
+	}
+}
+
+// newICLCashLetter returns a forward presentment cash letter with bundles of checks. Check amounts
+// are unique within the cash letter so records can't be mistaken for each other.
+func newICLCashLetter(now time.Time, cashLetterID string, bundles, checks int) moov.CashLetter {
+	cl := moov.CashLetter{
+		CashLetterHeader: moov.CashLetterHeader{
+			ID:                           base.ID(),
+			CollectionTypeIndicator:      "01",
+			DestinationRoutingNumber:     "231380104",
+			ECEInstitutionRoutingNumber:  defaultRoutingNumber,
+			CashLetterBusinessDate:       now.Format(time.RFC3339),
+			CashLetterCreationDate:       now,
+			CashLetterCreationTime:       now.Format("1504"),
+			RecordTypeIndicator:          "E",
+			DocumentationTypeIndicator:   "K",
+			CashLetterID:                 cashLetterID,
+			OriginatorContactName:        "Moov",
+			OriginatorContactPhoneNumber: "5558675552",
+		},
+		CashLetterControl: moov.CashLetterControl{
+			ECEInstitutionName: "Wells Fargo",
+			SettlementDate:     now,
+		},
+	}
+	for i := 0; i < bundles; i++ {
+		bundle := moov.Bundle{
+			BundleHeader: moov.BundleHeader{
+				ID:                          base.ID(),
+				CollectionTypeIndicator:     "01",
+				DestinationRoutingNumber:    "231380104",
+				ECEInstitutionRoutingNumber: defaultRoutingNumber,
+				BundleBusinessDate:          now,
+				BundleCreationDate:          now,
+				BundleID:                    fmt.Sprintf("%s%04d", cashLetterID, i+1),
+				BundleSequenceNumber:        strconv.Itoa(i + 1),
+				CycleNumber:                 "01",
+			},
+		}
+		for j := 0; j < checks; j++ {
+			seq := i*checks + j + 1
+			bundle.Checks = append(bundle.Checks, moov.Checks{
+				CheckDetail: moov.CheckDetail{
+					ID:                               base.ID(),
+					PayorBankRoutingNumber:           "03130001",
+					PayorBankCheckDigit:              "2",
+					OnUs:                             fmt.Sprintf("5558881/%04d", seq),
+					ItemAmount:                       int32(10000 + seq*123),
+					ECEInstitutionItemSequenceNumber: fmt.Sprintf("%s%014d", cashLetterID, seq),
+					DocumentationTypeIndicator:       "G",
+					ReturnAcceptanceIndicator:        "D",
+					MICRValidIndicator:               "1",
+					BOFDIndicator:                    "Y",
+					CorrectionIndicator:              "0",
+					ArchiveTypeIndicator:             "B",
+				},
+			})
+		}
+		cl.Bundles = append(cl.Bundles, bundle)
+	}
+	return cl
+}
+
+// iclTotals are the item count and amount of a bundle, cash letter or file.
+type iclTotals struct {
+	items  int
+	amount int
+}
+
+func bundleTotals(b moov.Bundle) iclTotals {
+	var t iclTotals
+	for _, check := range b.Checks {
+		t.items++
+		t.amount += int(check.CheckDetail.ItemAmount)
+	}
+	return t
+}
+
+func cashLetterTotals(cl moov.CashLetter) iclTotals {
+	var t iclTotals
+	for _, b := range cl.Bundles {
+		bt := bundleTotals(b)
+		t.items += bt.items
+		t.amount += bt.amount
+	}
+	return t
+}
+
+// compareICLFile returns an error listing the header fields and control totals of got which don't
+// match header and cashLetters.
+func compareICLFile(header moov.IclFileHeader, cashLetters []moov.CashLetter, got moov.IclFile) error {
+	var diffs []string
+	check := func(field string, expected, actual interface{}) {
+		if expected != actual {
+			diffs = append(diffs, fmt.Sprintf("%s is %v, expected %v", field, actual, expected))
+		}
+	}
+	check("immediateOrigin", header.ImmediateOrigin, got.FileHeader.ImmediateOrigin)
+	check("immediateDestination", header.ImmediateDestination, got.FileHeader.ImmediateDestination)
+	check("standardLevel", header.StandardLevel, got.FileHeader.StandardLevel)
+	check("cashLetters", len(cashLetters), len(got.CashLetters))
+
+	var file iclTotals
+	for i := 0; i < len(cashLetters) && i < len(got.CashLetters); i++ {
+		expected, cl := cashLetters[i], got.CashLetters[i]
+		field := fmt.Sprintf("cash letter #%d ", i+1)
+		check(field+"cashLetterID", expected.CashLetterHeader.CashLetterID, cl.CashLetterHeader.CashLetterID)
+		check(field+"bundles", len(expected.Bundles), len(cl.Bundles))
+
+		totals := cashLetterTotals(expected)
+		check(field+"cashLetterBundleCount", len(expected.Bundles), int(cl.CashLetterControl.CashLetterBundleCount))
+		check(field+"cashLetterItemsCount", totals.items, int(cl.CashLetterControl.CashLetterItemsCount))
+		check(field+"cashLetterTotalAmount", totals.amount, int(cl.CashLetterControl.CashLetterTotalAmount))
+		file.items += totals.items
+		file.amount += totals.amount
+
+		for j := 0; j < len(expected.Bundles) && j < len(cl.Bundles); j++ {
+			totals := bundleTotals(expected.Bundles[j])
+			field := fmt.Sprintf("cash letter #%d bundle #%d ", i+1, j+1)
+			check(field+"checks", totals.items, len(cl.Bundles[j].Checks))
+			check(field+"bundleItemsCount", totals.items, int(cl.Bundles[j].BundleControl.BundleItemsCount))
+			check(field+"bundleTotalAmount", totals.amount, int(cl.Bundles[j].BundleControl.BundleTotalAmount))
+		}
+	}
+	check("cashLetterCount", len(cashLetters), int(got.FileControl.CashLetterCount))
+	check("totalItemCount", file.items, int(got.FileControl.TotalItemCount))
+	check("fileTotalAmount", file.amount, int(got.FileControl.FileTotalAmount))
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// readX9Records splits X9 contents into records. Records are either newline separated or, as with
+// variable length files, each prefixed with its length as a 4 byte big-endian integer.
+func readX9Records(contents []byte) ([]string, error) {
+	if len(contents) < 4 {
+		return nil, errors.New("no X9 records")
+	}
+	var records []string
+	if strings.HasPrefix(string(contents), "01") {
+		for _, line := range strings.Split(string(contents), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if line == "" {
+				continue
+			}
+			if len(line) < 2 {
+				return nil, fmt.Errorf("invalid X9 record %q", line)
+			}
+			records = append(records, line)
+		}
+		return records, nil
+	}
+	for len(contents) > 0 {
+		if len(contents) < 4 {
+			return nil, errors.New("truncated X9 record length")
+		}
+		n := int(binary.BigEndian.Uint32(contents[:4]))
+		if n < 2 || len(contents)-4 < n {
+			return nil, fmt.Errorf("invalid X9 record length %d", n)
+		}
+		records = append(records, string(contents[4:4+n]))
+		contents = contents[4+n:]
+	}
+	return records, nil
+}
+
+// x9Field returns the columns start through end (1-indexed, inclusive) of record.
+func x9Field(record string, start, end int) string {
+	if len(record) < end {
+		return ""
+	}
+	return strings.TrimSpace(record[start-1 : end])
+}
+
+func x9Number(record string, start, end int) int {
+	n, _ := strconv.Atoi(x9Field(record, start, end))
+	return n
+}
+
+// compareX9Records checks the file header, record counts, check amounts and file control of records
+// against header and cashLetters. Image records (5x) and addenda (26, 27 and 28) are only counted.
+func compareX9Records(header moov.IclFileHeader, cashLetters []moov.CashLetter, records []string) error {
+	var diffs []string
+	check := func(field string, expected, actual interface{}) {
+		if expected != actual {
+			diffs = append(diffs, fmt.Sprintf("%s is %v, expected %v", field, actual, expected))
+		}
+	}
+	if len(records) == 0 || !strings.HasPrefix(records[0], "01") || !strings.HasPrefix(records[len(records)-1], "99") {
+		return errors.New("X9 contents need to start with a file header (01) and end with a file control (99) record")
+	}
+	fh, fc := records[0], records[len(records)-1]
+	check("01 immediateDestination", header.ImmediateDestination, x9Field(fh, 6, 14))
+	check("01 immediateOrigin", header.ImmediateOrigin, x9Field(fh, 15, 23))
+
+	counts := make(map[string]int)
+	var amounts []int
+	for _, record := range records {
+		counts[record[:2]]++
+		if strings.HasPrefix(record, "25") {
+			amounts = append(amounts, x9Number(record, 48, 57))
+		}
+	}
+
+	var expectedAmounts []int
+	var bundles int
+	for _, cl := range cashLetters {
+		for _, b := range cl.Bundles {
+			bundles++
+			for _, c := range b.Checks {
+				expectedAmounts = append(expectedAmounts, int(c.CheckDetail.ItemAmount))
+			}
+		}
+	}
+	check("cash letter headers (10)", len(cashLetters), counts["10"])
+	check("cash letter controls (90)", len(cashLetters), counts["90"])
+	check("bundle headers (20)", bundles, counts["20"])
+	check("bundle controls (70)", bundles, counts["70"])
+	check("check details (25)", len(expectedAmounts), len(amounts))
+	for i := 0; i < len(expectedAmounts) && i < len(amounts); i++ {
+		check(fmt.Sprintf("check #%d amount", i+1), expectedAmounts[i], amounts[i])
+	}
+
+	var total int
+	for _, a := range expectedAmounts {
+		total += a
+	}
+	check("99 cashLetterCount", len(cashLetters), x9Number(fc, 3, 8))
+	check("99 totalRecordCount", len(records), x9Number(fc, 9, 16))
+	check("99 totalItemCount", len(expectedAmounts), x9Number(fc, 17, 24))
+	check("99 fileTotalAmount", total, x9Number(fc, 25, 40))
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+// testX9Records returns the records apitest expects for file, without any fields it doesn't read.
+func testX9Records(file moov.CreateIclFile) []string {
+	pad := func(s string) string { return s + strings.Repeat(" ", 80-len(s)) }
+	records := []string{pad("0135T" + file.FileHeader.ImmediateDestination + file.FileHeader.ImmediateOrigin)}
+	var items, total int
+	for _, cl := range file.CashLetters {
+		records = append(records, pad("10"))
+		for _, b := range cl.Bundles {
+			records = append(records, pad("20"))
+			for _, c := range b.Checks {
+				items++
+				total += int(c.CheckDetail.ItemAmount)
+				records = append(records, pad("25"+strings.Repeat(" ", 45)+x9Pad(int(c.CheckDetail.ItemAmount), 10)))
+			}
+			records = append(records, pad("70"))
+		}
+		records = append(records, pad("90"))
+	}
+	return append(records, pad("99"+x9Pad(len(file.CashLetters), 6)+x9Pad(len(records)+1, 8)+x9Pad(items, 8)+x9Pad(total, 16)))
+}
+
+func x9Pad(n, width int) string {
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+func TestICL__newICLFile(t *testing.T) {
+	now := time.Now()
+	file := newICLFile(now, newICLCashLetter(now, "1", 2, 3))
+	if len(file.CashLetters) != 1 || len(file.CashLetters[0].Bundles) != 2 || len(file.CashLetters[0].Bundles[1].Checks) != 3 {
+		t.Fatalf("unexpected file: %#v", file)
+	}
+	seen := make(map[int32]bool)
+	for _, b := range file.CashLetters[0].Bundles {
+		for _, c := range b.Checks {
+			if seen[c.CheckDetail.ItemAmount] {
+				t.Errorf("duplicate amount %d", c.CheckDetail.ItemAmount)
+			}
+			seen[c.CheckDetail.ItemAmount] = true
+		}
+	}
+	if totals := cashLetterTotals(file.CashLetters[0]); totals.items != 6 {
+		t.Errorf("unexpected totals: %#v", totals)
+	}
+}
+
+func TestICL__compareX9Records(t *testing.T) {
+	now := time.Now()
+	file := newICLFile(now, newICLCashLetter(now, "1", 2, 3))
+	records := testX9Records(file)
+
+	// newline separated
+	parsed, err := readX9Records([]byte(strings.Join(records, "\r\n") + "\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareX9Records(file.FileHeader, file.CashLetters, parsed); err != nil {
+		t.Error(err)
+	}
+	if _, err := readX9Records([]byte(records[0] + "\n2\n" + records[1])); err == nil {
+		t.Error("expected error for short record")
+	}
+
+	// length prefixed
+	var buf []byte
+	for _, r := range records {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(r)))
+		buf = append(append(buf, n[:]...), r...)
+	}
+	parsed, err = readX9Records(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := compareX9Records(file.FileHeader, file.CashLetters, parsed); err != nil {
+		t.Error(err)
+	}
+	if _, err := readX9Records(buf[:len(buf)-10]); err == nil {
+		t.Error("expected error for truncated record")
+	}
+
+	// a different check amount and a missing cash letter
+	file.CashLetters[0].Bundles[1].Checks[2].CheckDetail.ItemAmount++
+	err = compareX9Records(file.FileHeader, file.CashLetters, parsed)
+	if err == nil || !strings.Contains(err.Error(), "check #6 amount") || !strings.Contains(err.Error(), "99 fileTotalAmount") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = compareX9Records(file.FileHeader, append(file.CashLetters, newICLCashLetter(now, "2", 1, 1)), parsed)
+	if err == nil || !strings.Contains(err.Error(), "cash letter headers (10) is 1, expected 2") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestICL__compareICLFile(t *testing.T) {
+	now := time.Now()
+	req := newICLFile(now, newICLCashLetter(now, "1", 1, 2))
+	got := moov.IclFile{FileHeader: req.FileHeader, CashLetters: req.CashLetters}
+	got.FileControl = moov.IclFileControl{CashLetterCount: 1, TotalItemCount: 2}
+
+	err := compareICLFile(req.FileHeader, req.CashLetters, got)
+	if err == nil || !strings.Contains(err.Error(), "fileTotalAmount is 0") || !strings.Contains(err.Error(), "bundleItemsCount is 0, expected 2") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+var (
+	flagIdempotency = flag.Bool("idempotency", false, "Replay each create call with the same X-Idempotency-Key and verify no duplicates are created")
+
+	// idempotencyLimit is the page size used when counting objects
+	idempotencyLimit int32 = 1000
+)
+
+// idempotencyCheck is a create call which is made twice with the same X-Idempotency-Key. The
+// second call needs to return the same response and not create anything.
+type idempotencyCheck struct {
+	name string
+
+	// create makes the call with key and returns its decoded response
+	create func(ctx context.Context, key string) (interface{}, *http.Response, error)
+
+	// count returns how many objects exist to find duplicates, it can be nil when we have
+	// no way to list the objects.
+	count func(ctx context.Context) (int, error)
+}
+
+// checkIdempotency replays every create call with the objects of iter. Each call is recorded as a
+// step of an "idempotency" suite and the calls which don't honor X-Idempotency-Key are returned
+// in the error.
+func checkIdempotency(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+	api := moov.NewAPIClient(conf)
+
+	suite := report.newSuite("idempotency")
+
+	var failed []string
+	for _, check := range idempotencyChecks(api, iter) {
+		check := check
+		err := suite.step(check.name, func() error {
+			return check.run(ctx)
+		})
+		if err != nil {
+			log.Printf("ERROR: %s doesn't honor X-Idempotency-Key: %v", check.name, err)
+			failed = append(failed, check.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("X-Idempotency-Key isn't honored by %s", strings.Join(failed, ", "))
+	}
+	log.Println("SUCCESS: every create call honored X-Idempotency-Key")
+	return nil
+}
+
+func (c idempotencyCheck) run(ctx context.Context) error {
+	counts := make([]int, 0, 3)
+	count := func() error {
+		if c.count == nil {
+			return nil
+		}
+		n, err := c.count(ctx)
+		if err != nil {
+			return fmt.Errorf("counting objects: %v", err)
+		}
+		counts = append(counts, n)
+		return nil
+	}
+	if err := count(); err != nil {
+		return err
+	}
+
+	key := generateID()
+	first, resp, err := c.create(ctx, key)
+	if err != nil {
+		return fmt.Errorf("first call: %v", describeAPIError(err))
+	}
+	status := resp.StatusCode
+	if err := count(); err != nil {
+		return err
+	}
+
+	second, resp, err := c.create(ctx, key)
+	if err != nil {
+		return fmt.Errorf("replayed call: %v", describeAPIError(err))
+	}
+	if resp.StatusCode != status {
+		return fmt.Errorf("replayed call returned HTTP status %d, first call returned %d", resp.StatusCode, status)
+	}
+	if !reflect.DeepEqual(first, second) {
+		return fmt.Errorf("replayed call returned a different response\n  first:  %#v\n  second: %#v", first, second)
+	}
+	if err := count(); err != nil {
+		return err
+	}
+
+	if len(counts) == 3 {
+		if counts[1] == counts[0] {
+			return errors.New("first call didn't create anything")
+		}
+		if counts[2] != counts[1] {
+			return fmt.Errorf("replayed call created %d more objects", counts[2]-counts[1])
+		}
+	}
+	return nil
+}
+
+// describeAPIError includes the response body of go-client errors.
+func describeAPIError(err error) error {
+	if e, ok := err.(moov.GenericOpenAPIError); ok && len(e.Body()) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(e.Body())))
+	}
+	return err
+}
+
+// idempotencyChecks returns every POST call which creates an object. Both calls of a check send
+// the same request body and checks can depend on the objects created by earlier checks.
+func idempotencyChecks(api *moov.APIClient, iter *iteration) []idempotencyCheck {
+	userID := iter.user.ID
+	var dep moov.Depository // created by addDepository
+
+	first, last := name()
+	userReq := moov.CreateUser{
+		Email:     email(first, last),
+		Password:  *flagPassword,
+		FirstName: first,
+		LastName:  last,
+		Phone:     phone(),
+	}
+	origReq := newOriginatorRequest(iter.featureFlags, iter.originatorDepository.ID)
+	receiverReq := newReceiverRequest(iter.user, iter.featureFlags, iter.receiverDepository.ID)
+	transferReq := newTransferRequest(iter.receiver, iter.originator, amount(), transferKind{
+		secCode:      iter.transfer.StandardEntryClassCode,
+		transferType: iter.transfer.TransferType,
+	})
+
+	countMicroDeposits := func(ctx context.Context) (int, error) {
+		transactions, resp, err := api.AccountsApi.GetAccountTransactions(ctx, iter.originatorAccount.ID, userID, &moov.GetAccountTransactionsOpts{
+			Limit: optional.NewFloat32(float32(idempotencyLimit)),
+		})
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return len(transactions), err
+	}
+	if iter.featureFlags.AccountsCallsDisabled {
+		countMicroDeposits = nil
+	}
+
+	return []idempotencyCheck{
+		{
+			name: "createUser",
+			create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+				return api.UserApi.CreateUser(ctx, userReq, &moov.CreateUserOpts{
+					XIdempotencyKey: optional.NewString(key),
+				})
+			},
+		},
+		{
+			name: "createOAuth2Client",
+			create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+				return api.OAuth2Api.CreateOAuth2Client(ctx, &moov.CreateOAuth2ClientOpts{
+					XIdempotencyKey: optional.NewString(key),
+				})
+			},
+			count: func(ctx context.Context) (int, error) {
+				clients, resp, err := api.OAuth2Api.GetClientsForUserId(ctx, nil)
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return len(clients), err
+			},
+		},
+		{
+			name: "addGateway",
+			create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+				req := moov.CreateGateway{
+					Origin:          iter.gateway.Origin,
+					OriginName:      iter.gateway.OriginName,
+					Destination:     iter.gateway.Destination,
+					DestinationName: iter.gateway.DestinationName,
+				}
+				return api.GatewaysApi.AddGateway(ctx, userID, req, &moov.AddGatewayOpts{
+					XIdempotencyKey: optional.NewString(key),
+				})
+			},
+		},
+		{
+			name: "addDepository",
+			create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+				req := moov.CreateDepository{
+					BankName:      "Moov Bank",
+					AccountNumber: iter.originatorAccount.AccountNumber,
+					RoutingNumber: iter.originatorAccount.RoutingNumber,
+					Holder:        iter.user.Name,
+					HolderType:    "Individual",
+					Type:          iter.originatorAccount.Type,
+				}
+				var resp *http.Response
+				var err error
+				dep, resp, err = api.DepositoriesApi.AddDepository(ctx, userID, req, &moov.AddDepositoryOpts{
+					XIdempotencyKey: optional.NewString(key),
+				})
+				return dep, resp, err
+			},
+			count: func(ctx context.Context) (int, error) {
+				deps, resp, err := api.DepositoriesApi.GetDepositories(ctx, userID, &moov.GetDepositoriesOpts{
+					Limit: optional.NewInt32(idempotencyLimit),
+				})
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return len(deps), err
+			},
+		},
+		{
+			name: "initiateMicroDeposits",
+			create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+				resp, err := api.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, userID, &moov.InitiateMicroDepositsOpts{
+					XIdempotencyKey: optional.NewString(key),
+				})
+				return nil, resp, err
+			},
+			count: countMicroDeposits,
+		},
+		{
+			name: "addOriginator",
+			create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+				return api.OriginatorsApi.AddOriginator(ctx, userID, origReq, &moov.AddOriginatorOpts{
+					XIdempotencyKey: optional.NewString(key),
+				})
+			},
+			count: func(ctx context.Context) (int, error) {
+				origs, resp, err := api.OriginatorsApi.GetOriginators(ctx, userID, &moov.GetOriginatorsOpts{
+					Limit: optional.NewInt32(idempotencyLimit),
+				})
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return len(origs), err
+			},
+		},
+		{
+			name: "addReceivers",
+			create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+				return api.ReceiversApi.AddReceivers(ctx, userID, receiverReq, &moov.AddReceiversOpts{
+					XIdempotencyKey: optional.NewString(key),
+				})
+			},
+			count: func(ctx context.Context) (int, error) {
+				receivers, resp, err := api.ReceiversApi.GetReceivers(ctx, userID, &moov.GetReceiversOpts{
+					Limit: optional.NewInt32(idempotencyLimit),
+				})
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return len(receivers), err
+			},
+		},
+		{
+			name: "addTransfer",
+			create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+				return api.TransfersApi.AddTransfer(ctx, userID, transferReq, &moov.AddTransferOpts{
+					XIdempotencyKey: optional.NewString(key),
+				})
+			},
+			count: func(ctx context.Context) (int, error) {
+				transfers, resp, err := api.TransfersApi.GetTransfers(ctx, userID, &moov.GetTransfersOpts{
+					Limit: optional.NewInt32(idempotencyLimit),
+				})
+				if resp != nil {
+					resp.Body.Close()
+				}
+				return len(transfers), err
+			},
+		},
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// fakeIdempotencyCheck creates an object on each call unless honorKey is true, in which case
+// calls with a seen key return the first response.
+func fakeIdempotencyCheck(honorKey bool) idempotencyCheck {
+	var objects []string
+	seen := make(map[string]string)
+	return idempotencyCheck{
+		name: "addWidget",
+		create: func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+			resp := &http.Response{StatusCode: http.StatusOK}
+			if id, exists := seen[key]; exists && honorKey {
+				return id, resp, nil
+			}
+			id := generateID()
+			objects = append(objects, id)
+			seen[key] = id
+			return id, resp, nil
+		},
+		count: func(ctx context.Context) (int, error) {
+			return len(objects), nil
+		},
+	}
+}
+
+func TestIdempotencyCheck(t *testing.T) {
+	ctx := context.Background()
+
+	if err := fakeIdempotencyCheck(true).run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	err := fakeIdempotencyCheck(false).run(ctx)
+	if err == nil || !strings.Contains(err.Error(), "different response") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Same response, but a duplicate was created
+	check := fakeIdempotencyCheck(true)
+	create := check.create
+	var extra int
+	check.create = func(ctx context.Context, key string) (interface{}, *http.Response, error) {
+		extra++
+		return create(ctx, key)
+	}
+	count := check.count
+	check.count = func(ctx context.Context) (int, error) {
+		n, err := count(ctx)
+		if extra > 1 {
+			n++
+		}
+		return n, err
+	}
+	if err := check.run(ctx); err == nil || !strings.Contains(err.Error(), "created 1 more objects") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
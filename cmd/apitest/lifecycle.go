@@ -0,0 +1,337 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+var (
+	flagLifecycle         = flag.Bool("lifecycle", false, "Wait for each transfer to be processed, failed or canceled then check its events, ACH files and failure reason")
+	flagLifecycleTimeout  = flag.Duration("lifecycle.timeout", 5*time.Minute, "How long -lifecycle waits for transfers to reach a terminal status")
+	flagLifecycleInterval = flag.Duration("lifecycle.interval", 10*time.Second, "How often -lifecycle reads transfers while waiting")
+)
+
+// checkTransferLifecycle polls each transfer of iter until it's processed, failed or canceled. The
+// events of each transfer are then compared against /v1/ach/events, each ACH file is downloaded and
+// parsed to find the transfer's entry and failed transfers need to return their reason. Each check
+// is a step of the "lifecycle" suite.
+func checkTransferLifecycle(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+	api := moov.NewAPIClient(conf)
+
+	suite := report.newSuite("lifecycle")
+
+	var transfers []moov.Transfer
+	err := suite.step("waitForTerminalStatus", func() (err error) {
+		transfers, err = waitForTerminalStatus(ctx, api, iter.userID, iter.transfers, *flagLifecycleTimeout, *flagLifecycleInterval)
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("transfer lifecycle: %v", err)
+	}
+
+	var events []moov.Event
+	err = suite.step("transferEvents", func() (err error) {
+		events, err = getTransferEvents(ctx, api, iter.userID, transfers)
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("transfer events: %v", err)
+	}
+
+	err = suite.step("events", func() error {
+		return compareEvents(ctx, api, iter.userID, events)
+	})
+	if err != nil {
+		return fmt.Errorf("events: %v", err)
+	}
+
+	err = suite.step("files", func() error {
+		return checkTransferFiles(ctx, api, iter, transfers)
+	})
+	if err != nil {
+		return fmt.Errorf("transfer files: %v", err)
+	}
+
+	err = suite.step("failed", func() error {
+		return checkFailedTransfers(ctx, api, iter.userID, transfers)
+	})
+	if err != nil {
+		return fmt.Errorf("failed transfers: %v", err)
+	}
+	log.Printf("SUCCESS: %d transfers reached a terminal status with matching events and files", len(transfers))
+	return nil
+}
+
+func terminalStatus(status moov.TransferStatus) bool {
+	switch status {
+	case moov.PROCESSED, moov.FAILED, moov.CANCELED:
+		return true
+	}
+	return false
+}
+
+// waitForTerminalStatus reads each transfer every interval until they've all reached a terminal
+// status, logging every status change with when it was seen. The final transfers are returned.
+func waitForTerminalStatus(ctx context.Context, api *moov.APIClient, userID string, transfers []moov.Transfer, timeout, interval time.Duration) ([]moov.Transfer, error) {
+	start := time.Now()
+	out := make([]moov.Transfer, len(transfers))
+	copy(out, transfers)
+	done := make([]bool, len(transfers))
+	err := poll(ctx, timeout, interval, func() ([]string, error) {
+		var waiting []string
+		for i := range out {
+			if done[i] {
+				continue
+			}
+			xfer, resp, err := api.TransfersApi.GetTransferByID(ctx, out[i].ID, userID, nil)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("problem reading transfer %s: %v", out[i].ID, describeAPIError(err))
+			}
+			if xfer.Status != out[i].Status {
+				log.Printf("INFO: transfer %s is %s after %v", xfer.ID, xfer.Status, time.Since(start).Round(time.Millisecond))
+			}
+			out[i] = xfer
+			if done[i] = terminalStatus(xfer.Status); !done[i] {
+				waiting = append(waiting, fmt.Sprintf("transfer %s is %s", xfer.ID, xfer.Status))
+			}
+		}
+		return waiting, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// poll calls check every interval until it returns nothing left to wait for, or timeout passes.
+func poll(ctx context.Context, timeout, interval time.Duration, check func() ([]string, error)) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		waiting, err := check()
+		if err != nil {
+			return err
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("after %v: %s", timeout, strings.Join(waiting, ", "))
+		case <-time.After(interval):
+		}
+	}
+}
+
+// getTransferEvents reads the events of each transfer and logs them. Every transfer needs at least
+// one event and each event needs an ID, a creation time and the transfer as its resource.
+func getTransferEvents(ctx context.Context, api *moov.APIClient, userID string, transfers []moov.Transfer) ([]moov.Event, error) {
+	var out []moov.Event
+	for i := range transfers {
+		events, resp, err := api.TransfersApi.GetTransferEventsByID(ctx, transfers[i].ID, userID, nil)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("problem reading transfer %s events: %v", transfers[i].ID, describeAPIError(err))
+		}
+		if len(events) == 0 {
+			return nil, fmt.Errorf("transfer %s has no events", transfers[i].ID)
+		}
+		for _, event := range events {
+			log.Printf("INFO: transfer %s event %s at %s: %s (%s)", transfers[i].ID, event.ID, event.Created.Format(time.RFC3339), event.Topic, event.Message)
+			switch {
+			case event.ID == "":
+				return nil, fmt.Errorf("transfer %s has an event without an ID", transfers[i].ID)
+			case event.Created.IsZero():
+				return nil, fmt.Errorf("event %s has no created time", event.ID)
+			case event.Resource != transfers[i].ID:
+				return nil, fmt.Errorf("event %s of transfer %s has resource %q", event.ID, transfers[i].ID, event.Resource)
+			}
+		}
+		out = append(out, events...)
+	}
+	return out, nil
+}
+
+// compareEvents checks each event is listed by /v1/ach/events and returned by /v1/ach/events/{eventID}
+// without any differences.
+func compareEvents(ctx context.Context, api *moov.APIClient, userID string, events []moov.Event) error {
+	all, resp, err := api.EventsApi.GetEvents(ctx, userID, &moov.GetEventsOpts{
+		Limit: optional.NewInt32(idempotencyLimit),
+	})
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("problem listing events: %v", describeAPIError(err))
+	}
+	listed := make(map[string]moov.Event)
+	for i := range all {
+		listed[all[i].ID] = all[i]
+	}
+
+	var diffs []string
+	for i := range events {
+		event, exists := listed[events[i].ID]
+		if !exists {
+			diffs = append(diffs, fmt.Sprintf("event %s isn't listed", events[i].ID))
+			continue
+		}
+		if err := compareEvent(events[i], event); err != nil {
+			diffs = append(diffs, fmt.Sprintf("listed event %s: %v", events[i].ID, err))
+		}
+
+		event, resp, err := api.EventsApi.GetEventByID(ctx, events[i].ID, userID, nil)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err != nil {
+			diffs = append(diffs, fmt.Sprintf("problem reading event %s: %v", events[i].ID, describeAPIError(err)))
+			continue
+		}
+		if err := compareEvent(events[i], event); err != nil {
+			diffs = append(diffs, fmt.Sprintf("event %s: %v", events[i].ID, err))
+		}
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// compareEvent returns an error if actual differs from the expected event.
+func compareEvent(expected, actual moov.Event) error {
+	var diffs []string
+	check := func(field, expected, actual string) {
+		if expected != actual {
+			diffs = append(diffs, fmt.Sprintf("%s is %q, expected %q", field, actual, expected))
+		}
+	}
+	check("topic", expected.Topic, actual.Topic)
+	check("message", expected.Message, actual.Message)
+	check("type", expected.Type, actual.Type)
+	check("resource", expected.Resource, actual.Resource)
+	if !expected.Created.Equal(actual.Created) {
+		diffs = append(diffs, fmt.Sprintf("created is %v, expected %v", actual.Created, expected.Created))
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// checkTransferFiles downloads the ACH files of each processed transfer and parses them. One of the
+// files needs an entry for the transfer.
+func checkTransferFiles(ctx context.Context, api *moov.APIClient, iter *iteration, transfers []moov.Transfer) error {
+	for i := range transfers {
+		if transfers[i].Status != moov.PROCESSED {
+			continue
+		}
+		files, resp, err := api.TransfersApi.GetTransferFiles(ctx, transfers[i].ID, iter.userID, nil)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("problem reading transfer %s files: %v", transfers[i].ID, describeAPIError(err))
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("processed transfer %s has no files", transfers[i].ID)
+		}
+		mismatches := make(map[string]string)
+		var found bool
+		for j := range files {
+			file, err := downloadACHFile(ctx, api, files[j].ID)
+			if err != nil {
+				return fmt.Errorf("transfer %s: %v", transfers[i].ID, err)
+			}
+			if matchEntry(file, iter, transfers[i], mismatches) != nil {
+				found = true
+			}
+		}
+		if !found {
+			if reason := mismatches[transfers[i].ID]; reason != "" {
+				return fmt.Errorf("transfer %s not found in its %d files, %s", transfers[i].ID, len(files), reason)
+			}
+			return fmt.Errorf("transfer %s not found in its %d files", transfers[i].ID, len(files))
+		}
+	}
+	return nil
+}
+
+// downloadACHFile reads the contents of fileID and parses them as a NACHA file.
+func downloadACHFile(ctx context.Context, api *moov.APIClient, fileID string) (*ach.File, error) {
+	contents, resp, err := api.ACHFilesApi.GetFileContents(ctx, fileID, nil)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("problem downloading file %s: %v", fileID, describeAPIError(err))
+	}
+	file, err := ach.NewReader(strings.NewReader(contents)).Read()
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing file %s: %v", fileID, err)
+	}
+	return &file, nil
+}
+
+// checkFailedTransfers calls the failed route of each transfer. Failed transfers need to be rejected
+// with an Error body, which is logged as their failure reason, and others need to be accepted.
+func checkFailedTransfers(ctx context.Context, api *moov.APIClient, userID string, transfers []moov.Transfer) error {
+	for i := range transfers {
+		_, resp, err := api.TransfersApi.GetTransferNachaCode(ctx, transfers[i].ID, userID, nil)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if transfers[i].Status != moov.FAILED {
+			if err != nil {
+				return fmt.Errorf("%s transfer %s: %v", transfers[i].Status, transfers[i].ID, describeAPIError(err))
+			}
+			continue
+		}
+		if err == nil {
+			return fmt.Errorf("failed transfer %s has no failure reason", transfers[i].ID)
+		}
+		if resp == nil {
+			return err
+		}
+		if resp.StatusCode < 400 || resp.StatusCode > 499 {
+			return fmt.Errorf("failed transfer %s returned HTTP status %s, expected 4xx: %v", transfers[i].ID, resp.Status, describeAPIError(err))
+		}
+		if e, ok := err.(moov.GenericOpenAPIError); ok {
+			if err := checkErrorBody(resp.Header, e.Body()); err != nil {
+				return fmt.Errorf("failed transfer %s: %v", transfers[i].ID, err)
+			}
+			var problem struct {
+				Error string `json:"error"`
+			}
+			json.Unmarshal(e.Body(), &problem)
+			log.Printf("INFO: transfer %s failed: %s", transfers[i].ID, problem.Error)
+		}
+	}
+	return nil
+}
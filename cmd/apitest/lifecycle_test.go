@@ -0,0 +1,40 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestLifecycle__terminalStatus(t *testing.T) {
+	for _, status := range []moov.TransferStatus{moov.PROCESSED, moov.FAILED, moov.CANCELED} {
+		if !terminalStatus(status) {
+			t.Errorf("%s should be terminal", status)
+		}
+	}
+	for _, status := range []moov.TransferStatus{moov.PENDING, moov.REVIEWABLE, ""} {
+		if terminalStatus(status) {
+			t.Errorf("%s shouldn't be terminal", status)
+		}
+	}
+}
+
+func TestLifecycle__compareEvent(t *testing.T) {
+	now := time.Now()
+	event := moov.Event{ID: "a", Topic: "Transfer created", Type: "TransferEvent", Resource: "xfer", Created: now}
+	if err := compareEvent(event, event); err != nil {
+		t.Error(err)
+	}
+
+	other := event
+	other.Topic = "Transfer processed"
+	other.Created = now.Add(time.Second)
+	if err := compareEvent(event, other); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,383 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const redacted = "REDACTED"
+
+var (
+	// redactedHeaders are replaced in recorded requests and responses
+	redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+	// redactedFields are JSON object keys and query parameters whose values are replaced in
+	// recorded bodies and URLs
+	redactedFields = []string{"password", "access_token", "refresh_token", "client_secret"}
+)
+
+// Cassette is a set of recorded HTTP request and response pairs. It's safe to share
+// across several Recorders.
+type Cassette struct {
+	mu sync.Mutex
+
+	Interactions []*Interaction `json:"interactions"`
+}
+
+func (c *Cassette) add(inter *Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Interactions = append(c.Interactions, inter)
+}
+
+// Save writes every recorded interaction to path as JSON.
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	bs, err := json.MarshalIndent(c, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bs, 0644)
+}
+
+// Interaction is one HTTP request and the response it was given.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is an HTTP body which is written as a string when it's valid UTF-8, otherwise base64.
+type Body []byte
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(struct {
+		Base64 []byte `json:"base64"`
+	}{b})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var wrapper struct {
+		Base64 []byte `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err != nil {
+		return err
+	}
+	*b = wrapper.Base64
+	return nil
+}
+
+// ReadCassette loads a Cassette previously saved by a Recorder.
+func ReadCassette(path string) (*Cassette, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(bs, &c); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %v", path, err)
+	}
+	return &c, nil
+}
+
+// Recorder is an http.RoundTripper which saves each request and response made through it
+// into a Cassette. Cookies, OAuth bearer tokens, client secrets and passwords are redacted before
+// being saved.
+//
+// Recorder should wrap Transport so cassettes contain production Moov API URLs and can be
+// replayed with or without local routing.
+type Recorder struct {
+	Underlying http.RoundTripper
+	Cassette   *Cassette
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.Underlying == nil {
+		return nil, errors.New("nil underlying Transport")
+	}
+	if r.Cassette == nil {
+		return nil, errors.New("nil Cassette")
+	}
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("recorder: reading request body: %v", err)
+	}
+	recorded := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    redactURL(req.URL), // save before Transport rewrites it
+			Header: redactHeaders(req.Header),
+			Body:   redactBody(reqBody),
+		},
+	}
+
+	resp, err := r.Underlying.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("recorder: reading response body: %v", err)
+	}
+	recorded.Response = RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Header:     redactHeaders(resp.Header),
+		Body:       redactBody(respBody),
+	}
+
+	r.Cassette.add(recorded)
+
+	return resp, nil
+}
+
+// Replayer is an http.RoundTripper which answers requests from a Cassette without making
+// any network calls.
+//
+// Requests are matched against unused interactions, in recorded order, by their method, normalized
+// path and (redacted) query and body. If no query and body match the first interaction with the
+// same method and path is used, as apitest generates random names, amounts, etc on each run.
+type Replayer struct {
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+}
+
+func NewReplayer(cassette *Cassette) *Replayer {
+	return &Replayer{
+		cassette: cassette,
+		used:     make([]bool, len(cassette.Interactions)),
+	}
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("replayer: reading request body: %v", err)
+	}
+	body = redactBody(body)
+	path := NormalizePath(req.URL.Path)
+	query := redactQuery(req.URL.Query())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	idx := -1
+	for i, inter := range r.cassette.Interactions {
+		if r.used[i] || !strings.EqualFold(inter.Request.Method, req.Method) {
+			continue
+		}
+		u, err := url.Parse(inter.Request.URL)
+		if err != nil || NormalizePath(u.Path) != path {
+			continue
+		}
+		if bytes.Equal(inter.Request.Body, body) && redactQuery(u.Query()) == query {
+			idx = i
+			break
+		}
+		if idx < 0 {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return nil, fmt.Errorf("replayer: no recorded response for %s %s", req.Method, req.URL.Path)
+	}
+	r.used[idx] = true
+
+	recorded := r.cassette.Interactions[idx].Response
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// NormalizePath replaces segments which look like IDs (e.g. /transfers/a1b2c3) with {id}
+// so requests for different resources of the same route can be matched.
+func NormalizePath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range parts {
+		if i == 0 || (i == 1 && parts[0] == "v1") {
+			continue // keep /v1/$app
+		}
+		if looksLikeID(parts[i]) {
+			parts[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+func looksLikeID(segment string) bool {
+	if len(segment) > 24 {
+		return true
+	}
+	for _, r := range segment {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactURL returns u with the values of sensitive query parameters replaced, such as the
+// client_secret go-client sends when creating OAuth2 tokens.
+func redactURL(u *url.URL) string {
+	out := *u
+	if out.RawQuery != "" {
+		out.RawQuery = redactQuery(u.Query())
+	}
+	return out.String()
+}
+
+// redactQuery encodes query with each parameter in redactedFields replaced.
+func redactQuery(query url.Values) string {
+	for k := range query {
+		for _, field := range redactedFields {
+			if strings.EqualFold(k, field) {
+				for i := range query[k] {
+					query[k][i] = redacted
+				}
+			}
+		}
+	}
+	return query.Encode()
+}
+
+// readBody consumes *rc and replaces it with a reader of the same bytes.
+func readBody(rc *io.ReadCloser) ([]byte, error) {
+	if *rc == nil || *rc == http.NoBody {
+		return nil, nil
+	}
+	bs, err := ioutil.ReadAll(*rc)
+	(*rc).Close()
+	*rc = ioutil.NopCloser(bytes.NewReader(bs))
+	return bs, err
+}
+
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range redactedHeaders {
+		vs := out[http.CanonicalHeaderKey(name)]
+		for i := range vs {
+			vs[i] = redactHeaderValue(name, vs[i])
+		}
+	}
+	return out
+}
+
+// redactHeaderValue keeps the auth scheme and cookie names (e.g. 'Bearer', 'moov_auth') so
+// recordings still show which form of auth was used.
+func redactHeaderValue(name, value string) string {
+	switch http.CanonicalHeaderKey(name) {
+	case "Authorization":
+		if idx := strings.Index(value, " "); idx > 0 {
+			return value[:idx] + " " + redacted
+		}
+		return redacted
+
+	case "Cookie":
+		cookies := strings.Split(value, ";")
+		for i := range cookies {
+			if idx := strings.Index(cookies[i], "="); idx > 0 {
+				cookies[i] = cookies[i][:idx] + "=" + redacted
+			}
+		}
+		return strings.Join(cookies, ";")
+
+	case "Set-Cookie":
+		parts := strings.SplitN(value, ";", 2)
+		if idx := strings.Index(parts[0], "="); idx > 0 {
+			parts[0] = parts[0][:idx] + "=" + redacted
+		}
+		return strings.Join(parts, ";")
+	}
+	return value
+}
+
+// redactBody replaces sensitive fields in JSON bodies. Other bodies are returned as-is.
+func redactBody(body []byte) []byte {
+	if len(body) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	if !redactValue(v) {
+		return body
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return bs
+}
+
+func redactValue(v interface{}) bool {
+	changed := false
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k := range vv {
+			for _, field := range redactedFields {
+				if strings.EqualFold(k, field) {
+					vv[k] = redacted
+					changed = true
+				}
+			}
+			if redactValue(vv[k]) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for i := range vv {
+			if redactValue(vv[i]) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,240 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+func TestCassette__RecordReplay(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		http.SetCookie(w, &http.Cookie{Name: "moov_auth", Value: "secret-cookie"})
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"path": "` + r.URL.Path + `", "access_token": "secret-token", "echo": ` + string(body) + `}`))
+	}))
+	defer svc.Close()
+
+	cassette := &Cassette{}
+	client := &http.Client{
+		Transport: &Recorder{
+			Underlying: http.DefaultTransport,
+			Cassette:   cassette,
+		},
+	}
+	req, _ := http.NewRequest("POST", svc.URL+"/v1/users/create", strings.NewReader(`{"email":"jane@example.com","password":"hunter2"}`))
+	req.Header.Set("Authorization", "Bearer secret-token")
+	req.Header.Set("Cookie", "moov_auth=secret-cookie")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(bs), "secret-token") {
+		t.Errorf("caller should see the real response: %s", string(bs))
+	}
+
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "apitest.json")
+	if err := cassette.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing sensitive should be saved
+	bs, _ = ioutil.ReadFile(path)
+	for _, secret := range []string{"hunter2", "secret-token", "secret-cookie"} {
+		if strings.Contains(string(bs), secret) {
+			t.Errorf("found %q in cassette: %s", secret, string(bs))
+		}
+	}
+	if !strings.Contains(string(bs), "Bearer REDACTED") || !strings.Contains(string(bs), "moov_auth=REDACTED") {
+		t.Errorf("expected redacted headers: %s", string(bs))
+	}
+
+	// Replay without the server
+	svc.Close()
+	recorded, err := ReadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Transport = NewReplayer(recorded)
+
+	req, _ = http.NewRequest("POST", "https://api.moov.io/v1/users/create", strings.NewReader(`{"email":"john@example.com","password":"other"}`))
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("bogus HTTP status: %d", resp.StatusCode)
+	}
+	if cookies := resp.Cookies(); len(cookies) != 1 || cookies[0].Value != "REDACTED" {
+		t.Errorf("unexpected cookies: %#v", cookies)
+	}
+	bs, _ = ioutil.ReadAll(resp.Body)
+	if !strings.Contains(string(bs), `"path":"/v1/users/create"`) {
+		t.Errorf("unexpected body: %s", string(bs))
+	}
+
+	// Each interaction is only replayed once
+	req, _ = http.NewRequest("POST", "https://api.moov.io/v1/users/create", nil)
+	if _, err := client.Do(req); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestCassette__ReplayMatching(t *testing.T) {
+	cassette := &Cassette{
+		Interactions: []*Interaction{
+			{
+				Request:  RecordedRequest{Method: "GET", URL: "https://api.moov.io/v1/ach/transfers/a1b2c3"},
+				Response: RecordedResponse{StatusCode: http.StatusOK, Body: Body(`first`)},
+			},
+			{
+				Request:  RecordedRequest{Method: "POST", URL: "https://api.moov.io/v1/ach/transfers", Body: Body(`{"amount":"USD 1.00"}`)},
+				Response: RecordedResponse{StatusCode: http.StatusOK, Body: Body(`one`)},
+			},
+			{
+				Request:  RecordedRequest{Method: "POST", URL: "https://api.moov.io/v1/ach/transfers", Body: Body(`{"amount":"USD 2.00"}`)},
+				Response: RecordedResponse{StatusCode: http.StatusOK, Body: Body(`two`)},
+			},
+		},
+	}
+	client := &http.Client{Transport: NewReplayer(cassette)}
+
+	read := func(method, u, body string) string {
+		req, _ := http.NewRequest(method, u, strings.NewReader(body))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return string(bs)
+	}
+
+	// exact body match, even if it's not the first recorded
+	if body := read("POST", "https://api.moov.io/v1/ach/transfers", `{"amount":"USD 2.00"}`); body != "two" {
+		t.Errorf("got %q", body)
+	}
+	// different IDs have the same normalized path
+	if body := read("GET", "https://api.moov.io/v1/ach/transfers/d4e5f6", ""); body != "first" {
+		t.Errorf("got %q", body)
+	}
+	// no body matches, so fallback to the first unused
+	if body := read("POST", "https://api.moov.io/v1/ach/transfers", `{"amount":"USD 3.00"}`); body != "one" {
+		t.Errorf("got %q", body)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	cases := map[string]string{
+		"/v1/ach/transfers":                            "/v1/ach/transfers",
+		"/v1/ach/transfers/a1b2c3/events":              "/v1/ach/transfers/{id}/events",
+		"/v1/ach/depositories/foo123/micro-deposits":   "/v1/ach/depositories/{id}/micro-deposits",
+		"/v1/watchman/ofac/sdn/2681":                   "/v1/watchman/ofac/sdn/{id}",
+		"/v1/customers/abcdefabcdefabcdefabcdefabcdef": "/v1/customers/{id}",
+	}
+	for in, expected := range cases {
+		if out := NormalizePath(in); out != expected {
+			t.Errorf("NormalizePath(%q)=%q expected %q", in, out, expected)
+		}
+	}
+}
+
+func TestCassette__RecordOAuth2Token(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "secret-token", "expires_in": 3600, "token_type": "Bearer"}`))
+	}))
+	defer svc.Close()
+
+	cassette := &Cassette{}
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	conf.HTTPClient = &http.Client{
+		Transport: &Recorder{
+			Underlying: http.DefaultTransport,
+			Cassette:   cassette,
+		},
+	}
+	api := moov.NewAPIClient(conf)
+	opts := &moov.CreateOAuth2TokenOpts{
+		GrantType:    optional.NewString("client_credentials"),
+		ClientId:     optional.NewString("client123"),
+		ClientSecret: optional.NewString("secret-client"),
+	}
+	if _, _, err := api.OAuth2Api.CreateOAuth2Token(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	bs, err := json.Marshal(cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret-client", "secret-token"} {
+		if strings.Contains(string(bs), secret) {
+			t.Errorf("found %q in cassette: %s", secret, string(bs))
+		}
+	}
+	if u := cassette.Interactions[0].Request.URL; !strings.Contains(u, "client_id=client123") || !strings.Contains(u, "client_secret=REDACTED") {
+		t.Errorf("unexpected URL: %s", u)
+	}
+
+	// Replayed requests are matched on the same redacted query
+	conf.HTTPClient.Transport = NewReplayer(cassette)
+	opts.ClientSecret = optional.NewString("other-secret")
+	token, _, err := api.OAuth2Api.CreateOAuth2Token(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "REDACTED" {
+		t.Errorf("unexpected token: %#v", token)
+	}
+}
+
+func TestCassette__ReplayQuery(t *testing.T) {
+	cassette := &Cassette{
+		Interactions: []*Interaction{
+			{
+				Request:  RecordedRequest{Method: "GET", URL: "https://api.moov.io/v1/watchman/ofac/search?name=jane"},
+				Response: RecordedResponse{StatusCode: 200, Body: Body(`jane`)},
+			},
+			{
+				Request:  RecordedRequest{Method: "GET", URL: "https://api.moov.io/v1/watchman/ofac/search?name=john"},
+				Response: RecordedResponse{StatusCode: 200, Body: Body(`john`)},
+			},
+		},
+	}
+	client := &http.Client{Transport: NewReplayer(cassette)}
+	for _, name := range []string{"john", "jane"} {
+		resp, err := client.Get("https://api.moov.io/v1/watchman/ofac/search?name=" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(bs) != name {
+			t.Errorf("got %q for %s", string(bs), name)
+		}
+	}
+}
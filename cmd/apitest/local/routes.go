@@ -0,0 +1,194 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/moov-io/base/http/bind"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Route sends requests for a Moov API path to a local service.
+type Route struct {
+	// Prefix is matched against the path after /v1/ or /v2/ (e.g. "ach" or "ach/transfers") where '*'
+	// matches any one segment. The route with the longest matching Prefix is used.
+	Prefix string `yaml:"prefix"`
+
+	// Host is the host:port requests are sent to.
+	Host string `yaml:"host"`
+
+	// Scheme of the proxied request, defaults to http.
+	Scheme string `yaml:"scheme,omitempty"`
+
+	// Rewrite replaces the /v1/$app segments of the path, everything after $app is kept.
+	// An empty Rewrite drops /v1/$app (e.g. /v1/ach/files becomes /files).
+	Rewrite string `yaml:"rewrite,omitempty"`
+}
+
+func (r Route) scheme() string {
+	if r.Scheme == "" {
+		return "http"
+	}
+	return r.Scheme
+}
+
+func (r Route) validate() error {
+	if strings.Trim(r.Prefix, "/") == "" {
+		return errors.New("missing prefix")
+	}
+	if r.Host == "" {
+		return fmt.Errorf("route %s: missing host", r.Prefix)
+	}
+	if r.Rewrite != "" && !strings.HasPrefix(r.Rewrite, "/") {
+		return fmt.Errorf("route %s: rewrite %q must start with /", r.Prefix, r.Rewrite)
+	}
+	return nil
+}
+
+func localhost(service string) string {
+	return "localhost" + bind.HTTP(service)
+}
+
+// DefaultRoutes returns the routing table for Moov services running on their bind.HTTP ports.
+// Routes should match our Ingress routes.
+func DefaultRoutes() []Route {
+	return []Route{
+		{Prefix: "ach", Host: localhost("ach")},
+		{Prefix: "ach/depositories", Host: localhost("paygate")},
+		{Prefix: "ach/gateways", Host: localhost("paygate")},
+		{Prefix: "ach/originators", Host: localhost("paygate")},
+		{Prefix: "ach/receivers", Host: localhost("paygate")},
+		{Prefix: "ach/transfers", Host: localhost("paygate")},
+
+		{Prefix: "auth", Host: localhost("auth")},
+		{Prefix: "oauth2", Host: localhost("auth"), Rewrite: "/oauth2"},
+		{Prefix: "users", Host: localhost("auth"), Rewrite: "/users"},
+
+		// fed expects /fed/ as a prefix on routes on non-ping routes
+		{Prefix: "fed", Host: localhost("fed"), Rewrite: "/fed"},
+		{Prefix: "fed/ping", Host: localhost("fed")},
+
+		{Prefix: "accounts", Host: localhost("accounts"), Rewrite: "/accounts"},
+		{Prefix: "accounts/ping", Host: localhost("accounts")},
+		{Prefix: "gl", Host: localhost("accounts"), Rewrite: "/accounts"},
+		{Prefix: "gl/ping", Host: localhost("accounts")},
+
+		{Prefix: "customers", Host: localhost("customers"), Rewrite: "/customers"},
+		{Prefix: "customers/*/accounts", Host: localhost("accounts"), Rewrite: "/customers"},
+
+		{Prefix: "imagecashletter", Host: localhost("icl")},
+		{Prefix: "wire", Host: localhost("wire")},
+
+		{Prefix: "paygate", Host: localhost("paygate")},
+
+		// paygate v2 routes
+		{Prefix: "tenants", Host: localhost("paygate"), Rewrite: "/tenants"},
+		{Prefix: "organizations", Host: localhost("paygate"), Rewrite: "/organizations"},
+		{Prefix: "transfers", Host: localhost("paygate"), Rewrite: "/transfers"},
+
+		{Prefix: "ofac", Host: localhost("watchman")},
+		{Prefix: "watchman", Host: localhost("watchman")},
+	}
+}
+
+// MergeRoutes returns base with each of the overrides added, replacing any route with the same prefix.
+func MergeRoutes(base []Route, overrides ...Route) []Route {
+	out := append([]Route(nil), base...)
+	for _, o := range overrides {
+		replaced := false
+		for i := range out {
+			if strings.EqualFold(strings.Trim(out[i].Prefix, "/"), strings.Trim(o.Prefix, "/")) {
+				out[i] = o
+				replaced = true
+			}
+		}
+		if !replaced {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// ReadRoutes reads a YAML file of routes, for example:
+//
+//	routes:
+//	  - prefix: ach
+//	    host: localhost:9080
+//	  - prefix: fed
+//	    host: fed.internal:443
+//	    scheme: https
+//	    rewrite: /fed
+func ReadRoutes(path string) ([]Route, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Routes []Route `yaml:"routes"`
+	}
+	if err := yaml.UnmarshalStrict(bs, &file); err != nil {
+		return nil, fmt.Errorf("reading routes from %s: %v", path, err)
+	}
+	for i := range file.Routes {
+		if err := file.Routes[i].validate(); err != nil {
+			return nil, fmt.Errorf("reading routes from %s: %v", path, err)
+		}
+	}
+	return file.Routes, nil
+}
+
+// ParseRoute reads a route from its flag form: prefix=[scheme://]host:port[/rewrite]
+//
+// For example: 'ach=localhost:9080' or 'fed=https://fed.internal:443/fed'
+func ParseRoute(value string) (Route, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return Route{}, fmt.Errorf("invalid route %q, expected prefix=host:port", value)
+	}
+	target := parts[1]
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return Route{}, fmt.Errorf("invalid route %q: %v", value, err)
+	}
+	route := Route{
+		Prefix:  strings.Trim(parts[0], "/"),
+		Host:    u.Host,
+		Scheme:  u.Scheme,
+		Rewrite: strings.TrimSuffix(u.Path, "/"),
+	}
+	return route, route.validate()
+}
+
+// matchRoute returns the route with the longest prefix matching segments, the path after /v1/ or /v2/.
+func matchRoute(routes []Route, segments []string) *Route {
+	var best *Route
+	bestLength := 0
+	for i := range routes {
+		prefix := strings.Split(strings.Trim(routes[i].Prefix, "/"), "/")
+		if len(prefix) > len(segments) || len(prefix) < bestLength {
+			continue
+		}
+		matched := true
+		for j := range prefix {
+			if prefix[j] != "*" && !strings.EqualFold(prefix[j], segments[j]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			best, bestLength = &routes[i], len(prefix)
+		}
+	}
+	return best
+}
@@ -6,14 +6,14 @@ package local
 
 import (
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
-
-	"github.com/moov-io/base/http/bind"
 )
 
-// Transport intercepts HTTP requests and re-writes them according to bind.HTTP's local port binds.
+// Transport intercepts HTTP requests and re-writes them according to a routing table, which
+// defaults to bind.HTTP's local port binds (see DefaultRoutes). Requests without a route fail.
 // This is done to provide an shared http.RoundTripper usable by clients wishing for local dev with Moov.
 //
 // The underlying http.RoundTripper is required to enforce timeouts and other config be non-default
@@ -21,6 +21,9 @@ import (
 type Transport struct {
 	Underlying http.RoundTripper
 
+	// Routes is the routing table used for requests. DefaultRoutes() is used when empty.
+	Routes []Route
+
 	Debug bool
 }
 
@@ -29,79 +32,45 @@ type Transport struct {
 // ends up causing problems we'll have to figure out another solution.
 //
 // This means:
-//  - Dropping /v1/$app routing prefix
-//  - Changing the local port used (each app runs on its own port now)
-//    - Adjusting the scheme if needed.
+//   - Dropping /v1/$app routing prefix (or replacing it with the Route's Rewrite)
+//   - Changing the local host and port used (each app runs on its own port now)
+//   - Adjusting the scheme if needed.
 func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
 	origURL := r.URL.String()
 
 	// Each route looks like /v1/$app/... so we need to trim off the v1 and $app segments
-	// while looking up $app's port mapping.
+	// while looking up $app's route.
 	parts := strings.Split(r.URL.Path, "/")
 
 	if len(parts) < 3 { // parts splits into: "", v1, $app, (rest of url)
 		// Pass through whatever this request is.
-		return t.Underlying.RoundTrip(r)
+		return t.underlying(r)
 	}
 
-	r.URL.Scheme = "http"
-	r.URL.Host = "localhost"
-	r.URL.Path = "/"
-
-	// Routing logic, should match Ingress routes
-	switch strings.ToLower(parts[2]) {
-	case "ach":
-		switch strings.ToLower(parts[3]) {
-		case "depositories", "gateways", "originators", "receivers", "transfers":
-			r.URL.Host += bind.HTTP("paygate")
-		default:
-			r.URL.Host += bind.HTTP("ach")
-		}
-	case "auth":
-		r.URL.Host += bind.HTTP("auth")
-	case "fed":
-		r.URL.Host += bind.HTTP("fed")
-		if len(parts) > 3 && parts[3] != "ping" {
-			r.URL.Path = "/fed/" // fed expects /fed/ as a prefix on routes on non-ping routes
-		}
-	case "accounts", "gl":
-		r.URL.Host += bind.HTTP("accounts")
-		r.URL.Path = "/accounts"
-		if len(parts) > 3 {
-			if parts[3] == "ping" {
-				r.URL.Path = "/"
-			} else {
-				r.URL.Path += "/"
-			}
-		}
-	case "customers":
-		if len(parts) >= 5 && strings.EqualFold(parts[4], "accounts") {
-			r.URL.Host += bind.HTTP("accounts")
-		} else {
-			r.URL.Host += bind.HTTP("customers")
-		}
-		r.URL.Path = "/customers"
-		if len(parts) > 3 {
-			r.URL.Path += "/"
-		}
-	case "paygate":
-		r.URL.Host += bind.HTTP("paygate")
-	case "oauth2":
-		r.URL.Host += bind.HTTP("auth")
-		r.URL.Path = "/oauth2/"
-	case "ofac", "watchman":
-		r.URL.Host += bind.HTTP("watchman")
-	case "users":
-		r.URL.Host += bind.HTTP("auth")
-		r.URL.Path = "/users/"
+	routes := t.Routes
+	if len(routes) == 0 {
+		routes = DefaultRoutes()
+	}
+	route := matchRoute(routes, parts[2:])
+	if route == nil {
+		// Never send a request meant for a local service on to production
+		return nil, fmt.Errorf("no local route for %s %s", r.Method, r.URL.Path)
 	}
 
-	r.URL.Path += strings.Join(parts[3:], "/") // everything after $app
+	r.URL.Scheme = route.scheme()
+	r.URL.Host = route.Host
+	r.URL.Path = route.Rewrite
+	if rest := parts[3:]; len(rest) > 0 || route.Rewrite == "" {
+		r.URL.Path += "/" + strings.Join(rest, "/") // everything after $app
+	}
 
 	if t.Debug {
 		log.Printf("%v %v request URL (Original: %v)", r.Method, r.URL.String(), origURL)
 	}
+	return t.underlying(r)
+}
 
+func (t *Transport) underlying(r *http.Request) (*http.Response, error) {
 	if t.Underlying == nil {
 		return nil, errors.New("nil underlying Transport")
 	}
@@ -5,9 +5,12 @@
 package local
 
 import (
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -86,3 +89,172 @@ func TestTransport(t *testing.T) {
 		}
 	}
 }
+
+// captureTransport records the last request it was sent
+type captureTransport struct {
+	req *http.Request
+}
+
+func (c *captureTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.req = r
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    r,
+	}, nil
+}
+
+func proxiedURL(t *testing.T, tr *Transport, incoming string) string {
+	t.Helper()
+
+	capture := &captureTransport{}
+	tr.Underlying = capture
+	if _, err := tr.RoundTrip(httptest.NewRequest("GET", incoming, nil)); err != nil {
+		t.Fatal(err)
+	}
+	return capture.req.URL.String()
+}
+
+func TestTransport__defaultRoutes(t *testing.T) {
+	cases := []struct {
+		incoming, proxied string
+	}{
+		{"https://api.moov.io/v1/ach/files/foo", "http://localhost:8080/files/foo"},
+		{"https://api.moov.io/v1/ach/transfers/foo", "http://localhost:8082/transfers/foo"},
+		{"https://api.moov.io/v1/users/login", "http://localhost:8081/users/login"},
+		{"https://api.moov.io/v1/accounts/search", "http://localhost:8085/accounts/search"},
+		{"https://api.moov.io/v1/accounts/ping", "http://localhost:8085/ping"},
+		{"https://api.moov.io/v1/gl/ping", "http://localhost:8085/ping"},
+		{"https://api.moov.io/v1/customers/foo", "http://localhost:8087/customers/foo"},
+		{"https://api.moov.io/v1/customers/foo/accounts", "http://localhost:8085/customers/foo/accounts"},
+		{"https://api.moov.io/v1/fed/ach/search", "http://localhost:8086/fed/ach/search"},
+		{"https://api.moov.io/v1/imagecashletter/files/create", "http://localhost:8083/files/create"},
+		{"https://api.moov.io/v1/imagecashletter/ping", "http://localhost:8083/ping"},
+		{"https://api.moov.io/v1/wire/files/create", "http://localhost:8088/files/create"},
+		{"https://api.moov.io/v1/wire/ping", "http://localhost:8088/ping"},
+		{"https://api.moov.io/v1/watchman/search", "http://localhost:8084/search"},
+		{"https://api.moov.io/v2/tenants/foo", "http://localhost:8082/tenants/foo"},
+		{"https://api.moov.io/v2/organizations", "http://localhost:8082/organizations"},
+		{"https://api.moov.io/v2/transfers/foo", "http://localhost:8082/transfers/foo"},
+	}
+	for i := range cases {
+		if got := proxiedURL(t, &Transport{}, cases[i].incoming); got != cases[i].proxied {
+			t.Errorf("%s: got %s, expected %s", cases[i].incoming, got, cases[i].proxied)
+		}
+	}
+}
+
+func TestTransport__customRoutes(t *testing.T) {
+	tr := &Transport{
+		Routes: []Route{
+			{Prefix: "ach", Host: "ach.internal:9080"},
+			{Prefix: "ach/transfers", Host: "paygate.internal:443", Scheme: "https", Rewrite: "/paygate"},
+			{Prefix: "customers/*/documents", Host: "localhost:9087", Rewrite: "/v2/customers"},
+		},
+	}
+	cases := []struct {
+		incoming, proxied string
+	}{
+		{"https://api.moov.io/v1/ach/files", "http://ach.internal:9080/files"},
+		{"https://api.moov.io/v1/ach/transfers/foo", "https://paygate.internal:443/paygate/transfers/foo"},
+		{"https://api.moov.io/v1/customers/foo/documents", "http://localhost:9087/v2/customers/foo/documents"},
+	}
+	for i := range cases {
+		if got := proxiedURL(t, tr, cases[i].incoming); got != cases[i].proxied {
+			t.Errorf("%s: got %s, expected %s", cases[i].incoming, got, cases[i].proxied)
+		}
+	}
+
+	// merged with our defaults
+	tr.Routes = MergeRoutes(DefaultRoutes(), tr.Routes...)
+	if got := proxiedURL(t, tr, "https://api.moov.io/v1/ach/files"); got != "http://ach.internal:9080/files" {
+		t.Errorf("got %s", got)
+	}
+	if got := proxiedURL(t, tr, "https://api.moov.io/v1/paygate/ping"); got != "http://localhost:8082/ping" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestTransport__unrouted(t *testing.T) {
+	tr := &Transport{
+		Routes: []Route{{Prefix: "ach", Host: "ach.internal:9080"}},
+	}
+	for _, incoming := range []string{
+		"https://api.moov.io/v1/unknown/foo",
+		"https://api.moov.io/v1/customers/foo",
+		"https://api.moov.io/v1/paygate/ping", // defaults aren't used
+	} {
+		capture := &captureTransport{}
+		tr.Underlying = capture
+		_, err := tr.RoundTrip(httptest.NewRequest("GET", incoming, nil))
+		if err == nil || !strings.Contains(err.Error(), "no local route") {
+			t.Errorf("%s: expected no local route error, got %v", incoming, err)
+		}
+		if capture.req != nil {
+			t.Errorf("%s: sent to %s", incoming, capture.req.URL)
+		}
+	}
+}
+
+func TestReadRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "routes.yaml")
+	body := `routes:
+  - prefix: ach
+    host: localhost:9080
+  - prefix: fed
+    host: fed.internal:443
+    scheme: https
+    rewrite: /fed
+`
+	if err := ioutil.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatal(err)
+	}
+	routes, err := ReadRoutes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("got %#v", routes)
+	}
+	if r := routes[1]; r.Prefix != "fed" || r.Host != "fed.internal:443" || r.Scheme != "https" || r.Rewrite != "/fed" {
+		t.Errorf("unexpected route: %#v", r)
+	}
+
+	// missing host
+	if err := ioutil.WriteFile(path, []byte("routes:\n  - prefix: ach\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadRoutes(path); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestParseRoute(t *testing.T) {
+	r, err := ParseRoute("ach=localhost:9080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Prefix != "ach" || r.Host != "localhost:9080" || r.Scheme != "http" || r.Rewrite != "" {
+		t.Errorf("unexpected route: %#v", r)
+	}
+
+	r, err = ParseRoute("/customers/*/accounts=https://accounts.internal:443/customers/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Prefix != "customers/*/accounts" || r.Host != "accounts.internal:443" || r.Scheme != "https" || r.Rewrite != "/customers" {
+		t.Errorf("unexpected route: %#v", r)
+	}
+
+	for _, v := range []string{"", "ach", "=localhost:9080", "ach="} {
+		if _, err := ParseRoute(v); err == nil {
+			t.Errorf("%q: expected error", v)
+		}
+	}
+}
@@ -68,6 +68,12 @@ func attemptFailedLogin(ctx context.Context, api *moov.APIClient) error {
 		if err := checkCORSHeaders(resp); err != nil {
 			return fmt.Errorf("attempt failed login: %v", err)
 		}
+		// -negative also requires an Error body on rejected credentials
+		if e, ok := err.(moov.GenericOpenAPIError); ok && *flagNegative {
+			if err := checkErrorBody(resp.Header, e.Body()); err != nil {
+				return fmt.Errorf("attempt failed login: %v", err)
+			}
+		}
 	}
 	if err == nil {
 		bs, err := ioutil.ReadAll(resp.Body)
@@ -51,8 +51,9 @@ var (
 	adminAddr = flag.String("admin.addr", bind.Admin("apitest"), "Admin HTTP listen address")
 
 	// Business logic flags
-	flagACHType = flag.String("ach.type", "PPD", "ACH Service Class Code (SEC) to use. Options: PPD, IAT")
-	flagOAuth   = flag.Bool("oauth", false, "Use OAuth instead of cookie auth")
+	flagACHType      = flag.String("ach.type", "PPD", "Comma separated ACH Standard Entry Class (SEC) codes to create transfers with, or 'all'. Options: CCD, IAT, PPD, TEL, WEB")
+	flagTransferType = flag.String("transfer.type", "push", "Comma separated directions to create transfers in. Options: push, pull")
+	flagOAuth        = flag.Bool("oauth", false, "Use OAuth instead of cookie auth")
 
 	flagCleanup = flag.Bool("cleanup", false, "Cleanup files, transfers, etc after creation")
 
@@ -89,21 +90,118 @@ func main() {
 	}()
 	defer adminServer.Shutdown()
 
+	// Check -ach.type and -transfer.type before creating anything
+	if _, err := parseACHTypes(*flagACHType); err != nil {
+		log.Fatalf("FAILURE: %v", err)
+	}
+	if _, err := parseTransferTypes(*flagTransferType); err != nil {
+		log.Fatalf("FAILURE: %v", err)
+	}
+	if *flagBatch && (*flagBatchSize < 1 || *flagBatchReceivers < 1) {
+		log.Fatal("FAILURE: -batch.size and -batch.receivers need to be positive")
+	}
+	if *flagReturns != "" || *flagReturnsNOC != "" {
+		if _, err := parseReturnCodes(*flagReturns); err != nil {
+			log.Fatalf("FAILURE: -returns: %v", err)
+		}
+		if _, err := parseChangeCodes(*flagReturnsNOC); err != nil {
+			log.Fatalf("FAILURE: -returns.noc: %v", err)
+		}
+		if *flagVerifyTransfers == "" || *flagReturnsInboundDir == "" {
+			log.Fatal("FAILURE: -returns and -returns.noc need -verify-transfers.dir and -returns.inbound-dir")
+		}
+	}
+	if *flagLifecycle && *flagCleanup {
+		log.Fatal("FAILURE: -lifecycle can't be used with -cleanup as transfers are deleted after they're created")
+	}
+	if *flagLifecycle && (*flagLifecycleTimeout <= 0 || *flagLifecycleInterval <= 0) {
+		log.Fatal("FAILURE: -lifecycle.timeout and -lifecycle.interval need to be positive")
+	}
+
 	ctx := context.TODO()
 	requestID := base.ID()
 
-	// Basic sanity check against apps
-	if err := pingApps(ctx, requestID); err != nil {
+	// Start our in-memory Moov API
+	if *flagMock {
+		if *flagLocal || *flagLocalDev {
+			log.Fatal("FAILURE: -mock can't be used with -local or -dev")
+		}
+		if err := startMockServer(); err != nil {
+			log.Fatalf("FAILURE: %v", err)
+		}
+	}
+
+	// Read any custom -local routes
+	if err := setupLocalRoutes(); err != nil {
 		log.Fatalf("FAILURE: %v", err)
 	}
+
+	// Validate responses against our OpenAPI specs
+	if err := setupContract(); err != nil {
+		log.Fatalf("FAILURE: %v", err)
+	}
+
+	// Record which OpenAPI operations we call
+	if err := setupCoverage(); err != nil {
+		log.Fatalf("FAILURE: %v", err)
+	}
+
+	// Verify X-Request-ID is returned and carried to downstream services
+	if err := setupRequestID(); err != nil {
+		log.Fatalf("FAILURE: %v", err)
+	}
+
+	// Read the Error schema invalid requests are checked against
+	if err := setupNegative(); err != nil {
+		log.Fatalf("FAILURE: %v", err)
+	}
+
+	// Record or replay HTTP responses
+	if err := setupCassette(); err != nil {
+		log.Fatalf("FAILURE: %v", err)
+	}
+	defer saveCassette()
+
+	// Write the JUnit and JSON reports once we're done
+	defer writeReports()
+	setup := report.newSuite("apitest")
+
+	// Basic sanity check against apps
+	err := setup.step("pingApps", func() error {
+		return pingApps(ctx, requestID)
+	})
+	if err != nil {
+		// The canary keeps serving and reports the failure through '/ready'
+		if !*flagCanary || *flagPing || *flagScenarios != "" {
+			fatalf("FAILURE: %v", err)
+		}
+		log.Printf("ERROR: %v", err)
+	}
 	if *flagPing {
 		log.Println("INFO: all applications responded")
 		return
 	}
 
+	// Run declarative scenarios instead of the default flow
+	if *flagScenarios != "" {
+		if err := runScenarios(ctx, requestID, *flagScenarios); err != nil {
+			fatalf("FAILURE: %v", err)
+		}
+		checkContract()
+		checkRequestIDs()
+		log.Println("SUCCESS: all scenarios passed")
+		return
+	}
+
+	// Run iterate() forever as a canary
+	if *flagCanary {
+		runCanary(ctx, adminServer, err)
+		return
+	}
+
 	// If we're going to verify we need the directory to be empty beforehand
 	if *flagVerifyTransfers != "" && !verifyDirIsEmpty(*flagVerifyTransfers) {
-		log.Fatalf("FAILURE: verify directory %s is not empty", *flagVerifyTransfers)
+		fatalf("FAILURE: verify directory %s is not empty", *flagVerifyTransfers)
 	}
 
 	var mu sync.Mutex
@@ -119,7 +217,7 @@ func main() {
 			wg.Add(1)
 			gate.Start()
 			go func() {
-				if iter := iterate(ctx, requestID); iter != nil {
+				if iter := iterate(ctx, requestID, report.newSuite("iterate")); iter != nil {
 					mu.Lock()
 					iterations = append(iterations, iter)
 					mu.Unlock()
@@ -130,7 +228,7 @@ func main() {
 		}
 		wg.Wait()
 	} else {
-		if iter := iterate(ctx, requestID); iter != nil {
+		if iter := iterate(ctx, requestID, report.newSuite("iterate")); iter != nil {
 			iterations = append(iterations, iter) // just one user and transfer
 
 			// Verify you can't just add x-user-id
@@ -144,23 +242,134 @@ func main() {
 				recDepID:     iter.receiverDepository.ID,
 				receiverID:   iter.receiver.ID,
 				transferID:   iter.transfer.ID,
+
+				iter: iter,
 			}
-			if err := ac.checkAll(); err != nil {
-				log.Fatalf("FAILURE: auth bypass %s", err)
+			err := setup.step("authChecker", func() error {
+				return ac.checkAll(ctx)
+			})
+			if err != nil {
+				fatalf("FAILURE: auth bypass %s", err)
 			}
 			log.Println("INFO: CORS headers present on all HTTP responses")
+
+			err = setup.step("corsPreflight", func() error {
+				return checkCORSPreflight(ctx, requestID)
+			})
+			if err != nil {
+				fatalf("FAILURE: CORS policy %v", err)
+			}
+
+			if *flagIdempotency {
+				err = setup.step("idempotency", func() error {
+					return checkIdempotency(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
+
+			if *flagNegative {
+				err = setup.step("negative", func() error {
+					return checkNegative(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
+
+			if *flagBatch {
+				err = setup.step("batch", func() error {
+					return checkBatchTransfers(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
+
+			if *flagLifecycle {
+				err = setup.step("lifecycle", func() error {
+					return checkTransferLifecycle(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
+
+			if *flagACHFiles {
+				err = setup.step("achFiles", func() error {
+					return checkACHFiles(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
+
+			if *flagICL {
+				err = setup.step("icl", func() error {
+					return checkICL(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
+
+			if *flagWire {
+				err = setup.step("wire", func() error {
+					return checkWire(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
+
+			if *flagWatchman {
+				err = setup.step("watchman", func() error {
+					return checkWatchman(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
+
+			if *flagWatchmanWatches {
+				err = setup.step("watchmanWatches", func() error {
+					return checkWatchmanWatches(ctx, iter)
+				})
+				if err != nil {
+					fatalf("FAILURE: %v", err)
+				}
+			}
 		}
 	}
 
 	// Verify every transfer we made exists
 	if *flagVerifyTransfers != "" {
 		if len(iterations) == 0 {
-			log.Fatalf("FAILURE: unable to create any transfers, see above output logs for errors")
+			fatalf("FAILURE: unable to create any transfers, see above output logs for errors")
 		}
 		log.Printf("Sleeping for %v to let paygate collect and merge %d transfers", flagVerifyInitialSleep, len(iterations))
 		time.Sleep(*flagVerifyInitialSleep)
-		if err := verifyTransfersWereMerged(*flagVerifyTransfers, iterations); err != nil {
-			log.Fatalf("FAILURE: %v", err)
+		var extra []string
+		err := setup.step("verifyTransfersWereMerged", func() (err error) {
+			extra, err = verifyTransfersWereMerged(*flagVerifyTransfers, iterations)
+			return err
+		})
+		if err != nil {
+			fatalf("FAILURE: %v", err)
+		}
+		// Paygate merges other entries (e.g. micro-deposits) too, so these fail the step but not apitest
+		if err := setup.step("extraMergedEntries", func() error { return checkExtraEntries(extra) }); err != nil {
+			log.Printf("ERROR: %v", err)
+		}
+
+		if *flagReturns != "" || *flagReturnsNOC != "" {
+			err := setup.step("returns", func() error {
+				return simulateReturns(ctx, *flagVerifyTransfers, *flagReturnsInboundDir, iterations)
+			})
+			if err != nil {
+				fatalf("FAILURE: %v", err)
+			}
 		}
 	}
 
@@ -169,6 +378,9 @@ func main() {
 		log.Printf("pausing for %v\n", flagPauseDuration)
 		time.Sleep(*flagPauseDuration)
 	}
+
+	checkContract()
+	checkRequestIDs()
 }
 
 var apiAddressOnce sync.Once
@@ -211,9 +423,17 @@ func makeConfiguration() *moov.Configuration {
 		tr := conf.HTTPClient.Transport
 		conf.HTTPClient.Transport = &local.Transport{
 			Underlying: tr,
+			Routes:     localRoutes,
 			Debug:      *flagDebug,
 		}
 	}
+	conf.HTTPClient.Transport = wrapCassette(conf.HTTPClient.Transport)
+	conf.HTTPClient.Transport = wrapContract(conf.HTTPClient.Transport)
+	conf.HTTPClient.Transport = wrapCoverage(conf.HTTPClient.Transport)
+	conf.HTTPClient.Transport = wrapRequestID(conf.HTTPClient.Transport)
+	conf.HTTPClient.Transport = &metricsTransport{
+		underlying: conf.HTTPClient.Transport,
+	}
 	return conf
 }
 
@@ -246,6 +466,22 @@ func pingApps(ctx context.Context, requestID string) error {
 	resp.Body.Close()
 	log.Println("FED PONG")
 
+	// imagecashletter
+	_, resp, err = api.MonitorApi.PingImageCashLetter(ctx, &moov.PingImageCashLetterOpts{})
+	if err != nil {
+		return fmt.Errorf("ERROR: failed to ping imagecashletter: %v", err)
+	}
+	resp.Body.Close()
+	log.Println("imagecashletter PONG")
+
+	// wire
+	_, resp, err = api.MonitorApi.PingWire(ctx, &moov.PingWireOpts{})
+	if err != nil {
+		return fmt.Errorf("ERROR: failed to ping wire: %v", err)
+	}
+	resp.Body.Close()
+	log.Println("wire PONG")
+
 	// Watchman
 	_, resp, err = api.MonitorApi.PingWatchman(ctx, &moov.PingWatchmanOpts{})
 	if err != nil {
@@ -265,12 +501,15 @@ func pingApps(ctx context.Context, requestID string) error {
 }
 
 type iteration struct {
-	user       *user
-	oauthToken moov.OAuth2Token
+	user         *user
+	oauthToken   moov.OAuth2Token
+	featureFlags *featureFlags
 
 	requestID string
 	userID    string
 
+	gateway moov.Gateway
+
 	originator           moov.Originator
 	originatorAccount    *moov.Account
 	originatorDepository moov.Depository
@@ -279,7 +518,9 @@ type iteration struct {
 	receiverAccount    *moov.Account
 	receiverDepository moov.Depository
 
-	transfer moov.Transfer
+	// transfer is the first of transfers, which has one Transfer for each -ach.type and -transfer.type
+	transfer  moov.Transfer
+	transfers []moov.Transfer
 }
 
 var (
@@ -296,7 +537,8 @@ var (
 	}, []string{"source"})
 )
 
-func iterate(ctx context.Context, requestID string) *iteration {
+// iterate runs our end-to-end flow (user signup through a transfer) and records each step in suite.
+func iterate(ctx context.Context, requestID string, suite *suiteResult) *iteration {
 	var failureOncer sync.Once
 
 	var lines []string
@@ -328,19 +570,28 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	}()
 
 	conf := makeConfiguration()
+	conf.HTTPClient.Transport = suite.wrap(conf.HTTPClient.Transport)
 	conf.AddDefaultHeader("X-Request-ID", requestID)
 	conf.AddDefaultHeader("Origin", "https://moov.io")
 	debugLogger("Using X-Request-ID: %s", requestID)
 	api := moov.NewAPIClient(conf)
 
-	featureFlags, err := grabPaygateFeatures(flagLocal, *flagPaygateAdminAddress, adminHTTPClient)
+	var featureFlags *featureFlags
+	err := suite.step("grabPaygateFeatures", func() (err error) {
+		featureFlags, err = grabPaygateFeatures(flagLocal, *flagPaygateAdminAddress, adminHTTPClient)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
 	}
 
 	// Create our random user
-	user, err := createUser(ctx, api)
+	var user *user
+	err = suite.step("createUser", func() (err error) {
+		user, err = createUser(ctx, api)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
@@ -351,13 +602,20 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	setMoovAuthCookie(conf, user)
 
 	// Verify Cookie works
-	if err := verifyUserIsLoggedIn(ctx, api, user); err != nil {
+	err = suite.step("verifyUserIsLoggedIn", func() error {
+		return verifyUserIsLoggedIn(ctx, api, user)
+	})
+	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
 	}
 	debugLogger("SUCCESS: Cookie works for user %s", user.ID)
 
-	oauthToken, err := createOAuthToken(ctx, api, user)
+	var oauthToken *moov.OAuth2Token
+	err = suite.step("createOAuthToken", func() (err error) {
+		oauthToken, err = createOAuthToken(ctx, api, user)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
@@ -377,7 +635,11 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	}
 
 	// Setup the Gateway
-	gateway, err := setupGateway(ctx, api, user)
+	var gateway moov.Gateway
+	err = suite.step("setupGateway", func() (err error) {
+		gateway, err = setupGateway(ctx, api, user)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
@@ -385,7 +647,11 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	debugLogger("SUCCESS: Setup Gateway (id=%s) for user", gateway.ID)
 
 	// Setup our micro-deposit origination account (or read its info if already setup)
-	microDepositOrig, err := createMicroDepositAccount(ctx, api, user)
+	var microDepositOrig *moov.Account
+	err = suite.step("createMicroDepositAccount", func() (err error) {
+		microDepositOrig, err = createMicroDepositAccount(ctx, api, user)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
@@ -394,14 +660,22 @@ func iterate(ctx context.Context, requestID string) *iteration {
 
 	// Create Originator Account
 	// We create these accounts because they won't exist in the Accounts service already. (We're using fake data/accounts.)
-	origAcct, err := createAccount(ctx, api, user, "from account", "")
+	var origAcct *moov.Account
+	err = suite.step("createAccount (originator)", func() (err error) {
+		origAcct, err = createAccount(ctx, api, user, "from account", "")
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
 	}
 
 	// Create Originator Depository
-	origDep, err := createDepository(ctx, api, user, origAcct)
+	var origDep moov.Depository
+	err = suite.step("createDepository (originator)", func() (err error) {
+		origDep, err = createDepository(ctx, api, user, origAcct)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
@@ -409,7 +683,11 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	debugLogger("SUCCESS: Created Originator Depository (id=%s) for user", origDep.ID)
 
 	// Create Originator
-	orig, err := createOriginator(ctx, api, user, featureFlags, origDep.ID)
+	var orig moov.Originator
+	err = suite.step("createOriginator", func() (err error) {
+		orig, err = createOriginator(ctx, api, user, featureFlags, origDep.ID)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
@@ -418,7 +696,10 @@ func iterate(ctx context.Context, requestID string) *iteration {
 
 	// By default with -local assume we want to approve customers.
 	if !featureFlags.CustomersCallsDisabled {
-		if err := attemptCustomerApproval(ctx, *flagCustomersAdminAddress, orig.CustomerID); err != nil {
+		err = suite.step("attemptCustomerApproval (originator)", func() error {
+			return attemptCustomerApproval(ctx, *flagCustomersAdminAddress, orig.CustomerID)
+		})
+		if err != nil {
 			errLogger("FAILURE: %v", err)
 			return nil
 		} else {
@@ -427,14 +708,22 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	}
 
 	// Create Receiver Account
-	receiverAcct, err := createAccount(ctx, api, user, "to account", "")
+	var receiverAcct *moov.Account
+	err = suite.step("createAccount (receiver)", func() (err error) {
+		receiverAcct, err = createAccount(ctx, api, user, "to account", "")
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
 	}
 
 	// Create Receiver Depository
-	receiverDep, err := createDepository(ctx, api, user, receiverAcct)
+	var receiverDep moov.Depository
+	err = suite.step("createDepository (receiver)", func() (err error) {
+		receiverDep, err = createDepository(ctx, api, user, receiverAcct)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
@@ -442,7 +731,11 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	debugLogger("SUCCESS: Created Receiver Depository (id=%s) for user", receiverDep.ID)
 
 	// Create Receiver
-	receiver, err := createReceiver(ctx, api, user, featureFlags, receiverDep.ID)
+	var receiver moov.Receiver
+	err = suite.step("createReceiver", func() (err error) {
+		receiver, err = createReceiver(ctx, api, user, featureFlags, receiverDep.ID)
+		return
+	})
 	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
@@ -450,7 +743,10 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	debugLogger("SUCCESS: Created Receiver (id=%s) for user", receiver.ID)
 
 	if !featureFlags.CustomersCallsDisabled {
-		if err := attemptCustomerApproval(ctx, *flagCustomersAdminAddress, receiver.CustomerID); err != nil {
+		err = suite.step("attemptCustomerApproval (receiver)", func() error {
+			return attemptCustomerApproval(ctx, *flagCustomersAdminAddress, receiver.CustomerID)
+		})
+		if err != nil {
 			errLogger("FAILURE: %v", err)
 			return nil
 		} else {
@@ -458,36 +754,68 @@ func iterate(ctx context.Context, requestID string) *iteration {
 		}
 	}
 
-	// Create Transfer
-	tx, err := createTransfer(ctx, api, receiver, orig, amount(), user.ID)
-	if err != nil {
-		errLogger("FAILURE: %v", err)
-		return nil
-	}
-	debugLogger("SUCCESS: Created %s transfer (id=%s) for user", tx.Amount, tx.ID)
-
-	// Verify the Transaction was posted
-	if !featureFlags.AccountsCallsDisabled {
-		if err := checkTransactions(ctx, api, origAcct.ID, user, tx.Amount); err != nil {
-			errLogger("FAILURE: %v", err)
-			return nil
+	// Create a Transfer for each SEC code and direction
+	secCodes, _ := parseACHTypes(*flagACHType)
+	types, _ := parseTransferTypes(*flagTransferType)
+	kinds := transferKinds(secCodes, types)
+	var transfers []moov.Transfer
+	for _, kind := range kinds {
+		kind := kind
+		stepName := "createTransfer"
+		if len(kinds) > 1 {
+			stepName = fmt.Sprintf("createTransfer (%s)", kind)
 		}
-		if err := checkTransactions(ctx, api, receiverAcct.ID, user, tx.Amount); err != nil {
+		var tx moov.Transfer
+		err = suite.step(stepName, func() (err error) {
+			tx, err = createTransfer(ctx, api, receiver, orig, amount(), kind, user.ID)
+			return
+		})
+		if err != nil {
 			errLogger("FAILURE: %v", err)
 			return nil
 		}
+		debugLogger("SUCCESS: Created %s %s transfer (id=%s) for user", tx.Amount, kind, tx.ID)
+		transfers = append(transfers, tx)
+	}
+
+	// Verify the Transactions were posted with the debit and credit on the right accounts
+	if !featureFlags.AccountsCallsDisabled {
+		for i := range transfers {
+			tx := transfers[i]
+			origPurpose, receiverPurpose := transactionPurposes(tx.TransferType)
+			err = suite.step("checkTransactions (originator)", func() error {
+				return checkTransactions(ctx, api, origAcct.ID, user, tx.Amount, origPurpose)
+			})
+			if err != nil {
+				errLogger("FAILURE: %v", err)
+				return nil
+			}
+			err = suite.step("checkTransactions (receiver)", func() error {
+				return checkTransactions(ctx, api, receiverAcct.ID, user, tx.Amount, receiverPurpose)
+			})
+			if err != nil {
+				errLogger("FAILURE: %v", err)
+				return nil
+			}
+		}
 		debugLogger("SUCCESS: Matched transactions on accounts")
 	}
 
 	// Attempt a Failed login
-	if err := attemptFailedLogin(ctx, api); err != nil {
+	err = suite.step("attemptFailedLogin", func() error {
+		return attemptFailedLogin(ctx, api)
+	})
+	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
 	}
 	debugLogger("SUCCESS: invalid login credentials were rejected")
 
 	// Attempt a Failed OAuth2 auth check
-	if err := attemptFailedOAuth2Login(ctx, api); err != nil {
+	err = suite.step("attemptFailedOAuth2Login", func() error {
+		return attemptFailedOAuth2Login(ctx, api)
+	})
+	if err != nil {
 		errLogger("FAILURE: %v", err)
 		return nil
 	}
@@ -498,15 +826,18 @@ func iterate(ctx context.Context, requestID string) *iteration {
 	return &iteration{
 		user:                 user,
 		oauthToken:           *oauthToken,
+		featureFlags:         featureFlags,
 		requestID:            requestID,
 		userID:               user.ID,
+		gateway:              gateway,
 		originator:           orig,
 		originatorAccount:    origAcct,
 		originatorDepository: origDep,
 		receiver:             receiver,
 		receiverAccount:      receiverAcct,
 		receiverDepository:   receiverDep,
-		transfer:             tx,
+		transfer:             transfers[0],
+		transfers:            transfers,
 	}
 }
 
@@ -0,0 +1,88 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/metrics/prometheus"
+	"github.com/moov-io/api/cmd/apitest/local"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+		Name:    "apitest_http_request_duration_seconds",
+		Help:    "Histogram of HTTP request durations to Moov services",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"service", "operation", "status"})
+
+	requestErrors = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Name: "apitest_http_request_errors",
+		Help: "Counter of failed HTTP requests (network errors and 4xx/5xx responses) to Moov services",
+	}, []string{"service", "operation", "status"})
+)
+
+// metricsTransport records the latency and status of every HTTP request made to Moov's API.
+//
+// It needs to wrap local.Transport (rather than be wrapped by it) as routes are labeled from
+// the production /v1/$app/... paths.
+type metricsTransport struct {
+	underlying http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service, operation := requestLabels(req)
+
+	start := time.Now()
+	resp, err := t.underlying.RoundTrip(req)
+
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	requestDuration.With("service", service, "operation", operation, "status", status).Observe(time.Since(start).Seconds())
+	if err != nil || (resp != nil && resp.StatusCode >= 400) {
+		requestErrors.With("service", service, "operation", operation, "status", status).Add(1)
+	}
+	return resp, err
+}
+
+// requestLabels returns the Moov service handling req and a low cardinality operation name
+// (e.g. "GET /ach/transfers/{id}") built from the request's path.
+func requestLabels(req *http.Request) (string, string) {
+	// Each route looks like /v1/$app/... which mirrors local.Transport's routing
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" {
+		return "unknown", req.Method + " " + local.NormalizePath(req.URL.Path)
+	}
+	parts = parts[1:]
+
+	service := strings.ToLower(parts[0])
+	switch service {
+	case "ach":
+		if len(parts) > 1 {
+			switch strings.ToLower(parts[1]) {
+			case "depositories", "gateways", "originators", "receivers", "transfers":
+				service = "paygate"
+			}
+		}
+	case "oauth2", "users":
+		service = "auth"
+	case "gl":
+		service = "accounts"
+	case "customers":
+		if len(parts) >= 3 && strings.EqualFold(parts[2], "accounts") {
+			service = "accounts"
+		}
+	case "ofac":
+		service = "watchman"
+	}
+
+	return service, req.Method + " " + strings.TrimPrefix(local.NormalizePath(req.URL.Path), "/v1")
+}
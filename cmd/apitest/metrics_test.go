@@ -0,0 +1,41 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestMetrics__requestLabels(t *testing.T) {
+	cases := []struct {
+		method, url        string
+		service, operation string
+	}{
+		{"GET", "https://api.moov.io/v1/ach/ping", "ach", "GET /ach/ping"},
+		{"POST", "https://api.moov.io/v1/ach/files/create", "ach", "POST /ach/files/create"},
+		{"GET", "https://api.moov.io/v1/ach/transfers/6d1a4c2ab6bbd1bc1f2a1f2d0d5a8b6d7e3b0f43/events", "paygate", "GET /ach/transfers/{id}/events"},
+		{"POST", "https://api.moov.io/v1/ach/depositories/abc123/micro-deposits/confirm", "paygate", "POST /ach/depositories/{id}/micro-deposits/confirm"},
+		{"POST", "https://api.moov.io/v1/users/create", "auth", "POST /users/create"},
+		{"POST", "https://api.moov.io/v1/oauth2/token", "auth", "POST /oauth2/token"},
+		{"GET", "https://api.moov.io/v1/accounts/search?number=123", "accounts", "GET /accounts/search"},
+		{"GET", "https://api.moov.io/v1/customers/a1b2c3/accounts", "accounts", "GET /customers/{id}/accounts"},
+		{"PUT", "https://api.moov.io/v1/customers/a1b2c3/status", "customers", "PUT /customers/{id}/status"},
+		{"GET", "https://api.moov.io/v1/fed/ach/search", "fed", "GET /fed/ach/search"},
+		{"GET", "https://api.moov.io/v1/watchman/ofac/sdn/2681", "watchman", "GET /watchman/ofac/sdn/{id}"},
+		{"GET", "http://localhost:8080/ping", "unknown", "GET /ping"},
+		{"PUT", "http://localhost:9097/customers/6d1a4c2ab6bbd1bc1f2a1f2d0d5a8b6d7e3b0f43/status", "unknown", "PUT /customers/{id}/status"},
+	}
+	for i := range cases {
+		req, err := http.NewRequest(cases[i].method, cases[i].url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		service, operation := requestLabels(req)
+		if service != cases[i].service || operation != cases[i].operation {
+			t.Errorf("%s: got service=%s operation=%s", cases[i].url, service, operation)
+		}
+	}
+}
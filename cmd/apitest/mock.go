@@ -0,0 +1,49 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/moov-io/api/cmd/apitest/mock"
+)
+
+var (
+	flagMock = flag.Bool("mock", false, "Run against an in-memory mock of the Moov API instead of real services")
+)
+
+// startMockServer serves a mock.Server on a random local port and points apitest's
+// API and admin addresses at it.
+func startMockServer() error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("mock server: %v", err)
+	}
+	srv := mock.NewServer()
+	go func() {
+		if err := http.Serve(ln, srv); err != nil {
+			log.Printf("ERROR: mock server: %v", err)
+		}
+	}()
+
+	// Write merged files for -verify-transfers.dir and read returns from -returns.inbound-dir
+	if *flagVerifyTransfers != "" || *flagReturnsInboundDir != "" {
+		go srv.RunCutoffs(*flagVerifyTransfers, *flagReturnsInboundDir, time.Second)
+	}
+
+	address := fmt.Sprintf("http://%s", ln.Addr().String())
+	*flagApiAddress = address
+	*flagPaygateAdminAddress = address
+	*flagCustomersAdminAddress = address
+	*flagWatchmanAdminAddress = address
+
+	log.Printf("INFO: started mock Moov API on %s", address)
+	return nil
+}
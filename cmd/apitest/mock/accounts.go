@@ -0,0 +1,198 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultRoutingNumber = "121042882"
+
+	// microDepositAccountNumber is the account paygate sends micro-deposits from. It's shared
+	// by every user so it can be found from searches.
+	microDepositAccountNumber = "123"
+)
+
+type account struct {
+	moov.Account
+	userID string
+}
+
+func (s *Server) addAccountsRoutes(r *mux.Router) {
+	r.Methods("POST").Path("/v1/accounts").HandlerFunc(s.authenticated(s.createAccount))
+	r.Methods("GET").Path("/v1/accounts/search").HandlerFunc(s.authenticated(s.searchAccounts))
+	r.Methods("POST").Path("/v1/accounts/transactions").HandlerFunc(s.authenticated(s.createTransaction))
+	r.Methods("GET").Path("/v1/accounts/{accountID}/transactions").HandlerFunc(s.authenticated(s.getAccountTransactions))
+}
+
+func (s *Server) createAccount(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateAccount
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.CustomerID == "" || req.Name == "" || req.Type == "" {
+		problem(w, http.StatusBadRequest, "missing customerID, name or type")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	number := req.Number
+	if number == "" {
+		number = fmt.Sprintf("%d", 1e9+s.random.Int63n(9e9))
+	}
+	if s.findAccount(number, defaultRoutingNumber) != nil {
+		problem(w, http.StatusBadRequest, "account number %s already exists", number)
+		return
+	}
+	masked := number
+	if len(masked) > 4 {
+		masked = masked[len(masked)-4:]
+	}
+	acct := &account{
+		Account: moov.Account{
+			ID:                  newID(),
+			CustomerID:          req.CustomerID,
+			Name:                req.Name,
+			AccountNumber:       number,
+			AccountNumberMasked: masked,
+			RoutingNumber:       defaultRoutingNumber,
+			Status:              "open",
+			Type:                req.Type,
+			CreatedAt:           time.Now(),
+			LastModified:        time.Now(),
+			Balance:             req.Balance,
+			BalanceAvailable:    req.Balance,
+		},
+		userID: userID,
+	}
+	s.accounts[acct.ID] = acct
+
+	writeJSON(w, http.StatusOK, acct.Account)
+}
+
+// findAccount returns the account for a number and routing number. Callers must hold s.mu.
+func (s *Server) findAccount(number, routingNumber string) *account {
+	for _, acct := range s.accounts {
+		if acct.AccountNumber == number && acct.RoutingNumber == routingNumber {
+			return acct
+		}
+	}
+	return nil
+}
+
+// postTransaction records lines and updates each account's balance. Callers must hold s.mu.
+func (s *Server) postTransaction(lines []moov.TransactionLine) {
+	for _, line := range lines {
+		acct, exists := s.accounts[line.AccountID]
+		if !exists {
+			continue
+		}
+		amount := int32(line.Amount)
+		if strings.EqualFold(line.Purpose, "ACHDebit") {
+			amount = -amount
+		}
+		acct.Balance += amount
+		acct.BalanceAvailable += amount
+		acct.LastModified = time.Now()
+	}
+	s.transactions = append(s.transactions, &moov.Transaction{
+		ID:        newID(),
+		Timestamp: time.Now(),
+		Lines:     lines,
+	})
+}
+
+func (s *Server) searchAccounts(w http.ResponseWriter, r *http.Request, userID string) {
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := make([]moov.Account, 0)
+	for _, acct := range s.accounts {
+		if acct.userID != userID && acct.AccountNumber != microDepositAccountNumber {
+			continue
+		}
+		if v := q.Get("number"); v != "" && v != acct.AccountNumber {
+			continue
+		}
+		if v := q.Get("routingNumber"); v != "" && v != acct.RoutingNumber {
+			continue
+		}
+		if v := q.Get("type"); v != "" && !strings.EqualFold(v, acct.Type) {
+			continue
+		}
+		if v := q.Get("customerID"); v != "" && v != acct.CustomerID {
+			continue
+		}
+		accounts = append(accounts, acct.Account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].CreatedAt.Before(accounts[j].CreatedAt) })
+
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+func (s *Server) getAccountTransactions(w http.ResponseWriter, r *http.Request, userID string) {
+	accountID := mux.Vars(r)["accountID"]
+	limit := 25
+	if v, err := strconv.ParseFloat(r.URL.Query().Get("limit"), 64); err == nil && v > 0 {
+		limit = int(v)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if acct, exists := s.accounts[accountID]; !exists || acct.userID != userID {
+		problem(w, http.StatusNotFound, "account not found")
+		return
+	}
+	transactions := make([]moov.Transaction, 0)
+	for i := len(s.transactions) - 1; i >= 0 && len(transactions) < limit; i-- { // newest first
+		for _, line := range s.transactions[i].Lines {
+			if line.AccountID == accountID {
+				transactions = append(transactions, *s.transactions[i])
+				break
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, transactions)
+}
+
+// createTransaction posts lines which must only be against the user's accounts.
+func (s *Server) createTransaction(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateTransaction
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.Lines) == 0 {
+		problem(w, http.StatusBadRequest, "missing transaction lines")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, line := range req.Lines {
+		if acct, exists := s.accounts[line.AccountID]; !exists || acct.userID != userID {
+			problem(w, http.StatusNotFound, "account=%s not found", line.AccountID)
+			return
+		}
+	}
+	s.postTransaction(req.Lines)
+
+	writeJSON(w, http.StatusOK, s.transactions[len(s.transactions)-1])
+}
@@ -0,0 +1,408 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/moov-io/ach"
+	achserver "github.com/moov-io/ach/server"
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+)
+
+// depositoryReturnCodes are the return codes paygate rejects the receiver's depository for, as
+// the account can't receive any more entries.
+var depositoryReturnCodes = map[string]bool{
+	"R02": true, "R03": true, "R04": true, "R07": true, "R10": true,
+	"R14": true, "R15": true, "R16": true, "R20": true,
+}
+
+// addACHRoutes serves the ACH Files API (/v1/ach/files) with moov-io/ach's own handler and in-memory
+// repository, which also holds the files of processed transfers.
+func (s *Server) addACHRoutes(r *mux.Router) {
+	handler := http.StripPrefix("/v1/ach", achserver.MakeHTTPHandler(achserver.NewService(s.achRepo), s.achRepo, kitlog.NewNopLogger()))
+	r.PathPrefix("/v1/ach/files").Handler(s.authenticated(func(w http.ResponseWriter, r *http.Request, _ string) {
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// newACHFile builds the NACHA file paygate would upload for xfer. It has one batch of xfer's SEC
+// code with one entry, which credits the receiver's account for pushes and debits it for pulls.
+// Callers must hold s.mu.
+func (s *Server) newACHFile(xfer *transfer) (*ach.File, error) {
+	cents, err := parseAmount(xfer.Amount)
+	if err != nil {
+		return nil, err
+	}
+	origDep, recDep := s.depositories[xfer.OriginatorDepository], s.depositories[xfer.ReceiverDepository]
+	if origDep == nil || recDep == nil {
+		return nil, errors.New("depository not found")
+	}
+	orig := s.originators[xfer.Originator]
+	if orig == nil {
+		return nil, errors.New("originator not found")
+	}
+	now := time.Now()
+	s.traceNumbers++
+
+	fh := ach.NewFileHeader()
+	fh.ID = newID()
+	fh.ImmediateOrigin = origDep.RoutingNumber
+	fh.ImmediateOriginName = truncate(origDep.BankName, 23)
+	fh.ImmediateDestination = recDep.RoutingNumber
+	fh.ImmediateDestinationName = truncate(recDep.BankName, 23)
+	fh.FileCreationDate = now.Format("060102")
+	fh.FileCreationTime = now.Format("1504")
+
+	file := ach.NewFile()
+	file.ID = fh.ID
+	file.SetHeader(fh)
+	if strings.EqualFold(xfer.StandardEntryClassCode, ach.IAT) {
+		batch := newIATBatch(xfer, origDep, recDep, orig.Identification, cents, s.traceNumbers, now)
+		if err := batch.Create(); err != nil {
+			return nil, err
+		}
+		file.AddIATBatch(batch)
+	} else {
+		batch, err := newBatch(xfer, origDep, recDep, orig.Identification, cents, s.traceNumbers, now)
+		if err != nil {
+			return nil, err
+		}
+		if err := batch.Create(); err != nil {
+			return nil, err
+		}
+		file.AddBatch(batch)
+	}
+	if err := file.Create(); err != nil {
+		return nil, err
+	}
+	return file, file.Validate()
+}
+
+func newBatch(xfer *transfer, origDep, recDep *depository, companyID string, cents, seq int, now time.Time) (ach.Batcher, error) {
+	pull := strings.EqualFold(xfer.TransferType, "pull")
+	odfi := origDep.RoutingNumber[:8]
+
+	bh := ach.NewBatchHeader()
+	bh.ServiceClassCode = ach.CreditsOnly
+	if pull {
+		bh.ServiceClassCode = ach.DebitsOnly
+	}
+	bh.CompanyName = truncate(origDep.Holder, 16)
+	bh.CompanyIdentification = truncate(companyID, 10)
+	bh.StandardEntryClassCode = strings.ToUpper(xfer.StandardEntryClassCode)
+	bh.CompanyEntryDescription = truncate(xfer.Description, 10)
+	bh.EffectiveEntryDate = effectiveDate(xfer, now)
+	bh.ODFIIdentification = odfi
+
+	ed := ach.NewEntryDetail()
+	ed.TransactionCode = transactionCode(recDep.Type, pull)
+	ed.SetRDFI(recDep.RoutingNumber)
+	ed.DFIAccountNumber = recDep.AccountNumber
+	ed.Amount = cents
+	ed.IdentificationNumber = truncate(xfer.ID, 15)
+	ed.IndividualName = truncate(recDep.Holder, 22)
+	ed.SetTraceNumber(odfi, seq)
+	ed.Category = ach.CategoryForward
+
+	switch bh.StandardEntryClassCode {
+	case ach.TEL:
+		ed.DiscretionaryData = paymentType(xfer.TELDetail.PaymentType)
+	case ach.WEB:
+		ed.DiscretionaryData = paymentType(xfer.WEBDetail.PaymentType)
+	}
+	batch, err := ach.NewBatch(bh)
+	if err != nil {
+		return nil, err
+	}
+	batch.AddEntry(ed)
+	return batch, nil
+}
+
+func newIATBatch(xfer *transfer, origDep, recDep *depository, companyID string, cents, seq int, now time.Time) ach.IATBatch {
+	pull := strings.EqualFold(xfer.TransferType, "pull")
+	odfi := origDep.RoutingNumber[:8]
+	detail := xfer.IATDetail
+
+	bh := ach.NewIATBatchHeader()
+	bh.ServiceClassCode = ach.CreditsOnly
+	if pull {
+		bh.ServiceClassCode = ach.DebitsOnly
+	}
+	bh.ForeignExchangeIndicator = "FF"
+	bh.ForeignExchangeReferenceIndicator = 3
+	bh.ISODestinationCountryCode = detail.ReceiverCountryCode
+	bh.OriginatorIdentification = truncate(companyID, 10)
+	bh.StandardEntryClassCode = ach.IAT
+	bh.CompanyEntryDescription = truncate(xfer.Description, 10)
+	bh.ISOOriginatingCurrencyCode = "USD"
+	bh.ISODestinationCurrencyCode = "USD"
+	bh.ODFIIdentification = odfi
+	bh.EffectiveEntryDate = effectiveDate(xfer, now)
+
+	ed := ach.NewIATEntryDetail()
+	ed.TransactionCode = transactionCode(recDep.Type, pull)
+	ed.SetRDFI(recDep.RoutingNumber)
+	ed.AddendaRecords = 7
+	ed.DFIAccountNumber = recDep.AccountNumber
+	ed.Amount = cents
+	ed.SetTraceNumber(odfi, seq)
+	ed.Category = ach.CategoryForward
+
+	ed.Addenda10 = ach.NewAddenda10()
+	ed.Addenda10.TransactionTypeCode = "ANN"
+	ed.Addenda10.ForeignPaymentAmount = cents
+	ed.Addenda10.Name = truncate(detail.ReceiverName, 35)
+	ed.Addenda10.EntryDetailSequenceNumber = 1
+
+	ed.Addenda11 = ach.NewAddenda11()
+	ed.Addenda11.OriginatorName = truncate(detail.OriginatorName, 35)
+	ed.Addenda11.OriginatorStreetAddress = truncate(detail.OriginatorAddress, 35)
+	ed.Addenda11.EntryDetailSequenceNumber = 1
+
+	ed.Addenda12 = ach.NewAddenda12()
+	ed.Addenda12.OriginatorCityStateProvince = fmt.Sprintf("%s*%s\\", detail.OriginatorCity, detail.OriginatorState)
+	ed.Addenda12.OriginatorCountryPostalCode = fmt.Sprintf("%s*%s\\", detail.OriginatorCountryCode, detail.OriginatorPostalCode)
+	ed.Addenda12.EntryDetailSequenceNumber = 1
+
+	ed.Addenda13 = ach.NewAddenda13()
+	ed.Addenda13.ODFIName = truncate(detail.ODFIName, 35)
+	ed.Addenda13.ODFIIDNumberQualifier = detail.ODFIIDNumberQualifier
+	ed.Addenda13.ODFIIdentification = detail.ODFIIdentification
+	ed.Addenda13.ODFIBranchCountryCode = detail.ODFIBranchCurrencyCode
+	ed.Addenda13.EntryDetailSequenceNumber = 1
+
+	ed.Addenda14 = ach.NewAddenda14()
+	ed.Addenda14.RDFIName = truncate(detail.RDFIName, 35)
+	ed.Addenda14.RDFIIDNumberQualifier = detail.RDFIIDNumberQualifier
+	ed.Addenda14.RDFIIdentification = detail.RDFIIdentification
+	ed.Addenda14.RDFIBranchCountryCode = detail.RDFIBranchCurrencyCode
+	ed.Addenda14.EntryDetailSequenceNumber = 1
+
+	ed.Addenda15 = ach.NewAddenda15()
+	ed.Addenda15.ReceiverIDNumber = truncate(xfer.Receiver, 15)
+	ed.Addenda15.ReceiverStreetAddress = truncate(detail.ReceiverAddress, 35)
+	ed.Addenda15.EntryDetailSequenceNumber = 1
+
+	ed.Addenda16 = ach.NewAddenda16()
+	ed.Addenda16.ReceiverCityStateProvince = fmt.Sprintf("%s*%s\\", detail.ReceiverCity, detail.ReceiverState)
+	ed.Addenda16.ReceiverCountryPostalCode = fmt.Sprintf("%s*%s\\", detail.ReceiverCountryCode, detail.ReceiverPostalCode)
+	ed.Addenda16.EntryDetailSequenceNumber = 1
+
+	batch := ach.NewIATBatch(bh)
+	batch.AddEntry(ed)
+	return batch
+}
+
+// transactionCode returns the NACHA code which credits (or debits for pulls) an account type.
+func transactionCode(accountType string, pull bool) int {
+	if strings.EqualFold(accountType, "savings") {
+		if pull {
+			return ach.SavingsDebit
+		}
+		return ach.SavingsCredit
+	}
+	if pull {
+		return ach.CheckingDebit
+	}
+	return ach.CheckingCredit
+}
+
+// paymentType returns the discretionary data code of a TEL or WEB payment type.
+func paymentType(v string) string {
+	if strings.EqualFold(v, "recurring") {
+		return "R"
+	}
+	return "S"
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// RunCutoffs stands in for paygate's cutoff and inbound file processing. Every interval pending
+// transfers are processed with their ACH files written into outboundDir, then each file in
+// inboundDir is read for returns and NOCs of those transfers and removed. Either directory can be
+// empty to skip it. RunCutoffs never returns.
+func (s *Server) RunCutoffs(outboundDir, inboundDir string, interval time.Duration) {
+	s.mu.Lock()
+	s.outboundDir = outboundDir
+	s.mu.Unlock()
+
+	for range time.Tick(interval) {
+		s.mu.Lock()
+		for _, xfer := range s.transfers {
+			if xfer.Status == moov.PENDING {
+				s.processTransfer(xfer)
+			}
+		}
+		if inboundDir != "" {
+			if err := s.readInboundDir(inboundDir); err != nil {
+				log.Printf("ERROR: mock: inbound files: %v", err)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// writeOutboundFile saves file in s.outboundDir, like paygate's merged files. Callers must hold s.mu.
+func (s *Server) writeOutboundFile(file *ach.File) error {
+	if s.outboundDir == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := ach.NewWriter(&buf).Write(file); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.outboundDir, file.ID+".ach"), buf.Bytes(), 0644)
+}
+
+// readInboundDir applies the returns and NOCs of each file in dir then removes it. Callers must hold s.mu.
+func (s *Server) readInboundDir(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		fd, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		file, err := ach.NewReader(fd).Read()
+		fd.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", path, err)
+		}
+		for _, batch := range file.Batches {
+			for _, entry := range batch.GetEntries() {
+				switch {
+				case entry.Addenda99 != nil:
+					s.returnTransfer(entry.Addenda99)
+				case entry.Addenda98 != nil:
+					s.correctDepository(entry.Addenda98)
+				}
+			}
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) findTransferByTrace(traceNumber string) *transfer {
+	for _, xfer := range s.transfers {
+		if xfer.traceNumber != "" && xfer.traceNumber == traceNumber {
+			return xfer
+		}
+	}
+	return nil
+}
+
+// returnTransfer fails the transfer of a return entry and rejects its receiver depository for codes
+// where the account can't be used again. Callers must hold s.mu.
+func (s *Server) returnTransfer(addenda *ach.Addenda99) {
+	xfer := s.findTransferByTrace(addenda.OriginalTrace)
+	if xfer == nil {
+		log.Printf("ERROR: mock: no transfer for returned trace number %s", addenda.OriginalTrace)
+		return
+	}
+	code := addenda.ReturnCodeField()
+	if code == nil {
+		log.Printf("ERROR: mock: unknown return code %s for transfer %s", addenda.ReturnCode, xfer.ID)
+		return
+	}
+	xfer.Status = moov.FAILED
+	xfer.ReturnCode = moov.ReturnCode{
+		Code:        code.Code,
+		Reason:      code.Reason,
+		Description: code.Description,
+	}
+	xfer.failure = fmt.Sprintf("returned with %s: %s", code.Code, code.Reason)
+	xfer.events = append(xfer.events, moov.Event{
+		ID:       newID(),
+		Topic:    "Transfer returned",
+		Message:  fmt.Sprintf("Returned with %s (%s)", code.Code, code.Reason),
+		Type:     "TransferEvent",
+		Resource: xfer.ID,
+		Created:  time.Now(),
+	})
+	if dep := s.depositories[xfer.ReceiverDepository]; dep != nil && depositoryReturnCodes[code.Code] {
+		dep.Status = moov.REJECTED
+		dep.Updated = time.Now()
+	}
+}
+
+// correctDepository updates the receiver depository of a NOC entry's transfer with its corrected
+// data. Callers must hold s.mu.
+func (s *Server) correctDepository(addenda *ach.Addenda98) {
+	xfer := s.findTransferByTrace(addenda.OriginalTrace)
+	if xfer == nil {
+		log.Printf("ERROR: mock: no transfer for NOC trace number %s", addenda.OriginalTrace)
+		return
+	}
+	dep := s.depositories[xfer.ReceiverDepository]
+	corrected := addenda.ParseCorrectedData()
+	if dep == nil || corrected == nil {
+		log.Printf("ERROR: mock: unable to apply %s NOC for transfer %s", addenda.ChangeCode, xfer.ID)
+		return
+	}
+	setString(&dep.AccountNumber, corrected.AccountNumber)
+	setString(&dep.RoutingNumber, corrected.RoutingNumber)
+	switch corrected.TransactionCode / 10 {
+	case 2:
+		dep.Type = "Checking"
+	case 3:
+		dep.Type = "Savings"
+	}
+	dep.Updated = time.Now()
+	xfer.events = append(xfer.events, moov.Event{
+		ID:       newID(),
+		Topic:    "Transfer NOC",
+		Message:  fmt.Sprintf("Corrected depository %s with %s", dep.ID, addenda.ChangeCode),
+		Type:     "TransferEvent",
+		Resource: xfer.ID,
+		Created:  time.Now(),
+	})
+}
+
+// traceNumber returns the trace number of file's first entry.
+func traceNumber(file *ach.File) string {
+	if len(file.IATBatches) > 0 && len(file.IATBatches[0].Entries) > 0 {
+		return file.IATBatches[0].Entries[0].TraceNumber
+	}
+	if len(file.Batches) > 0 && len(file.Batches[0].GetEntries()) > 0 {
+		return file.Batches[0].GetEntries()[0].TraceNumber
+	}
+	return ""
+}
+
+// effectiveDate returns the next banking day after now, or today for same day transfers.
+func effectiveDate(xfer *transfer, now time.Time) string {
+	if xfer.SameDay {
+		return now.Format("060102")
+	}
+	return base.NewTime(now).AddBankingDay(1).Format("060102")
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/gorilla/mux"
+)
+
+type user struct {
+	moov.User
+	password string
+}
+
+type client struct {
+	moov.OAuth2Client
+	userID string
+}
+
+func (s *Server) addAuthRoutes(r *mux.Router) {
+	r.Methods("POST").Path("/v1/users/create").HandlerFunc(s.createUser)
+	r.Methods("POST").Path("/v1/users/login").HandlerFunc(s.userLogin)
+	r.Methods("GET").Path("/v1/users/login").HandlerFunc(s.authenticated(s.checkUserLogin))
+
+	r.Methods("POST").Path("/v1/oauth2/client").HandlerFunc(s.authenticated(s.createOAuth2Client))
+	r.Methods("GET").Path("/v1/oauth2/clients").HandlerFunc(s.authenticated(s.getOAuth2Clients))
+	r.Methods("POST").Path("/v1/oauth2/token").HandlerFunc(s.createOAuth2Token)
+	r.Methods("GET").Path("/v1/oauth2/authorize").HandlerFunc(s.checkOAuthClientCredentials)
+}
+
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	var req moov.CreateUser
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Email == "" || req.Password == "" || req.FirstName == "" || req.LastName == "" || req.Phone == "" {
+		problem(w, http.StatusBadRequest, "missing user fields")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := strings.ToLower(req.Email)
+	if _, exists := s.emails[email]; exists {
+		problem(w, http.StatusBadRequest, "user already exists")
+		return
+	}
+	u := &user{
+		User: moov.User{
+			ID:         newID(),
+			Email:      req.Email,
+			FirstName:  req.FirstName,
+			LastName:   req.LastName,
+			Phone:      req.Phone,
+			CompanyUrl: req.CompanyUrl,
+			CreatedAt:  time.Now(),
+		},
+		password: req.Password,
+	}
+	s.users[u.ID] = u
+	s.emails[email] = u.ID
+
+	writeJSON(w, http.StatusOK, u.User)
+}
+
+func (s *Server) userLogin(w http.ResponseWriter, r *http.Request) {
+	var req moov.Login
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, exists := s.users[s.emails[strings.ToLower(req.Email)]]
+	if !exists || u.password != req.Password {
+		problem(w, http.StatusForbidden, "invalid credentials")
+		return
+	}
+
+	cookie := newID()
+	s.sessions[cookie] = u.ID
+	http.SetCookie(w, &http.Cookie{
+		Name:     "moov_auth",
+		Value:    cookie,
+		Path:     "/",
+		Expires:  time.Now().Add(30 * 24 * time.Hour),
+		HttpOnly: true,
+	})
+	writeJSON(w, http.StatusOK, u.User)
+}
+
+func (s *Server) checkUserLogin(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	u := s.users[userID]
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, u.User)
+}
+
+func (s *Server) createOAuth2Client(w http.ResponseWriter, r *http.Request, userID string) {
+	c := &client{
+		OAuth2Client: moov.OAuth2Client{
+			ClientId:     newID(),
+			ClientSecret: newID(),
+			Domain:       "https://moov.io",
+		},
+		userID: userID,
+	}
+
+	s.mu.Lock()
+	s.oauthClients[c.ClientId] = c
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, []moov.OAuth2Client{c.OAuth2Client})
+}
+
+func (s *Server) getOAuth2Clients(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clients := make([]moov.OAuth2Client, 0)
+	for _, c := range s.oauthClients {
+		if c.userID == userID {
+			clients = append(clients, c.OAuth2Client)
+		}
+	}
+	writeJSON(w, http.StatusOK, clients)
+}
+
+func (s *Server) createOAuth2Token(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("grant_type") != "client_credentials" {
+		problem(w, http.StatusBadRequest, "unsupported grant_type")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, exists := s.oauthClients[q.Get("client_id")]
+	if !exists || c.ClientSecret != q.Get("client_secret") {
+		problem(w, http.StatusForbidden, "invalid client credentials")
+		return
+	}
+	token := moov.OAuth2Token{
+		AccessToken: newID(),
+		ExpiresIn:   7200,
+		TokenType:   "Bearer",
+	}
+	s.tokens[token.AccessToken] = c.userID
+
+	writeJSON(w, http.StatusOK, token)
+}
+
+// checkOAuthClientCredentials only accepts OAuth2 access tokens, cookies are ignored.
+func (s *Server) checkOAuthClientCredentials(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	userID, exists := s.tokens[token]
+	s.mu.Unlock()
+
+	if token == "" || !exists {
+		problem(w, http.StatusForbidden, "invalid OAuth2 access token")
+		return
+	}
+	w.Header().Set("X-User-ID", userID)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/gorilla/mux"
+)
+
+type customer struct {
+	moov.Customer
+	userID string
+}
+
+func (s *Server) addCustomersRoutes(r *mux.Router) {
+	r.Methods("PUT").Path("/customers/{customerID}/status").HandlerFunc(s.updateCustomerStatus) // admin route
+
+	r.Methods("GET").Path("/v1/customers/{customerID}").HandlerFunc(s.authenticated(s.getCustomer))
+	r.Methods("GET").Path("/v1/customers/{customerID}/documents").HandlerFunc(s.authenticated(s.getCustomerDocuments))
+}
+
+// approvedCustomerStatus returns true for statuses paygate accepts for transfers (OFAC or higher).
+func approvedCustomerStatus(status string) bool {
+	switch strings.ToLower(status) {
+	case "ofac", "cip":
+		return true
+	}
+	return false
+}
+
+func (s *Server) updateCustomerStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status   string `json:"status"`
+		Comments string `json:"comments"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	switch strings.ToLower(req.Status) {
+	case "deceased", "rejected", "receiveonly", "verified", "ofac", "cip":
+	default:
+		problem(w, http.StatusBadRequest, "unknown status %q", req.Status)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cust, exists := s.customers[mux.Vars(r)["customerID"]]
+	if !exists {
+		problem(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	cust.Status = req.Status
+	cust.LastModified = time.Now()
+	w.WriteHeader(http.StatusOK)
+}
+
+// lookupCustomer returns the customer owned by userID. Callers must hold s.mu.
+func (s *Server) lookupCustomer(customerID, userID string) *customer {
+	if cust, exists := s.customers[customerID]; exists && cust.userID == userID {
+		return cust
+	}
+	return nil
+}
+
+func (s *Server) getCustomer(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cust := s.lookupCustomer(mux.Vars(r)["customerID"], userID)
+	if cust == nil {
+		problem(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, cust.Customer)
+}
+
+// getCustomerDocuments always returns an empty list as we don't store documents.
+func (s *Server) getCustomerDocuments(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lookupCustomer(mux.Vars(r)["customerID"], userID) == nil {
+		problem(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, []moov.Document{})
+}
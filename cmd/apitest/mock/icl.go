@@ -0,0 +1,329 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/gorilla/mux"
+)
+
+// addICLRoutes serves the Image Cash Letter files API (/v1/imagecashletter/files). Files are only
+// accepted as JSON and their contents are written as newline separated X9 (ASCII) records, without
+// any image records.
+func (s *Server) addICLRoutes(r *mux.Router) {
+	r.Methods("GET").Path("/v1/imagecashletter/files").HandlerFunc(s.authenticated(s.getICLFiles))
+	r.Methods("POST").Path("/v1/imagecashletter/files/create").HandlerFunc(s.authenticated(s.createICLFile))
+	r.Methods("GET").Path("/v1/imagecashletter/files/{fileID}").HandlerFunc(s.authenticated(s.getICLFile))
+	r.Methods("DELETE").Path("/v1/imagecashletter/files/{fileID}").HandlerFunc(s.authenticated(s.deleteICLFile))
+	r.Methods("GET").Path("/v1/imagecashletter/files/{fileID}/contents").HandlerFunc(s.authenticated(s.getICLFileContents))
+	r.Methods("GET").Path("/v1/imagecashletter/files/{fileID}/validate").HandlerFunc(s.authenticated(s.validateICLFile))
+	r.Methods("POST").Path("/v1/imagecashletter/files/{fileID}/cashLetters").HandlerFunc(s.authenticated(s.addICLCashLetter))
+	r.Methods("DELETE").Path("/v1/imagecashletter/files/{fileID}/cashLetters/{cashLetterID}").HandlerFunc(s.authenticated(s.deleteICLCashLetter))
+}
+
+func (s *Server) getICLFiles(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]moov.IclFile, 0, len(s.iclFiles))
+	for _, file := range s.iclFiles {
+		out = append(out, *file)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) createICLFile(w http.ResponseWriter, r *http.Request, _ string) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		problem(w, http.StatusBadRequest, "only JSON files can be created")
+		return
+	}
+	var file moov.IclFile
+	if !readJSON(w, r, &file) {
+		return
+	}
+	if file.ID == "" {
+		file.ID = newID()
+	}
+	createICLControls(&file)
+
+	s.mu.Lock()
+	s.iclFiles[file.ID] = &file
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, file)
+}
+
+func (s *Server) getICLFile(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.iclFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, file)
+}
+
+func (s *Server) deleteICLFile(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fileID := mux.Vars(r)["fileID"]
+	if s.iclFiles[fileID] == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	delete(s.iclFiles, fileID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getICLFileContents(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.iclFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strings.Join(x9Records(file), "\n") + "\n"))
+}
+
+func (s *Server) validateICLFile(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.iclFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	if err := validateICL(file); err != nil {
+		problem(w, http.StatusBadRequest, "invalid file: %v", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"error": nil})
+}
+
+func (s *Server) addICLCashLetter(w http.ResponseWriter, r *http.Request, _ string) {
+	var cashLetter moov.CashLetter
+	if !readJSON(w, r, &cashLetter) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.iclFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	if cashLetter.CashLetterHeader.ID == "" {
+		cashLetter.CashLetterHeader.ID = newID()
+	}
+	file.CashLetters = append(file.CashLetters, cashLetter)
+	createICLControls(file)
+	writeJSON(w, http.StatusOK, file)
+}
+
+func (s *Server) deleteICLCashLetter(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.iclFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	cashLetterID := mux.Vars(r)["cashLetterID"]
+	for i := range file.CashLetters {
+		if file.CashLetters[i].CashLetterHeader.ID == cashLetterID {
+			file.CashLetters = append(file.CashLetters[:i], file.CashLetters[i+1:]...)
+			createICLControls(file)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	}
+	problem(w, http.StatusNotFound, "cash letter not found")
+}
+
+// createICLControls fills in the bundle, cash letter and file controls of file like imagecashletter's
+// File.Create does.
+func createICLControls(file *moov.IclFile) {
+	var items, amount int32
+	for i := range file.CashLetters {
+		cl := &file.CashLetters[i]
+		var clItems, clAmount int32
+		for j := range cl.Bundles {
+			b := &cl.Bundles[j]
+			var bItems, bAmount, micrValid int32
+			for _, check := range b.Checks {
+				bItems++
+				bAmount += check.CheckDetail.ItemAmount
+				if check.CheckDetail.MICRValidIndicator == "1" {
+					micrValid += check.CheckDetail.ItemAmount
+				}
+			}
+			b.BundleControl.BundleItemsCount = bItems
+			b.BundleControl.BundleTotalAmount = bAmount
+			b.BundleControl.MicrValidTotalAmount = micrValid
+			clItems += bItems
+			clAmount += bAmount
+		}
+		cl.CashLetterControl.CashLetterBundleCount = int32(len(cl.Bundles))
+		cl.CashLetterControl.CashLetterItemsCount = clItems
+		cl.CashLetterControl.CashLetterTotalAmount = clAmount
+		items += clItems
+		amount += clAmount
+	}
+	file.FileControl.CashLetterCount = int32(len(file.CashLetters))
+	file.FileControl.TotalItemCount = items
+	file.FileControl.FileTotalAmount = amount
+	file.FileControl.TotalRecordCount = int32(len(x9Records(file)))
+}
+
+// validateICL checks the fields of file which x9Records needs.
+func validateICL(file *moov.IclFile) error {
+	fh := file.FileHeader
+	switch fh.StandardLevel {
+	case "03", "30", "35":
+	default:
+		return fmt.Errorf("invalid standardLevel %q", fh.StandardLevel)
+	}
+	if fh.TestFileIndicator != "T" && fh.TestFileIndicator != "P" {
+		return fmt.Errorf("invalid testFileIndicator %q", fh.TestFileIndicator)
+	}
+	if fh.ResendIndicator != "Y" && fh.ResendIndicator != "N" {
+		return fmt.Errorf("invalid resendIndicator %q", fh.ResendIndicator)
+	}
+	if !digits(fh.ImmediateOrigin, 9) || !digits(fh.ImmediateDestination, 9) {
+		return errors.New("immediateOrigin and immediateDestination must be routing numbers")
+	}
+	if len(file.CashLetters) == 0 {
+		return errors.New("no cash letters")
+	}
+	for _, cl := range file.CashLetters {
+		if cl.CashLetterHeader.CashLetterID == "" || cl.CashLetterHeader.CollectionTypeIndicator == "" {
+			return errors.New("cash letter is missing cashLetterID or collectionTypeIndicator")
+		}
+		for _, b := range cl.Bundles {
+			if len(b.Checks) == 0 {
+				return fmt.Errorf("bundle %s has no checks", b.BundleHeader.BundleID)
+			}
+			for _, check := range b.Checks {
+				cd := check.CheckDetail
+				if !digits(cd.PayorBankRoutingNumber, 8) || !digits(cd.PayorBankCheckDigit, 1) {
+					return fmt.Errorf("check %s has an invalid payorBankRoutingNumber", cd.ECEInstitutionItemSequenceNumber)
+				}
+				if cd.ItemAmount <= 0 {
+					return fmt.Errorf("check %s has an invalid itemAmount", cd.ECEInstitutionItemSequenceNumber)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func digits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// x9Records returns the 80 character X9.100-187 records of file: 01 (file header), 10 (cash letter
+// header), 20 (bundle header), 25 (check detail), 70 (bundle control), 90 (cash letter control)
+// and 99 (file control).
+func x9Records(file *moov.IclFile) []string {
+	fh := file.FileHeader
+	records := []string{
+		"01" + alpha(fh.StandardLevel, 2) + alpha(fh.TestFileIndicator, 1) + alpha(fh.ImmediateDestination, 9) +
+			alpha(fh.ImmediateOrigin, 9) + x9Date(fh.FileCreationDate) + alpha(fh.FileCreationTime, 4) +
+			alpha(fh.ResendIndicator, 1) + alpha(fh.ImmediateDestinationName, 18) + alpha(fh.ImmediateOriginName, 18) +
+			alpha(fh.FileIDModifier, 1) + alpha(fh.CountryCode, 2) + alpha(fh.UserField, 4) + alpha(fh.CompanionDocumentIndicator, 1),
+	}
+	for _, cl := range file.CashLetters {
+		ch := cl.CashLetterHeader
+		records = append(records, "10"+alpha(ch.CollectionTypeIndicator, 2)+alpha(ch.DestinationRoutingNumber, 9)+
+			alpha(ch.ECEInstitutionRoutingNumber, 9)+x9DateString(ch.CashLetterBusinessDate)+x9Date(ch.CashLetterCreationDate)+
+			alpha(ch.CashLetterCreationTime, 4)+alpha(ch.RecordTypeIndicator, 1)+alpha(ch.DocumentationTypeIndicator, 1)+
+			alpha(ch.CashLetterID, 8)+alpha(ch.OriginatorContactName, 14)+alpha(ch.OriginatorContactPhoneNumber, 10)+
+			alpha(ch.FedWorkType, 1)+alpha(ch.ReturnsIndicator, 1)+alpha(ch.UserField, 1)+alpha("", 1))
+
+		for _, b := range cl.Bundles {
+			bh := b.BundleHeader
+			records = append(records, "20"+alpha(bh.CollectionTypeIndicator, 2)+alpha(bh.DestinationRoutingNumber, 9)+
+				alpha(bh.ECEInstitutionRoutingNumber, 9)+x9Date(bh.BundleBusinessDate)+x9Date(bh.BundleCreationDate)+
+				alpha(bh.BundleID, 10)+alpha(bh.BundleSequenceNumber, 4)+alpha(bh.CycleNumber, 2)+alpha("", 9)+
+				alpha(bh.UserField, 5)+alpha("", 12))
+
+			for _, check := range b.Checks {
+				cd := check.CheckDetail
+				records = append(records, "25"+alpha(cd.AuxiliaryOnUs, 15)+alpha(cd.ExternalProcessingCode, 1)+
+					alpha(cd.PayorBankRoutingNumber, 8)+alpha(cd.PayorBankCheckDigit, 1)+alpha(cd.OnUs, 20)+
+					numeric(int64(cd.ItemAmount), 10)+alpha(cd.ECEInstitutionItemSequenceNumber, 15)+
+					alpha(cd.DocumentationTypeIndicator, 1)+alpha(cd.ReturnAcceptanceIndicator, 1)+
+					alpha(cd.MICRValidIndicator, 1)+alpha(cd.BOFDIndicator, 1)+numeric(0, 2)+
+					alpha(cd.CorrectionIndicator, 1)+alpha(cd.ArchiveTypeIndicator, 1))
+			}
+
+			bc := b.BundleControl
+			records = append(records, "70"+numeric(int64(bc.BundleItemsCount), 4)+numeric(int64(bc.BundleTotalAmount), 12)+
+				numeric(int64(bc.MicrValidTotalAmount), 12)+numeric(0, 5)+alpha(bc.UserField, 20)+alpha("", 1)+alpha("", 24))
+		}
+
+		cc := cl.CashLetterControl
+		records = append(records, "90"+numeric(int64(cc.CashLetterBundleCount), 6)+numeric(int64(cc.CashLetterItemsCount), 8)+
+			numeric(int64(cc.CashLetterTotalAmount), 14)+numeric(0, 9)+alpha(cc.ECEInstitutionName, 18)+
+			x9Date(cc.SettlementDate)+alpha("", 1)+alpha("", 14))
+	}
+	fc := file.FileControl
+	return append(records, "99"+numeric(int64(fc.CashLetterCount), 6)+numeric(int64(len(records)+1), 8)+
+		numeric(int64(fc.TotalItemCount), 8)+numeric(int64(fc.FileTotalAmount), 16)+alpha(fc.ImmediateOriginContactName, 14)+
+		alpha(fc.ImmediateOriginContactPhoneNumber, 10)+alpha(fc.CreditTotalIndicator, 1)+alpha("", 15))
+}
+
+func alpha(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s + strings.Repeat(" ", n-len(s))
+}
+
+func numeric(v int64, n int) string {
+	s := fmt.Sprintf("%0*d", n, v)
+	return s[len(s)-n:]
+}
+
+func x9Date(t time.Time) string {
+	if t.IsZero() {
+		return alpha("", 8)
+	}
+	return t.Format("20060102")
+}
+
+// x9DateString formats the RFC 3339 timestamps go-client sends for string typed dates.
+func x9DateString(s string) string {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return x9Date(t)
+	}
+	return alpha(s, 8)
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// savedResponse is written back for requests which reuse an X-Idempotency-Key.
+type savedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// idempotencyKey returns the key a POST, PUT or PATCH request is saved under, which is scoped
+// to the request's credentials and path. Other requests return an empty key.
+func idempotencyKey(r *http.Request) string {
+	switch r.Method {
+	case "POST", "PUT", "PATCH":
+	default:
+		return ""
+	}
+	key := r.Header.Get("X-Idempotency-Key")
+	if key == "" {
+		return ""
+	}
+	return strings.Join([]string{key, r.Method, r.URL.Path, r.Header.Get("Cookie"), r.Header.Get("Authorization")}, "\n")
+}
+
+// serveIdempotent replays the saved response for a reused X-Idempotency-Key or calls next and
+// saves its response.
+func (s *Server) serveIdempotent(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	key := idempotencyKey(r)
+	if key == "" {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	s.idempotencyMu.Lock()
+	defer s.idempotencyMu.Unlock()
+
+	if saved, exists := s.idempotent[key]; exists {
+		for k, v := range saved.header {
+			if _, exists := w.Header()[k]; !exists {
+				w.Header()[k] = v
+			}
+		}
+		w.WriteHeader(saved.status)
+		w.Write(saved.body)
+		return
+	}
+
+	rec := &responseRecorder{ResponseWriter: w}
+	next.ServeHTTP(rec, r)
+	s.idempotent[key] = &savedResponse{
+		status: rec.statusCode(),
+		header: w.Header().Clone(),
+		body:   rec.body.Bytes(),
+	}
+}
+
+// responseRecorder copies what's written to an http.ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
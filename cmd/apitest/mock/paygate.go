@@ -0,0 +1,900 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/gorilla/mux"
+)
+
+// secCodes are the Standard Entry Class codes paygate accepts on transfers
+var secCodes = map[string]bool{
+	ach.CCD: true,
+	ach.IAT: true,
+	ach.PPD: true,
+	ach.TEL: true,
+	ach.WEB: true,
+}
+
+type depository struct {
+	moov.Depository
+	userID string
+
+	// microDeposits are the amounts (in cents) credited by initiateMicroDeposits
+	microDeposits []int
+}
+
+type originator struct {
+	moov.Originator
+	userID string
+}
+
+type receiver struct {
+	moov.Receiver
+	userID string
+}
+
+type transfer struct {
+	moov.Transfer
+	userID string
+
+	events []moov.Event
+
+	// files are the IDs of ACH files created when the transfer was processed
+	files       []string
+	traceNumber string
+
+	// failure is why the transfer's file couldn't be created
+	failure string
+}
+
+func (s *Server) addPaygateRoutes(r *mux.Router) {
+	r.Methods("GET").Path("/features").HandlerFunc(s.getFeatures) // admin route
+
+	r.Methods("POST").Path("/v1/ach/gateways").HandlerFunc(s.authenticated(s.addGateway))
+	r.Methods("GET").Path("/v1/ach/gateways").HandlerFunc(s.authenticated(s.getGateways))
+
+	r.Methods("POST").Path("/v1/ach/depositories").HandlerFunc(s.authenticated(s.addDepository))
+	r.Methods("GET").Path("/v1/ach/depositories").HandlerFunc(s.authenticated(s.getDepositories))
+	r.Methods("GET").Path("/v1/ach/depositories/{depositoryID}").HandlerFunc(s.authenticated(s.getDepository))
+	r.Methods("PATCH").Path("/v1/ach/depositories/{depositoryID}").HandlerFunc(s.authenticated(s.updateDepository))
+	r.Methods("DELETE").Path("/v1/ach/depositories/{depositoryID}").HandlerFunc(s.authenticated(s.deleteDepository))
+	r.Methods("POST").Path("/v1/ach/depositories/{depositoryID}/micro-deposits").HandlerFunc(s.authenticated(s.initiateMicroDeposits))
+	r.Methods("POST").Path("/v1/ach/depositories/{depositoryID}/micro-deposits/confirm").HandlerFunc(s.authenticated(s.confirmMicroDeposits))
+
+	r.Methods("POST").Path("/v1/ach/originators").HandlerFunc(s.authenticated(s.addOriginator))
+	r.Methods("GET").Path("/v1/ach/originators").HandlerFunc(s.authenticated(s.getOriginators))
+	r.Methods("GET").Path("/v1/ach/originators/{originatorID}").HandlerFunc(s.authenticated(s.getOriginator))
+	r.Methods("PATCH").Path("/v1/ach/originators/{originatorID}").HandlerFunc(s.authenticated(s.updateOriginator))
+	r.Methods("DELETE").Path("/v1/ach/originators/{originatorID}").HandlerFunc(s.authenticated(s.deleteOriginator))
+
+	r.Methods("POST").Path("/v1/ach/receivers").HandlerFunc(s.authenticated(s.addReceiver))
+	r.Methods("GET").Path("/v1/ach/receivers").HandlerFunc(s.authenticated(s.getReceivers))
+	r.Methods("GET").Path("/v1/ach/receivers/{receiverID}").HandlerFunc(s.authenticated(s.getReceiver))
+	r.Methods("PATCH").Path("/v1/ach/receivers/{receiverID}").HandlerFunc(s.authenticated(s.updateReceiver))
+	r.Methods("DELETE").Path("/v1/ach/receivers/{receiverID}").HandlerFunc(s.authenticated(s.deleteReceiver))
+
+	r.Methods("POST").Path("/v1/ach/transfers").HandlerFunc(s.authenticated(s.addTransfer))
+	r.Methods("POST").Path("/v1/ach/transfers/batch").HandlerFunc(s.authenticated(s.addTransfers))
+	r.Methods("GET").Path("/v1/ach/transfers").HandlerFunc(s.authenticated(s.getTransfers))
+	r.Methods("GET").Path("/v1/ach/transfers/{transferID}").HandlerFunc(s.authenticated(s.getTransfer))
+	r.Methods("DELETE").Path("/v1/ach/transfers/{transferID}").HandlerFunc(s.authenticated(s.deleteTransfer))
+	r.Methods("GET").Path("/v1/ach/transfers/{transferID}/events").HandlerFunc(s.authenticated(s.getTransferEvents))
+	r.Methods("POST").Path("/v1/ach/transfers/{transferID}/files").HandlerFunc(s.authenticated(s.getTransferFiles))
+	r.Methods("POST").Path("/v1/ach/transfers/{transferID}/failed").HandlerFunc(s.authenticated(s.validateTransfer))
+
+	r.Methods("GET").Path("/v1/ach/events").HandlerFunc(s.authenticated(s.getEvents))
+	r.Methods("GET").Path("/v1/ach/events/{eventID}").HandlerFunc(s.authenticated(s.getEvent))
+}
+
+// getFeatures enables the Accounts and Customers calls so apitest runs its full flow.
+func (s *Server) getFeatures(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{
+		"accountsCallsDisabled":  false,
+		"customersCallsDisabled": false,
+	})
+}
+
+func (s *Server) addGateway(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateGateway
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Origin == "" || req.Destination == "" {
+		problem(w, http.StatusBadRequest, "missing origin or destination")
+		return
+	}
+	for _, routingNumber := range []string{req.Origin, req.Destination} {
+		if err := ach.CheckRoutingNumber(routingNumber); err != nil {
+			problem(w, http.StatusBadRequest, "invalid routing number %q: %v", routingNumber, err)
+			return
+		}
+	}
+	gateway := &moov.Gateway{
+		ID:              newID(),
+		Origin:          req.Origin,
+		OriginName:      req.OriginName,
+		Destination:     req.Destination,
+		DestinationName: req.DestinationName,
+		Created:         time.Now(),
+	}
+
+	s.mu.Lock()
+	s.gateways[userID] = gateway
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, gateway)
+}
+
+func (s *Server) getGateways(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	gateways := make([]moov.Gateway, 0)
+	if g, exists := s.gateways[userID]; exists {
+		gateways = append(gateways, *g)
+	}
+	writeJSON(w, http.StatusOK, gateways)
+}
+
+func (s *Server) addDepository(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateDepository
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.AccountNumber == "" || req.RoutingNumber == "" || req.Holder == "" {
+		problem(w, http.StatusBadRequest, "missing accountNumber, routingNumber or holder")
+		return
+	}
+	if err := ach.CheckRoutingNumber(req.RoutingNumber); err != nil {
+		problem(w, http.StatusBadRequest, "invalid routingNumber: %v", err)
+		return
+	}
+	dep := &depository{
+		Depository: moov.Depository{
+			ID:            newID(),
+			BankName:      req.BankName,
+			Holder:        req.Holder,
+			HolderType:    req.HolderType,
+			Type:          req.Type,
+			RoutingNumber: req.RoutingNumber,
+			AccountNumber: req.AccountNumber,
+			Status:        moov.UNVERIFIED,
+			Metadata:      req.Metadata,
+			Created:       time.Now(),
+			Updated:       time.Now(),
+		},
+		userID: userID,
+	}
+
+	s.mu.Lock()
+	s.depositories[dep.ID] = dep
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, dep.Depository)
+}
+
+func (s *Server) getDepositories(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deps := make([]moov.Depository, 0)
+	for _, dep := range s.depositories {
+		if dep.userID == userID {
+			deps = append(deps, dep.Depository)
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool { return deps[i].Created.Before(deps[j].Created) })
+	writeJSON(w, http.StatusOK, deps)
+}
+
+// lookupDepository returns the depository owned by userID. Callers must hold s.mu.
+func (s *Server) lookupDepository(depositoryID, userID string) *depository {
+	if dep, exists := s.depositories[depositoryID]; exists && dep.userID == userID {
+		return dep
+	}
+	return nil
+}
+
+func (s *Server) getDepository(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.lookupDepository(mux.Vars(r)["depositoryID"], userID)
+	if dep == nil {
+		problem(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, dep.Depository)
+}
+
+// updateDepository changes the non-empty fields of a depository. Changing the account or routing
+// number requires the depository be verified again.
+func (s *Server) updateDepository(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateDepository
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.lookupDepository(mux.Vars(r)["depositoryID"], userID)
+	if dep == nil {
+		problem(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	if (req.AccountNumber != "" && req.AccountNumber != dep.AccountNumber) || (req.RoutingNumber != "" && req.RoutingNumber != dep.RoutingNumber) {
+		dep.Status = moov.UNVERIFIED
+		dep.microDeposits = nil
+	}
+	setString(&dep.BankName, req.BankName)
+	setString(&dep.Holder, req.Holder)
+	setString(&dep.HolderType, req.HolderType)
+	setString(&dep.Type, req.Type)
+	setString(&dep.RoutingNumber, req.RoutingNumber)
+	setString(&dep.AccountNumber, req.AccountNumber)
+	setString(&dep.Metadata, req.Metadata)
+	dep.Updated = time.Now()
+
+	writeJSON(w, http.StatusOK, dep.Depository)
+}
+
+func (s *Server) deleteDepository(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.lookupDepository(mux.Vars(r)["depositoryID"], userID)
+	if dep == nil {
+		problem(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	delete(s.depositories, dep.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+// initiateMicroDeposits credits two small amounts to the depository's account (if we have it) from
+// the micro-deposit origination account, which is how paygate posts them into Accounts.
+func (s *Server) initiateMicroDeposits(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.lookupDepository(mux.Vars(r)["depositoryID"], userID)
+	if dep == nil {
+		problem(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	dep.microDeposits = []int{s.random.Intn(49) + 1, s.random.Intn(49) + 1}
+
+	if acct := s.findAccount(dep.AccountNumber, dep.RoutingNumber); acct != nil {
+		origin := s.findAccount(microDepositAccountNumber, dep.RoutingNumber)
+		for _, amount := range dep.microDeposits {
+			lines := []moov.TransactionLine{
+				{AccountID: acct.ID, Purpose: "ACHCredit", Amount: float32(amount)},
+			}
+			if origin != nil {
+				lines = append(lines, moov.TransactionLine{AccountID: origin.ID, Purpose: "ACHDebit", Amount: float32(amount)})
+			}
+			s.postTransaction(lines)
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) confirmMicroDeposits(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.Amounts
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dep := s.lookupDepository(mux.Vars(r)["depositoryID"], userID)
+	if dep == nil {
+		problem(w, http.StatusNotFound, "depository not found")
+		return
+	}
+	if len(dep.microDeposits) == 0 || len(req.Amounts) != len(dep.microDeposits) {
+		problem(w, http.StatusBadRequest, "micro-deposits not initiated or incorrect number of amounts")
+		return
+	}
+	remaining := append([]int(nil), dep.microDeposits...)
+	for _, amt := range req.Amounts {
+		cents, err := parseAmount(amt)
+		if err != nil {
+			problem(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		found := false
+		for i := range remaining {
+			if remaining[i] == cents {
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			problem(w, http.StatusBadRequest, "incorrect micro-deposit amounts")
+			return
+		}
+	}
+	dep.Status = moov.VERIFIED
+	dep.Updated = time.Now()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// newCustomer registers a Customer for userID which starts out unapproved like in Moov's Customers
+// service. Callers must hold s.mu.
+func (s *Server) newCustomer(userID string) string {
+	cust := &customer{
+		Customer: moov.Customer{
+			ID:           newID(),
+			Status:       "Unknown",
+			CreatedAt:    time.Now(),
+			LastModified: time.Now(),
+		},
+		userID: userID,
+	}
+	s.customers[cust.ID] = cust
+	return cust.ID
+}
+
+func (s *Server) addOriginator(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateOriginator
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.DefaultDepository == "" || req.Identification == "" {
+		problem(w, http.StatusBadRequest, "missing defaultDepository or identification")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lookupDepository(req.DefaultDepository, userID) == nil {
+		problem(w, http.StatusBadRequest, "depository not found")
+		return
+	}
+	orig := &originator{
+		Originator: moov.Originator{
+			ID:                newID(),
+			DefaultDepository: req.DefaultDepository,
+			Identification:    req.Identification,
+			CustomerID:        s.newCustomer(userID),
+			BirthDate:         req.BirthDate,
+			Address:           req.Address,
+			Metadata:          req.Metadata,
+			Created:           time.Now(),
+			Updated:           time.Now(),
+		},
+		userID: userID,
+	}
+	s.originators[orig.ID] = orig
+
+	writeJSON(w, http.StatusOK, orig.Originator)
+}
+
+func (s *Server) getOriginators(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	origs := make([]moov.Originator, 0)
+	for _, orig := range s.originators {
+		if orig.userID == userID {
+			origs = append(origs, orig.Originator)
+		}
+	}
+	sort.Slice(origs, func(i, j int) bool { return origs[i].Created.Before(origs[j].Created) })
+	writeJSON(w, http.StatusOK, origs)
+}
+
+// lookupOriginator returns the originator owned by userID. Callers must hold s.mu.
+func (s *Server) lookupOriginator(originatorID, userID string) *originator {
+	if orig, exists := s.originators[originatorID]; exists && orig.userID == userID {
+		return orig
+	}
+	return nil
+}
+
+func (s *Server) getOriginator(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orig := s.lookupOriginator(mux.Vars(r)["originatorID"], userID)
+	if orig == nil {
+		problem(w, http.StatusNotFound, "originator not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, orig.Originator)
+}
+
+func (s *Server) updateOriginator(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateOriginator
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orig := s.lookupOriginator(mux.Vars(r)["originatorID"], userID)
+	if orig == nil {
+		problem(w, http.StatusNotFound, "originator not found")
+		return
+	}
+	if req.DefaultDepository != "" && s.lookupDepository(req.DefaultDepository, userID) == nil {
+		problem(w, http.StatusBadRequest, "depository not found")
+		return
+	}
+	setString(&orig.DefaultDepository, req.DefaultDepository)
+	setString(&orig.Identification, req.Identification)
+	setString(&orig.Metadata, req.Metadata)
+	orig.Updated = time.Now()
+
+	writeJSON(w, http.StatusOK, orig.Originator)
+}
+
+func (s *Server) deleteOriginator(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orig := s.lookupOriginator(mux.Vars(r)["originatorID"], userID)
+	if orig == nil {
+		problem(w, http.StatusNotFound, "originator not found")
+		return
+	}
+	delete(s.originators, orig.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) addReceiver(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateReceiver
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.DefaultDepository == "" || req.Email == "" {
+		problem(w, http.StatusBadRequest, "missing defaultDepository or email")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lookupDepository(req.DefaultDepository, userID) == nil {
+		problem(w, http.StatusBadRequest, "depository not found")
+		return
+	}
+	rec := &receiver{
+		Receiver: moov.Receiver{
+			ID:                newID(),
+			Email:             req.Email,
+			DefaultDepository: req.DefaultDepository,
+			Status:            "Verified",
+			BirthDate:         req.BirthDate,
+			Address:           req.Address,
+			CustomerID:        s.newCustomer(userID),
+			Metadata:          req.Metadata,
+			Created:           time.Now(),
+			Updated:           time.Now(),
+		},
+		userID: userID,
+	}
+	s.receivers[rec.ID] = rec
+
+	writeJSON(w, http.StatusOK, rec.Receiver)
+}
+
+func (s *Server) getReceivers(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	receivers := make([]moov.Receiver, 0)
+	for _, rec := range s.receivers {
+		if rec.userID == userID {
+			receivers = append(receivers, rec.Receiver)
+		}
+	}
+	sort.Slice(receivers, func(i, j int) bool { return receivers[i].Created.Before(receivers[j].Created) })
+	writeJSON(w, http.StatusOK, receivers)
+}
+
+// lookupReceiver returns the receiver owned by userID. Callers must hold s.mu.
+func (s *Server) lookupReceiver(receiverID, userID string) *receiver {
+	if rec, exists := s.receivers[receiverID]; exists && rec.userID == userID {
+		return rec
+	}
+	return nil
+}
+
+func (s *Server) getReceiver(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.lookupReceiver(mux.Vars(r)["receiverID"], userID)
+	if rec == nil {
+		problem(w, http.StatusNotFound, "receiver not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, rec.Receiver)
+}
+
+func (s *Server) updateReceiver(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateReceiver
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.lookupReceiver(mux.Vars(r)["receiverID"], userID)
+	if rec == nil {
+		problem(w, http.StatusNotFound, "receiver not found")
+		return
+	}
+	if req.DefaultDepository != "" && s.lookupDepository(req.DefaultDepository, userID) == nil {
+		problem(w, http.StatusBadRequest, "depository not found")
+		return
+	}
+	setString(&rec.DefaultDepository, req.DefaultDepository)
+	setString(&rec.Email, req.Email)
+	setString(&rec.Metadata, req.Metadata)
+	rec.Updated = time.Now()
+
+	writeJSON(w, http.StatusOK, rec.Receiver)
+}
+
+func (s *Server) deleteReceiver(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := s.lookupReceiver(mux.Vars(r)["receiverID"], userID)
+	if rec == nil {
+		problem(w, http.StatusNotFound, "receiver not found")
+		return
+	}
+	delete(s.receivers, rec.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) addTransfer(w http.ResponseWriter, r *http.Request, userID string) {
+	var req moov.CreateTransfer
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cents, err := s.checkTransfer(&req, userID)
+	if err != nil {
+		problem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	xfer := s.createTransfer(req, cents, userID)
+
+	writeJSON(w, http.StatusOK, xfer.Transfer)
+}
+
+// addTransfers creates a batch of transfers. Like paygate, every transfer is checked first and the
+// whole batch is rejected if any of them are invalid.
+func (s *Server) addTransfers(w http.ResponseWriter, r *http.Request, userID string) {
+	var reqs []moov.CreateTransfer
+	if !readJSON(w, r, &reqs) {
+		return
+	}
+	if len(reqs) == 0 {
+		problem(w, http.StatusBadRequest, "no transfers")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	amounts := make([]int, len(reqs))
+	for i := range reqs {
+		cents, err := s.checkTransfer(&reqs[i], userID)
+		if err != nil {
+			problem(w, http.StatusBadRequest, "transfer %d: %v", i, err)
+			return
+		}
+		amounts[i] = cents
+	}
+	out := make([]moov.Transfer, 0, len(reqs))
+	for i := range reqs {
+		out = append(out, s.createTransfer(reqs[i], amounts[i], userID).Transfer)
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// checkTransfer validates req, filling in its default depositories, and returns the amount in cents.
+// Callers must hold s.mu.
+func (s *Server) checkTransfer(req *moov.CreateTransfer, userID string) (int, error) {
+	cents, err := parseAmount(req.Amount)
+	if err != nil {
+		return 0, err
+	}
+	if !secCodes[strings.ToUpper(req.StandardEntryClassCode)] {
+		return 0, fmt.Errorf("unknown standardEntryClassCode %q", req.StandardEntryClassCode)
+	}
+	pull := strings.EqualFold(req.TransferType, "pull")
+	if !pull && !strings.EqualFold(req.TransferType, "push") {
+		return 0, fmt.Errorf("unknown transferType %q", req.TransferType)
+	}
+	if !pull && strings.EqualFold(req.StandardEntryClassCode, ach.TEL) {
+		return 0, errors.New("TEL transfers can only be pulled")
+	}
+
+	orig := s.lookupOriginator(req.Originator, userID)
+	if orig == nil {
+		return 0, errors.New("originator not found")
+	}
+	rec := s.lookupReceiver(req.Receiver, userID)
+	if rec == nil {
+		return 0, errors.New("receiver not found")
+	}
+	if req.OriginatorDepository == "" {
+		req.OriginatorDepository = orig.DefaultDepository
+	}
+	if req.ReceiverDepository == "" {
+		req.ReceiverDepository = rec.DefaultDepository
+	}
+	origDep := s.lookupDepository(req.OriginatorDepository, userID)
+	recDep := s.lookupDepository(req.ReceiverDepository, userID)
+	if origDep == nil || recDep == nil {
+		return 0, errors.New("depository not found")
+	}
+	if origDep.Status != moov.VERIFIED || recDep.Status != moov.VERIFIED {
+		return 0, errors.New("depositories must be verified")
+	}
+	for _, customerID := range []string{orig.CustomerID, rec.CustomerID} {
+		if cust, exists := s.customers[customerID]; !exists || !approvedCustomerStatus(cust.Status) {
+			return 0, fmt.Errorf("customer=%s is not approved for transfers", customerID)
+		}
+	}
+	return cents, nil
+}
+
+// createTransfer saves a transfer checked by checkTransfer and posts it into Accounts, like paygate
+// does, when we have both accounts. Callers must hold s.mu.
+func (s *Server) createTransfer(req moov.CreateTransfer, cents int, userID string) *transfer {
+	xfer := &transfer{
+		Transfer: moov.Transfer{
+			ID:                     newID(),
+			TransferType:           req.TransferType,
+			Amount:                 formatAmount(cents),
+			Originator:             req.Originator,
+			OriginatorDepository:   req.OriginatorDepository,
+			Receiver:               req.Receiver,
+			ReceiverDepository:     req.ReceiverDepository,
+			Description:            req.Description,
+			StandardEntryClassCode: req.StandardEntryClassCode,
+			Status:                 moov.PENDING,
+			SameDay:                req.SameDay,
+			Created:                time.Now(),
+			CCDDetail:              req.CCDDetail,
+			IATDetail:              req.IATDetail,
+			PPDDetail:              req.PPDDetail,
+			TELDetail:              req.TELDetail,
+			WEBDetail:              req.WEBDetail,
+		},
+		userID: userID,
+	}
+	xfer.events = append(xfer.events, moov.Event{
+		ID:       newID(),
+		Topic:    "Transfer created",
+		Message:  fmt.Sprintf("Created %s transfer of %s", req.TransferType, xfer.Amount),
+		Type:     "TransferEvent",
+		Resource: xfer.ID,
+		Created:  time.Now(),
+	})
+	s.transfers[xfer.ID] = xfer
+
+	origDep := s.depositories[req.OriginatorDepository]
+	recDep := s.depositories[req.ReceiverDepository]
+	origAcct := s.findAccount(origDep.AccountNumber, origDep.RoutingNumber)
+	recAcct := s.findAccount(recDep.AccountNumber, recDep.RoutingNumber)
+	if origAcct != nil && recAcct != nil {
+		from, to := origAcct, recAcct
+		if strings.EqualFold(req.TransferType, "pull") {
+			from, to = recAcct, origAcct
+		}
+		s.postTransaction([]moov.TransactionLine{
+			{AccountID: from.ID, Purpose: "ACHDebit", Amount: float32(cents)},
+			{AccountID: to.ID, Purpose: "ACHCredit", Amount: float32(cents)},
+		})
+	}
+	return xfer
+}
+
+func (s *Server) getTransfers(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	transfers := make([]moov.Transfer, 0)
+	for _, xfer := range s.transfers {
+		if xfer.userID == userID {
+			transfers = append(transfers, xfer.Transfer)
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].Created.Before(transfers[j].Created) })
+	writeJSON(w, http.StatusOK, transfers)
+}
+
+// lookupTransfer returns the transfer owned by userID. Callers must hold s.mu.
+func (s *Server) lookupTransfer(transferID, userID string) *transfer {
+	if xfer, exists := s.transfers[transferID]; exists && xfer.userID == userID {
+		return xfer
+	}
+	return nil
+}
+
+func (s *Server) getTransfer(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	xfer := s.lookupTransfer(mux.Vars(r)["transferID"], userID)
+	if xfer == nil {
+		problem(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	if xfer.Status == moov.PENDING {
+		s.processTransfer(xfer)
+	}
+	writeJSON(w, http.StatusOK, xfer.Transfer)
+}
+
+// processTransfer stands in for paygate's cutoff: the transfer's ACH file is created and it's marked
+// processed, or failed when the file is invalid. Pending transfers are processed the first time
+// they're read so deleting them right after they're created still works. Callers must hold s.mu.
+func (s *Server) processTransfer(xfer *transfer) {
+	event := moov.Event{
+		ID:       newID(),
+		Type:     "TransferEvent",
+		Resource: xfer.ID,
+		Created:  time.Now(),
+	}
+	file, err := s.newACHFile(xfer)
+	if err != nil {
+		xfer.Status = moov.FAILED
+		xfer.failure = err.Error()
+		event.Topic = "Transfer failed"
+		event.Message = fmt.Sprintf("Problem creating ACH file: %v", err)
+	} else {
+		if err := s.writeOutboundFile(file); err != nil {
+			log.Printf("ERROR: mock: writing ACH file %s: %v", file.ID, err)
+		}
+		if err := s.achRepo.StoreFile(file); err != nil {
+			log.Printf("ERROR: mock: storing ACH file %s: %v", file.ID, err)
+		}
+		xfer.files = append(xfer.files, file.ID)
+		xfer.traceNumber = traceNumber(file)
+		xfer.Status = moov.PROCESSED
+		event.Topic = "Transfer processed"
+		event.Message = fmt.Sprintf("Uploaded ACH file %s", file.ID)
+	}
+	xfer.events = append(xfer.events, event)
+}
+
+func (s *Server) deleteTransfer(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	xfer := s.lookupTransfer(mux.Vars(r)["transferID"], userID)
+	if xfer == nil {
+		problem(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	if xfer.Status != moov.PENDING {
+		problem(w, http.StatusBadRequest, "only pending transfers can be deleted")
+		return
+	}
+	delete(s.transfers, xfer.ID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getTransferEvents(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	xfer := s.lookupTransfer(mux.Vars(r)["transferID"], userID)
+	if xfer == nil {
+		problem(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, xfer.events)
+}
+
+func (s *Server) getTransferFiles(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	xfer := s.lookupTransfer(mux.Vars(r)["transferID"], userID)
+	if xfer == nil {
+		problem(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.transferFiles(xfer))
+}
+
+// validateTransfer serves the failed route, which rejects transfers whose ACH file couldn't be created.
+func (s *Server) validateTransfer(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	xfer := s.lookupTransfer(mux.Vars(r)["transferID"], userID)
+	if xfer == nil {
+		problem(w, http.StatusNotFound, "transfer not found")
+		return
+	}
+	if xfer.failure != "" {
+		problem(w, http.StatusBadRequest, "transfer failed: %s", xfer.failure)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.transferFiles(xfer))
+}
+
+func (s *Server) transferFiles(xfer *transfer) []moov.File {
+	files := make([]moov.File, 0, len(xfer.files))
+	for _, fileID := range xfer.files {
+		files = append(files, moov.File{ID: fileID})
+	}
+	return files
+}
+
+// getEvents returns the events of every transfer owned by userID, oldest first.
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]moov.Event, 0)
+	for _, xfer := range s.transfers {
+		if xfer.userID == userID {
+			events = append(events, xfer.events...)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Created.Before(events[j].Created) })
+	writeJSON(w, http.StatusOK, events)
+}
+
+func (s *Server) getEvent(w http.ResponseWriter, r *http.Request, userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	eventID := mux.Vars(r)["eventID"]
+	for _, xfer := range s.transfers {
+		if xfer.userID != userID {
+			continue
+		}
+		for i := range xfer.events {
+			if xfer.events[i].ID == eventID {
+				writeJSON(w, http.StatusOK, xfer.events[i])
+				return
+			}
+		}
+	}
+	problem(w, http.StatusNotFound, "event not found")
+}
+
+// setString overwrites dst when value is non-empty, for partial updates.
+func setString(dst *string, value string) {
+	if value != "" {
+		*dst = value
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+// Package mock is an in-memory fake of the Moov API endpoints apitest calls (see openapi.yaml).
+// It's intended for running apitest on a laptop or in CI without any Moov services.
+//
+// Every route is served under its production path (e.g. /v1/ach/transfers) along with the
+// paygate, customers and watchman admin routes apitest uses (GET /features, PUT /customers/{id}/status
+// and GET /data/refresh).
+// State is only kept in memory.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	achserver "github.com/moov-io/ach/server"
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
+
+	kitlog "github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+)
+
+// Server implements http.Handler for the mocked Moov API.
+type Server struct {
+	router *mux.Router
+
+	mu sync.Mutex
+
+	// auth
+	users        map[string]*user   // by userID
+	emails       map[string]string  // email to userID
+	sessions     map[string]string  // moov_auth cookie to userID
+	oauthClients map[string]*client // by client_id
+	tokens       map[string]string  // OAuth2 access_token to userID
+
+	// paygate
+	gateways     map[string]*moov.Gateway // by userID
+	depositories map[string]*depository
+	originators  map[string]*originator
+	receivers    map[string]*receiver
+	transfers    map[string]*transfer
+
+	// accounts
+	accounts     map[string]*account
+	transactions []*moov.Transaction
+
+	// ach files uploaded through the ACH Files API or generated for transfers
+	achRepo      achserver.Repository
+	traceNumbers int    // last trace number sequence
+	outboundDir  string // see RunCutoffs
+
+	// imagecashletter files, by fileID
+	iclFiles map[string]*moov.IclFile
+
+	// wire files, by fileID
+	wireFiles map[string]*moov.WireFile
+
+	// watchman refreshes of sdnList (oldest first), customer and company watches by watchID
+	// and the client calling their webhooks
+	sdnDownloads []moov.Download
+	watches      map[string]*watch
+	webhooks     *http.Client
+
+	// customers, by customerID
+	customers map[string]*customer
+
+	// responses by idempotencyKey
+	idempotencyMu sync.Mutex
+	idempotent    map[string]*savedResponse
+
+	random *rand.Rand
+}
+
+// NewServer returns an empty Server with every route registered.
+func NewServer() *Server {
+	s := &Server{
+		router:       mux.NewRouter(),
+		users:        make(map[string]*user),
+		emails:       make(map[string]string),
+		sessions:     make(map[string]string),
+		oauthClients: make(map[string]*client),
+		tokens:       make(map[string]string),
+		gateways:     make(map[string]*moov.Gateway),
+		depositories: make(map[string]*depository),
+		originators:  make(map[string]*originator),
+		receivers:    make(map[string]*receiver),
+		transfers:    make(map[string]*transfer),
+		accounts:     make(map[string]*account),
+		achRepo:      achserver.NewRepositoryInMemory(0, kitlog.NewNopLogger()),
+		iclFiles:     make(map[string]*moov.IclFile),
+		wireFiles:    make(map[string]*moov.WireFile),
+		sdnDownloads: []moov.Download{newSDNDownload()},
+		watches:      make(map[string]*watch),
+		webhooks:     &http.Client{Timeout: 10 * time.Second},
+		customers:    make(map[string]*customer),
+		idempotent:   make(map[string]*savedResponse),
+		random:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	s.router.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	for _, app := range []string{"accounts", "ach", "auth", "customers", "fed", "imagecashletter", "paygate", "watchman", "wire"} {
+		s.router.Methods("GET").Path(fmt.Sprintf("/v1/%s/ping", app)).HandlerFunc(ping)
+	}
+	s.addAuthRoutes(s.router)
+	s.addPaygateRoutes(s.router)
+	s.addACHRoutes(s.router)
+	s.addICLRoutes(s.router)
+	s.addWireRoutes(s.router)
+	s.addWatchmanRoutes(s.router)
+	s.addAccountsRoutes(s.router)
+	s.addCustomersRoutes(s.router)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Mirror the CORS and X-Request-ID headers our load balancer adds
+	if origin := r.Header.Get("Origin"); trustedOrigin(origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Cookie, X-Idempotency-Key, X-Request-ID, X-User-ID")
+	}
+	if requestID := r.Header.Get("X-Request-ID"); requestID != "" {
+		w.Header().Set("X-Request-ID", requestID)
+	}
+	s.serveIdempotent(w, r, s.router)
+}
+
+// trustedOrigin returns true for moov.io (and its subdomains) over HTTPS and any localhost port.
+func trustedOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || origin == "" {
+		return false
+	}
+	if u.Scheme == "http" && u.Hostname() == "localhost" {
+		return true
+	}
+	return u.Scheme == "https" && (u.Host == "moov.io" || strings.HasSuffix(u.Host, ".moov.io"))
+}
+
+func ping(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("PONG"))
+}
+
+// authenticated wraps a handler to require a valid moov_auth cookie or OAuth2 access token.
+// The userID of those credentials is passed to h, and a mismatched X-User-ID is rejected.
+func (s *Server) authenticated(h func(w http.ResponseWriter, r *http.Request, userID string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := s.lookupUserID(r)
+		if userID == "" {
+			problem(w, http.StatusForbidden, "missing or invalid credentials")
+			return
+		}
+		if v := r.Header.Get("X-User-ID"); v != "" && v != userID {
+			problem(w, http.StatusForbidden, "X-User-ID does not match credentials")
+			return
+		}
+		h(w, r, userID)
+	}
+}
+
+func (s *Server) lookupUserID(r *http.Request) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cookie, err := r.Cookie("moov_auth"); err == nil {
+		if userID, exists := s.sessions[cookie.Value]; exists {
+			return userID
+		}
+	}
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		if userID, exists := s.tokens[token]; exists {
+			return userID
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// problem writes an Error object like Moov services do for non-2xx responses.
+func problem(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, moov.Error{
+		Error: fmt.Sprintf(format, args...),
+	})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		problem(w, http.StatusBadRequest, "invalid JSON: %v", err)
+		return false
+	}
+	return true
+}
+
+// parseAmount reads 'USD 12.34' formatted amounts into cents.
+func parseAmount(amount string) (int, error) {
+	parts := strings.Fields(amount)
+	if len(parts) != 2 || parts[0] != "USD" {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	v, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	return int(v*100 + 0.5), nil
+}
+
+func formatAmount(cents int) string {
+	return fmt.Sprintf("USD %.2f", float64(cents)/100.0)
+}
+
+func newID() string {
+	return base.ID()
+}
@@ -0,0 +1,933 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+func setupClient(t *testing.T) (*moov.APIClient, *moov.Configuration, func()) {
+	t.Helper()
+
+	svc := httptest.NewServer(NewServer())
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	conf.HTTPClient = svc.Client()
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	return moov.NewAPIClient(conf), conf, svc.Close
+}
+
+func login(t *testing.T, api *moov.APIClient, conf *moov.Configuration) moov.User {
+	t.Helper()
+	ctx := context.Background()
+
+	req := moov.CreateUser{Email: "jane@example.com", Password: "password", FirstName: "Jane", LastName: "Doe", Phone: "555.555.5555"}
+	if _, _, err := api.UserApi.CreateUser(ctx, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	u, resp, err := api.UserApi.UserLogin(ctx, moov.Login{Email: req.Email, Password: req.Password}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range resp.Cookies() {
+		if c.Name == "moov_auth" {
+			conf.AddDefaultHeader("Cookie", fmt.Sprintf("moov_auth=%s", c.Value))
+		}
+	}
+	return u
+}
+
+func TestServer__auth(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	// No credentials
+	resp, err := api.UserApi.CheckUserLogin(ctx, nil)
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403: %v", err)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v == "" {
+		t.Error("missing CORS headers")
+	}
+
+	u := login(t, api, conf)
+	if _, err := api.UserApi.CheckUserLogin(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bad password
+	_, resp, err = api.UserApi.UserLogin(ctx, moov.Login{Email: u.Email, Password: "wrong"}, nil)
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403: %v", err)
+	}
+
+	// Another user's ID is rejected
+	_, resp, err = api.GatewaysApi.GetGateways(ctx, "other", nil)
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403: %v", err)
+	}
+
+	// OAuth2
+	clients, _, err := api.OAuth2Api.CreateOAuth2Client(ctx, nil)
+	if err != nil || len(clients) != 1 {
+		t.Fatalf("clients=%#v error=%v", clients, err)
+	}
+	token, _, err := api.OAuth2Api.CreateOAuth2Token(ctx, &moov.CreateOAuth2TokenOpts{
+		GrantType:    optional.NewString("client_credentials"),
+		ClientId:     optional.NewString(clients[0].ClientId),
+		ClientSecret: optional.NewString(clients[0].ClientSecret),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.OAuth2Api.CheckOAuthClientCredentials(ctx, "Bearer "+token.AccessToken, nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = api.OAuth2Api.CheckOAuthClientCredentials(ctx, "Bearer invalid", nil)
+	if err == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected 403: %v", err)
+	}
+}
+
+func TestServer__cors(t *testing.T) {
+	svc := httptest.NewServer(NewServer())
+	defer svc.Close()
+
+	cases := map[string]bool{
+		"https://moov.io":          true,
+		"https://app.moov.io":      true,
+		"http://localhost:3000":    true,
+		"http://moov.io":           false,
+		"https://evil.example.com": false,
+		"https://moov.io.evil.com": false,
+		"":                         false,
+	}
+	for origin, trusted := range cases {
+		req, _ := http.NewRequest("OPTIONS", svc.URL+"/v1/ach/transfers", nil)
+		req.Header.Set("Origin", origin)
+		resp, err := svc.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if v := resp.Header.Get("Access-Control-Allow-Origin"); (v == origin && origin != "") != trusted {
+			t.Errorf("origin %q: Access-Control-Allow-Origin=%q", origin, v)
+		}
+	}
+}
+
+func TestServer__transfer(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	u := login(t, api, conf)
+
+	// Accounts and their depositories
+	var deps []moov.Depository
+	var accounts []moov.Account
+	for _, name := range []string{"from", "to"} {
+		acct, _, err := api.AccountsApi.CreateAccount(ctx, u.ID, moov.CreateAccount{CustomerID: u.ID, Name: name, Type: "Savings", Balance: 1000}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dep, _, err := api.DepositoriesApi.AddDepository(ctx, u.ID, moov.CreateDepository{
+			BankName:      "Moov Bank",
+			Holder:        "Jane Doe",
+			HolderType:    "Individual",
+			Type:          "Savings",
+			RoutingNumber: acct.RoutingNumber,
+			AccountNumber: acct.AccountNumber,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := api.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, u.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+		txs, _, err := api.AccountsApi.GetAccountTransactions(ctx, acct.ID, u.ID, nil)
+		if err != nil || len(txs) != 2 {
+			t.Fatalf("transactions=%#v error=%v", txs, err)
+		}
+
+		// Wrong amounts are rejected
+		_, err = api.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, u.ID, moov.Amounts{Amounts: []string{"USD 0.99", "USD 0.98"}}, nil)
+		if err == nil {
+			t.Error("expected error")
+		}
+		var amounts moov.Amounts
+		for i := range txs {
+			amounts.Amounts = append(amounts.Amounts, fmt.Sprintf("USD %.2f", txs[i].Lines[0].Amount/100))
+		}
+		if _, err := api.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, u.ID, amounts, nil); err != nil {
+			t.Fatal(err)
+		}
+		deps = append(deps, dep)
+		accounts = append(accounts, acct)
+	}
+
+	orig, _, err := api.OriginatorsApi.AddOriginator(ctx, u.ID, moov.CreateOriginator{DefaultDepository: deps[0].ID, Identification: "123456789"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _, err := api.ReceiversApi.AddReceivers(ctx, u.ID, moov.CreateReceiver{DefaultDepository: deps[1].ID, Email: "john@example.com"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := moov.CreateTransfer{
+		TransferType:           "Push",
+		Amount:                 "USD 12.34",
+		Originator:             orig.ID,
+		Receiver:               rec.ID,
+		Description:            "test",
+		StandardEntryClassCode: "PPD",
+	}
+	// Customers need to be approved first
+	if _, _, err := api.TransfersApi.AddTransfer(ctx, u.ID, req, nil); err == nil || !strings.Contains(string(err.(moov.GenericOpenAPIError).Body()), "not approved") {
+		t.Fatalf("expected error: %v", err)
+	}
+	for _, customerID := range []string{orig.CustomerID, rec.CustomerID} {
+		approve(t, conf.BasePath, customerID)
+	}
+
+	xfer, _, err := api.TransfersApi.AddTransfer(ctx, u.ID, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xfer.Status != moov.PENDING || xfer.Amount != "USD 12.34" {
+		t.Errorf("unexpected transfer: %#v", xfer)
+	}
+	for _, acct := range accounts {
+		txs, _, err := api.AccountsApi.GetAccountTransactions(ctx, acct.ID, u.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(txs) != 3 || txs[0].Lines[0].Amount != 1234 {
+			t.Errorf("unexpected transactions: %#v", txs)
+		}
+	}
+
+	// Pull transfers debit the receiver and credit the originator
+	req.TransferType = "Pull"
+	req.Amount = "USD 5.00"
+	if _, _, err := api.TransfersApi.AddTransfer(ctx, u.ID, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i, purpose := range []string{"ACHCredit", "ACHDebit"} {
+		txs, _, err := api.AccountsApi.GetAccountTransactions(ctx, accounts[i].ID, u.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found bool
+		for _, tx := range txs {
+			for _, line := range tx.Lines {
+				if line.AccountID == accounts[i].ID && line.Amount == 500 {
+					found = line.Purpose == purpose
+				}
+			}
+		}
+		if !found {
+			t.Errorf("missing %s on account %s: %#v", purpose, accounts[i].ID, txs)
+		}
+	}
+
+	// Batches are rejected when any transfer is invalid
+	batch := []moov.CreateTransfer{req, req}
+	batch[1].Amount = "USD -1.00"
+	if _, resp, err := api.TransfersApi.AddTransfers(ctx, u.ID, batch, nil); err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected error: %v", err)
+	}
+	batch[1].Amount = "USD 1.00"
+	xfers, _, err := api.TransfersApi.AddTransfers(ctx, u.ID, batch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(xfers) != 2 || xfers[0].Amount != "USD 5.00" || xfers[1].Amount != "USD 1.00" {
+		t.Errorf("unexpected transfers: %#v", xfers)
+	}
+	all, _, err := api.TransfersApi.GetTransfers(ctx, u.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 {
+		t.Errorf("expected 4 transfers, got %d", len(all))
+	}
+
+	// TEL entries can only be debits
+	req.TransferType = "Push"
+	req.StandardEntryClassCode = "TEL"
+	if _, resp, err := api.TransfersApi.AddTransfer(ctx, u.ID, req, nil); err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected error: %v", err)
+	}
+
+	// Transfers are processed when read and their ACH file can be downloaded
+	for _, secCode := range []string{"CCD", "IAT", "PPD", "TEL", "WEB"} {
+		req.StandardEntryClassCode = secCode
+		req.TransferType = "Pull"
+		req.Amount = "USD 2.50"
+		switch secCode {
+		case "IAT":
+			req.IATDetail = moov.IatDetail{
+				OriginatorName:         "Jane Doe",
+				OriginatorAddress:      "123 1st st",
+				OriginatorCity:         "anytown",
+				OriginatorState:        "PA",
+				OriginatorPostalCode:   "12345",
+				OriginatorCountryCode:  "US",
+				ODFIName:               "my bank",
+				ODFIIDNumberQualifier:  "01",
+				ODFIIdentification:     "2",
+				ODFIBranchCurrencyCode: "USD",
+				ReceiverName:           "John Doe",
+				ReceiverAddress:        "321 2nd st",
+				ReceiverCity:           "othertown",
+				ReceiverState:          "GB",
+				ReceiverPostalCode:     "54321",
+				ReceiverCountryCode:    "GB",
+				RDFIName:               "their bank",
+				RDFIIDNumberQualifier:  "01",
+				RDFIIdentification:     "4",
+				RDFIBranchCurrencyCode: "GBP",
+			}
+		case "TEL":
+			req.TELDetail = moov.TelDetail{PhoneNumber: "555-555-1234", PaymentType: "single"}
+		case "WEB":
+			req.WEBDetail = moov.WebDetail{PaymentInformation: "test", PaymentType: "recurring"}
+		}
+		checkProcessed(t, api, u.ID, req)
+	}
+}
+
+// checkProcessed creates a transfer from req and verifies it's processed with an ACH file containing its entry.
+func checkProcessed(t *testing.T, api *moov.APIClient, userID string, req moov.CreateTransfer) {
+	t.Helper()
+	ctx := context.Background()
+
+	xfer, _, err := api.TransfersApi.AddTransfer(ctx, userID, req, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", req.StandardEntryClassCode, err)
+	}
+	xfer, _, err = api.TransfersApi.GetTransferByID(ctx, xfer.ID, userID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xfer.Status != moov.PROCESSED {
+		t.Fatalf("%s: transfer is %s", req.StandardEntryClassCode, xfer.Status)
+	}
+	if _, err := api.TransfersApi.DeleteTransferByID(ctx, xfer.ID, userID, nil); err == nil {
+		t.Error("expected error deleting a processed transfer")
+	}
+
+	events, _, err := api.TransfersApi.GetTransferEventsByID(ctx, xfer.ID, userID, nil)
+	if err != nil || len(events) != 2 || events[1].Topic != "Transfer processed" {
+		t.Fatalf("events=%#v error=%v", events, err)
+	}
+	all, _, err := api.EventsApi.GetEvents(ctx, userID, nil)
+	if err != nil || len(all) < 2 {
+		t.Fatalf("events=%#v error=%v", all, err)
+	}
+	event, _, err := api.EventsApi.GetEventByID(ctx, events[1].ID, userID, nil)
+	if err != nil || event.Resource != xfer.ID {
+		t.Fatalf("event=%#v error=%v", event, err)
+	}
+
+	files, _, err := api.TransfersApi.GetTransferFiles(ctx, xfer.ID, userID, nil)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files=%#v error=%v", files, err)
+	}
+	if _, _, err := api.TransfersApi.GetTransferNachaCode(ctx, xfer.ID, userID, nil); err != nil {
+		t.Errorf("%s: %v", req.StandardEntryClassCode, err)
+	}
+	contents, _, err := api.ACHFilesApi.GetFileContents(ctx, files[0].ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ach.NewReader(strings.NewReader(contents)).Read()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", req.StandardEntryClassCode, err, contents)
+	}
+	var amount int
+	if req.StandardEntryClassCode == "IAT" {
+		amount = file.IATBatches[0].Entries[0].Amount
+	} else {
+		amount = file.Batches[0].GetEntries()[0].Amount
+		if cd := file.Batches[0].GetEntries()[0].CreditOrDebit(); cd != "D" {
+			t.Errorf("%s: expected a debit entry, got %s", req.StandardEntryClassCode, cd)
+		}
+	}
+	if amount != 250 {
+		t.Errorf("%s: unexpected amount %d", req.StandardEntryClassCode, amount)
+	}
+}
+
+func TestServer__ownership(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	u := login(t, api, conf)
+	acct, _, err := api.AccountsApi.CreateAccount(ctx, u.ID, moov.CreateAccount{CustomerID: u.ID, Name: "from", Type: "Savings", Balance: 1000}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dep, _, err := api.DepositoriesApi.AddDepository(ctx, u.ID, moov.CreateDepository{
+		BankName:      "Moov Bank",
+		Holder:        "Jane Doe",
+		HolderType:    "Individual",
+		Type:          "Savings",
+		RoutingNumber: acct.RoutingNumber,
+		AccountNumber: acct.AccountNumber,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, _, err := api.OriginatorsApi.AddOriginator(ctx, u.ID, moov.CreateOriginator{DefaultDepository: dep.ID, Identification: "123456789"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Switch to another user
+	delete(conf.DefaultHeader, "Cookie")
+	req := moov.CreateUser{Email: "john@example.com", Password: "password", FirstName: "John", LastName: "Doe", Phone: "555.555.5555"}
+	if _, _, err := api.UserApi.CreateUser(ctx, req, nil); err != nil {
+		t.Fatal(err)
+	}
+	other, resp, err := api.UserApi.UserLogin(ctx, moov.Login{Email: req.Email, Password: req.Password}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.AddDefaultHeader("Cookie", "moov_auth="+resp.Cookies()[0].Value)
+
+	if _, resp, err := api.DepositoriesApi.GetDepositoryByID(ctx, dep.ID, other.ID, nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404: %v", err)
+	}
+	if resp, err := api.DepositoriesApi.DeleteDepository(ctx, dep.ID, other.ID, nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404: %v", err)
+	}
+	if _, resp, err := api.OriginatorsApi.UpdateOriginator(ctx, orig.ID, other.ID, moov.CreateOriginator{Metadata: "other"}, nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404: %v", err)
+	}
+	if _, resp, err := api.CustomersApi.GetCustomer(ctx, orig.CustomerID, nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404: %v", err)
+	}
+	accounts, _, err := api.AccountsApi.SearchAccounts(ctx, other.ID, &moov.SearchAccountsOpts{
+		Number: optional.NewString(acct.AccountNumber),
+	})
+	if err != nil || len(accounts) != 0 {
+		t.Errorf("accounts=%#v error=%v", accounts, err)
+	}
+	_, resp, err = api.AccountsApi.CreateTransaction(ctx, other.ID, moov.CreateTransaction{
+		Lines: []moov.TransactionLine{{AccountID: acct.ID, Purpose: "ACHDebit", Amount: -1}},
+	}, nil)
+	if err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404: %v", err)
+	}
+}
+
+func TestServer__idempotency(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	u := login(t, api, conf)
+	req := moov.CreateGateway{Origin: "121042882", Destination: "231380104"}
+	opts := &moov.AddGatewayOpts{XIdempotencyKey: optional.NewString("key")}
+	first, _, err := api.GatewaysApi.AddGateway(ctx, u.ID, req, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := api.GatewaysApi.AddGateway(ctx, u.ID, req, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID != second.ID {
+		t.Errorf("expected replayed gateway: %s vs %s", first.ID, second.ID)
+	}
+
+	// A new key creates another gateway
+	third, _, err := api.GatewaysApi.AddGateway(ctx, u.ID, req, &moov.AddGatewayOpts{XIdempotencyKey: optional.NewString("other")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID == first.ID {
+		t.Error("expected a new gateway")
+	}
+}
+
+func approve(t *testing.T, address, customerID string) {
+	t.Helper()
+
+	req, _ := http.NewRequest("PUT", address+"/customers/"+customerID+"/status", strings.NewReader(`{"status": "OFAC"}`))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("bogus HTTP status: %s", resp.Status)
+	}
+}
+
+func TestServer__validation(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	u := login(t, api, conf)
+
+	_, resp, err := api.GatewaysApi.AddGateway(ctx, u.ID, moov.CreateGateway{Origin: "123456789", Destination: "231380104"}, nil)
+	if err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected error: %v", err)
+	}
+	if body := string(err.(moov.GenericOpenAPIError).Body()); !strings.Contains(body, `"error":"invalid routing number`) {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	_, resp, err = api.DepositoriesApi.AddDepository(ctx, u.ID, moov.CreateDepository{AccountNumber: "1234", RoutingNumber: "12345", Holder: "John Doe"}, nil)
+	if err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected error: %v", err)
+	}
+
+	// Unknown SEC codes are rejected before anything else is checked
+	req := moov.CreateTransfer{Amount: "USD 1.00", StandardEntryClassCode: "XYZ"}
+	_, resp, err = api.TransfersApi.AddTransfer(ctx, u.ID, req, nil)
+	if err == nil || resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(err.(moov.GenericOpenAPIError).Body()), "standardEntryClassCode") {
+		t.Fatalf("expected error: %v", err)
+	}
+}
+
+func TestServer__inbound(t *testing.T) {
+	s := NewServer()
+	for _, dep := range []*depository{
+		{Depository: moov.Depository{ID: "origDep", BankName: "Moov Bank", Holder: "Jane Doe", Type: "Checking", RoutingNumber: "121042882", AccountNumber: "123", Status: moov.VERIFIED}},
+		{Depository: moov.Depository{ID: "recDep", BankName: "Moov Bank", Holder: "John Doe", Type: "Checking", RoutingNumber: "231380104", AccountNumber: "4567890123", Status: moov.VERIFIED}},
+	} {
+		s.depositories[dep.ID] = dep
+	}
+	s.originators["orig"] = &originator{Originator: moov.Originator{ID: "orig", Identification: "123456789"}}
+	xfer := s.createTransfer(moov.CreateTransfer{
+		TransferType:           "Push",
+		Originator:             "orig",
+		OriginatorDepository:   "origDep",
+		Receiver:               "rec",
+		ReceiverDepository:     "recDep",
+		Description:            "test",
+		StandardEntryClassCode: "PPD",
+	}, 1234, "user")
+
+	dir, err := ioutil.TempDir("", "mock-inbound")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s.outboundDir = dir
+	s.processTransfer(xfer)
+	if xfer.Status != moov.PROCESSED || xfer.traceNumber == "" {
+		t.Fatalf("unexpected transfer: %#v", xfer)
+	}
+	if infos, _ := ioutil.ReadDir(dir); len(infos) != 1 {
+		t.Fatalf("expected one outbound file: %#v", infos)
+	}
+	os.Remove(filepath.Join(dir, xfer.files[0]+".ach"))
+
+	// NOCs correct the receiver's depository
+	writeInbound := func(addenda98 *ach.Addenda98, addenda99 *ach.Addenda99) {
+		t.Helper()
+		bh := ach.NewBatchHeader()
+		bh.ServiceClassCode = ach.CreditsOnly
+		bh.CompanyName = "Jane Doe"
+		bh.CompanyIdentification = "123456789"
+		bh.StandardEntryClassCode = ach.PPD
+		bh.CompanyEntryDescription = "test"
+		bh.EffectiveEntryDate = time.Now().Format("060102")
+		bh.ODFIIdentification = "23138010"
+
+		ed := ach.NewEntryDetail()
+		ed.TransactionCode = ach.CheckingReturnNOCCredit
+		ed.SetRDFI("121042882")
+		ed.DFIAccountNumber = "4567890123"
+		ed.Amount = 1234
+		ed.IndividualName = "John Doe"
+		ed.SetTraceNumber(bh.ODFIIdentification, 1)
+		ed.AddendaRecordIndicator = 1
+		ed.Category = ach.CategoryReturn
+		if addenda99 != nil {
+			addenda99.TraceNumber = ed.TraceNumber
+			ed.Addenda99 = addenda99
+		}
+		if addenda98 != nil {
+			addenda98.TraceNumber = ed.TraceNumber
+			bh.StandardEntryClassCode = ach.COR
+			ed.Amount = 0
+			ed.Category = ach.CategoryNOC
+			ed.Addenda98 = addenda98
+		}
+		batch, err := ach.NewBatch(bh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch.AddEntry(ed)
+		if err := batch.Create(); err != nil {
+			t.Fatal(err)
+		}
+		file := ach.NewFile()
+		file.Header = ach.NewFileHeader()
+		file.Header.ImmediateOrigin = "231380104"
+		file.Header.ImmediateOriginName = "Moov Bank"
+		file.Header.ImmediateDestination = "121042882"
+		file.Header.ImmediateDestinationName = "Moov Bank"
+		file.Header.FileCreationDate = time.Now().Format("060102")
+		file.AddBatch(batch)
+		if err := file.Create(); err != nil {
+			t.Fatal(err)
+		}
+		fd, err := os.Create(filepath.Join(dir, "inbound.ach"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fd.Close()
+		if err := ach.NewWriter(fd).Write(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	noc := ach.NewAddenda98()
+	noc.ChangeCode = "C06"
+	noc.OriginalTrace = xfer.traceNumber
+	noc.OriginalDFI = "23138010"
+	noc.CorrectedData = "987654321           32"
+	writeInbound(noc, nil)
+	if err := s.readInboundDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if dep := s.depositories["recDep"]; dep.AccountNumber != "987654321" || dep.Type != "Savings" || dep.Status != moov.VERIFIED {
+		t.Errorf("unexpected depository: %#v", dep.Depository)
+	}
+	if infos, _ := ioutil.ReadDir(dir); len(infos) != 0 {
+		t.Errorf("inbound file wasn't removed: %#v", infos)
+	}
+
+	// Returns fail the transfer and some reject the receiver's depository
+	ret := ach.NewAddenda99()
+	ret.ReturnCode = "R02"
+	ret.OriginalTrace = xfer.traceNumber
+	ret.OriginalDFI = "23138010"
+	writeInbound(nil, ret)
+	if err := s.readInboundDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if xfer.Status != moov.FAILED || xfer.ReturnCode.Code != "R02" || xfer.failure == "" {
+		t.Errorf("unexpected transfer: %#v", xfer.Transfer)
+	}
+	if dep := s.depositories["recDep"]; dep.Status != moov.REJECTED {
+		t.Errorf("unexpected depository: %#v", dep.Depository)
+	}
+}
+
+func TestServer__icl(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	if _, _, err := api.ImageCashLetterFilesApi.GetICLFiles(ctx, nil); err == nil {
+		t.Fatal("expected error without credentials")
+	}
+	login(t, api, conf)
+
+	now := time.Now()
+	check := func(amount int32) moov.Checks {
+		return moov.Checks{CheckDetail: moov.CheckDetail{PayorBankRoutingNumber: "03130001", PayorBankCheckDigit: "2", ItemAmount: amount, MICRValidIndicator: "1"}}
+	}
+	req := moov.CreateIclFile{
+		FileHeader: moov.IclFileHeader{StandardLevel: "35", TestFileIndicator: "T", ImmediateDestination: "231380104", ImmediateOrigin: "121042882", FileCreationDate: now, ResendIndicator: "N"},
+		CashLetters: []moov.CashLetter{{
+			CashLetterHeader: moov.CashLetterHeader{ID: "cl1", CollectionTypeIndicator: "01", CashLetterID: "1"},
+			Bundles:          []moov.Bundle{{Checks: []moov.Checks{check(100), check(250)}}},
+		}},
+	}
+	file, _, err := api.ImageCashLetterFilesApi.CreateICLFile(ctx, req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fc := file.FileControl; fc.CashLetterCount != 1 || fc.TotalItemCount != 2 || fc.FileTotalAmount != 350 || fc.TotalRecordCount != 8 {
+		t.Errorf("unexpected file control: %#v", fc)
+	}
+	if bc := file.CashLetters[0].Bundles[0].BundleControl; bc.BundleItemsCount != 2 || bc.MicrValidTotalAmount != 350 {
+		t.Errorf("unexpected bundle control: %#v", bc)
+	}
+	if _, _, err := api.ImageCashLetterFilesApi.ValidateICLFile(ctx, file.ID, nil); err != nil {
+		t.Error(err)
+	}
+
+	contents, _, err := api.ImageCashLetterFilesApi.GetICLFileContents(ctx, file.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	if len(records) != 8 || !strings.HasPrefix(records[3], "25") || records[3][47:57] != "0000000100" {
+		t.Errorf("unexpected records:\n%s", contents)
+	}
+	for _, record := range records {
+		if len(record) != 80 {
+			t.Errorf("%d character record: %q", len(record), record)
+		}
+	}
+
+	// Add and delete a cash letter
+	cl := moov.CashLetter{
+		CashLetterHeader: moov.CashLetterHeader{ID: "cl2", CollectionTypeIndicator: "01", CashLetterID: "2"},
+		Bundles:          []moov.Bundle{{Checks: []moov.Checks{check(-5)}}},
+	}
+	if _, err := api.ImageCashLetterFilesApi.AddICLToFile(ctx, file.ID, cl, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := api.ImageCashLetterFilesApi.ValidateICLFile(ctx, file.ID, nil); err == nil {
+		t.Error("expected error for negative check amount")
+	}
+	if _, err := api.ImageCashLetterFilesApi.DeleteICLFromFile(ctx, file.ID, "cl2", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.ImageCashLetterFilesApi.DeleteICLFromFile(ctx, file.ID, "cl2", nil); err == nil {
+		t.Error("expected error deleting cash letter twice")
+	}
+	file, _, err = api.ImageCashLetterFilesApi.GetICLFileByID(ctx, file.ID, nil)
+	if err != nil || len(file.CashLetters) != 1 || file.FileControl.FileTotalAmount != 350 {
+		t.Errorf("unexpected file: %#v (%v)", file, err)
+	}
+
+	if _, err := api.ImageCashLetterFilesApi.DeleteICLFile(ctx, file.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, resp, _ := api.ImageCashLetterFilesApi.GetICLFileByID(ctx, file.ID, nil); resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected response: %#v", resp)
+	}
+}
+
+func TestServer__wire(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+	login(t, api, conf)
+
+	fwm := moov.FedWireMessage{
+		SenderSupplied:                 moov.SenderSupplied{FormatVersion: "30", TestProductionCode: "T"},
+		TypeSubType:                    moov.TypeSubType{TypeCode: "10", SubTypeCode: "00"},
+		InputMessageAccountabilityData: moov.InputMessageAccountabilityData{InputCycleDate: "20200401"},
+		Amount:                         moov.WireAmount{Amount: "000000001234"},
+		SenderDepositoryInstitution:    moov.SenderDepositoryInstitution{SenderABANumber: "121042882"},
+		ReceiverDepositoryInstitution:  moov.ReceiverDepositoryInstitution{ReceiverABANumber: "231380104"},
+		BusinessFunctionCode:           moov.BusinessFunctionCode{BusinessFunctionCode: "CTR"},
+		Beneficiary:                    moov.Personal{IdentificationCode: "D", Identifier: "123", Name: "Jane Doe"},
+		Originator:                     moov.Personal{IdentificationCode: "D", Identifier: "456", Name: "John Doe"},
+	}
+	file, _, err := api.WireFilesApi.CreateWireFile(ctx, moov.CreateWireFile{FedWireMessage: []moov.FedWireMessage{fwm}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := api.WireFilesApi.ValidateWireFile(ctx, file.ID, nil); err != nil {
+		t.Error(err)
+	}
+	contents, _, err := api.WireFilesApi.GetWireFileContents(ctx, file.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(contents, "{2000}000000001234\n") || !strings.Contains(contents, "{3600}CTR") || !strings.Contains(contents, "{5000}D456") {
+		t.Errorf("unexpected contents:\n%s", contents)
+	}
+
+	// CTR messages can't have a local instrument or drawdown accounts
+	invalid := fwm
+	invalid.LocalInstrument = moov.LocalInstrument{LocalInstrumentCode: "PROP", ProprietaryCode: "Moov"}
+	resp, err := api.WireFilesApi.AddFEDWireMessageToFile(ctx, file.ID, invalid, nil)
+	if err == nil || resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(err.(moov.GenericOpenAPIError).Body()), "LocalInstrument") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	invalid = fwm
+	invalid.BusinessFunctionCode.BusinessFunctionCode = "DRC"
+	if _, _, err := api.WireFilesApi.CreateWireFile(ctx, moov.CreateWireFile{FedWireMessage: []moov.FedWireMessage{invalid}}, nil); err == nil {
+		t.Error("expected error for DRC with a CTR type")
+	}
+
+	fwm.Amount.Amount = "000000005678"
+	if _, err := api.WireFilesApi.AddFEDWireMessageToFile(ctx, file.ID, fwm, nil); err != nil {
+		t.Fatal(err)
+	}
+	file, _, err = api.WireFilesApi.GetWireFileByID(ctx, file.ID, nil)
+	if err != nil || len(file.FedWireMessage) != 1 || file.FedWireMessage[0].Amount.Amount != "000000005678" {
+		t.Errorf("unexpected file: %#v (%v)", file, err)
+	}
+	if _, err := api.WireFilesApi.DeleteWireFileByID(ctx, file.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, resp, _ := api.WireFilesApi.GetWireFileByID(ctx, file.ID, nil); resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected response: %#v", resp)
+	}
+}
+
+func TestServer__watchman(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+	login(t, api, conf)
+
+	res, _, err := api.WatchmanApi.Search(ctx, &moov.SearchOpts{Name: optional.NewString("Nicolas Maduro"), Limit: optional.NewInt32(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.SDNs) != 1 || res.SDNs[0].EntityID != "22790" || res.SDNs[0].Match < 0.9 || len(res.AltNames) != 0 {
+		t.Errorf("unexpected search: %#v", res)
+	}
+	res, _, err = api.WatchmanApi.Search(ctx, &moov.SearchOpts{Q: optional.NewString("NATIONAL BANK OF CUBA")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.AltNames) == 0 || res.AltNames[0].AlternateID != "219" || res.AltNames[0].Match < 0.99 {
+		t.Errorf("unexpected alt names: %#v", res.AltNames)
+	}
+	if _, resp, err := api.WatchmanApi.Search(ctx, nil); err == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected error: %v", err)
+	}
+
+	sdn, _, err := api.WatchmanApi.GetSDN(ctx, "306", nil)
+	if err != nil || sdn.SdnName != "BANCO NACIONAL DE CUBA" {
+		t.Errorf("unexpected SDN: %#v (%v)", sdn, err)
+	}
+	addresses, _, err := api.WatchmanApi.GetSDNAddresses(ctx, "306", nil)
+	if err != nil || len(addresses) != 3 {
+		t.Errorf("unexpected addresses: %#v (%v)", addresses, err)
+	}
+	if _, resp, _ := api.WatchmanApi.GetSDNAltNames(ctx, "0", nil); resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected response: %#v", resp)
+	}
+
+	downloads, _, err := api.WatchmanApi.GetLatestDownloads(ctx, nil)
+	if err != nil || len(downloads) != 1 || downloads[0].SDNs != 3 || time.Since(downloads[0].Timestamp) > time.Minute {
+		t.Errorf("unexpected downloads: %#v (%v)", downloads, err)
+	}
+}
+
+func TestServer__jaroWinkler(t *testing.T) {
+	cases := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"martha", "marhta", 0.96, 0.962},
+		{"dixon", "dicksonx", 0.81, 0.815},
+		{normalizeSDNName("MADURO MOROS, Nicolas", "individual"), normalizeSDNName("Nicolas Maduro Moros", "individual"), 1, 1},
+		{"", "moov", 0, 0},
+	}
+	for _, tc := range cases {
+		if score := jaroWinkler(tc.a, tc.b); score < tc.min || score > tc.max {
+			t.Errorf("jaroWinkler(%q, %q) = %.3f", tc.a, tc.b, score)
+		}
+	}
+}
+
+func TestServer__watches(t *testing.T) {
+	api, conf, cleanup := setupClient(t)
+	defer cleanup()
+	ctx := context.Background()
+	login(t, api, conf)
+
+	type webhook struct {
+		auth string
+		body []byte
+	}
+	webhooks := make(chan webhook, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		webhooks <- webhook{auth: r.Header.Get("Authorization"), body: body}
+	}))
+	defer receiver.Close()
+
+	refresh := func() {
+		t.Helper()
+		resp, err := http.Get(conf.BasePath + "/data/refresh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("bogus HTTP status: %s", resp.Status)
+		}
+	}
+
+	req := moov.OfacWatchRequest{AuthToken: "secret", Webhook: receiver.URL}
+	watch, _, err := api.WatchmanApi.AddOfacCustomerWatch(ctx, "22790", req, nil)
+	if err != nil || watch.WatchID == "" {
+		t.Fatalf("unexpected watch: %#v (%v)", watch, err)
+	}
+	refresh()
+	select {
+	case hook := <-webhooks:
+		var customer moov.OfacCustomer
+		if err := json.Unmarshal(hook.body, &customer); err != nil {
+			t.Fatal(err)
+		}
+		if hook.auth != "secret" || customer.ID != "22790" || customer.Sdn.SdnName != "MADURO MOROS, Nicolas" {
+			t.Errorf("unexpected webhook: %#v", customer)
+		}
+	default:
+		t.Fatal("no webhook")
+	}
+	downloads, _, err := api.WatchmanApi.GetLatestDownloads(ctx, nil)
+	if err != nil || len(downloads) != 2 || downloads[0].Timestamp.Before(downloads[1].Timestamp) {
+		t.Errorf("unexpected downloads: %#v (%v)", downloads, err)
+	}
+
+	if _, err := api.WatchmanApi.RemoveOfacCustomerWatch(ctx, "22790", watch.WatchID, nil); err != nil {
+		t.Fatal(err)
+	}
+	refresh()
+	if len(webhooks) != 0 {
+		t.Errorf("got %d webhooks after removing the watch", len(webhooks))
+	}
+
+	// name watches are sent search results
+	watch, _, err = api.WatchmanApi.AddOfacCompanyNameWatch(ctx, "Banco Nacional de Cuba", req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh()
+	var res moov.Search
+	if err := json.Unmarshal((<-webhooks).body, &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.SDNs) == 0 || res.SDNs[0].EntityID != "306" {
+		t.Errorf("unexpected search: %#v", res)
+	}
+	if resp, _ := api.WatchmanApi.RemoveOfacCompanyNameWatch(ctx, watch.WatchID, "Acme", nil); resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected response: %#v", resp)
+	}
+	if _, err := api.WatchmanApi.RemoveOfacCompanyNameWatch(ctx, watch.WatchID, "Banco Nacional de Cuba", nil); err != nil {
+		t.Error(err)
+	}
+
+	// individuals aren't companies and webhooks need to be URLs
+	if _, resp, _ := api.WatchmanApi.AddOfacCompanyWatch(ctx, "22790", req, nil); resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected response: %#v", resp)
+	}
+	req.Webhook = "moov.io"
+	if _, resp, _ := api.WatchmanApi.AddOfacCustomerWatch(ctx, "22790", req, nil); resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected response: %#v", resp)
+	}
+}
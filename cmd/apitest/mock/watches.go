@@ -0,0 +1,202 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/gorilla/mux"
+)
+
+// watch is a Watchman customer or company watch of one SDN (entityID) or of a name.
+// Its webhook is called after every refresh of sdnList.
+type watch struct {
+	moov.OfacWatchRequest
+
+	watchID  string
+	userID   string
+	kind     string // customer or company
+	entityID string
+	name     string
+}
+
+// watchKinds are the Watchman routes watches are served under, by kind. Customers are individuals
+// on the SDN list and companies are every other SDN.
+var watchKinds = []struct {
+	kind, path, param string
+}{
+	{kind: "customer", path: "/v1/watchman/ofac/customers", param: "customerID"},
+	{kind: "company", path: "/v1/watchman/companies", param: "companyID"},
+}
+
+func (s *Server) addWatchRoutes(r *mux.Router) {
+	r.Methods("GET").Path("/data/refresh").HandlerFunc(s.refreshSDNs) // admin route
+
+	for _, k := range watchKinds {
+		id := fmt.Sprintf("%s/{%s}", k.path, k.param)
+		r.Methods("GET").Path(id).HandlerFunc(s.authenticated(s.getWatchedEntity(k.kind, k.param)))
+		r.Methods("POST").Path(k.path + "/watch").HandlerFunc(s.authenticated(s.addWatch(k.kind, "")))
+		r.Methods("POST").Path(id + "/watch").HandlerFunc(s.authenticated(s.addWatch(k.kind, k.param)))
+		r.Methods("DELETE").Path(k.path + "/watch/{watchID}").HandlerFunc(s.authenticated(s.removeWatch(k.kind, "")))
+		r.Methods("DELETE").Path(id + "/watch/{watchID}").HandlerFunc(s.authenticated(s.removeWatch(k.kind, k.param)))
+	}
+}
+
+// lookupWatchedEntity returns the SDN of a customer (individual) or company (any other SDN).
+func lookupWatchedEntity(kind, id string) *sdnEntry {
+	for i := range sdnList {
+		if sdnList[i].sdn.EntityID != id {
+			continue
+		}
+		if individual := strings.EqualFold(sdnList[i].sdn.SdnType, "individual"); individual == (kind == "customer") {
+			return &sdnList[i]
+		}
+	}
+	return nil
+}
+
+// watchedEntity returns entry as an OfacCustomer or OfacCompany.
+func watchedEntity(kind string, entry *sdnEntry) interface{} {
+	if kind == "customer" {
+		return moov.OfacCustomer{ID: entry.sdn.EntityID, Sdn: entry.sdn, Addresses: entry.addresses, Alts: entry.alts}
+	}
+	return moov.OfacCompany{ID: entry.sdn.EntityID, Sdn: entry.sdn, Addresses: entry.addresses, Alts: entry.alts}
+}
+
+func (s *Server) getWatchedEntity(kind, param string) func(w http.ResponseWriter, r *http.Request, userID string) {
+	return func(w http.ResponseWriter, r *http.Request, _ string) {
+		id := mux.Vars(r)[param]
+		entry := lookupWatchedEntity(kind, id)
+		if entry == nil {
+			problem(w, http.StatusNotFound, "%s %s not found", kind, id)
+			return
+		}
+		writeJSON(w, http.StatusOK, watchedEntity(kind, entry))
+	}
+}
+
+// addWatch creates a watch of the customer or company in param, or of the name query parameter
+// when param is empty. Unlike Watchman, plain HTTP webhooks are accepted so apitest can receive
+// them locally.
+func (s *Server) addWatch(kind, param string) func(w http.ResponseWriter, r *http.Request, userID string) {
+	return func(w http.ResponseWriter, r *http.Request, userID string) {
+		var req moov.OfacWatchRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.AuthToken == "" {
+			problem(w, http.StatusBadRequest, "missing authToken")
+			return
+		}
+		if u, err := url.Parse(req.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problem(w, http.StatusBadRequest, "invalid webhook %q", req.Webhook)
+			return
+		}
+
+		wt := &watch{OfacWatchRequest: req, watchID: newID(), userID: userID, kind: kind}
+		if param != "" {
+			wt.entityID = mux.Vars(r)[param]
+			if lookupWatchedEntity(kind, wt.entityID) == nil {
+				problem(w, http.StatusNotFound, "%s %s not found", kind, wt.entityID)
+				return
+			}
+		} else if wt.name = strings.TrimSpace(r.URL.Query().Get("name")); wt.name == "" {
+			problem(w, http.StatusBadRequest, "missing name")
+			return
+		}
+
+		s.mu.Lock()
+		s.watches[wt.watchID] = wt
+		s.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, moov.OfacWatch{WatchID: wt.watchID})
+	}
+}
+
+// removeWatch deletes a watch of the customer or company in param, or of the name query parameter
+// when param is empty.
+func (s *Server) removeWatch(kind, param string) func(w http.ResponseWriter, r *http.Request, userID string) {
+	return func(w http.ResponseWriter, r *http.Request, userID string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		watchID := mux.Vars(r)["watchID"]
+		wt, exists := s.watches[watchID]
+		if !exists || wt.userID != userID || wt.kind != kind {
+			problem(w, http.StatusNotFound, "watch %s not found", watchID)
+			return
+		}
+		if param != "" && wt.entityID != mux.Vars(r)[param] {
+			problem(w, http.StatusNotFound, "watch %s isn't of %s %s", watchID, kind, mux.Vars(r)[param])
+			return
+		}
+		if param == "" && !strings.EqualFold(wt.name, strings.TrimSpace(r.URL.Query().Get("name"))) {
+			problem(w, http.StatusNotFound, "watch %s isn't of name %q", watchID, r.URL.Query().Get("name"))
+			return
+		}
+		delete(s.watches, watchID)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// refreshSDNs "downloads" sdnList again and calls the webhook of every watch, like Watchman's
+// GET /data/refresh admin route. Watches of a customer or company are sent its OfacCustomer or
+// OfacCompany and watches of a name are sent the Search results for it.
+func (s *Server) refreshSDNs(w http.ResponseWriter, r *http.Request) {
+	download := newSDNDownload()
+
+	s.mu.Lock()
+	s.sdnDownloads = append(s.sdnDownloads, download)
+	var watches []watch
+	for _, wt := range s.watches {
+		watches = append(watches, *wt)
+	}
+	s.mu.Unlock()
+
+	for _, wt := range watches {
+		var body interface{}
+		if wt.name != "" {
+			body = searchSDNList(wt.name, wt.name, "", 10, download.Timestamp)
+		} else {
+			body = watchedEntity(wt.kind, lookupWatchedEntity(wt.kind, wt.entityID))
+		}
+		if err := s.callWebhook(wt, body); err != nil {
+			log.Printf("ERROR: mock: watch %s: %v", wt.watchID, err)
+		}
+	}
+	writeJSON(w, http.StatusOK, download)
+}
+
+// callWebhook POSTs body as JSON to the watch's webhook with its authToken in the Authorization header.
+func (s *Server) callWebhook(wt watch, body interface{}) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", wt.Webhook, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", wt.AuthToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.webhooks.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded %s", wt.Webhook, resp.Status)
+	}
+	return nil
+}
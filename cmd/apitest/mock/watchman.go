@@ -0,0 +1,276 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/gorilla/mux"
+)
+
+// sdnEntry is one SDN along with its alternate names and addresses.
+type sdnEntry struct {
+	sdn       moov.OfacSdn
+	alts      []moov.OfacAlt
+	addresses []moov.OfacEntityAddress
+}
+
+// sdnList is a small sample of OFAC's SDN list which the mocked Watchman searches.
+var sdnList = []sdnEntry{
+	{
+		sdn: moov.OfacSdn{EntityID: "306", SdnName: "BANCO NACIONAL DE CUBA", SdnType: "", Programs: []string{"CUBA"}, Remarks: "a.k.a. 'BNC'."},
+		alts: []moov.OfacAlt{
+			{EntityID: "306", AlternateID: "219", AlternateType: "aka", AlternateName: "NATIONAL BANK OF CUBA"},
+		},
+		addresses: []moov.OfacEntityAddress{
+			{EntityID: "306", AddressID: "199", Address: "Zweierstrasse 35", CityStateProvincePostalCode: "Zurich CH-8022", Country: "Switzerland"},
+			{EntityID: "306", AddressID: "200", Address: "Avenida de Concha Espina 8", CityStateProvincePostalCode: "Madrid E-28036", Country: "Spain"},
+			{EntityID: "306", AddressID: "201", Address: "Dai-Ichi Bldg. 6th Floor, 10-2 Nihombashi, 2-chome, Chuo-ku", CityStateProvincePostalCode: "Tokyo 103", Country: "Japan"},
+		},
+	},
+	{
+		sdn: moov.OfacSdn{EntityID: "2681", SdnName: "HAWATMA, Nayif", SdnType: "individual", Programs: []string{"SDT"}, Title: "Secretary General of DEMOCRATIC FRONT FOR THE LIBERATION OF PALESTINE - HAWATMEH FACTION"},
+		alts: []moov.OfacAlt{
+			{EntityID: "2681", AlternateID: "1567", AlternateType: "aka", AlternateName: "HAWATMEH, Nayif"},
+			{EntityID: "2681", AlternateID: "1568", AlternateType: "aka", AlternateName: "KHALID, Abu"},
+		},
+	},
+	{
+		sdn: moov.OfacSdn{EntityID: "22790", SdnName: "MADURO MOROS, Nicolas", SdnType: "individual", Programs: []string{"VENEZUELA"}, Title: "President of the Bolivarian Republic of Venezuela"},
+	},
+}
+
+// addWatchmanRoutes serves Watchman's OFAC search, SDN and download routes from sdnList along with
+// customer and company watches (see watches.go).
+func (s *Server) addWatchmanRoutes(r *mux.Router) {
+	r.Methods("GET").Path("/v1/watchman/ofac/search").HandlerFunc(s.authenticated(s.searchSDNs))
+	r.Methods("GET").Path("/v1/watchman/ofac/downloads").HandlerFunc(s.authenticated(s.getSDNDownloads))
+	r.Methods("GET").Path("/v1/watchman/ofac/sdn/{sdnID}").HandlerFunc(s.authenticated(getSDN))
+	r.Methods("GET").Path("/v1/watchman/ofac/sdn/{sdnID}/alts").HandlerFunc(s.authenticated(getSDNAlts))
+	r.Methods("GET").Path("/v1/watchman/ofac/sdn/{sdnID}/addresses").HandlerFunc(s.authenticated(getSDNAddresses))
+	s.addWatchRoutes(r)
+}
+
+func findSDN(w http.ResponseWriter, r *http.Request) *sdnEntry {
+	id := mux.Vars(r)["sdnID"]
+	for i := range sdnList {
+		if sdnList[i].sdn.EntityID == id {
+			return &sdnList[i]
+		}
+	}
+	problem(w, http.StatusNotFound, "SDN %s not found", id)
+	return nil
+}
+
+func getSDN(w http.ResponseWriter, r *http.Request, _ string) {
+	if entry := findSDN(w, r); entry != nil {
+		writeJSON(w, http.StatusOK, entry.sdn)
+	}
+}
+
+func getSDNAlts(w http.ResponseWriter, r *http.Request, _ string) {
+	if entry := findSDN(w, r); entry != nil {
+		writeJSON(w, http.StatusOK, append([]moov.OfacAlt{}, entry.alts...))
+	}
+}
+
+func getSDNAddresses(w http.ResponseWriter, r *http.Request, _ string) {
+	if entry := findSDN(w, r); entry != nil {
+		writeJSON(w, http.StatusOK, append([]moov.OfacEntityAddress{}, entry.addresses...))
+	}
+}
+
+// newSDNDownload returns the counts of sdnList as if it was just downloaded.
+func newSDNDownload() moov.Download {
+	download := moov.Download{Timestamp: time.Now()}
+	for _, entry := range sdnList {
+		download.SDNs++
+		download.AltNames += int32(len(entry.alts))
+		download.Addresses += int32(len(entry.addresses))
+	}
+	return download
+}
+
+// latestSDNDownload returns the most recent refresh of sdnList. Callers must hold s.mu.
+func (s *Server) latestSDNDownload() moov.Download {
+	return s.sdnDownloads[len(s.sdnDownloads)-1]
+}
+
+// getSDNDownloads returns the refreshes of sdnList, newest first.
+func (s *Server) getSDNDownloads(w http.ResponseWriter, r *http.Request, _ string) {
+	limit := 10
+	if v, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []moov.Download
+	for i := len(s.sdnDownloads) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, s.sdnDownloads[i])
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// searchSDNs scores SDN names, alt names and addresses against the query like Watchman: names are
+// lowercased with punctuation removed, individuals (and queries) are reordered from "LAST, First" to
+// "first last" and compared with Jaro-Winkler. q searches everything, otherwise name, altName and address only
+// search their own kind.
+func (s *Server) searchSDNs(w http.ResponseWriter, r *http.Request, _ string) {
+	query := r.URL.Query()
+	limit := 10
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		limit = v
+	}
+	q := query.Get("q")
+	name, altName, address := query.Get("name"), query.Get("altName"), query.Get("address")
+	if name == "" {
+		name = q
+	}
+	if altName == "" {
+		altName = q
+	}
+	if address == "" {
+		address = q
+	}
+	if name == "" && altName == "" && address == "" {
+		problem(w, http.StatusBadRequest, "missing search parameter")
+		return
+	}
+
+	s.mu.Lock()
+	refreshedAt := s.latestSDNDownload().Timestamp
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, searchSDNList(name, altName, address, limit, refreshedAt))
+}
+
+// searchSDNList returns the limit best matches of sdnList for name, altName and address. Empty
+// parameters aren't searched.
+func searchSDNList(name, altName, address string, limit int, refreshedAt time.Time) moov.Search {
+	out := moov.Search{
+		SDNs:        []moov.OfacSdn{},
+		AltNames:    []moov.OfacAlt{},
+		Addresses:   []moov.OfacEntityAddress{},
+		RefreshedAt: refreshedAt,
+	}
+	for _, entry := range sdnList {
+		if name != "" {
+			sdn := entry.sdn
+			sdn.Match = float32(jaroWinkler(normalizeSDNName(sdn.SdnName, sdn.SdnType), normalizeSDNName(name, "individual")))
+			out.SDNs = append(out.SDNs, sdn)
+		}
+		if altName != "" {
+			for _, alt := range entry.alts {
+				alt.Match = float32(jaroWinkler(normalizeSDNName(alt.AlternateName, entry.sdn.SdnType), normalizeSDNName(altName, "individual")))
+				out.AltNames = append(out.AltNames, alt)
+			}
+		}
+		if address != "" {
+			for _, addr := range entry.addresses {
+				addr.Match = float32(jaroWinkler(normalizeSDNName(addr.Address, ""), normalizeSDNName(address, "")))
+				out.Addresses = append(out.Addresses, addr)
+			}
+		}
+	}
+	sort.SliceStable(out.SDNs, func(i, j int) bool { return out.SDNs[i].Match > out.SDNs[j].Match })
+	sort.SliceStable(out.AltNames, func(i, j int) bool { return out.AltNames[i].Match > out.AltNames[j].Match })
+	sort.SliceStable(out.Addresses, func(i, j int) bool { return out.Addresses[i].Match > out.Addresses[j].Match })
+	if len(out.SDNs) > limit {
+		out.SDNs = out.SDNs[:limit]
+	}
+	if len(out.AltNames) > limit {
+		out.AltNames = out.AltNames[:limit]
+	}
+	if len(out.Addresses) > limit {
+		out.Addresses = out.Addresses[:limit]
+	}
+	return out
+}
+
+// normalizeSDNName lowercases name and removes punctuation. Individuals are listed as "LAST, First"
+// so they're reordered to "first last".
+func normalizeSDNName(name, sdnType string) string {
+	if strings.EqualFold(sdnType, "individual") {
+		if parts := strings.SplitN(name, ",", 2); len(parts) == 2 {
+			name = parts[1] + " " + parts[0]
+		}
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b, from 0 (nothing in common) to 1 (equal).
+func jaroWinkler(a, b string) float64 {
+	s1, s2 := []rune(a), []rune(b)
+	if len(s1) == 0 || len(s2) == 0 {
+		return 0
+	}
+	window := len(s1)
+	if len(s2) > window {
+		window = len(s2)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+
+	m1, m2 := make([]bool, len(s1)), make([]bool, len(s2))
+	matches := 0
+	for i := range s1 {
+		lo, hi := i-window, i+window+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(s2) {
+			hi = len(s2)
+		}
+		for j := lo; j < hi; j++ {
+			if !m2[j] && s1[i] == s2[j] {
+				m1[i], m2[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, k := 0, 0
+	for i := range s1 {
+		if !m1[i] {
+			continue
+		}
+		for !m2[k] {
+			k++
+		}
+		if s1[i] != s2[k] {
+			transpositions++
+		}
+		k++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(s1)) + m/float64(len(s2)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < 4 && prefix < len(s1) && prefix < len(s2) && s1[prefix] == s2[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,289 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package mock
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/gorilla/mux"
+)
+
+// addWireRoutes serves the Fedwire files API (/v1/wire/files). Files are only accepted as JSON and
+// messages are validated for the CTR, CTP and DRC business function codes. Contents are written
+// with one tag per line.
+func (s *Server) addWireRoutes(r *mux.Router) {
+	r.Methods("GET").Path("/v1/wire/files").HandlerFunc(s.authenticated(s.getWireFiles))
+	r.Methods("POST").Path("/v1/wire/files/create").HandlerFunc(s.authenticated(s.createWireFile))
+	r.Methods("GET").Path("/v1/wire/files/{fileID}").HandlerFunc(s.authenticated(s.getWireFile))
+	r.Methods("DELETE").Path("/v1/wire/files/{fileID}").HandlerFunc(s.authenticated(s.deleteWireFile))
+	r.Methods("GET").Path("/v1/wire/files/{fileID}/contents").HandlerFunc(s.authenticated(s.getWireFileContents))
+	r.Methods("GET").Path("/v1/wire/files/{fileID}/validate").HandlerFunc(s.authenticated(s.validateWireFile))
+	r.Methods("POST").Path("/v1/wire/files/{fileID}/FEDWireMessage").HandlerFunc(s.authenticated(s.addFEDWireMessage))
+}
+
+func (s *Server) getWireFiles(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]moov.WireFile, 0, len(s.wireFiles))
+	for _, file := range s.wireFiles {
+		out = append(out, *file)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) createWireFile(w http.ResponseWriter, r *http.Request, _ string) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		problem(w, http.StatusBadRequest, "only JSON files can be created")
+		return
+	}
+	var file moov.WireFile
+	if !readJSON(w, r, &file) {
+		return
+	}
+	for i := range file.FedWireMessage {
+		if err := validateFEDWireMessage(file.FedWireMessage[i]); err != nil {
+			problem(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+	if file.ID == "" {
+		file.ID = newID()
+	}
+
+	s.mu.Lock()
+	s.wireFiles[file.ID] = &file
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, file)
+}
+
+func (s *Server) getWireFile(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.wireFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, file)
+}
+
+func (s *Server) deleteWireFile(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fileID := mux.Vars(r)["fileID"]
+	if s.wireFiles[fileID] == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	delete(s.wireFiles, fileID)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getWireFileContents(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.wireFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	var lines []string
+	for _, fwm := range file.FedWireMessage {
+		lines = append(lines, fedWireTags(fwm)...)
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+}
+
+func (s *Server) validateWireFile(w http.ResponseWriter, r *http.Request, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.wireFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	if len(file.FedWireMessage) == 0 {
+		problem(w, http.StatusBadRequest, "file has no FEDWireMessage")
+		return
+	}
+	for i := range file.FedWireMessage {
+		if err := validateFEDWireMessage(file.FedWireMessage[i]); err != nil {
+			problem(w, http.StatusBadRequest, "%v", err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"error": nil})
+}
+
+// addFEDWireMessage replaces the file's message, as a Fedwire file only holds one.
+func (s *Server) addFEDWireMessage(w http.ResponseWriter, r *http.Request, _ string) {
+	var fwm moov.FedWireMessage
+	if !readJSON(w, r, &fwm) {
+		return
+	}
+	if err := validateFEDWireMessage(fwm); err != nil {
+		problem(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file := s.wireFiles[mux.Vars(r)["fileID"]]
+	if file == nil {
+		problem(w, http.StatusNotFound, "file not found")
+		return
+	}
+	file.FedWireMessage = []moov.FedWireMessage{fwm}
+	writeJSON(w, http.StatusOK, file)
+}
+
+// fieldError formats errors like wire's FieldError: the field, its value and what's wrong with it.
+func fieldError(field, value, msg string) error {
+	return fmt.Errorf("%s %q %s", field, value, msg)
+}
+
+// validateFEDWireMessage checks the mandatory tags of fwm and the tags its business function code
+// needs or doesn't allow.
+func validateFEDWireMessage(fwm moov.FedWireMessage) error {
+	if v := fwm.SenderSupplied.FormatVersion; v != "30" {
+		return fieldError("FormatVersion", v, "is invalid")
+	}
+	if v := fwm.SenderSupplied.TestProductionCode; v != "T" && v != "P" {
+		return fieldError("TestProductionCode", v, "is invalid")
+	}
+	if v := fwm.InputMessageAccountabilityData.InputCycleDate; !digits(v, 8) {
+		return fieldError("InputCycleDate", v, "is not a YYYYMMDD date")
+	}
+	if v := fwm.Amount.Amount; !digits(v, 12) || strings.Trim(v, "0") == "" {
+		return fieldError("Amount", v, "needs to be 12 digits and more than zero")
+	}
+	if v := fwm.SenderDepositoryInstitution.SenderABANumber; !digits(v, 9) {
+		return fieldError("SenderABANumber", v, "is not a routing number")
+	}
+	if v := fwm.ReceiverDepositoryInstitution.ReceiverABANumber; !digits(v, 9) {
+		return fieldError("ReceiverABANumber", v, "is not a routing number")
+	}
+
+	typeSubType := fwm.TypeSubType.TypeCode + fwm.TypeSubType.SubTypeCode
+	bfc := fwm.BusinessFunctionCode.BusinessFunctionCode
+	drawdown := fwm.AccountDebitedDrawdown != (moov.AccountDebitedDrawdown{}) || fwm.AccountCreditedDrawdown != (moov.AccountCreditedDrawdown{})
+	switch bfc {
+	case "CTR", "CTP":
+		if typeSubType != "1000" && typeSubType != "1002" && typeSubType != "1008" {
+			return fieldError("TypeSubType", typeSubType, "is invalid for BusinessFunctionCode "+bfc)
+		}
+		if err := validatePersonal("Beneficiary", fwm.Beneficiary); err != nil {
+			return err
+		}
+		if err := validatePersonal("Originator", fwm.Originator); err != nil {
+			return err
+		}
+		if drawdown {
+			return fieldError("AccountDebitedDrawdown", fwm.AccountDebitedDrawdown.Identifier, "is invalid for BusinessFunctionCode "+bfc)
+		}
+		li := fwm.LocalInstrument
+		if bfc == "CTR" && li != (moov.LocalInstrument{}) {
+			return fieldError("LocalInstrument", li.LocalInstrumentCode, "is invalid for BusinessFunctionCode CTR")
+		}
+		if li.LocalInstrumentCode == "PROP" && li.ProprietaryCode == "" {
+			return fieldError("ProprietaryCode", li.ProprietaryCode, "is required for LocalInstrumentCode PROP")
+		}
+	case "DRC":
+		if typeSubType != "1031" {
+			return fieldError("TypeSubType", typeSubType, "is invalid for BusinessFunctionCode DRC")
+		}
+		if v := fwm.AccountDebitedDrawdown; v.Identifier == "" || v.Name == "" {
+			return fieldError("AccountDebitedDrawdown", v.Identifier, "is required for BusinessFunctionCode DRC")
+		}
+		if err := validatePersonal("Beneficiary", fwm.Beneficiary); err != nil {
+			return err
+		}
+		if v := fwm.AccountCreditedDrawdown.DrawdownCreditAccountNumber; !digits(v, 9) {
+			return fieldError("DrawdownCreditAccountNumber", v, "is required for BusinessFunctionCode DRC")
+		}
+	default:
+		return fieldError("BusinessFunctionCode", bfc, "is not supported")
+	}
+	return nil
+}
+
+func validatePersonal(tag string, p moov.Personal) error {
+	if p.Identifier == "" || p.Name == "" {
+		return fieldError(tag, p.Identifier, "is required")
+	}
+	switch p.IdentificationCode {
+	case "B", "C", "D", "F", "U", "1", "2", "3", "4", "5", "9":
+	default:
+		return fieldError(tag+" IdentificationCode", p.IdentificationCode, "is invalid")
+	}
+	if len(p.Identifier) > 34 || len(p.Name) > 35 {
+		return errors.New(tag + " Identifier or Name is too long")
+	}
+	return nil
+}
+
+// fedWireTags returns the tags of fwm as Fedwire writes them, e.g. {2000}000000001234. Optional
+// tags are only written when they're set.
+func fedWireTags(fwm moov.FedWireMessage) []string {
+	ss, ima := fwm.SenderSupplied, fwm.InputMessageAccountabilityData
+	tags := []string{
+		"{1500}" + alpha(ss.FormatVersion, 2) + alpha(ss.UserRequestCorrelation, 8) + alpha(ss.TestProductionCode, 1) + alpha(ss.MessageDuplicationCode, 1),
+		"{1510}" + alpha(fwm.TypeSubType.TypeCode, 2) + alpha(fwm.TypeSubType.SubTypeCode, 2),
+		"{1520}" + alpha(ima.InputCycleDate, 8) + alpha(ima.InputSource, 8) + alpha(ima.InputSequenceNumber, 6),
+		"{2000}" + alpha(fwm.Amount.Amount, 12),
+		"{3100}" + alpha(fwm.SenderDepositoryInstitution.SenderABANumber, 9) + alpha(fwm.SenderDepositoryInstitution.SenderShortName, 18),
+	}
+	if v := fwm.SenderReference.SenderReference; v != "" {
+		tags = append(tags, "{3320}"+alpha(v, 16))
+	}
+	tags = append(tags,
+		"{3400}"+alpha(fwm.ReceiverDepositoryInstitution.ReceiverABANumber, 9)+alpha(fwm.ReceiverDepositoryInstitution.ReceiverShortName, 18),
+		"{3600}"+alpha(fwm.BusinessFunctionCode.BusinessFunctionCode, 3)+alpha(fwm.BusinessFunctionCode.TransactionTypeCode, 3),
+	)
+	if li := fwm.LocalInstrument; li != (moov.LocalInstrument{}) {
+		tags = append(tags, "{3610}"+alpha(li.LocalInstrumentCode, 4)+alpha(li.ProprietaryCode, 35))
+	}
+	if fwm.BeneficiaryFI != (moov.FinancialInstitution{}) {
+		fi := fwm.BeneficiaryFI
+		tags = append(tags, "{4100}"+fedWireParty(fi.IdentificationCode, fi.Identifier, fi.Name, fi.Address))
+	}
+	if fwm.Beneficiary != (moov.Personal{}) {
+		tags = append(tags, "{4200}"+fedWireParty(fwm.Beneficiary.IdentificationCode, fwm.Beneficiary.Identifier, fwm.Beneficiary.Name, fwm.Beneficiary.Address))
+	}
+	if add := fwm.AccountDebitedDrawdown; add != (moov.AccountDebitedDrawdown{}) {
+		tags = append(tags, "{4400}"+fedWireParty(add.IdentificationCode, add.Identifier, add.Name, moov.WireAddress{
+			AddressLineOne: add.AddressLineOne, AddressLineTwo: add.AddressLineTwo, AddressLineThree: add.AddressLineThree,
+		}))
+	}
+	if fwm.Originator != (moov.Personal{}) {
+		tags = append(tags, "{5000}"+fedWireParty(fwm.Originator.IdentificationCode, fwm.Originator.Identifier, fwm.Originator.Name, fwm.Originator.Address))
+	}
+	if v := fwm.AccountCreditedDrawdown.DrawdownCreditAccountNumber; v != "" {
+		tags = append(tags, "{5400}"+alpha(v, 9))
+	}
+	if ob := fwm.OriginatorToBeneficiary; ob != (moov.OriginatorToBeneficiary{}) {
+		tags = append(tags, "{6000}"+alpha(ob.LineOne, 35)+alpha(ob.LineTwo, 35)+alpha(ob.LineThree, 35)+alpha(ob.LineFour, 35))
+	}
+	return tags
+}
+
+func fedWireParty(idCode, identifier, name string, addr moov.WireAddress) string {
+	return alpha(idCode, 1) + alpha(identifier, 34) + alpha(name, 35) +
+		alpha(addr.AddressLineOne, 35) + alpha(addr.AddressLineTwo, 35) + alpha(addr.AddressLineThree, 35)
+}
@@ -0,0 +1,258 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/moov-io/api/cmd/apitest/contract"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+var (
+	flagNegative       = flag.Bool("negative", false, "Send invalid payloads to each create call and verify they're rejected with a 4xx status and Error body")
+	flagNegativeSchema = flag.String("negative.schema", "openapi-common.yaml#/components/schemas/Error", "OpenAPI schema 4xx response bodies are validated against")
+
+	// errorSchema is read from -negative.schema, when it's nil only the error field is checked.
+	errorSchema *contract.Schema
+)
+
+// negativeCase is a create call with one invalid or malformed field which needs to be rejected.
+type negativeCase struct {
+	name string
+	path string
+
+	// body is marshaled as JSON, strings are sent as-is to test malformed JSON
+	body interface{}
+
+	// statuses are the accepted HTTP statuses
+	statuses []int
+}
+
+// setupNegative reads the Error schema for -negative.
+func setupNegative() error {
+	if !*flagNegative {
+		return nil
+	}
+	if err := checkSpecFiles("negative.schema", *flagNegativeSchema); err != nil {
+		return err
+	}
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	schema, err := contract.LoadSchema(client, *flagNegativeSchema)
+	if err != nil {
+		return fmt.Errorf("reading -negative.schema: %v", err)
+	}
+	errorSchema = schema
+	return nil
+}
+
+// checkNegative sends every negativeCase for iter. Each case is recorded as a step of a "negative"
+// suite and the cases which weren't properly rejected are returned in the error.
+func checkNegative(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+
+	suite := report.newSuite("negative")
+
+	var failed []string
+	for _, c := range negativeCases(iter) {
+		c := c
+		err := suite.step(c.name, func() error {
+			return c.run(ctx, conf)
+		})
+		if err != nil {
+			log.Printf("ERROR: %s wasn't rejected properly: %v", c.name, err)
+			failed = append(failed, c.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("invalid requests weren't rejected properly: %s", strings.Join(failed, ", "))
+	}
+	log.Println("SUCCESS: every invalid create call was rejected with an Error body")
+	return nil
+}
+
+func (c negativeCase) run(ctx context.Context, conf *moov.Configuration) error {
+	var body []byte
+	if s, ok := c.body.(string); ok {
+		body = []byte(s)
+	} else {
+		bs, err := json.Marshal(c.body)
+		if err != nil {
+			return err
+		}
+		body = bs
+	}
+
+	req, err := http.NewRequest("POST", conf.BasePath+c.path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range conf.DefaultHeader {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", conf.UserAgent)
+	req.Header.Set("X-Idempotency-Key", generateID())
+
+	resp, err := conf.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	bs, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %v", err)
+	}
+	if !containsStatus(c.statuses, resp.StatusCode) {
+		return fmt.Errorf("got HTTP status %s, expected %v: %s", resp.Status, c.statuses, strings.TrimSpace(string(bs)))
+	}
+	if err := checkCORSHeaders(resp); err != nil {
+		return err
+	}
+	return checkErrorBody(resp.Header, bs)
+}
+
+func containsStatus(statuses []int, status int) bool {
+	for i := range statuses {
+		if statuses[i] == status {
+			return true
+		}
+	}
+	return false
+}
+
+// checkErrorBody returns an error if a 4xx response body isn't JSON with a non-empty error field.
+// The body is also validated against -negative.schema when it was read.
+func checkErrorBody(header http.Header, body []byte) error {
+	if ct := header.Get("Content-Type"); !strings.Contains(ct, "json") {
+		return fmt.Errorf("expected a JSON error body, got Content-Type %q", ct)
+	}
+	var problem struct {
+		Error *string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &problem); err != nil {
+		return fmt.Errorf("invalid JSON error body %q: %v", string(body), err)
+	}
+	if problem.Error == nil {
+		return fmt.Errorf("error body %q is missing the error field", string(body))
+	}
+	if strings.TrimSpace(*problem.Error) == "" {
+		return errors.New("error field is empty")
+	}
+	if errorSchema != nil {
+		if violations := errorSchema.Validate(body); len(violations) > 0 {
+			msgs := make([]string, 0, len(violations))
+			for i := range violations {
+				msgs = append(msgs, violations[i].Error())
+			}
+			return fmt.Errorf("error body doesn't match schema: %s", strings.Join(msgs, ", "))
+		}
+	}
+	return nil
+}
+
+// withField returns v as a JSON object with one field replaced (or removed when value is nil).
+func withField(v interface{}, field string, value interface{}) map[string]interface{} {
+	bs, _ := json.Marshal(v)
+	out := make(map[string]interface{})
+	json.Unmarshal(bs, &out)
+	if value == nil {
+		delete(out, field)
+	} else {
+		out[field] = value
+	}
+	return out
+}
+
+// negativeCases returns the invalid create calls. Each case starts from a valid request for the
+// objects of iter so only the field being tested is wrong.
+func negativeCases(iter *iteration) []negativeCase {
+	badRequest := []int{http.StatusBadRequest}
+	notFound := []int{http.StatusBadRequest, http.StatusNotFound}
+	badRoutingNumber := "123456789" // fails the checksum
+	badDate := "04/10/2020"
+
+	first, last := name()
+	userReq := moov.CreateUser{
+		Email:     email(first, last),
+		Password:  *flagPassword,
+		FirstName: first,
+		LastName:  last,
+		Phone:     phone(),
+	}
+	gatewayReq := moov.CreateGateway{
+		Origin:          iter.gateway.Origin,
+		OriginName:      iter.gateway.OriginName,
+		Destination:     iter.gateway.Destination,
+		DestinationName: iter.gateway.DestinationName,
+	}
+	depReq := moov.CreateDepository{
+		BankName:      "Moov Bank",
+		AccountNumber: iter.originatorDepository.AccountNumber,
+		RoutingNumber: iter.originatorDepository.RoutingNumber,
+		Holder:        iter.originatorDepository.Holder,
+		HolderType:    "Individual",
+		Type:          iter.originatorDepository.Type,
+	}
+	origReq := newOriginatorRequest(iter.featureFlags, iter.originatorDepository.ID)
+	receiverReq := newReceiverRequest(iter.user, iter.featureFlags, iter.receiverDepository.ID)
+	transferReq := newTransferRequest(iter.receiver, iter.originator, amount(), transferKind{
+		secCode:      iter.transfer.StandardEntryClassCode,
+		transferType: iter.transfer.TransferType,
+	})
+
+	cases := []negativeCase{
+		{"createUser: missing password", "/v1/users/create", withField(userReq, "password", nil), badRequest},
+		{"createUser: malformed JSON", "/v1/users/create", `{"email": "`, badRequest},
+
+		{"addGateway: bad origin routing number", "/v1/ach/gateways", withField(gatewayReq, "origin", badRoutingNumber), badRequest},
+
+		{"addDepository: bad routing number", "/v1/ach/depositories", withField(depReq, "routingNumber", badRoutingNumber), badRequest},
+		{"addDepository: short routing number", "/v1/ach/depositories", withField(depReq, "routingNumber", "12345"), badRequest},
+		{"addDepository: missing account number", "/v1/ach/depositories", withField(depReq, "accountNumber", nil), badRequest},
+		{"addDepository: malformed JSON", "/v1/ach/depositories", `{"bankName": "Moov Bank",`, badRequest},
+
+		{"addOriginator: missing depository", "/v1/ach/originators", withField(origReq, "defaultDepository", generateID()), notFound},
+		{"addOriginator: bad birthDate", "/v1/ach/originators", withField(origReq, "birthDate", badDate), badRequest},
+
+		{"addReceivers: missing depository", "/v1/ach/receivers", withField(receiverReq, "defaultDepository", generateID()), notFound},
+		{"addReceivers: bad birthDate", "/v1/ach/receivers", withField(receiverReq, "birthDate", badDate), badRequest},
+
+		{"addTransfer: negative amount", "/v1/ach/transfers", withField(transferReq, "amount", "USD -12.34"), badRequest},
+		{"addTransfer: amount without currency", "/v1/ach/transfers", withField(transferReq, "amount", "12.34"), badRequest},
+		{"addTransfer: unknown SEC code", "/v1/ach/transfers", withField(transferReq, "standardEntryClassCode", "XYZ"), badRequest},
+		{"addTransfer: missing originator depository", "/v1/ach/transfers", withField(transferReq, "originatorDepository", generateID()), notFound},
+		{"addTransfer: missing receiver", "/v1/ach/transfers", withField(transferReq, "receiver", generateID()), notFound},
+	}
+	if !iter.featureFlags.AccountsCallsDisabled {
+		acctReq := moov.CreateAccount{
+			CustomerID: iter.user.ID,
+			Name:       "Negative Test",
+			Type:       "Savings",
+		}
+		cases = append(cases, negativeCase{
+			"createAccount: missing name", "/v1/accounts", withField(acctReq, "name", nil), badRequest,
+		})
+	}
+	return cases
+}
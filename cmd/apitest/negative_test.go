@@ -0,0 +1,53 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/moov-io/api/cmd/apitest/contract"
+)
+
+func TestCheckErrorBody(t *testing.T) {
+	schema, err := contract.LoadSchema(nil, filepath.Join("..", "..", "openapi-common.yaml")+"#/components/schemas/Error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorSchema = schema
+	defer func() { errorSchema = nil }()
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json; charset=utf-8")
+
+	if err := checkErrorBody(header, []byte(`{"error": "invalid amount"}`)); err != nil {
+		t.Error(err)
+	}
+	for _, body := range []string{``, `[]`, `{}`, `{"error": ""}`, `{"error": 12}`, `{"message": "invalid amount"}`} {
+		if err := checkErrorBody(header, []byte(body)); err == nil {
+			t.Errorf("%s: expected error", body)
+		}
+	}
+	if err := checkErrorBody(make(http.Header), []byte(`{"error": "invalid amount"}`)); err == nil {
+		t.Error("expected error without a JSON Content-Type")
+	}
+}
+
+func TestWithField(t *testing.T) {
+	req := struct {
+		Amount string `json:"amount"`
+		SEC    string `json:"standardEntryClassCode"`
+	}{"USD 12.34", "PPD"}
+
+	out := withField(req, "amount", "USD -1.00")
+	if out["amount"] != "USD -1.00" || out["standardEntryClassCode"] != "PPD" {
+		t.Errorf("unexpected object: %#v", out)
+	}
+	out = withField(req, "amount", nil)
+	if _, exists := out["amount"]; exists || len(out) != 1 {
+		t.Errorf("unexpected object: %#v", out)
+	}
+}
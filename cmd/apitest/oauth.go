@@ -90,6 +90,12 @@ func attemptFailedOAuth2Login(ctx context.Context, api *moov.APIClient) error {
 		if err := checkCORSHeaders(resp); err != nil {
 			return fmt.Errorf("attempt failed oauth login: %v", err)
 		}
+		// -negative also requires an Error body on rejected credentials
+		if e, ok := err.(moov.GenericOpenAPIError); ok && *flagNegative {
+			if err := checkErrorBody(resp.Header, e.Body()); err != nil {
+				return fmt.Errorf("attempt failed oauth login: %v", err)
+			}
+		}
 	}
 	if err == nil {
 		bs, err := ioutil.ReadAll(resp.Body)
@@ -0,0 +1,349 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	flagReportJUnit = flag.String("report.junit", "", "Write per-step results as JUnit XML to the given file")
+	flagReportJSON  = flag.String("report.json", "", "Write per-step results as JSON to the given file")
+
+	// report collects every suite (iterate() call, scenario, etc) ran by apitest.
+	report = newRunReport()
+)
+
+// runReport holds the results of each step apitest has performed, grouped by suites.
+type runReport struct {
+	mu      sync.Mutex
+	started time.Time
+	suites  []*suiteResult
+}
+
+func newRunReport() *runReport {
+	return &runReport{
+		started: time.Now(),
+	}
+}
+
+// newSuite starts recording a group of steps. Suites are numbered in the order they're created.
+func (r *runReport) newSuite(name string) *suiteResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	suite := &suiteResult{
+		Name:    fmt.Sprintf("%s %d", name, len(r.suites)+1),
+		Started: time.Now(),
+	}
+	r.suites = append(r.suites, suite)
+	return suite
+}
+
+func (r *runReport) snapshot() []*suiteResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]*suiteResult, len(r.suites))
+	for i := range r.suites {
+		out[i] = r.suites[i].copy()
+	}
+	return out
+}
+
+// suiteResult is an ordered set of steps, typically one iterate() call.
+type suiteResult struct {
+	mu sync.Mutex
+
+	Name    string        `json:"name"`
+	Started time.Time     `json:"started"`
+	Steps   []*stepResult `json:"steps"`
+
+	// details of the most recent HTTP response, see suiteTransport
+	lastStatusCode int
+	lastRequestID  string
+}
+
+// stepResult is the outcome of one operation (e.g. createUser) inside a suite.
+type stepResult struct {
+	Name            string    `json:"name"`
+	Started         time.Time `json:"started"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	RequestID       string    `json:"requestID,omitempty"`
+	StatusCode      int       `json:"statusCode,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	Skipped         string    `json:"skipped,omitempty"` // why the step didn't run its checks
+}
+
+// skipError is returned by a step which couldn't run its checks, see skipStep.
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+// skipStep returns an error which makes step record a skip rather than a pass or failure.
+func skipStep(format string, args ...interface{}) error {
+	return &skipError{reason: fmt.Sprintf(format, args...)}
+}
+
+// step runs f and records its duration, error and the last HTTP response made while running.
+// If f returns skipStep(...) the step is recorded as skipped and nil is returned.
+func (s *suiteResult) step(name string, f func() error) error {
+	s.mu.Lock()
+	s.lastStatusCode, s.lastRequestID = 0, ""
+	s.mu.Unlock()
+
+	start := time.Now()
+	err := f()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &stepResult{
+		Name:            name,
+		Started:         start,
+		DurationSeconds: time.Since(start).Seconds(),
+		RequestID:       s.lastRequestID,
+		StatusCode:      s.lastStatusCode,
+	}
+	var skip *skipError
+	if errors.As(err, &skip) {
+		log.Printf("SKIP: %s %s: %s", s.Name, name, skip.reason)
+		result.Skipped = skip.reason
+		err = nil
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	s.Steps = append(s.Steps, result)
+	return err
+}
+
+func (s *suiteResult) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.Steps {
+		if s.Steps[i].Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *suiteResult) copy() *suiteResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := &suiteResult{
+		Name:    s.Name,
+		Started: s.Started,
+	}
+	for i := range s.Steps {
+		step := *s.Steps[i]
+		out.Steps = append(out.Steps, &step)
+	}
+	return out
+}
+
+// wrap returns an http.RoundTripper which records each response's status and X-Request-ID
+// so steps can report them.
+func (s *suiteResult) wrap(underlying http.RoundTripper) http.RoundTripper {
+	return &suiteTransport{
+		suite:      s,
+		underlying: underlying,
+	}
+}
+
+type suiteTransport struct {
+	suite      *suiteResult
+	underlying http.RoundTripper
+}
+
+func (t *suiteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestID := req.Header.Get("X-Request-ID")
+
+	resp, err := t.underlying.RoundTrip(req)
+
+	t.suite.mu.Lock()
+	defer t.suite.mu.Unlock()
+	if resp != nil {
+		t.suite.lastStatusCode = resp.StatusCode
+		if v := resp.Header.Get("X-Request-ID"); v != "" {
+			requestID = v
+		}
+	}
+	t.suite.lastRequestID = requestID
+	return resp, err
+}
+
+// writeReports saves the JUnit XML, JSON and coverage reports if they were requested.
+func writeReports() {
+	suites := report.snapshot()
+	if *flagReportJUnit != "" {
+		if err := writeReportFile(*flagReportJUnit, suites, writeJUnitReport); err != nil {
+			log.Printf("ERROR: writing JUnit report: %v", err)
+		}
+	}
+	if *flagReportJSON != "" {
+		if err := writeReportFile(*flagReportJSON, suites, writeJSONReport); err != nil {
+			log.Printf("ERROR: writing JSON report: %v", err)
+		}
+	}
+	writeCoverage()
+}
+
+func writeReportFile(path string, suites []*suiteResult, write func(io.Writer, []*suiteResult) error) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(fd, suites); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// fatalf writes any reports (and a recorded cassette) before exiting like log.Fatalf does.
+func fatalf(format string, args ...interface{}) {
+	writeReports()
+	saveCassette()
+	log.Fatalf(format, args...)
+}
+
+type jsonReport struct {
+	Started time.Time    `json:"started"`
+	Passed  bool         `json:"passed"`
+	Suites  []*jsonSuite `json:"suites"`
+}
+
+type jsonSuite struct {
+	*suiteResult
+	Passed bool `json:"passed"`
+}
+
+func writeJSONReport(w io.Writer, suites []*suiteResult) error {
+	out := jsonReport{
+		Started: report.started,
+		Passed:  true,
+	}
+	for i := range suites {
+		passed := !suites[i].failed()
+		out.Passed = out.Passed && passed
+		out.Suites = append(out.Suites, &jsonSuite{
+			suiteResult: suites[i],
+			Passed:      passed,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// JUnit XML format, see https://llg.cubic.org/docs/junit/
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func writeJUnitReport(w io.Writer, suites []*suiteResult) error {
+	out := junitTestSuites{
+		Name: "apitest",
+	}
+	var total float64
+	for i := range suites {
+		suite := junitTestSuite{
+			Name:      suites[i].Name,
+			Timestamp: suites[i].Started.UTC().Format(time.RFC3339),
+		}
+		var elapsed float64
+		for _, step := range suites[i].Steps {
+			tc := junitTestCase{
+				Name:      step.Name,
+				ClassName: fmt.Sprintf("apitest.%s", suites[i].Name),
+				Time:      fmt.Sprintf("%.3f", step.DurationSeconds),
+				SystemOut: fmt.Sprintf("request_id=%s status=%d", step.RequestID, step.StatusCode),
+			}
+			if step.Error != "" {
+				tc.Failure = &junitFailure{
+					Message: step.Error,
+					Body:    step.Error,
+				}
+				suite.Failures++
+			}
+			if step.Skipped != "" {
+				tc.Skipped = &junitSkipped{Message: step.Skipped}
+				suite.Skipped++
+			}
+			suite.Tests++
+			suite.Cases = append(suite.Cases, tc)
+			elapsed += step.DurationSeconds
+		}
+		suite.Time = fmt.Sprintf("%.3f", elapsed)
+		out.Tests += suite.Tests
+		out.Failures += suite.Failures
+		out.Skipped += suite.Skipped
+		out.Suites = append(out.Suites, suite)
+		total += elapsed
+	}
+	out.Time = fmt.Sprintf("%.3f", total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
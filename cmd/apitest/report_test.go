@@ -0,0 +1,115 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReport__step(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer svc.Close()
+
+	r := newRunReport()
+	suite := r.newSuite("iterate")
+	if suite.Name != "iterate 1" {
+		t.Errorf("suite.Name=%q", suite.Name)
+	}
+	client := &http.Client{
+		Transport: suite.wrap(http.DefaultTransport),
+	}
+
+	err := suite.step("createUser", func() error {
+		req, _ := http.NewRequest("POST", svc.URL, nil)
+		req.Header.Set("X-Request-ID", "foo")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = suite.step("createTransfer", func() error {
+		return errors.New("bad thing")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	suites := r.snapshot()
+	if len(suites) != 1 || len(suites[0].Steps) != 2 {
+		t.Fatalf("unexpected suites: %#v", suites)
+	}
+	if step := suites[0].Steps[0]; step.StatusCode != http.StatusCreated || step.RequestID != "foo" || step.Error != "" {
+		t.Errorf("unexpected step: %#v", step)
+	}
+	if step := suites[0].Steps[1]; step.StatusCode != 0 || step.Error != "bad thing" {
+		t.Errorf("unexpected step: %#v", step)
+	}
+	if !suites[0].failed() {
+		t.Error("expected failed suite")
+	}
+}
+
+func TestReport__write(t *testing.T) {
+	r := newRunReport()
+	suite := r.newSuite("iterate")
+	suite.step("createUser", func() error { return nil })
+	suite.step("createTransfer", func() error { return errors.New("bad thing") })
+	suite.step("cors", func() error { return skipStep("no CORS headers") })
+
+	// JUnit
+	var buf bytes.Buffer
+	if err := writeJUnitReport(&buf, r.snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	var junit junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &junit); err != nil {
+		t.Fatal(err)
+	}
+	if junit.Tests != 3 || junit.Failures != 1 || junit.Skipped != 1 || len(junit.Suites) != 1 {
+		t.Errorf("unexpected JUnit report: %#v", junit)
+	}
+	if tc := junit.Suites[0].Cases[1]; tc.Name != "createTransfer" || tc.Failure == nil || tc.Failure.Message != "bad thing" {
+		t.Errorf("unexpected testcase: %#v", tc)
+	}
+	if tc := junit.Suites[0].Cases[2]; tc.Failure != nil || tc.Skipped == nil || tc.Skipped.Message != "no CORS headers" {
+		t.Errorf("unexpected testcase: %#v", tc)
+	}
+
+	// JSON
+	buf.Reset()
+	if err := writeJSONReport(&buf, r.snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Passed bool `json:"passed"`
+		Suites []struct {
+			Name   string        `json:"name"`
+			Passed bool          `json:"passed"`
+			Steps  []*stepResult `json:"steps"`
+		} `json:"suites"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Passed || len(out.Suites) != 1 || out.Suites[0].Passed || len(out.Suites[0].Steps) != 3 {
+		t.Errorf("unexpected JSON report: %s", buf.String())
+	}
+	if step := out.Suites[0].Steps[2]; step.Skipped != "no CORS headers" || step.Error != "" {
+		t.Errorf("unexpected step: %#v", step)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/moov-io/api/cmd/apitest/local"
+	"github.com/moov-io/base"
+)
+
+var (
+	flagRequestID     = flag.Bool("request-id", false, "Verify every response returns the X-Request-ID it was sent")
+	flagRequestIDLogs = flag.String("request-id.logs", "", "Directory of service logs (e.g. accounts.log) to verify paygate's downstream calls carry X-Request-ID. Only logs are read as admin endpoints don't expose request IDs")
+
+	requestIDs *requestIDTracker
+
+	// downstreamServices are called by paygate and should log the X-Request-ID paygate was sent
+	downstreamServices = []string{"accounts", "customers", "ach"}
+)
+
+// requestIDTracker records which operations dropped X-Request-ID and the IDs of successful
+// paygate create calls.
+type requestIDTracker struct {
+	suite *suiteResult
+
+	mu      sync.Mutex
+	dropped map[string]int // "METHOD /normalized/path" to count
+	paygate map[string]bool
+}
+
+func newRequestIDTracker(suite *suiteResult) *requestIDTracker {
+	return &requestIDTracker{
+		suite:   suite,
+		dropped: make(map[string]int),
+		paygate: make(map[string]bool),
+	}
+}
+
+// setupRequestID starts checking X-Request-ID if -request-id or -request-id.logs were given.
+// Each operation which drops the ID is recorded as a failed step in the "request-id" suite.
+func setupRequestID() error {
+	if !*flagRequestID && *flagRequestIDLogs == "" {
+		return nil
+	}
+	if *flagRequestIDLogs != "" {
+		if fi, err := os.Stat(*flagRequestIDLogs); err != nil || !fi.IsDir() {
+			return fmt.Errorf("-request-id.logs %s isn't a directory", *flagRequestIDLogs)
+		}
+	}
+	requestIDs = newRequestIDTracker(report.newSuite("request-id"))
+	log.Println("INFO: verifying X-Request-ID is returned on every response")
+	return nil
+}
+
+// wrapRequestID returns an http.RoundTripper which checks X-Request-ID on each response if
+// -request-id was given, otherwise underlying is returned.
+func wrapRequestID(underlying http.RoundTripper) http.RoundTripper {
+	if requestIDs == nil {
+		return underlying
+	}
+	return &requestIDTransport{
+		underlying: underlying,
+		tracker:    requestIDs,
+	}
+}
+
+type requestIDTransport struct {
+	underlying http.RoundTripper
+	tracker    *requestIDTracker
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// local.Transport rewrites req.URL in place, so keep the production path from before
+	method, path, sent := req.Method, req.URL.Path, req.Header.Get("X-Request-ID")
+	if sent != "" && strings.EqualFold(method, "POST") && isPaygatePath(path) {
+		// Each paygate create gets its own ID so downstream logs show every call carried it
+		sent = base.ID()
+		req = req.Clone(req.Context())
+		req.Header.Set("X-Request-ID", sent)
+	}
+	resp, err := t.underlying.RoundTrip(req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+	if sent != "" {
+		t.tracker.record(method, path, resp.StatusCode, sent, resp.Header.Get("X-Request-ID"))
+	}
+	return resp, nil
+}
+
+func (t *requestIDTracker) record(method, path string, status int, sent, returned string) {
+	op := strings.ToUpper(method) + " " + local.NormalizePath(path)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// paygate calls other services when objects are created
+	if strings.EqualFold(method, "POST") && status >= 200 && status < 300 && isPaygatePath(path) {
+		t.paygate[sent] = true
+	}
+	if returned == sent {
+		return
+	}
+	t.dropped[op]++
+	if t.dropped[op] == 1 {
+		err := fmt.Errorf("sent X-Request-ID %q but got %q back", sent, returned)
+		log.Printf("ERROR: %s dropped X-Request-ID: %v", op, err)
+		if t.suite != nil {
+			t.suite.step(op, func() error {
+				return err
+			})
+		}
+	}
+}
+
+// isPaygatePath returns true for routes served by paygate, which calls our other services.
+func isPaygatePath(path string) bool {
+	for _, prefix := range []string{"depositories", "originators", "receivers", "transfers", "gateways", "events"} {
+		if strings.HasPrefix(path, "/v1/ach/"+prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// droppedOperations returns each operation which didn't return its X-Request-ID, sorted.
+func (t *requestIDTracker) droppedOperations() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]string, 0, len(t.dropped))
+	for op, n := range t.dropped {
+		out = append(out, fmt.Sprintf("%s (x%d)", op, n))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// checkDownstreamLogs returns an error for each downstream service whose logs in dir don't
+// contain every X-Request-ID sent to paygate. Services without a log file are skipped.
+func (t *requestIDTracker) checkDownstreamLogs(dir string) []error {
+	t.mu.Lock()
+	ids := make([]string, 0, len(t.paygate))
+	for id := range t.paygate {
+		ids = append(ids, id)
+	}
+	t.mu.Unlock()
+	sort.Strings(ids)
+
+	var errs []error
+	for _, service := range downstreamServices {
+		matches, err := filepath.Glob(filepath.Join(dir, service+"*.log"))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", service, err))
+			continue
+		}
+		if len(matches) == 0 {
+			log.Printf("INFO: no %s logs found in %s, skipping X-Request-ID check", service, dir)
+			continue
+		}
+		var logs []byte
+		for i := range matches {
+			bs, err := ioutil.ReadFile(matches[i])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", service, err))
+			}
+			logs = append(logs, bs...)
+		}
+		var missing []string
+		for _, id := range ids {
+			if !strings.Contains(string(logs), id) {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) > 0 {
+			errs = append(errs, fmt.Errorf("%s logs are missing %d of %d X-Request-IDs sent to paygate: %s",
+				service, len(missing), len(ids), strings.Join(missing, ", ")))
+		}
+	}
+	return errs
+}
+
+// checkRequestIDs fails apitest if any operation dropped X-Request-ID or a downstream service
+// didn't log the IDs paygate was sent.
+func checkRequestIDs() {
+	if requestIDs == nil {
+		return
+	}
+	if dropped := requestIDs.droppedOperations(); len(dropped) > 0 {
+		fatalf("FAILURE: X-Request-ID was dropped by %d operations:\n  %s", len(dropped), strings.Join(dropped, "\n  "))
+	}
+	if *flagRequestIDLogs != "" {
+		errs := requestIDs.checkDownstreamLogs(*flagRequestIDLogs)
+		for i := range errs {
+			log.Printf("ERROR: %v", errs[i])
+			err := errs[i]
+			requestIDs.suite.step("downstream", func() error {
+				return err
+			})
+		}
+		if len(errs) > 0 {
+			fatalf("FAILURE: X-Request-ID wasn't carried to %d downstream services", len(errs))
+		}
+	}
+	log.Println("SUCCESS: X-Request-ID was returned on every response")
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/api/cmd/apitest/local"
+)
+
+func TestRequestID__transport(t *testing.T) {
+	var received []string
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Request-ID"))
+		if !strings.HasPrefix(r.URL.Path, "/v1/wire") {
+			w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svc.Close()
+
+	tracker := newRequestIDTracker(nil)
+	client := &http.Client{
+		Transport: &requestIDTransport{
+			underlying: svc.Client().Transport,
+			tracker:    tracker,
+		},
+	}
+	for _, path := range []string{"/v1/ach/transfers", "/v1/ach/transfers", "/v1/wire/files/abc123", "/v1/wire/files/def456", "/v1/accounts"} {
+		req, _ := http.NewRequest("POST", svc.URL+path, nil)
+		req.Header.Set("X-Request-ID", "req-"+path)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	dropped := tracker.droppedOperations()
+	if len(dropped) != 1 || dropped[0] != "POST /v1/wire/files/{id} (x2)" {
+		t.Errorf("unexpected dropped operations: %v", dropped)
+	}
+	// each paygate create was sent its own X-Request-ID
+	if len(tracker.paygate) != 2 || !tracker.paygate[received[0]] || !tracker.paygate[received[1]] {
+		t.Errorf("unexpected paygate request IDs: %v (received %v)", tracker.paygate, received)
+	}
+	if received[0] == "req-/v1/ach/transfers" || received[2] != "req-/v1/wire/files/abc123" {
+		t.Errorf("unexpected request IDs: %v", received)
+	}
+}
+
+func TestRequestID__local(t *testing.T) {
+	var received string
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("X-Request-ID")
+		w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer svc.Close()
+
+	// -local sends /v1/ach/transfers to paygate's /transfers
+	tracker := newRequestIDTracker(nil)
+	client := &http.Client{
+		Transport: &requestIDTransport{
+			underlying: &local.Transport{
+				Underlying: svc.Client().Transport,
+				Routes:     []local.Route{{Prefix: "ach", Host: strings.TrimPrefix(svc.URL, "http://")}},
+			},
+			tracker: tracker,
+		},
+	}
+	req, _ := http.NewRequest("POST", "https://api.moov.io/v1/ach/transfers", nil)
+	req.Header.Set("X-Request-ID", "abc")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if len(tracker.paygate) != 1 || !tracker.paygate[received] {
+		t.Errorf("unexpected paygate request IDs: %v", tracker.paygate)
+	}
+}
+
+func TestRequestID__checkDownstreamLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "request-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tracker := newRequestIDTracker(nil)
+	tracker.record("POST", "/v1/ach/transfers", http.StatusOK, "abc", "abc")
+	tracker.record("POST", "/v1/ach/originators", http.StatusCreated, "def", "def")
+	tracker.record("POST", "/v1/ach/receivers", http.StatusBadRequest, "ghi", "ghi")
+
+	// customers has no logs, so it's skipped
+	ioutil.WriteFile(filepath.Join(dir, "accounts.log"), []byte("requestID=abc\nrequestID=def\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "ach.log"), []byte("requestID=abc\n"), 0644)
+
+	errs := tracker.checkDownstreamLogs(dir)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "ach logs are missing 1 of 2 X-Request-IDs sent to paygate: def") {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
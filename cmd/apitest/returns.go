@@ -0,0 +1,462 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+)
+
+var (
+	flagReturns           = flag.String("returns", "", "Comma separated return codes (e.g. R01,R02,R03) sent back for transfers found with -verify-transfers.dir")
+	flagReturnsNOC        = flag.String("returns.noc", "", "Comma separated change codes (C01, C02, C03, C05, C06 or C07) sent as NOCs for transfers found with -verify-transfers.dir")
+	flagReturnsInboundDir = flag.String("returns.inbound-dir", "", "Directory return and NOC files are written into for paygate to read")
+	flagReturnsTimeout    = flag.Duration("returns.timeout", 5*time.Minute, "How long to wait for paygate to apply the returns and NOCs")
+	flagReturnsInterval   = flag.Duration("returns.interval", 10*time.Second, "How often transfers and depositories are read while waiting for returns and NOCs")
+)
+
+// depositoryReturnCodes are the return codes paygate rejects the receiver's depository for.
+var depositoryReturnCodes = map[string]bool{
+	"R02": true, "R03": true, "R04": true, "R07": true, "R10": true,
+	"R14": true, "R15": true, "R16": true, "R20": true,
+}
+
+// changeCodes are the NOC change codes which correct a depository.
+var changeCodes = map[string]bool{
+	"C01": true, "C02": true, "C03": true, "C05": true, "C06": true, "C07": true,
+}
+
+// parseReturnCodes reads -returns, each code needs to be a NACHA return code.
+func parseReturnCodes(v string) ([]string, error) {
+	return parseCodes(v, func(code string) bool {
+		return ach.LookupReturnCode(code) != nil
+	})
+}
+
+// parseChangeCodes reads -returns.noc, each code needs to correct a depository.
+func parseChangeCodes(v string) ([]string, error) {
+	return parseCodes(v, func(code string) bool {
+		return changeCodes[code]
+	})
+}
+
+func parseCodes(v string, valid func(code string) bool) ([]string, error) {
+	var out []string
+	for _, code := range strings.Split(v, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" {
+			continue
+		}
+		if !valid(code) {
+			return nil, fmt.Errorf("unsupported code %q", code)
+		}
+		out = append(out, code)
+	}
+	return out, nil
+}
+
+// simulatedReturn is a return or NOC sent for a transfer's entry in a merged file.
+type simulatedReturn struct {
+	mergedTransfer
+	code string
+
+	header ach.FileHeader
+	batch  ach.Batcher
+	entry  *ach.EntryDetail
+
+	// corrected is what the receiver's depository is changed to by a NOC
+	corrected *ach.CorrectedData
+}
+
+func (r *simulatedReturn) noc() bool {
+	return strings.HasPrefix(r.code, "C")
+}
+
+// changesDepository returns true when paygate updates the receiver's depository for r.
+func (r *simulatedReturn) changesDepository() bool {
+	return r.noc() || depositoryReturnCodes[r.code]
+}
+
+// simulateReturns finds a transfer in the merged files of dir for each -returns and -returns.noc code
+// and writes a return or NOC file for its entry into inboundDir. Returned transfers need to fail
+// with the return code and the receiver depository needs to be rejected or corrected. NOCs for the
+// same depository are sent in separate rounds so each correction can be checked. Each check is a
+// step of the "returns" suite.
+func simulateReturns(ctx context.Context, dir, inboundDir string, iterations []*iteration) error {
+	returnCodes, _ := parseReturnCodes(*flagReturns)
+	nocCodes, _ := parseChangeCodes(*flagReturnsNOC)
+
+	suite := report.newSuite("returns")
+
+	var returns []*simulatedReturn
+	err := suite.step("findEntries", func() (err error) {
+		returns, err = findReturnEntries(dir, pendingTransfers(iterations), append(returnCodes, nocCodes...))
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("returns: %v", err)
+	}
+
+	rounds := returnRounds(returns)
+	for i := range rounds {
+		round := rounds[i]
+		stepName := func(name string) string {
+			if len(rounds) > 1 {
+				return fmt.Sprintf("%s (round %d)", name, i+1)
+			}
+			return name
+		}
+
+		err = suite.step(stepName("writeFiles"), func() error {
+			for _, r := range round {
+				path, err := writeReturnFile(inboundDir, r)
+				if err != nil {
+					return fmt.Errorf("transfer %s: %v", r.transfer.ID, err)
+				}
+				log.Printf("INFO: wrote %s for transfer %s to %s", r.code, r.transfer.ID, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("returns: %v", err)
+		}
+
+		err = suite.step(stepName("transfers"), func() error {
+			return waitForReturns(ctx, round, *flagReturnsTimeout, *flagReturnsInterval)
+		})
+		if err != nil {
+			return fmt.Errorf("returned transfers: %v", err)
+		}
+
+		err = suite.step(stepName("depositories"), func() error {
+			return waitForDepositoryUpdates(ctx, round, *flagReturnsTimeout, *flagReturnsInterval)
+		})
+		if err != nil {
+			return fmt.Errorf("returned depositories: %v", err)
+		}
+	}
+	log.Printf("SUCCESS: paygate applied %d returns and NOCs", len(returns))
+	return nil
+}
+
+// findReturnEntries picks a different transfer found in the merged files of dir for each code.
+func findReturnEntries(dir string, pending []mergedTransfer, codes []string) ([]*simulatedReturn, error) {
+	var out []*simulatedReturn
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if (err != nil && err != filepath.SkipDir) || info.IsDir() {
+			return nil
+		}
+		file, err := parseACHFilepath(path)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+		entries := mergedEntries(file)
+		mismatches := make(map[string]string)
+		var leftover []mergedTransfer
+		for i := range pending {
+			if len(out) == len(codes) {
+				break
+			}
+			e := matchEntries(entries, pending[i].iter, pending[i].transfer, mismatches)
+			if e == nil {
+				leftover = append(leftover, pending[i])
+				continue
+			}
+			if e.entry == nil {
+				continue // IAT entries aren't returned
+			}
+			out = append(out, &simulatedReturn{
+				mergedTransfer: pending[i],
+				code:           codes[len(out)],
+				header:         file.Header,
+				batch:          e.batch,
+				entry:          e.entry,
+			})
+		}
+		pending = leftover
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out) < len(codes) {
+		return nil, fmt.Errorf("found %d transfers for %d return and change codes, create more transfers with -ach.type or -batch", len(out), len(codes))
+	}
+	return out, nil
+}
+
+// returnRounds splits returns so each round has at most one NOC for a depository. Returns are all
+// sent in the first round.
+func returnRounds(returns []*simulatedReturn) [][]*simulatedReturn {
+	var rounds [][]*simulatedReturn
+	var corrected []map[string]bool // receiver depository IDs with a NOC, by round
+	for _, r := range returns {
+		i := 0
+		if r.noc() {
+			depID := r.iter.receiverDepository.ID
+			for i < len(corrected) && corrected[i][depID] {
+				i++
+			}
+			if i == len(corrected) {
+				corrected = append(corrected, make(map[string]bool))
+			}
+			corrected[i][depID] = true
+		}
+		if i == len(rounds) {
+			rounds = append(rounds, nil)
+		}
+		rounds[i] = append(rounds[i], r)
+	}
+	return rounds
+}
+
+// writeReturnFile writes the return or NOC file of r into dir and returns its path.
+func writeReturnFile(dir string, r *simulatedReturn) (string, error) {
+	var file *ach.File
+	var err error
+	if r.noc() {
+		file, err = newNOCFile(r)
+	} else {
+		file, err = newReturnFile(r)
+	}
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := ach.NewWriter(&buf).Write(file); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.ach", r.transfer.ID, r.code))
+	return path, ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// returnFileHeader is the header of a file sent back from the receiver's bank to the originator's.
+func returnFileHeader(original ach.FileHeader) ach.FileHeader {
+	now := time.Now()
+	fh := ach.NewFileHeader()
+	fh.ID = generateID()
+	fh.ImmediateOrigin = original.ImmediateDestination
+	fh.ImmediateOriginName = original.ImmediateDestinationName
+	fh.ImmediateDestination = original.ImmediateOrigin
+	fh.ImmediateDestinationName = original.ImmediateOriginName
+	fh.FileCreationDate = now.Format("060102")
+	fh.FileCreationTime = now.Format("1504")
+	return fh
+}
+
+// returnEntry copies the original entry of r as sent back by the receiver's bank.
+func returnEntry(r *simulatedReturn, transactionCode int) *ach.EntryDetail {
+	ed := ach.NewEntryDetail()
+	ed.TransactionCode = transactionCode
+	ed.SetRDFI(r.header.ImmediateOrigin)
+	ed.DFIAccountNumber = r.entry.DFIAccountNumber
+	ed.IdentificationNumber = r.entry.IdentificationNumber
+	ed.IndividualName = r.entry.IndividualName
+	ed.DiscretionaryData = r.entry.DiscretionaryData
+	ed.SetTraceNumber(r.entry.RDFIIdentification, 1)
+	ed.AddendaRecordIndicator = 1
+	return ed
+}
+
+// newReturnFile builds an ACH return of r's entry with its return code.
+func newReturnFile(r *simulatedReturn) (*ach.File, error) {
+	bh := ach.NewBatchHeader()
+	*bh = *r.batch.GetHeader()
+	bh.ODFIIdentification = r.entry.RDFIIdentification
+
+	// Returns use the automated return code of the original entry (e.g. 22 -> 21)
+	ed := returnEntry(r, r.entry.TransactionCode-1)
+	ed.Amount = r.entry.Amount
+	ed.Category = ach.CategoryReturn
+	ed.Addenda99 = ach.NewAddenda99()
+	ed.Addenda99.ReturnCode = r.code
+	ed.Addenda99.OriginalTrace = r.entry.TraceNumber
+	ed.Addenda99.OriginalDFI = r.entry.RDFIIdentification
+	ed.Addenda99.TraceNumber = ed.TraceNumber
+
+	batch, err := ach.NewBatch(bh)
+	if err != nil {
+		return nil, err
+	}
+	batch.AddEntry(ed)
+	return newInboundFile(r, batch)
+}
+
+// newNOCFile builds a COR file correcting the receiver's depository of r's entry.
+func newNOCFile(r *simulatedReturn) (*ach.File, error) {
+	corrected, data := correctedData(r.code, r.entry)
+	r.corrected = corrected
+
+	bh := ach.NewBatchHeader()
+	*bh = *r.batch.GetHeader()
+	bh.StandardEntryClassCode = ach.COR
+	bh.ODFIIdentification = r.entry.RDFIIdentification
+
+	ed := returnEntry(r, r.entry.TransactionCode-1)
+	ed.Amount = 0
+	ed.Category = ach.CategoryNOC
+	ed.Addenda98 = ach.NewAddenda98()
+	ed.Addenda98.ChangeCode = r.code
+	ed.Addenda98.OriginalTrace = r.entry.TraceNumber
+	ed.Addenda98.OriginalDFI = r.entry.RDFIIdentification
+	ed.Addenda98.CorrectedData = data
+	ed.Addenda98.TraceNumber = ed.TraceNumber
+
+	batch, err := ach.NewBatch(bh)
+	if err != nil {
+		return nil, err
+	}
+	batch.AddEntry(ed)
+	return newInboundFile(r, batch)
+}
+
+func newInboundFile(r *simulatedReturn, batch ach.Batcher) (*ach.File, error) {
+	if err := batch.Create(); err != nil {
+		return nil, err
+	}
+	file := ach.NewFile()
+	file.SetHeader(returnFileHeader(r.header))
+	file.ID = file.Header.ID
+	file.AddBatch(batch)
+	if err := file.Create(); err != nil {
+		return nil, err
+	}
+	return file, file.Validate()
+}
+
+// correctedData returns the new account details of a change code along with the Addenda98 CorrectedData
+// field they're sent in.
+func correctedData(code string, entry *ach.EntryDetail) (*ach.CorrectedData, string) {
+	routingNumber := "231380104"
+	if entry.RDFIIdentification+entry.CheckDigit == routingNumber {
+		routingNumber = defaultRoutingNumber
+	}
+	accountNumber := fmt.Sprintf("%d", 100000000+randSource.Int63()%900000000)
+
+	// Flip between checking (2x) and savings (3x) keeping the entry's direction
+	transactionCode := entry.TransactionCode + 10
+	if transactionCode/10 > 3 {
+		transactionCode -= 20
+	}
+
+	switch code {
+	case "C01":
+		return &ach.CorrectedData{AccountNumber: accountNumber}, accountNumber
+	case "C02":
+		return &ach.CorrectedData{RoutingNumber: routingNumber}, routingNumber
+	case "C03":
+		return &ach.CorrectedData{RoutingNumber: routingNumber, AccountNumber: accountNumber}, fmt.Sprintf("%s   %s", routingNumber, accountNumber)
+	case "C05":
+		return &ach.CorrectedData{TransactionCode: transactionCode}, fmt.Sprintf("%d", transactionCode)
+	case "C06":
+		return &ach.CorrectedData{AccountNumber: accountNumber, TransactionCode: transactionCode}, fmt.Sprintf("%-17s   %d", accountNumber, transactionCode)
+	case "C07":
+		return &ach.CorrectedData{RoutingNumber: routingNumber, AccountNumber: accountNumber, TransactionCode: transactionCode}, fmt.Sprintf("%s%-17s%d", routingNumber, accountNumber, transactionCode)
+	}
+	return nil, ""
+}
+
+// returnsAPI returns a client authenticated as the user of iter.
+func returnsAPI(iter *iteration) *moov.APIClient {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+	return moov.NewAPIClient(conf)
+}
+
+// waitForReturns reads each returned transfer until it's failed with its return code. Transfers sent a
+// NOC can't fail.
+func waitForReturns(ctx context.Context, returns []*simulatedReturn, timeout, interval time.Duration) error {
+	return poll(ctx, timeout, interval, func() ([]string, error) {
+		var waiting []string
+		for _, r := range returns {
+			xfer, resp, err := returnsAPI(r.iter).TransfersApi.GetTransferByID(ctx, r.transfer.ID, r.iter.userID, nil)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("problem reading transfer %s: %v", r.transfer.ID, describeAPIError(err))
+			}
+			if r.noc() {
+				if xfer.Status == moov.FAILED {
+					return nil, fmt.Errorf("transfer %s failed after %s NOC", xfer.ID, r.code)
+				}
+				continue
+			}
+			if xfer.Status != moov.FAILED || xfer.ReturnCode.Code != r.code {
+				waiting = append(waiting, fmt.Sprintf("transfer %s is %s with return code %q, expected %s", xfer.ID, xfer.Status, xfer.ReturnCode.Code, r.code))
+			}
+		}
+		return waiting, nil
+	})
+}
+
+// waitForDepositoryUpdates reads the receiver depository of each return which changes it until it's
+// rejected or has the corrected account details.
+func waitForDepositoryUpdates(ctx context.Context, returns []*simulatedReturn, timeout, interval time.Duration) error {
+	return poll(ctx, timeout, interval, func() ([]string, error) {
+		var waiting []string
+		for _, r := range returns {
+			if !r.changesDepository() {
+				continue
+			}
+			depID := r.iter.receiverDepository.ID
+			dep, resp, err := returnsAPI(r.iter).DepositoriesApi.GetDepositoryByID(ctx, depID, r.iter.userID, nil)
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("problem reading depository %s: %v", depID, describeAPIError(err))
+			}
+			if err := checkReturnedDepository(r, dep); err != nil {
+				waiting = append(waiting, fmt.Sprintf("depository %s after %s: %v", depID, r.code, err))
+			}
+		}
+		return waiting, nil
+	})
+}
+
+// checkReturnedDepository returns an error if dep hasn't been rejected or corrected for r.
+func checkReturnedDepository(r *simulatedReturn, dep moov.Depository) error {
+	if !r.noc() {
+		if dep.Status != moov.REJECTED {
+			return fmt.Errorf("status is %s, expected %s", dep.Status, moov.REJECTED)
+		}
+		return nil
+	}
+	var diffs []string
+	if v := r.corrected.AccountNumber; v != "" && dep.AccountNumber != v {
+		diffs = append(diffs, fmt.Sprintf("account number is %q, expected %q", dep.AccountNumber, v))
+	}
+	if v := r.corrected.RoutingNumber; v != "" && dep.RoutingNumber != v {
+		diffs = append(diffs, fmt.Sprintf("routing number is %q, expected %q", dep.RoutingNumber, v))
+	}
+	if code := r.corrected.TransactionCode; code > 0 {
+		expected := "Checking"
+		if code/10 == 3 {
+			expected = "Savings"
+		}
+		if !strings.EqualFold(dep.Type, expected) {
+			diffs = append(diffs, fmt.Sprintf("type is %q, expected %q", dep.Type, expected))
+		}
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
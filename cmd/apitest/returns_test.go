@@ -0,0 +1,127 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestReturns__parseCodes(t *testing.T) {
+	codes, err := parseReturnCodes(" r01, R02,,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 2 || codes[0] != "R01" || codes[1] != "R02" {
+		t.Errorf("unexpected codes: %v", codes)
+	}
+	if _, err := parseReturnCodes("R99"); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := parseReturnCodes("C01"); err == nil {
+		t.Error("expected error")
+	}
+
+	codes, err = parseChangeCodes("C01,c07")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 2 || codes[1] != "C07" {
+		t.Errorf("unexpected codes: %v", codes)
+	}
+	if _, err := parseChangeCodes("C04"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestReturns__correctedData(t *testing.T) {
+	entry := ach.NewEntryDetail()
+	entry.TransactionCode = ach.CheckingCredit
+	entry.SetRDFI("231380104")
+
+	for code := range changeCodes {
+		expected, data := correctedData(code, entry)
+		if expected == nil {
+			t.Fatalf("%s: no corrected data", code)
+		}
+		addenda := ach.NewAddenda98()
+		addenda.ChangeCode = code
+		addenda.CorrectedData = data
+		parsed := addenda.ParseCorrectedData()
+		if parsed == nil {
+			t.Fatalf("%s: unable to parse %q", code, data)
+		}
+		if parsed.AccountNumber != expected.AccountNumber || parsed.RoutingNumber != expected.RoutingNumber || parsed.TransactionCode != expected.TransactionCode {
+			t.Errorf("%s: got %#v, expected %#v", code, parsed, expected)
+		}
+		if expected.RoutingNumber == "231380104" {
+			t.Errorf("%s: routing number wasn't changed", code)
+		}
+		if expected.TransactionCode != 0 && expected.TransactionCode != ach.SavingsCredit {
+			t.Errorf("%s: unexpected transaction code %d", code, expected.TransactionCode)
+		}
+	}
+}
+
+func TestReturns__returnRounds(t *testing.T) {
+	first := &iteration{receiverDepository: moov.Depository{ID: "first"}}
+	second := &iteration{receiverDepository: moov.Depository{ID: "second"}}
+	returns := []*simulatedReturn{
+		{mergedTransfer: mergedTransfer{iter: first}, code: "R01"},
+		{mergedTransfer: mergedTransfer{iter: first}, code: "C01"},
+		{mergedTransfer: mergedTransfer{iter: first}, code: "C05"},
+		{mergedTransfer: mergedTransfer{iter: second}, code: "C02"},
+		{mergedTransfer: mergedTransfer{iter: first}, code: "R02"},
+	}
+	rounds := returnRounds(returns)
+	if len(rounds) != 2 {
+		t.Fatalf("got %d rounds", len(rounds))
+	}
+	if len(rounds[0]) != 4 || len(rounds[1]) != 1 || rounds[1][0].code != "C05" {
+		t.Errorf("unexpected rounds: %#v", rounds)
+	}
+}
+
+func TestReturns__newFiles(t *testing.T) {
+	file := testMergedFile(1234, "PPD")
+	bh := file.Batches[0].GetHeader()
+	bh.ServiceClassCode = ach.CreditsOnly
+	bh.CompanyName = "Jane Doe"
+	bh.CompanyIdentification = "123456789"
+	bh.CompanyEntryDescription = "test"
+	bh.ODFIIdentification = "12104288"
+	bh.EffectiveEntryDate = "200401"
+	entry := file.Batches[0].GetEntries()[0]
+	entry.SetRDFI("231380104")
+	entry.DFIAccountNumber = "4567890123"
+	entry.IndividualName = "John Doe"
+	entry.SetTraceNumber(bh.ODFIIdentification, 1)
+
+	r := &simulatedReturn{code: "R01", header: file.Header, batch: file.Batches[0], entry: entry}
+	ret, err := newReturnFile(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Header.ImmediateOrigin != "231380104" || ret.Header.ImmediateDestination != "121042882" {
+		t.Errorf("unexpected header: %#v", ret.Header)
+	}
+	if ed := ret.Batches[0].GetEntries()[0]; ed.Addenda99 == nil || ed.Addenda99.OriginalTrace != entry.TraceNumber || ed.TransactionCode != ach.SavingsReturnNOCCredit {
+		t.Errorf("unexpected return entry: %#v", ed)
+	}
+
+	r.code = "C01"
+	noc, err := newNOCFile(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if noc.Batches[0].GetHeader().StandardEntryClassCode != ach.COR || r.corrected == nil {
+		t.Errorf("unexpected NOC: %#v", noc.Batches[0].GetHeader())
+	}
+	if ed := noc.Batches[0].GetEntries()[0]; ed.Addenda98 == nil || ed.Amount != 0 {
+		t.Errorf("unexpected NOC entry: %#v", ed)
+	}
+}
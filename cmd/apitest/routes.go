@@ -0,0 +1,63 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/moov-io/api/cmd/apitest/local"
+)
+
+var (
+	flagLocalRoutes = flag.String("local.routes", "", "YAML file of routes for -local, these replace the default routes with the same prefix")
+	flagLocalRoute  routeFlags
+
+	localRoutes = local.DefaultRoutes()
+)
+
+func init() {
+	flag.Var(&flagLocalRoute, "local.route", "Route for -local as prefix=[scheme://]host:port[/rewrite], can be repeated (e.g. 'ach=localhost:9080')")
+}
+
+// routeFlags collects each -local.route flag
+type routeFlags []local.Route
+
+func (rs *routeFlags) String() string {
+	var out []string
+	for _, r := range *rs {
+		out = append(out, r.Prefix+"="+r.Host)
+	}
+	return strings.Join(out, ",")
+}
+
+func (rs *routeFlags) Set(value string) error {
+	route, err := local.ParseRoute(value)
+	if err != nil {
+		return err
+	}
+	*rs = append(*rs, route)
+	return nil
+}
+
+// setupLocalRoutes merges -local.routes and -local.route into our default routing table.
+// Routes from flags are applied after the YAML file.
+func setupLocalRoutes() error {
+	if !*flagLocal && (*flagLocalRoutes != "" || len(flagLocalRoute) > 0) {
+		return errors.New("-local.routes and -local.route require -local")
+	}
+	if *flagLocalRoutes != "" {
+		routes, err := local.ReadRoutes(*flagLocalRoutes)
+		if err != nil {
+			return err
+		}
+		localRoutes = local.MergeRoutes(localRoutes, routes...)
+		log.Printf("INFO: read %d local routes from %s", len(routes), *flagLocalRoutes)
+	}
+	localRoutes = local.MergeRoutes(localRoutes, flagLocalRoute...)
+	return nil
+}
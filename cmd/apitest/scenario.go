@@ -0,0 +1,462 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	flagScenarios = flag.String("scenarios", "", "Comma separated list of scenario files (or directories of them) to run instead of the default flow")
+)
+
+// scenario is a declarative flow of Moov API operations read from a YAML or JSON file.
+//
+// Each step names an operation (see scenarioOperations), the params and body to send, values to
+// capture from the response and the HTTP status codes expected back. Captured values (and a few
+// builtin values) are referenced in later steps as ${name}.
+type scenario struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Steps       []scenarioStep `json:"steps"`
+
+	path string
+}
+
+type scenarioStep struct {
+	Name      string            `json:"name"`
+	Operation string            `json:"operation"`
+	Params    map[string]string `json:"params"`
+	Body      interface{}       `json:"body"`
+
+	// Capture holds variable names to a dotted path in the JSON response. (e.g. depID: ID)
+	Capture map[string]string `json:"capture"`
+
+	Expect scenarioExpect `json:"expect"`
+}
+
+func (step scenarioStep) String() string {
+	if step.Name != "" {
+		return fmt.Sprintf("%s (%s)", step.Name, step.Operation)
+	}
+	return step.Operation
+}
+
+type scenarioExpect struct {
+	// Status is the set of HTTP status codes accepted for a step. When empty any 2xx status is accepted.
+	Status []int `json:"status"`
+}
+
+func (exp scenarioExpect) matches(status int) bool {
+	if len(exp.Status) == 0 {
+		return status >= 200 && status < 300
+	}
+	for i := range exp.Status {
+		if exp.Status[i] == status {
+			return true
+		}
+	}
+	return false
+}
+
+// readScenarios loads each scenario file from a comma separated list of files and directories.
+// Directories are read for .yaml, .yml and .json files in lexical order.
+func readScenarios(paths string) ([]*scenario, error) {
+	var files []string
+	for _, p := range strings.Split(paths, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		s, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !s.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		infos, err := ioutil.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		for i := range infos {
+			switch strings.ToLower(filepath.Ext(infos[i].Name())) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, filepath.Join(p, infos[i].Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+
+	var out []*scenario
+	for i := range files {
+		sc, err := readScenarioFile(files[i])
+		if err != nil {
+			return nil, fmt.Errorf("scenario %s: %v", files[i], err)
+		}
+		out = append(out, sc)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no scenarios found in %q", paths)
+	}
+	return out, nil
+}
+
+func readScenarioFile(path string) (*scenario, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := parseScenario(bs)
+	if err != nil {
+		return nil, err
+	}
+	sc.path = path
+	if sc.Name == "" {
+		sc.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return sc, nil
+}
+
+// parseScenario reads YAML (or JSON, which is valid YAML) into a scenario and checks each step
+// references a known operation.
+func parseScenario(bs []byte) (*scenario, error) {
+	bs, err := yamlToJSON(bs)
+	if err != nil {
+		return nil, err
+	}
+	var sc scenario
+	if err := json.Unmarshal(bs, &sc); err != nil {
+		return nil, err
+	}
+	if len(sc.Steps) == 0 {
+		return nil, errors.New("no steps")
+	}
+	for i := range sc.Steps {
+		if _, exists := scenarioOperations[sc.Steps[i].Operation]; !exists {
+			return nil, fmt.Errorf("step %d: unknown operation %q", i+1, sc.Steps[i].Operation)
+		}
+	}
+	return &sc, nil
+}
+
+// yamlToJSON converts a YAML document into JSON so we can decode into the Moov client's models
+// which only have json struct tags.
+func yamlToJSON(bs []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(bs, &v); err != nil {
+		return nil, err
+	}
+	v, err := jsonCompatible(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func jsonCompatible(v interface{}) (interface{}, error) {
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{})
+		for k, val := range vv {
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprintf("%v", k)
+			}
+			val, err := jsonCompatible(val)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = val
+		}
+		return out, nil
+	case []interface{}:
+		for i := range vv {
+			val, err := jsonCompatible(vv[i])
+			if err != nil {
+				return nil, err
+			}
+			vv[i] = val
+		}
+		return vv, nil
+	}
+	return v, nil
+}
+
+// scenarioState is shared across every step in a scenario run.
+type scenarioState struct {
+	conf *moov.Configuration
+	user *user
+
+	vars map[string]interface{}
+
+	// dir is the directory of the scenario file, which relative file params are read from
+	dir string
+}
+
+func (st *scenarioState) userID(step *scenarioStep) string {
+	if v := step.Params["userID"]; v != "" {
+		return v
+	}
+	if st.user != nil {
+		return st.user.ID
+	}
+	return ""
+}
+
+var scenarioVariable = regexp.MustCompile(`\$\{([a-zA-Z0-9_.\-]+)\}`)
+
+// lookup returns the value of a variable. Captured values take priority over builtins.
+func (st *scenarioState) lookup(key string) (interface{}, bool) {
+	if v, exists := st.vars[key]; exists {
+		return v, true
+	}
+	switch key {
+	case "random.id":
+		return generateID(), true
+	case "random.amount":
+		return amount(), true
+	case "random.phone":
+		return phone(), true
+	case "random.email":
+		return email(name()), true
+	case "random.name":
+		first, last := name()
+		return fmt.Sprintf("%s %s", first, last), true
+	}
+	return nil, false
+}
+
+// expand replaces ${name} references in every string of v. A string which is only a reference
+// is replaced with the variable's value so numbers and objects keep their JSON type.
+func (st *scenarioState) expand(v interface{}) (interface{}, error) {
+	switch vv := v.(type) {
+	case string:
+		if m := scenarioVariable.FindStringSubmatch(vv); m != nil && m[0] == vv {
+			val, ok := st.lookup(m[1])
+			if !ok {
+				return nil, fmt.Errorf("undefined variable %q", m[1])
+			}
+			return val, nil
+		}
+		var err error
+		out := scenarioVariable.ReplaceAllStringFunc(vv, func(s string) string {
+			key := scenarioVariable.FindStringSubmatch(s)[1]
+			val, ok := st.lookup(key)
+			if !ok {
+				err = fmt.Errorf("undefined variable %q", key)
+				return s
+			}
+			return fmt.Sprintf("%v", val)
+		})
+		return out, err
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for k, val := range vv {
+			val, err := st.expand(val)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = val
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(vv))
+		for i := range vv {
+			val, err := st.expand(vv[i])
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// capture reads each captured variable out of the JSON form of resp.
+func (st *scenarioState) capture(captures map[string]string, resp interface{}) error {
+	if len(captures) == 0 {
+		return nil
+	}
+	bs, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(bs, &doc); err != nil {
+		return err
+	}
+	for name, path := range captures {
+		v, err := jsonPath(doc, path)
+		if err != nil {
+			return fmt.Errorf("capture %s: %v", name, err)
+		}
+		st.vars[name] = v
+	}
+	return nil
+}
+
+// jsonPath walks a dotted path (e.g. lines.0.accountID) through a decoded JSON document.
+// Object keys are matched case-insensitively since Moov's models mix ID and camelCase names.
+func jsonPath(doc interface{}, path string) (interface{}, error) {
+	if path == "" || path == "." {
+		return doc, nil
+	}
+	cur := doc
+	for _, part := range strings.Split(path, ".") {
+		switch vv := cur.(type) {
+		case map[string]interface{}:
+			v, exists := vv[part]
+			if !exists {
+				for k := range vv {
+					if strings.EqualFold(k, part) {
+						v, exists = vv[k], true
+						break
+					}
+				}
+			}
+			if !exists {
+				return nil, fmt.Errorf("%q not found in %q", part, path)
+			}
+			cur = v
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(vv) {
+				return nil, fmt.Errorf("invalid index %q in %q", part, path)
+			}
+			cur = vv[idx]
+		default:
+			return nil, fmt.Errorf("%q not found in %q", part, path)
+		}
+	}
+	return cur, nil
+}
+
+// decodeBody converts a step's (expanded) body into one of the Moov client's request models.
+func decodeBody(body interface{}, into interface{}) error {
+	if body == nil {
+		return nil
+	}
+	bs, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, into)
+}
+
+// run executes each step of the scenario in order and stops on the first unexpected result.
+func (sc *scenario) run(ctx context.Context, requestID string) error {
+	suite := report.newSuite(fmt.Sprintf("scenario %s", sc.Name))
+
+	conf := makeConfiguration()
+	conf.HTTPClient.Transport = suite.wrap(conf.HTTPClient.Transport)
+	conf.AddDefaultHeader("X-Request-ID", requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	api := moov.NewAPIClient(conf)
+
+	st := &scenarioState{
+		conf: conf,
+		vars: make(map[string]interface{}),
+		dir:  filepath.Dir(sc.path),
+	}
+	for i := range sc.Steps {
+		step := sc.Steps[i]
+		err := suite.step(step.String(), func() error {
+			return st.runStep(ctx, api, &step)
+		})
+		if err != nil {
+			return fmt.Errorf("step %d %s: %v", i+1, step, err)
+		}
+		log.Printf("SUCCESS: %s step %d %s", sc.Name, i+1, step)
+	}
+	return nil
+}
+
+// resolvePath returns path relative to the scenario file's directory, unless it's absolute.
+func (st *scenarioState) resolvePath(path string) string {
+	if filepath.IsAbs(path) || st.dir == "" {
+		return path
+	}
+	return filepath.Join(st.dir, path)
+}
+
+func (st *scenarioState) runStep(ctx context.Context, api *moov.APIClient, step *scenarioStep) error {
+	params := make(map[string]string)
+	for k, v := range step.Params {
+		val, err := st.expand(v)
+		if err != nil {
+			return err
+		}
+		params[k] = fmt.Sprintf("%v", val)
+	}
+	step.Params = params
+
+	body, err := st.expand(step.Body)
+	if err != nil {
+		return err
+	}
+	step.Body = body
+
+	result, resp, err := scenarioOperations[step.Operation](ctx, api, st, step)
+	if resp == nil {
+		if err == nil {
+			err = errors.New("no HTTP response")
+		}
+		return err
+	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+	if !step.Expect.matches(resp.StatusCode) {
+		if err != nil {
+			return fmt.Errorf("unexpected HTTP status %s: %v", resp.Status, err)
+		}
+		return fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+	if resp.StatusCode >= 300 {
+		return nil // an expected failure, so there's nothing to capture
+	}
+	if err != nil {
+		return err
+	}
+	return st.capture(step.Capture, result)
+}
+
+func runScenarios(ctx context.Context, requestID string, paths string) error {
+	scenarios, err := readScenarios(paths)
+	if err != nil {
+		return err
+	}
+	for i := range scenarios {
+		log.Printf("INFO: running scenario %s from %s", scenarios[i].Name, scenarios[i].path)
+		if err := scenarios[i].run(ctx, requestID); err != nil {
+			return fmt.Errorf("scenario %s: %v", scenarios[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// scenarioOperation performs a Moov API call for a step. The returned value is what
+// variables are captured from and the *http.Response is checked against the step's expectations.
+type scenarioOperation func(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error)
@@ -0,0 +1,359 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+// scenarioOperations are the Moov API operations a scenario step can call. Names match the
+// operationId's from openapi.yaml where one exists. A few operations (e.g. createUser) wrap
+// several calls the same way iterate() does.
+var scenarioOperations = map[string]scenarioOperation{
+	// auth
+	"createUser":        scenarioCreateUser,
+	"checkUserLogin":    scenarioCheckUserLogin,
+	"createOAuth2Token": scenarioCreateOAuth2Token,
+
+	// paygate
+	"setupMicroDepositAccount": scenarioSetupMicroDepositAccount,
+	"addGateway":               scenarioAddGateway,
+	"addDepository":            scenarioAddDepository,
+	"getDepositoryByID":        scenarioGetDepositoryByID,
+	"initiateMicroDeposits":    scenarioInitiateMicroDeposits,
+	"confirmMicroDeposits":     scenarioConfirmMicroDeposits,
+	"verifyDepository":         scenarioVerifyDepository,
+	"addOriginator":            scenarioAddOriginator,
+	"getOriginatorByID":        scenarioGetOriginatorByID,
+	"addReceivers":             scenarioAddReceivers,
+	"getReceiverByID":          scenarioGetReceiverByID,
+	"addTransfer":              scenarioAddTransfer,
+	"addTransfers":             scenarioAddTransfers,
+	"getTransferByID":          scenarioGetTransferByID,
+	"getTransferEventsByID":    scenarioGetTransferEventsByID,
+	"deleteTransferByID":       scenarioDeleteTransferByID,
+
+	// accounts
+	"createAccount":          scenarioCreateAccount,
+	"searchAccounts":         scenarioSearchAccounts,
+	"getAccountTransactions": scenarioGetAccountTransactions,
+
+	// customers
+	"createCustomer":         scenarioCreateCustomer,
+	"getCustomer":            scenarioGetCustomer,
+	"approveCustomer":        scenarioApproveCustomer,
+	"uploadCustomerDocument": scenarioUploadCustomerDocument,
+	"getCustomerDocuments":   scenarioGetCustomerDocuments,
+}
+
+// okResponse is returned by operations which wrap several API calls and only report an error.
+func okResponse() *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+	}
+}
+
+func requireParams(step *scenarioStep, names ...string) error {
+	for i := range names {
+		if step.Params[names[i]] == "" {
+			return fmt.Errorf("missing %s param", names[i])
+		}
+	}
+	return nil
+}
+
+func scenarioCreateUser(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	u, err := createUser(ctx, api)
+	if err != nil {
+		return nil, nil, err
+	}
+	st.user = u
+	setMoovAuthCookie(st.conf, u)
+
+	st.vars["user.id"] = u.ID
+	st.vars["user.email"] = u.Email
+	st.vars["user.name"] = u.Name
+
+	return u, okResponse(), nil
+}
+
+func scenarioCheckUserLogin(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	resp, err := api.UserApi.CheckUserLogin(ctx, &moov.CheckUserLoginOpts{})
+	return nil, resp, err
+}
+
+// scenarioCreateOAuth2Token creates OAuth2 credentials for the scenario's user. With the 'use'
+// param set to "true" (or -oauth) every later step is authenticated with the access token.
+func scenarioCreateOAuth2Token(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if st.user == nil {
+		return nil, nil, errors.New("createUser must be called first")
+	}
+	token, err := createOAuthToken(ctx, api, st.user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *flagOAuth || step.Params["use"] == "true" {
+		removeMoovAuthCookie(st.conf)
+		setMoovOAuthToken(st.conf, token)
+	}
+	return token, okResponse(), nil
+}
+
+// scenarioSetupMicroDepositAccount makes sure paygate's micro-deposit origination account exists.
+func scenarioSetupMicroDepositAccount(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if st.user == nil {
+		return nil, nil, errors.New("createUser must be called first")
+	}
+	acct, err := createMicroDepositAccount(ctx, api, st.user)
+	if err != nil {
+		return nil, nil, err
+	}
+	return acct, okResponse(), nil
+}
+
+func scenarioAddGateway(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	var req moov.CreateGateway
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	return api.GatewaysApi.AddGateway(ctx, st.userID(step), req, &moov.AddGatewayOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+}
+
+func scenarioAddDepository(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	var req moov.CreateDepository
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	return api.DepositoriesApi.AddDepository(ctx, st.userID(step), req, &moov.AddDepositoryOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+}
+
+func scenarioGetDepositoryByID(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "depositoryID"); err != nil {
+		return nil, nil, err
+	}
+	return api.DepositoriesApi.GetDepositoryByID(ctx, step.Params["depositoryID"], st.userID(step), &moov.GetDepositoryByIDOpts{})
+}
+
+func scenarioInitiateMicroDeposits(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "depositoryID"); err != nil {
+		return nil, nil, err
+	}
+	resp, err := api.DepositoriesApi.InitiateMicroDeposits(ctx, step.Params["depositoryID"], st.userID(step), &moov.InitiateMicroDepositsOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+	return nil, resp, err
+}
+
+func scenarioConfirmMicroDeposits(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "depositoryID"); err != nil {
+		return nil, nil, err
+	}
+	var req moov.Amounts
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	resp, err := api.DepositoriesApi.ConfirmMicroDeposits(ctx, step.Params["depositoryID"], st.userID(step), req, &moov.ConfirmMicroDepositsOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+	return nil, resp, err
+}
+
+// scenarioVerifyDepository initiates and confirms micro-deposits by reading the amounts posted to
+// the accountID param, which is what createDepository does in the default flow.
+func scenarioVerifyDepository(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "depositoryID", "accountID"); err != nil {
+		return nil, nil, err
+	}
+	if st.user == nil {
+		return nil, nil, errors.New("createUser must be called first")
+	}
+	dep := moov.Depository{ID: step.Params["depositoryID"]}
+	if err := verifyDepository(ctx, api, step.Params["accountID"], dep, st.user); err != nil {
+		return nil, nil, err
+	}
+	return nil, okResponse(), nil
+}
+
+func scenarioAddOriginator(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	var req moov.CreateOriginator
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	return api.OriginatorsApi.AddOriginator(ctx, st.userID(step), req, &moov.AddOriginatorOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+}
+
+func scenarioGetOriginatorByID(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "originatorID"); err != nil {
+		return nil, nil, err
+	}
+	return api.OriginatorsApi.GetOriginatorByID(ctx, step.Params["originatorID"], st.userID(step), &moov.GetOriginatorByIDOpts{})
+}
+
+func scenarioAddReceivers(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	var req moov.CreateReceiver
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	return api.ReceiversApi.AddReceivers(ctx, st.userID(step), req, &moov.AddReceiversOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+}
+
+func scenarioGetReceiverByID(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "receiverID"); err != nil {
+		return nil, nil, err
+	}
+	return api.ReceiversApi.GetReceiverByID(ctx, step.Params["receiverID"], st.userID(step), &moov.GetReceiverByIDOpts{})
+}
+
+func scenarioAddTransfer(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	var req moov.CreateTransfer
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	return api.TransfersApi.AddTransfer(ctx, st.userID(step), req, &moov.AddTransferOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+}
+
+func scenarioAddTransfers(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	var req []moov.CreateTransfer
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	return api.TransfersApi.AddTransfers(ctx, st.userID(step), req, &moov.AddTransfersOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+}
+
+func scenarioGetTransferByID(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "transferID"); err != nil {
+		return nil, nil, err
+	}
+	return api.TransfersApi.GetTransferByID(ctx, step.Params["transferID"], st.userID(step), &moov.GetTransferByIDOpts{})
+}
+
+func scenarioGetTransferEventsByID(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "transferID"); err != nil {
+		return nil, nil, err
+	}
+	return api.TransfersApi.GetTransferEventsByID(ctx, step.Params["transferID"], st.userID(step), &moov.GetTransferEventsByIDOpts{})
+}
+
+func scenarioDeleteTransferByID(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "transferID"); err != nil {
+		return nil, nil, err
+	}
+	resp, err := api.TransfersApi.DeleteTransferByID(ctx, step.Params["transferID"], st.userID(step), &moov.DeleteTransferByIDOpts{})
+	return nil, resp, err
+}
+
+func scenarioCreateAccount(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	var req moov.CreateAccount
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	if req.CustomerID == "" {
+		req.CustomerID = st.userID(step)
+	}
+	return api.AccountsApi.CreateAccount(ctx, st.userID(step), req, &moov.CreateAccountOpts{})
+}
+
+func scenarioSearchAccounts(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	opts := &moov.SearchAccountsOpts{}
+	if v := step.Params["number"]; v != "" {
+		opts.Number = optional.NewString(v)
+	}
+	if v := step.Params["routingNumber"]; v != "" {
+		opts.RoutingNumber = optional.NewString(v)
+	}
+	if v := step.Params["type"]; v != "" {
+		opts.Type_ = optional.NewString(v)
+	}
+	if v := step.Params["customerID"]; v != "" {
+		opts.CustomerID = optional.NewString(v)
+	}
+	return api.AccountsApi.SearchAccounts(ctx, st.userID(step), opts)
+}
+
+func scenarioGetAccountTransactions(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "accountID"); err != nil {
+		return nil, nil, err
+	}
+	return api.AccountsApi.GetAccountTransactions(ctx, step.Params["accountID"], st.userID(step), &moov.GetAccountTransactionsOpts{
+		Limit: optional.NewFloat32(25),
+	})
+}
+
+func scenarioCreateCustomer(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	var req moov.CreateCustomer
+	if err := decodeBody(step.Body, &req); err != nil {
+		return nil, nil, err
+	}
+	return api.CustomersApi.CreateCustomer(ctx, req, &moov.CreateCustomerOpts{
+		XUserID: optional.NewString(st.userID(step)),
+	})
+}
+
+func scenarioGetCustomer(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "customerID"); err != nil {
+		return nil, nil, err
+	}
+	return api.CustomersApi.GetCustomer(ctx, step.Params["customerID"], &moov.GetCustomerOpts{
+		XUserID: optional.NewString(st.userID(step)),
+	})
+}
+
+// scenarioApproveCustomer sets the customer's status through the Customers admin endpoint,
+// see attemptCustomerApproval.
+func scenarioApproveCustomer(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "customerID"); err != nil {
+		return nil, nil, err
+	}
+	if err := attemptCustomerApproval(ctx, *flagCustomersAdminAddress, step.Params["customerID"]); err != nil {
+		return nil, nil, err
+	}
+	return nil, okResponse(), nil
+}
+
+// scenarioUploadCustomerDocument uploads the file at the 'file' param (relative to the scenario file).
+func scenarioUploadCustomerDocument(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "customerID", "type", "file"); err != nil {
+		return nil, nil, err
+	}
+	fd, err := os.Open(st.resolvePath(step.Params["file"]))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fd.Close()
+
+	return api.CustomersApi.UploadCustomerDocument(ctx, step.Params["customerID"], step.Params["type"], fd, &moov.UploadCustomerDocumentOpts{
+		XUserID: optional.NewString(st.userID(step)),
+	})
+}
+
+func scenarioGetCustomerDocuments(ctx context.Context, api *moov.APIClient, st *scenarioState, step *scenarioStep) (interface{}, *http.Response, error) {
+	if err := requireParams(step, "customerID"); err != nil {
+		return nil, nil, err
+	}
+	return api.CustomersApi.GetCustomerDocuments(ctx, step.Params["customerID"], &moov.GetCustomerDocumentsOpts{
+		XUserID: optional.NewString(st.userID(step)),
+	})
+}
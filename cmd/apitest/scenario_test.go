@@ -0,0 +1,169 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestScenario__readScenarios(t *testing.T) {
+	scenarios, err := readScenarios("scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) != 3 {
+		t.Fatalf("got %d scenarios", len(scenarios))
+	}
+	for i := range scenarios {
+		if scenarios[i].Name == "" || len(scenarios[i].Steps) == 0 {
+			t.Errorf("%s: %#v", scenarios[i].path, scenarios[i])
+		}
+	}
+}
+
+func TestScenario__parse(t *testing.T) {
+	sc, err := parseScenario([]byte(`
+name: example
+steps:
+  - operation: addTransfer
+    body:
+      amount: USD 12.34
+      originator: ${origID}
+    capture:
+      transferID: ID
+    expect:
+      status: [200, 201]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Name != "example" || len(sc.Steps) != 1 {
+		t.Fatalf("unexpected scenario: %#v", sc)
+	}
+	step := sc.Steps[0]
+	if step.Capture["transferID"] != "ID" {
+		t.Errorf("capture: %#v", step.Capture)
+	}
+	if !step.Expect.matches(201) || step.Expect.matches(400) {
+		t.Errorf("expect: %#v", step.Expect)
+	}
+
+	// JSON works also
+	if _, err := parseScenario([]byte(`{"steps": [{"operation": "createUser"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScenario__parseErr(t *testing.T) {
+	if _, err := parseScenario([]byte(`name: empty`)); err == nil {
+		t.Error("expected error")
+	}
+	_, err := parseScenario([]byte(`
+steps:
+  - operation: makeMoney
+`))
+	if err == nil || !strings.Contains(err.Error(), "makeMoney") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestScenario__expand(t *testing.T) {
+	st := &scenarioState{
+		vars: map[string]interface{}{
+			"depID":   "dep123",
+			"balance": float64(1000),
+		},
+	}
+	out, err := st.expand(map[string]interface{}{
+		"defaultDepository": "${depID}",
+		"balance":           "${balance}",
+		"description":       "from ${depID} to ${depID}",
+		"amount":            "${random.amount}",
+		"lines":             []interface{}{"${depID}"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req struct {
+		DefaultDepository string   `json:"defaultDepository"`
+		Balance           int32    `json:"balance"`
+		Description       string   `json:"description"`
+		Amount            string   `json:"amount"`
+		Lines             []string `json:"lines"`
+	}
+	if err := decodeBody(out, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.DefaultDepository != "dep123" || req.Balance != 1000 || len(req.Lines) != 1 {
+		t.Errorf("unexpected body: %#v", req)
+	}
+	if req.Description != "from dep123 to dep123" {
+		t.Errorf("description=%q", req.Description)
+	}
+	if !strings.HasPrefix(req.Amount, "USD ") {
+		t.Errorf("amount=%q", req.Amount)
+	}
+
+	if _, err := st.expand("${missing}"); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := st.expand("prefix ${missing}"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestScenario__capture(t *testing.T) {
+	st := &scenarioState{
+		vars: make(map[string]interface{}),
+	}
+	transfers := []moov.Transfer{{ID: "t1", Amount: "USD 1.00"}, {ID: "t2"}}
+	err := st.capture(map[string]string{
+		"first":  "0.ID",
+		"second": "1.id",
+		"amount": "0.amount",
+	}, transfers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.vars["first"] != "t1" || st.vars["second"] != "t2" || st.vars["amount"] != "USD 1.00" {
+		t.Errorf("vars: %#v", st.vars)
+	}
+
+	if err := st.capture(map[string]string{"x": "2.ID"}, transfers); err == nil {
+		t.Error("expected error")
+	}
+	if err := st.capture(map[string]string{"x": "0.missing"}, transfers); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestScenario__resolvePath(t *testing.T) {
+	st := &scenarioState{dir: filepath.Join("cmd", "apitest", "scenarios")}
+	if path := st.resolvePath(filepath.Join("documents", "drivers-license.pdf")); path != filepath.Join("cmd", "apitest", "scenarios", "documents", "drivers-license.pdf") {
+		t.Errorf("unexpected path: %s", path)
+	}
+	if path := st.resolvePath("/tmp/license.pdf"); path != "/tmp/license.pdf" {
+		t.Errorf("unexpected path: %s", path)
+	}
+
+	// scenario files need to find their documents wherever apitest runs from
+	sc, err := readScenarioFile(filepath.Join("scenarios", "customer-documents.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st = &scenarioState{dir: filepath.Dir(sc.path)}
+	for _, step := range sc.Steps {
+		if file := step.Params["file"]; file != "" {
+			if _, err := os.Stat(st.resolvePath(file)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+}
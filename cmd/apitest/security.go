@@ -5,17 +5,29 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"strings"
+	"text/tabwriter"
 	"time"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
 )
 
 var (
+	flagCrossUser = flag.Bool("cross-user", false, "Create a second user and check they can't read, update or delete the first user's objects")
+
 	httpClient = &http.Client{
 		Timeout: 10 * time.Second,
 	}
@@ -32,11 +44,20 @@ type authChecker struct {
 
 	requestID string
 	userID    string
+
+	// iter holds every object created by userID
+	iter *iteration
 }
 
-func (ac *authChecker) checkAll() error {
+func (ac *authChecker) checkAll(ctx context.Context) error {
+	if *flagCrossUser {
+		if err := ac.checkCrossUserAccess(ctx); err != nil {
+			return fmt.Errorf("cross-user access: %v", err)
+		}
+	}
+
 	if *flagLocal {
-		return nil // skip this check in local dev
+		return nil // local dev has no auth in front of paygate to bypass
 	}
 
 	if err := ac.canWeBypassAuth("depositories", ac.origDepID); err != nil {
@@ -116,5 +137,482 @@ func checkCORSHeaders(resp *http.Response) error {
 	if v := resp.Header.Get("Access-Control-Allow-Credentials"); v == "" {
 		return errors.New("missing CORS headers: Credentials")
 	}
+	return checkCORSWildcard(resp.Header)
+}
+
+// checkCORSWildcard returns an error if credentials are allowed from any origin. Browsers reject
+// this combination, but it also means every website could make authenticated calls.
+func checkCORSWildcard(header http.Header) error {
+	if header.Get("Access-Control-Allow-Origin") == "*" && strings.EqualFold(header.Get("Access-Control-Allow-Credentials"), "true") {
+		return errors.New("CORS credentials are allowed with a wildcard (*) origin")
+	}
+	return nil
+}
+
+// checkAPIResponse closes resp and returns err along with any problem of its CORS headers.
+func checkAPIResponse(resp *http.Response, err error) error {
+	if resp != nil {
+		resp.Body.Close()
+		if err := checkCORSHeaders(resp); err != nil {
+			return err
+		}
+	}
+	if e, ok := err.(moov.GenericOpenAPIError); ok {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(e.Body())))
+	}
+	return err
+}
+
+var (
+	flagCORSOrigin          = flag.String("cors.origin", "https://moov.io", "Trusted Origin to send CORS preflight requests from")
+	flagCORSUntrustedOrigin = flag.String("cors.untrusted-origin", "https://evil.example.com", "Origin which CORS responses must not allow, empty skips this check")
+
+	// corsRequestHeaders are sent by Moov's clients and need to be allowed by every route
+	corsRequestHeaders = []string{"X-Request-ID", "X-Idempotency-Key", "Authorization"}
+
+	// corsRoutes has a route (and method which needs a preflight) from each group of our API
+	corsRoutes = []corsRoute{
+		{"auth", "POST", "/v1/users/login"},
+		{"oauth2", "POST", "/v1/oauth2/token"},
+		{"accounts", "POST", "/v1/accounts"},
+		{"ach", "POST", "/v1/ach/files/create"},
+		{"customers", "POST", "/v1/customers"},
+		{"depositories", "PATCH", "/v1/ach/depositories/foo"},
+		{"fed", "GET", "/v1/fed/ach/search"},
+		{"gateways", "POST", "/v1/ach/gateways"},
+		{"imagecashletter", "POST", "/v1/imagecashletter/files/create"},
+		{"originators", "DELETE", "/v1/ach/originators/foo"},
+		{"receivers", "POST", "/v1/ach/receivers"},
+		{"transfers", "POST", "/v1/ach/transfers"},
+		{"watchman", "GET", "/v1/watchman/ofac/search"},
+		{"wire", "POST", "/v1/wire/files/create"},
+	}
+)
+
+type corsRoute struct {
+	group  string
+	method string
+	path   string
+}
+
+// corsResult is the outcome of preflight requests to one corsRoute
+type corsResult struct {
+	corsRoute
+
+	header    http.Header // preflight response headers for the trusted origin
+	untrusted string      // Access-Control-Allow-Origin returned for the untrusted origin
+	skipped   bool        // a local service sent no CORS headers
+	err       error
+}
+
+// checkCORSPreflight sends OPTIONS requests to each of corsRoutes from a trusted and untrusted origin.
+// Each route is recorded as a step of a "cors" suite and a table of response headers is printed.
+// With -local routes whose service sends no CORS headers are recorded as skipped.
+func checkCORSPreflight(ctx context.Context, requestID string) error {
+	conf := makeConfiguration()
+	suite := report.newSuite("cors")
+
+	var results []corsResult
+	var failures, skipped int
+	for _, route := range corsRoutes {
+		result := corsResult{corsRoute: route}
+		result.err = suite.step(route.group, func() error {
+			return result.check(ctx, conf, requestID)
+		})
+		if result.err != nil {
+			failures++
+		}
+		if result.skipped {
+			skipped++
+		}
+		results = append(results, result)
+	}
+	writeCORSReport(os.Stdout, results)
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d routes failed CORS checks", failures, len(results))
+	}
+	log.Printf("INFO: CORS preflight requests passed on %d routes, %d skipped", len(results)-skipped, skipped)
+	return nil
+}
+
+func (r *corsResult) check(ctx context.Context, conf *moov.Configuration, requestID string) error {
+	resp, err := sendPreflight(ctx, conf, r.method, r.path, *flagCORSOrigin, requestID)
+	if err != nil {
+		return err
+	}
+	r.header = resp.Header
+	if *flagLocal && resp.Header.Get("Access-Control-Allow-Origin") == "" {
+		r.skipped = true // local services don't send CORS headers, see checkCORSHeaders
+		return skipStep("%s %s sent no CORS headers with -local (HTTP status %s)", r.method, r.path, resp.Status)
+	}
+	if err := checkPreflight(resp, *flagCORSOrigin, r.method); err != nil {
+		return err
+	}
+
+	if *flagCORSUntrustedOrigin == "" {
+		return nil
+	}
+	resp, err = sendPreflight(ctx, conf, r.method, r.path, *flagCORSUntrustedOrigin, requestID)
+	if err != nil {
+		return err
+	}
+	r.untrusted = resp.Header.Get("Access-Control-Allow-Origin")
+	return checkUntrustedOrigin(resp, *flagCORSUntrustedOrigin)
+}
+
+func sendPreflight(ctx context.Context, conf *moov.Configuration, method, path, origin, requestID string) (*http.Response, error) {
+	req, err := http.NewRequest("OPTIONS", conf.BasePath+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	req.Header.Set("Access-Control-Request-Headers", strings.ToLower(strings.Join(corsRequestHeaders, ",")))
+	req.Header.Set("User-Agent", conf.UserAgent)
+	req.Header.Set("X-Request-ID", requestID)
+
+	resp, err := conf.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// checkPreflight returns an error if a preflight response doesn't allow origin to make credentialed
+// requests with method and each of corsRequestHeaders.
+func checkPreflight(resp *http.Response, origin, method string) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("preflight returned HTTP status %s", resp.Status)
+	}
+	if err := checkCORSWildcard(resp.Header); err != nil {
+		return err
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v != origin {
+		return fmt.Errorf("Access-Control-Allow-Origin is %q, expected %q", v, origin)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Credentials"); !strings.EqualFold(v, "true") {
+		return fmt.Errorf("Access-Control-Allow-Credentials is %q, expected \"true\"", v)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Methods"); !headerListContains(v, method) {
+		return fmt.Errorf("Access-Control-Allow-Methods (%q) is missing %s", v, method)
+	}
+	allowed := resp.Header.Get("Access-Control-Allow-Headers")
+	for _, name := range corsRequestHeaders {
+		if !headerListContains(allowed, name) {
+			return fmt.Errorf("Access-Control-Allow-Headers (%q) is missing %s", allowed, name)
+		}
+	}
 	return nil
 }
+
+// checkUntrustedOrigin returns an error if a response allows requests from origin.
+func checkUntrustedOrigin(resp *http.Response, origin string) error {
+	if err := checkCORSWildcard(resp.Header); err != nil {
+		return err
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v == origin {
+		return fmt.Errorf("untrusted origin %s was allowed", origin)
+	}
+	return nil
+}
+
+// headerListContains returns true if a comma separated header value contains name. A wildcard (*)
+// isn't accepted as browsers treat it literally on credentialed requests.
+func headerListContains(list, name string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeCORSReport(w io.Writer, results []corsResult) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tMETHOD\tPATH\tALLOW-ORIGIN\tALLOW-CREDENTIALS\tALLOW-METHODS\tALLOW-HEADERS\tUNTRUSTED-ORIGIN\tRESULT")
+	for _, r := range results {
+		result := "OK"
+		if r.skipped {
+			result = "SKIP"
+		}
+		if r.err != nil {
+			result = r.err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.group, r.method, r.path,
+			headerOrDash(r.header, "Access-Control-Allow-Origin"),
+			headerOrDash(r.header, "Access-Control-Allow-Credentials"),
+			headerOrDash(r.header, "Access-Control-Allow-Methods"),
+			headerOrDash(r.header, "Access-Control-Allow-Headers"),
+			valueOrDash(r.untrusted), result)
+	}
+	return tw.Flush()
+}
+
+func headerOrDash(header http.Header, name string) string {
+	if header == nil {
+		return "-"
+	}
+	return valueOrDash(header.Get(name))
+}
+
+func valueOrDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// checkCrossUserAccess creates a second user and attempts to read, update and delete every object
+// created by ac.userID. The second user authenticates with their cookie and then their OAuth2 token,
+// each with their own X-User-ID and a spoofed one. Every attempt needs to be rejected.
+func (ac *authChecker) checkCrossUserAccess(ctx context.Context) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", ac.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	api := moov.NewAPIClient(conf)
+
+	other, err := createUser(ctx, api)
+	if err != nil {
+		return fmt.Errorf("second user: %v", err)
+	}
+	if other.ID == ac.userID {
+		return fmt.Errorf("second user has the same ID (%s)", other.ID)
+	}
+
+	// We don't use setMoovAuthCookie as X-User-ID is set on each request
+	conf.AddDefaultHeader("Cookie", fmt.Sprintf("moov_auth=%s", other.Cookie.Value))
+	if err := ac.runCrossUserChecks(ctx, api, other); err != nil {
+		return fmt.Errorf("cookie auth: %v", err)
+	}
+
+	token, err := createOAuthToken(ctx, api, other)
+	if err != nil {
+		return fmt.Errorf("second user: %v", err)
+	}
+	removeMoovAuthCookie(conf)
+	setMoovOAuthToken(conf, token)
+	if err := ac.runCrossUserChecks(ctx, api, other); err != nil {
+		return fmt.Errorf("OAuth2 auth: %v", err)
+	}
+
+	log.Printf("INFO: user %s was unable to access objects of user %s", other.ID, ac.userID)
+	return nil
+}
+
+func (ac *authChecker) runCrossUserChecks(ctx context.Context, api *moov.APIClient, other *user) error {
+	for _, xUserID := range []string{other.ID, ac.userID} {
+		for _, check := range ac.crossUserChecks() {
+			if err := check.run(ctx, api, xUserID); err != nil {
+				return fmt.Errorf("%s (X-User-ID: %s): %v", check.name, xUserID, err)
+			}
+		}
+	}
+	return nil
+}
+
+// crossUserCheck is one request from another user against the objects of authChecker.userID
+type crossUserCheck struct {
+	name string
+	run  func(ctx context.Context, api *moov.APIClient, xUserID string) error
+}
+
+// crossUserChecks returns reads, then updates and finally deletes so each object still exists
+// when it's read or updated.
+func (ac *authChecker) crossUserChecks() []crossUserCheck {
+	iter := ac.iter
+	var checks []crossUserCheck
+	add := func(name string, run func(ctx context.Context, api *moov.APIClient, xUserID string) error) {
+		checks = append(checks, crossUserCheck{name: name, run: run})
+	}
+
+	// Reads
+	add("GetGateways", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		gateways, resp, err := api.GatewaysApi.GetGateways(ctx, xUserID, nil)
+		if err != nil {
+			return expectDenied(resp, err)
+		}
+		for i := range gateways {
+			if gateways[i].ID == iter.gateway.ID {
+				return fmt.Errorf("found gateway=%s", gateways[i].ID)
+			}
+		}
+		return nil
+	})
+	for _, dep := range []moov.Depository{iter.originatorDepository, iter.receiverDepository} {
+		depID := dep.ID
+		add("GetDepositoryByID", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			_, resp, err := api.DepositoriesApi.GetDepositoryByID(ctx, depID, xUserID, nil)
+			return expectDenied(resp, err)
+		})
+	}
+	add("GetOriginatorByID", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.OriginatorsApi.GetOriginatorByID(ctx, iter.originator.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	add("GetReceiverByID", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.ReceiversApi.GetReceiverByID(ctx, iter.receiver.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	add("GetTransferByID", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.TransfersApi.GetTransferByID(ctx, iter.transfer.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	add("GetTransferEventsByID", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.TransfersApi.GetTransferEventsByID(ctx, iter.transfer.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	add("GetTransferFiles", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.TransfersApi.GetTransferFiles(ctx, iter.transfer.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	add("GetTransferNachaCode", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.TransfersApi.GetTransferNachaCode(ctx, iter.transfer.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	for _, acct := range []*moov.Account{iter.originatorAccount, iter.receiverAccount} {
+		acct := acct
+		add("SearchAccounts", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			accounts, resp, err := api.AccountsApi.SearchAccounts(ctx, xUserID, &moov.SearchAccountsOpts{
+				Number:        optional.NewString(acct.AccountNumber),
+				RoutingNumber: optional.NewString(acct.RoutingNumber),
+				Type_:         optional.NewString(acct.Type),
+			})
+			if err != nil {
+				return expectDenied(resp, err)
+			}
+			for i := range accounts {
+				if accounts[i].ID == acct.ID {
+					return fmt.Errorf("found account=%s", acct.ID)
+				}
+			}
+			return nil
+		})
+		add("GetAccountTransactions", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			transactions, resp, err := api.AccountsApi.GetAccountTransactions(ctx, acct.ID, xUserID, nil)
+			if err != nil {
+				return expectDenied(resp, err)
+			}
+			if len(transactions) > 0 {
+				return fmt.Errorf("found %d transactions on account=%s", len(transactions), acct.ID)
+			}
+			return nil
+		})
+	}
+	for _, customerID := range []string{iter.originator.CustomerID, iter.receiver.CustomerID} {
+		if customerID == "" {
+			continue // Customers calls are disabled in paygate
+		}
+		customerID := customerID
+		add("GetCustomer", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			_, resp, err := api.CustomersApi.GetCustomer(ctx, customerID, &moov.GetCustomerOpts{
+				XUserID: optional.NewString(xUserID),
+			})
+			return expectDenied(resp, err)
+		})
+		add("GetCustomerDocuments", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			_, resp, err := api.CustomersApi.GetCustomerDocuments(ctx, customerID, &moov.GetCustomerDocumentsOpts{
+				XUserID: optional.NewString(xUserID),
+			})
+			return expectDenied(resp, err)
+		})
+	}
+
+	// Updates use each object's current values so only ownership can reject them.
+	for _, dep := range []moov.Depository{iter.originatorDepository, iter.receiverDepository} {
+		dep := dep
+		add("UpdateDepository", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			_, resp, err := api.DepositoriesApi.UpdateDepository(ctx, dep.ID, xUserID, moov.CreateDepository{
+				BankName:      dep.BankName,
+				Holder:        dep.Holder,
+				HolderType:    dep.HolderType,
+				Type:          dep.Type,
+				RoutingNumber: dep.RoutingNumber,
+				AccountNumber: dep.AccountNumber,
+			}, nil)
+			return expectDenied(resp, err)
+		})
+		add("InitiateMicroDeposits", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			resp, err := api.DepositoriesApi.InitiateMicroDeposits(ctx, dep.ID, xUserID, nil)
+			return expectDenied(resp, err)
+		})
+		add("ConfirmMicroDeposits", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			amounts := moov.Amounts{Amounts: []string{"USD 0.01", "USD 0.03"}}
+			resp, err := api.DepositoriesApi.ConfirmMicroDeposits(ctx, dep.ID, xUserID, amounts, nil)
+			return expectDenied(resp, err)
+		})
+	}
+	add("UpdateOriginator", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.OriginatorsApi.UpdateOriginator(ctx, iter.originator.ID, xUserID, moov.CreateOriginator{
+			DefaultDepository: iter.originator.DefaultDepository,
+			Identification:    iter.originator.Identification,
+			Metadata:          iter.originator.Metadata,
+		}, nil)
+		return expectDenied(resp, err)
+	})
+	add("UpdateReceiver", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.ReceiversApi.UpdateReceiver(ctx, iter.receiver.ID, xUserID, moov.CreateReceiver{
+			DefaultDepository: iter.receiver.DefaultDepository,
+			Email:             iter.receiver.Email,
+			Metadata:          iter.receiver.Metadata,
+		}, nil)
+		return expectDenied(resp, err)
+	})
+	add("CreateTransaction", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		_, resp, err := api.AccountsApi.CreateTransaction(ctx, xUserID, moov.CreateTransaction{
+			Lines: []moov.TransactionLine{
+				{AccountID: iter.originatorAccount.ID, Purpose: "ACHDebit", Amount: -1},
+				{AccountID: iter.receiverAccount.ID, Purpose: "ACHCredit", Amount: 1},
+			},
+		}, nil)
+		return expectDenied(resp, err)
+	})
+
+	// Deletes
+	add("DeleteTransferByID", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		resp, err := api.TransfersApi.DeleteTransferByID(ctx, iter.transfer.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	add("DeleteReceiver", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		resp, err := api.ReceiversApi.DeleteReceiver(ctx, iter.receiver.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	add("DeleteOriginator", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+		resp, err := api.OriginatorsApi.DeleteOriginator(ctx, iter.originator.ID, xUserID, nil)
+		return expectDenied(resp, err)
+	})
+	for _, dep := range []moov.Depository{iter.originatorDepository, iter.receiverDepository} {
+		depID := dep.ID
+		add("DeleteDepository", func(ctx context.Context, api *moov.APIClient, xUserID string) error {
+			resp, err := api.DepositoriesApi.DeleteDepository(ctx, depID, xUserID, nil)
+			return expectDenied(resp, err)
+		})
+	}
+
+	return checks
+}
+
+// expectDenied returns nil if the response was rejected as unauthorized, forbidden or not found.
+// A successful response means another user accessed our object.
+func expectDenied(resp *http.Response, err error) error {
+	if resp == nil {
+		if err != nil {
+			return err
+		}
+		return errors.New("missing HTTP response")
+	}
+	resp.Body.Close()
+	if err := checkCORSHeaders(resp); err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("request was allowed with HTTP status %s", resp.Status)
+	}
+	return fmt.Errorf("unexpected HTTP status %s: %v", resp.Status, err)
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func preflightResponse(headers map[string]string) *http.Response {
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     make(http.Header),
+	}
+	for k, v := range headers {
+		resp.Header.Set(k, v)
+	}
+	return resp
+}
+
+func TestSecurity__checkPreflight(t *testing.T) {
+	good := map[string]string{
+		"Access-Control-Allow-Origin":      "https://moov.io",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET,POST,PATCH,DELETE,OPTIONS",
+		"Access-Control-Allow-Headers":     "Authorization, Cookie, X-Request-Id, X-Idempotency-Key",
+	}
+	if err := checkPreflight(preflightResponse(good), "https://moov.io", "PATCH"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]map[string]string{
+		"Access-Control-Allow-Origin is":   {"Access-Control-Allow-Origin": "https://other.com"},
+		"wildcard":                         {"Access-Control-Allow-Origin": "*"},
+		"Access-Control-Allow-Credentials": {"Access-Control-Allow-Credentials": ""},
+		"Access-Control-Allow-Methods (\"GET,POST\") is missing PATCH": {"Access-Control-Allow-Methods": "GET,POST"},
+		"is missing X-Idempotency-Key":                                 {"Access-Control-Allow-Headers": "Authorization, X-Request-ID"},
+		"is missing X-Request-ID":                                      {"Access-Control-Allow-Headers": "*"},
+	}
+	for expected, overrides := range cases {
+		headers := make(map[string]string)
+		for k, v := range good {
+			headers[k] = v
+		}
+		for k, v := range overrides {
+			headers[k] = v
+		}
+		err := checkPreflight(preflightResponse(headers), "https://moov.io", "PATCH")
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q error, got %v", expected, err)
+		}
+	}
+
+	resp := preflightResponse(good)
+	resp.Status, resp.StatusCode = "404 Not Found", http.StatusNotFound
+	if err := checkPreflight(resp, "https://moov.io", "PATCH"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestSecurity__checkUntrustedOrigin(t *testing.T) {
+	origin := "https://evil.example.com"
+	if err := checkUntrustedOrigin(preflightResponse(nil), origin); err != nil {
+		t.Error(err)
+	}
+	resp := preflightResponse(map[string]string{"Access-Control-Allow-Origin": origin})
+	if err := checkUntrustedOrigin(resp, origin); err == nil {
+		t.Error("expected error")
+	}
+	resp = preflightResponse(map[string]string{
+		"Access-Control-Allow-Origin":      "*",
+		"Access-Control-Allow-Credentials": "true",
+	})
+	if err := checkUntrustedOrigin(resp, origin); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestSecurity__checkCORSLocal(t *testing.T) {
+	svc := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/wire/files/create" {
+			w.Header().Set("Access-Control-Allow-Origin", "https://other.com")
+		}
+	}))
+	defer svc.Close()
+
+	defer func(local bool) { *flagLocal = local }(*flagLocal)
+	*flagLocal = true
+
+	conf := moov.NewConfiguration()
+	conf.BasePath = svc.URL
+	conf.HTTPClient = svc.Client()
+
+	// no CORS headers are skipped with -local
+	suite := newRunReport().newSuite("cors")
+	result := corsResult{corsRoute: corsRoute{"transfers", "POST", "/v1/ach/transfers"}}
+	if err := suite.step(result.group, func() error { return result.check(context.Background(), conf, "foo") }); err != nil {
+		t.Fatal(err)
+	}
+	if !result.skipped || suite.Steps[0].Skipped == "" {
+		t.Errorf("expected skipped step: %#v", suite.Steps[0])
+	}
+
+	// but CORS headers which are sent are checked
+	result = corsResult{corsRoute: corsRoute{"wire", "POST", "/v1/wire/files/create"}}
+	if err := result.check(context.Background(), conf, "foo"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestSecurity__writeCORSReport(t *testing.T) {
+	var buf bytes.Buffer
+	writeCORSReport(&buf, []corsResult{
+		{
+			corsRoute: corsRoute{"transfers", "POST", "/v1/ach/transfers"},
+			header:    preflightResponse(map[string]string{"Access-Control-Allow-Origin": "https://moov.io"}).Header,
+		},
+		{
+			corsRoute: corsRoute{"wire", "POST", "/v1/wire/files/create"},
+			err:       errors.New("preflight returned HTTP status 404 Not Found"),
+		},
+	})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected report:\n%s", buf.String())
+	}
+	if !strings.Contains(lines[1], "https://moov.io") || !strings.HasSuffix(lines[1], "OK") {
+		t.Errorf("unexpected line: %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "404 Not Found") {
+		t.Errorf("unexpected line: %q", lines[2])
+	}
+}
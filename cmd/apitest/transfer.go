@@ -6,6 +6,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -100,6 +101,23 @@ func verifyDepository(ctx context.Context, api *moov.APIClient, accountID string
 }
 
 func createOriginator(ctx context.Context, api *moov.APIClient, u *user, flags *featureFlags, depId string) (moov.Originator, error) {
+	req := newOriginatorRequest(flags, depId)
+	orig, resp, err := api.OriginatorsApi.AddOriginator(ctx, u.ID, req, &moov.AddOriginatorOpts{
+		XIdempotencyKey: optional.NewString(generateID()),
+	})
+	if resp != nil {
+		resp.Body.Close()
+		if err := checkCORSHeaders(resp); err != nil {
+			return orig, fmt.Errorf("create originator: %v", err)
+		}
+	}
+	if err != nil {
+		return orig, fmt.Errorf("problem creating originator: %v", err)
+	}
+	return orig, nil
+}
+
+func newOriginatorRequest(flags *featureFlags, depId string) moov.CreateOriginator {
 	first, _ := name()
 	req := moov.CreateOriginator{
 		DefaultDepository: depId,
@@ -117,22 +135,27 @@ func createOriginator(ctx context.Context, api *moov.APIClient, u *user, flags *
 			PostalCode: "90301",
 		}
 	}
-	orig, resp, err := api.OriginatorsApi.AddOriginator(ctx, u.ID, req, &moov.AddOriginatorOpts{
+	return req
+}
+
+func createReceiver(ctx context.Context, api *moov.APIClient, u *user, flags *featureFlags, depId string) (moov.Receiver, error) {
+	req := newReceiverRequest(u, flags, depId)
+	receiver, resp, err := api.ReceiversApi.AddReceivers(ctx, u.ID, req, &moov.AddReceiversOpts{
 		XIdempotencyKey: optional.NewString(generateID()),
 	})
 	if resp != nil {
 		resp.Body.Close()
 		if err := checkCORSHeaders(resp); err != nil {
-			return orig, fmt.Errorf("create originator: %v", err)
+			return receiver, fmt.Errorf("create receiver: %v", err)
 		}
 	}
 	if err != nil {
-		return orig, fmt.Errorf("problem creating originator: %v", err)
+		return receiver, fmt.Errorf("problem creating receiver: %v", err)
 	}
-	return orig, nil
+	return receiver, nil
 }
 
-func createReceiver(ctx context.Context, api *moov.APIClient, u *user, flags *featureFlags, depId string) (moov.Receiver, error) {
+func newReceiverRequest(u *user, flags *featureFlags, depId string) moov.CreateReceiver {
 	req := moov.CreateReceiver{
 		Email:             email(name()), // new random email address
 		DefaultDepository: depId,
@@ -150,73 +173,181 @@ func createReceiver(ctx context.Context, api *moov.APIClient, u *user, flags *fe
 			PostalCode: "90301",
 		}
 	}
-	receiver, resp, err := api.ReceiversApi.AddReceivers(ctx, u.ID, req, &moov.AddReceiversOpts{
+	return req
+}
+
+func createTransfer(ctx context.Context, api *moov.APIClient, receiver moov.Receiver, orig moov.Originator, amount string, kind transferKind, userID string) (moov.Transfer, error) {
+	req := newTransferRequest(receiver, orig, amount, kind)
+	tx, resp, err := api.TransfersApi.AddTransfer(ctx, userID, req, &moov.AddTransferOpts{
 		XIdempotencyKey: optional.NewString(generateID()),
 	})
 	if resp != nil {
 		resp.Body.Close()
 		if err := checkCORSHeaders(resp); err != nil {
-			return receiver, fmt.Errorf("create receiver: %v", err)
+			return tx, fmt.Errorf("create transfer: %v", err)
 		}
 	}
 	if err != nil {
-		return receiver, fmt.Errorf("problem creating receiver: %v", err)
+		return tx, fmt.Errorf("problem creating %s %s transfer: %v", amount, kind, err)
 	}
-	return receiver, nil
+
+	if *flagCleanup {
+		// Delete the transfer (and underlying file) since we're only making one Transfer
+		resp, err = api.TransfersApi.DeleteTransferByID(ctx, tx.ID, userID, &moov.DeleteTransferByIDOpts{})
+		if resp != nil {
+			resp.Body.Close()
+			if err := checkCORSHeaders(resp); err != nil {
+				return tx, fmt.Errorf("delete transfer: %v", err)
+			}
+		}
+		if err != nil {
+			return tx, fmt.Errorf("problem deleting transfer: %v", err)
+		}
+	}
+	return tx, nil
 }
 
-func createTransfer(ctx context.Context, api *moov.APIClient, receiver moov.Receiver, orig moov.Originator, amount string, userID string) (moov.Transfer, error) {
+// transferKind is the SEC code and direction of a Transfer.
+type transferKind struct {
+	secCode      string
+	transferType string // Push or Pull
+}
+
+func (k transferKind) String() string {
+	return fmt.Sprintf("%s %s", k.secCode, strings.ToLower(k.transferType))
+}
+
+// newTransferRequest returns a Transfer from orig to receiver. Push transfers credit the receiver's
+// depository and pull transfers debit it, crediting the originator's depository.
+func newTransferRequest(receiver moov.Receiver, orig moov.Originator, amount string, kind transferKind) moov.CreateTransfer {
 	req := moov.CreateTransfer{
-		TransferType:         "Push",
-		Amount:               amount,
-		Originator:           orig.ID,
-		OriginatorDepository: orig.DefaultDepository,
-		Receiver:             receiver.ID,
-		ReceiverDepository:   receiver.DefaultDepository,
-		Description:          fmt.Sprintf("apitest transfer to %s", receiver.Metadata),
-	}
-	switch *flagACHType {
+		TransferType:           kind.transferType,
+		Amount:                 amount,
+		Originator:             orig.ID,
+		OriginatorDepository:   orig.DefaultDepository,
+		Receiver:               receiver.ID,
+		ReceiverDepository:     receiver.DefaultDepository,
+		Description:            fmt.Sprintf("apitest transfer to %s", receiver.Metadata),
+		StandardEntryClassCode: kind.secCode,
+	}
+	if strings.EqualFold(kind.transferType, "pull") {
+		req.Description = fmt.Sprintf("apitest transfer from %s", receiver.Metadata)
+	}
+	switch kind.secCode {
+	case ach.CCD:
+		req.CCDDetail = moov.CcdDetail{
+			PaymentInformation: "apitest corporate payment",
+		}
 	case ach.IAT:
-		req.StandardEntryClassCode = "IAT"
 		req.IATDetail = createIATDetail(receiver, orig)
 	case ach.PPD:
-		req.StandardEntryClassCode = "PPD"
 		req.PPDDetail = moov.PpdDetail{
 			PaymentInformation: "apitest transfer",
 		}
+	case ach.TEL:
+		req.TELDetail = createTELDetail()
 	case ach.WEB:
-		req.StandardEntryClassCode = "WEB"
 		req.WEBDetail = createWEBDetail()
+	}
+	return req
+}
+
+// achTypes are the Standard Entry Class (SEC) codes paygate accepts on transfers, which all have
+// a detail object in moov.CreateTransfer.
+var achTypes = []string{ach.CCD, ach.IAT, ach.PPD, ach.TEL, ach.WEB}
 
+// parseACHTypes reads the comma separated SEC codes of -ach.type, where "all" is every code in achTypes.
+func parseACHTypes(v string) ([]string, error) {
+	if strings.EqualFold(strings.TrimSpace(v), "all") {
+		return append([]string(nil), achTypes...), nil
+	}
+	var out []string
+	seen := make(map[string]bool)
+	for _, code := range strings.Split(v, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code == "" || seen[code] {
+			continue
+		}
+		if !supportedACHType(code) {
+			return nil, fmt.Errorf("unsupported -ach.type %s, options: %s", code, strings.Join(achTypes, ", "))
+		}
+		seen[code] = true
+		out = append(out, code)
 	}
+	if len(out) == 0 {
+		return nil, errors.New("no -ach.type given")
+	}
+	return out, nil
+}
 
-	tx, resp, err := api.TransfersApi.AddTransfer(ctx, userID, req, &moov.AddTransferOpts{
-		XIdempotencyKey: optional.NewString(generateID()),
-	})
-	if resp != nil {
-		resp.Body.Close()
-		if err := checkCORSHeaders(resp); err != nil {
-			return tx, fmt.Errorf("create transfer: %v", err)
+// transferTypes are the directions transfers can be created in
+var transferTypes = []string{"Push", "Pull"}
+
+// parseTransferTypes reads the comma separated directions of -transfer.type (push or pull).
+func parseTransferTypes(v string) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool)
+	for _, typ := range strings.Split(v, ",") {
+		typ = strings.TrimSpace(typ)
+		if typ == "" {
+			continue
+		}
+		var found string
+		for i := range transferTypes {
+			if strings.EqualFold(typ, transferTypes[i]) {
+				found = transferTypes[i]
+			}
+		}
+		if found == "" {
+			return nil, fmt.Errorf("unsupported -transfer.type %s, options: push, pull", typ)
+		}
+		if !seen[found] {
+			seen[found] = true
+			out = append(out, found)
 		}
 	}
-	if err != nil {
-		return tx, fmt.Errorf("problem creating %s transfer: %v", amount, err)
+	if len(out) == 0 {
+		return nil, errors.New("no -transfer.type given")
 	}
+	return out, nil
+}
 
-	if *flagCleanup {
-		// Delete the transfer (and underlying file) since we're only making one Transfer
-		resp, err = api.TransfersApi.DeleteTransferByID(ctx, tx.ID, userID, &moov.DeleteTransferByIDOpts{})
-		if resp != nil {
-			resp.Body.Close()
-			if err := checkCORSHeaders(resp); err != nil {
-				return tx, fmt.Errorf("delete transfer: %v", err)
+// transferKinds returns each combination of SEC code and direction to create transfers for. TEL entries
+// can only be debits, so those transfers are always pulled.
+func transferKinds(secCodes []string, types []string) []transferKind {
+	var out []transferKind
+	seen := make(map[transferKind]bool)
+	for i := range secCodes {
+		for j := range types {
+			kind := transferKind{secCode: secCodes[i], transferType: types[j]}
+			if kind.secCode == ach.TEL {
+				kind.transferType = "Pull"
+			}
+			if !seen[kind] {
+				seen[kind] = true
+				out = append(out, kind)
 			}
 		}
-		if err != nil {
-			return tx, fmt.Errorf("problem deleting transfer: %v", err)
+	}
+	return out
+}
+
+// transactionPurposes returns the purpose of the transaction lines posted to the originator and
+// receiver accounts for a Transfer.
+func transactionPurposes(transferType string) (originator string, receiver string) {
+	if strings.EqualFold(transferType, "pull") {
+		return "ACHCredit", "ACHDebit"
+	}
+	return "ACHDebit", "ACHCredit"
+}
+
+func supportedACHType(code string) bool {
+	for i := range achTypes {
+		if achTypes[i] == code {
+			return true
 		}
 	}
-	return tx, nil
+	return false
 }
 
 func createIATDetail(receiver moov.Receiver, orig moov.Originator) moov.IatDetail {
@@ -248,6 +379,13 @@ func createIATDetail(receiver moov.Receiver, orig moov.Originator) moov.IatDetai
 	}
 }
 
+func createTELDetail() moov.TelDetail {
+	return moov.TelDetail{
+		PhoneNumber: phone(),
+		PaymentType: "single",
+	}
+}
+
 func createWEBDetail() moov.WebDetail {
 	return moov.WebDetail{
 		PaymentInformation: "apitest payment",
@@ -0,0 +1,118 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestTransfer__parseACHTypes(t *testing.T) {
+	cases := map[string][]string{
+		"PPD":          {"PPD"},
+		"ppd, web,PPD": {"PPD", "WEB"},
+		"CCD,TEL,":     {"CCD", "TEL"},
+		" All ":        {"CCD", "IAT", "PPD", "TEL", "WEB"},
+	}
+	for input, expected := range cases {
+		codes, err := parseACHTypes(input)
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(codes, expected) {
+			t.Errorf("%q: got %v, expected %v", input, codes, expected)
+		}
+	}
+
+	for _, input := range []string{"", ",", "CTX", "PPD,CIE"} {
+		if _, err := parseACHTypes(input); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestTransfer__parseTransferTypes(t *testing.T) {
+	cases := map[string][]string{
+		"push":            {"Push"},
+		"Pull":            {"Pull"},
+		"push, PULL,push": {"Push", "Pull"},
+	}
+	for input, expected := range cases {
+		types, err := parseTransferTypes(input)
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(types, expected) {
+			t.Errorf("%q: got %v, expected %v", input, types, expected)
+		}
+	}
+	for _, input := range []string{"", "both", "push,credit"} {
+		if _, err := parseTransferTypes(input); err == nil {
+			t.Errorf("%q: expected error", input)
+		}
+	}
+}
+
+func TestTransfer__transferKinds(t *testing.T) {
+	kinds := transferKinds([]string{"PPD", "TEL"}, []string{"Push", "Pull"})
+	expected := []transferKind{
+		{"PPD", "Push"},
+		{"PPD", "Pull"},
+		{"TEL", "Pull"}, // TEL is only debits
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("got %v, expected %v", kinds, expected)
+	}
+	if kinds := transferKinds([]string{"TEL"}, []string{"Push"}); len(kinds) != 1 || kinds[0].transferType != "Pull" {
+		t.Errorf("unexpected kinds: %v", kinds)
+	}
+}
+
+func TestTransfer__transactionPurposes(t *testing.T) {
+	if orig, rec := transactionPurposes("Push"); orig != "ACHDebit" || rec != "ACHCredit" {
+		t.Errorf("push: originator=%s receiver=%s", orig, rec)
+	}
+	if orig, rec := transactionPurposes("pull"); orig != "ACHCredit" || rec != "ACHDebit" {
+		t.Errorf("pull: originator=%s receiver=%s", orig, rec)
+	}
+}
+
+func TestTransfer__newTransferRequest(t *testing.T) {
+	receiver := moov.Receiver{ID: "receiver", DefaultDepository: "receiverDep", Metadata: "Jane Doe"}
+	orig := moov.Originator{ID: "orig", DefaultDepository: "origDep", Metadata: "Moov Corp"}
+
+	for _, secCode := range achTypes {
+		req := newTransferRequest(receiver, orig, "USD 12.34", transferKind{secCode, "Push"})
+		if req.StandardEntryClassCode != secCode || req.Amount != "USD 12.34" || req.TransferType != "Push" {
+			t.Errorf("%s: unexpected transfer: %#v", secCode, req)
+		}
+		var empty bool
+		switch secCode {
+		case "CCD":
+			empty = req.CCDDetail == moov.CcdDetail{}
+		case "IAT":
+			empty = req.IATDetail == moov.IatDetail{}
+		case "PPD":
+			empty = req.PPDDetail == moov.PpdDetail{}
+		case "TEL":
+			empty = req.TELDetail == moov.TelDetail{}
+		case "WEB":
+			empty = req.WEBDetail == moov.WebDetail{}
+		}
+		if empty {
+			t.Errorf("%s: missing detail", secCode)
+		}
+	}
+
+	// Pull transfers keep the same depositories
+	req := newTransferRequest(receiver, orig, "USD 12.34", transferKind{"PPD", "Pull"})
+	if req.TransferType != "Pull" || req.OriginatorDepository != "origDep" || req.ReceiverDepository != "receiverDep" {
+		t.Errorf("unexpected pull transfer: %#v", req)
+	}
+}
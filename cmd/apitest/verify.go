@@ -5,14 +5,19 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/moov-io/ach"
+	"github.com/moov-io/base"
+	moov "github.com/moov-io/go-client/client"
 )
 
 func verifyDirIsEmpty(dir string) bool {
@@ -31,14 +36,43 @@ func verifyDirIsEmpty(dir string) bool {
 	return true
 }
 
+// mergedTransfer is a Transfer (and its iteration) we expect to find in a merged ACH file.
+type mergedTransfer struct {
+	iter     *iteration
+	transfer moov.Transfer
+}
+
+// pendingTransfers returns every Transfer created by iterations.
+func pendingTransfers(iterations []*iteration) []mergedTransfer {
+	var out []mergedTransfer
+	for i := range iterations {
+		transfers := iterations[i].transfers
+		if len(transfers) == 0 {
+			transfers = []moov.Transfer{iterations[i].transfer}
+		}
+		for j := range transfers {
+			out = append(out, mergedTransfer{iter: iterations[i], transfer: transfers[j]})
+		}
+	}
+	return out
+}
+
 // verifyTransfersWereMerged will take the incoming iterations (i.e. Transfers and related metadata) to
 // verify all transfers exist in the merged ACH files in dir. This is done to help ensure paygate handles
-// and uploads all the given transfers to the FED / receiving FI.
-func verifyTransfersWereMerged(dir string, iterations []*iteration) error {
-	iterationsBeforeMatching, mergedFilesProcessed := len(iterations), 0
+// and uploads all the given transfers to the FED / receiving FI. Each transfer needs to match an entry
+// on its amount, SEC code, transaction code, receiver, individual ID and originator (see entryMismatches).
+// Transfers without an entry are returned as an error and entries without a transfer are returned.
+func verifyTransfersWereMerged(dir string, iterations []*iteration) ([]string, error) {
 	if len(iterations) == 0 {
-		return fmt.Errorf("no iterations (transfers) found")
+		return nil, fmt.Errorf("no iterations (transfers) found")
 	}
+	pending := pendingTransfers(iterations)
+	transfersBeforeMatching, mergedFilesProcessed := len(pending), 0
+
+	// mismatches describe why a transfer with a matching amount wasn't matched, by transfer ID
+	mismatches := make(map[string]string)
+	var extra []string
+
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if (err != nil && err != filepath.SkipDir) || info.IsDir() {
 			return nil // Ignore SkipDir and directories
@@ -48,64 +82,276 @@ func verifyTransfersWereMerged(dir string, iterations []*iteration) error {
 		if err != nil {
 			return fmt.Errorf("error reading %s: %v", path, err)
 		}
-		i := -1
 		mergedFilesProcessed++
-		for {
-			i++
-			if i >= len(iterations) {
-				break
-			}
-			if file.Header.ImmediateOrigin != iterations[i].originatorDepository.RoutingNumber {
-				continue
-			}
-			if file.Header.ImmediateDestination != iterations[i].receiverDepository.RoutingNumber {
-				continue
+		var entries []*mergedEntry
+		pending, entries = matchMergedFile(file, pending, mismatches)
+		for i := range entries {
+			if entries[i].transferID == "" {
+				extra = append(extra, fmt.Sprintf("%s %s", filepath.Base(path), entries[i]))
 			}
-			if *flagDebug {
-				log.Printf("origin: %s vs %s destination: %s vs %s\n",
-					file.Header.ImmediateOrigin, iterations[i].originatorDepository.RoutingNumber,
-					file.Header.ImmediateDestination, iterations[i].receiverDepository.RoutingNumber)
-			}
-			// Check file's batches
-			for j := range file.Batches {
-				entries := file.Batches[j].GetEntries()
-				for k := range entries {
-					amount := fmt.Sprintf("USD %.2f", float64(entries[k].Amount)/100.0) // TODO(adam): use paygate's shared Amount type
-					if *flagDebug {
-						log.Printf("DEBUG: amounts %s vs %s\n", iterations[i].transfer.Amount, amount)
-					}
-					if iterations[i].transfer.Amount == amount {
-						log.Printf("INFO: Matched transfer %s for %s", iterations[i].transfer.ID, iterations[i].transfer.Amount)
-						// found a match // TODO(adam): compare more fields?
-						iterations = append(iterations[:i], iterations[i+1:]...) // remove iteration
-						i = -1                                                   // reset i so we reprocess entire iterations array
-						goto next
-					}
-				}
-			}
-		next:
-			// check the next iteration, iterations leftover are those that weren't found in a file
 		}
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if len(iterations) > 0 {
+	if len(pending) > 0 {
 		var transferLine []string
-		for i := range iterations {
-			transferLine = append(transferLine, fmt.Sprintf("%s (amount: %s)", iterations[i].transfer.ID, iterations[i].transfer.Amount))
+		for i := range pending {
+			xfer := pending[i].transfer
+			line := fmt.Sprintf("%s (amount: %s, SEC: %s, type: %s)", xfer.ID, xfer.Amount, xfer.StandardEntryClassCode, xfer.TransferType)
+			if reason, exists := mismatches[xfer.ID]; exists {
+				line += " " + reason
+			}
+			transferLine = append(transferLine, line)
+		}
+		if transfersBeforeMatching == len(pending) || mergedFilesProcessed == 0 {
+			log.Printf("0/%d transfers matched, did paygate create any merged files? (%d files processed)", transfersBeforeMatching, mergedFilesProcessed)
 		}
-		if iterationsBeforeMatching == len(iterations) || mergedFilesProcessed == 0 {
-			log.Printf("0/%d transfers matched, did paygate create any merged files? (%d files processed)", iterationsBeforeMatching, mergedFilesProcessed)
+		msg := fmt.Sprintf("transfers not matched!!\n%s", strings.Join(transferLine, "\n"))
+		if len(extra) > 0 {
+			msg += fmt.Sprintf("\nentries not matched:\n%s", strings.Join(extra, "\n"))
 		}
-		return fmt.Errorf(fmt.Sprintf("transfers not matched!!\n%s", strings.Join(transferLine, "\n")))
+		return extra, errors.New(msg)
 	} else {
 		log.Printf("SUCCESS: all transfers matched in merged file(s)")
 	}
+	return extra, nil
+}
+
+// checkExtraEntries returns an error listing the entries verifyTransfersWereMerged didn't match
+// to a transfer.
+func checkExtraEntries(extra []string) error {
+	if len(extra) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d entries didn't match a transfer:\n%s", len(extra), strings.Join(extra, "\n"))
+}
+
+// mergedEntry is an entry (domestic or IAT) of a merged file along with the batch fields it's matched on.
+type mergedEntry struct {
+	batch ach.Batcher      // nil for IAT entries
+	entry *ach.EntryDetail // nil for IAT entries
+
+	secCode       string
+	companyID     string
+	effectiveDate string
+
+	transactionCode int
+	amount          int
+	routingNumber   string
+	accountNumber   string
+	name            string
+	individualID    string // empty for IAT entries
+	traceNumber     string
+
+	// transferID is the Transfer matched to this entry
+	transferID string
+}
+
+func (e *mergedEntry) String() string {
+	return fmt.Sprintf("%s entry %s (amount: %d, transaction code: %d, account: %s/%s, name: %q, ID: %q)",
+		e.secCode, e.traceNumber, e.amount, e.transactionCode, e.routingNumber, e.accountNumber, e.name, e.individualID)
+}
+
+// mergedEntries returns each entry in the batches and IAT batches of file.
+func mergedEntries(file *ach.File) []*mergedEntry {
+	var out []*mergedEntry
+	for i := range file.Batches {
+		bh := file.Batches[i].GetHeader()
+		for _, ed := range file.Batches[i].GetEntries() {
+			out = append(out, &mergedEntry{
+				batch:           file.Batches[i],
+				entry:           ed,
+				secCode:         bh.StandardEntryClassCode,
+				companyID:       strings.TrimSpace(bh.CompanyIdentification),
+				effectiveDate:   bh.EffectiveEntryDate,
+				transactionCode: ed.TransactionCode,
+				amount:          ed.Amount,
+				routingNumber:   ed.RDFIIdentification + ed.CheckDigit,
+				accountNumber:   strings.TrimSpace(ed.DFIAccountNumber),
+				name:            strings.TrimSpace(ed.IndividualName),
+				individualID:    strings.TrimSpace(ed.IdentificationNumber),
+				traceNumber:     ed.TraceNumber,
+			})
+		}
+	}
+	for i := range file.IATBatches {
+		bh := file.IATBatches[i].Header
+		for _, ed := range file.IATBatches[i].Entries {
+			e := &mergedEntry{
+				secCode:         bh.StandardEntryClassCode,
+				companyID:       strings.TrimSpace(bh.OriginatorIdentification),
+				effectiveDate:   bh.EffectiveEntryDate,
+				transactionCode: ed.TransactionCode,
+				amount:          ed.Amount,
+				routingNumber:   ed.RDFIIdentification + ed.CheckDigit,
+				accountNumber:   strings.TrimSpace(ed.DFIAccountNumber),
+				traceNumber:     ed.TraceNumber,
+			}
+			if ed.Addenda10 != nil {
+				e.name = strings.TrimSpace(ed.Addenda10.Name)
+			}
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// matchMergedFile removes each pending transfer found in file and returns those leftover along with every
+// entry of file. Each entry matches at most one transfer. Transfers with an entry of the same amount which
+// doesn't match have the differences recorded in mismatches.
+func matchMergedFile(file *ach.File, pending []mergedTransfer, mismatches map[string]string) ([]mergedTransfer, []*mergedEntry) {
+	entries := mergedEntries(file)
+	var leftover []mergedTransfer
+	for i := range pending {
+		iter, xfer := pending[i].iter, pending[i].transfer
+		if file.Header.ImmediateOrigin != iter.originatorDepository.RoutingNumber ||
+			file.Header.ImmediateDestination != iter.receiverDepository.RoutingNumber {
+			leftover = append(leftover, pending[i])
+			continue
+		}
+		if *flagDebug {
+			log.Printf("origin: %s vs %s destination: %s vs %s\n",
+				file.Header.ImmediateOrigin, iter.originatorDepository.RoutingNumber,
+				file.Header.ImmediateDestination, iter.receiverDepository.RoutingNumber)
+		}
+		if matchEntries(entries, iter, xfer, mismatches) == nil {
+			leftover = append(leftover, pending[i])
+		}
+	}
+	return leftover, entries
+}
+
+// matchEntry returns the entry of file for xfer, or nil when it isn't found.
+func matchEntry(file *ach.File, iter *iteration, xfer moov.Transfer, mismatches map[string]string) *mergedEntry {
+	return matchEntries(mergedEntries(file), iter, xfer, mismatches)
+}
+
+// matchEntries returns the first unmatched entry for xfer and marks it as matched, or nil when there isn't one.
+func matchEntries(entries []*mergedEntry, iter *iteration, xfer moov.Transfer, mismatches map[string]string) *mergedEntry {
+	cents, err := parseAmount(xfer.Amount)
+	if err != nil {
+		mismatches[xfer.ID] = err.Error()
+		return nil
+	}
+	for _, e := range entries {
+		if *flagDebug {
+			log.Printf("DEBUG: amounts %d vs %d (SEC: %s vs %s)\n", cents, e.amount, xfer.StandardEntryClassCode, e.secCode)
+		}
+		if e.amount != cents || e.transferID != "" {
+			continue
+		}
+		if diffs := entryMismatches(iter, xfer, e); len(diffs) > 0 {
+			mismatches[xfer.ID] = fmt.Sprintf("found with %s", strings.Join(diffs, ", "))
+			continue
+		}
+		log.Printf("INFO: Matched %s transfer %s for %s (trace number %s)", e.secCode, xfer.ID, xfer.Amount, e.traceNumber)
+		delete(mismatches, xfer.ID)
+		e.transferID = xfer.ID
+		return e
+	}
 	return nil
 }
 
+// entryMismatches returns each field of e which is different from what paygate writes for xfer. Paygate
+// doesn't return a transfer's trace number, so it's only checked against the originator's ODFI. The
+// individual ID of domestic entries is the start of the transfer's ID.
+func entryMismatches(iter *iteration, xfer moov.Transfer, e *mergedEntry) []string {
+	var diffs []string
+	if xfer.StandardEntryClassCode != "" && !strings.EqualFold(xfer.StandardEntryClassCode, e.secCode) {
+		diffs = append(diffs, fmt.Sprintf("SEC code %s", e.secCode))
+	}
+	if code := expectedTransactionCode(iter.receiverDepository.Type, xfer.TransferType); code != e.transactionCode {
+		diffs = append(diffs, fmt.Sprintf("transaction code %d", e.transactionCode))
+	}
+	if e.routingNumber != iter.receiverDepository.RoutingNumber {
+		diffs = append(diffs, fmt.Sprintf("routing number %s", e.routingNumber))
+	}
+	if e.accountNumber != iter.receiverDepository.AccountNumber {
+		diffs = append(diffs, fmt.Sprintf("account number %s", e.accountNumber))
+	}
+	name, width := iter.receiver.Metadata, 22
+	if strings.EqualFold(xfer.StandardEntryClassCode, ach.IAT) {
+		name, width = xfer.IATDetail.ReceiverName, 35
+	}
+	if len(name) > width {
+		name = name[:width]
+	}
+	if !strings.EqualFold(e.name, strings.TrimSpace(name)) {
+		diffs = append(diffs, fmt.Sprintf("name %q", e.name))
+	}
+	if id := xfer.ID; e.entry != nil {
+		if len(id) > 15 {
+			id = id[:15]
+		}
+		if e.individualID != id {
+			diffs = append(diffs, fmt.Sprintf("individual ID %q", e.individualID))
+		}
+	}
+	if e.companyID != iter.originator.Identification {
+		diffs = append(diffs, fmt.Sprintf("originator ID %q", e.companyID))
+	}
+	if odfi := iter.originatorDepository.RoutingNumber; len(odfi) < 8 || !strings.HasPrefix(e.traceNumber, odfi[:8]) {
+		diffs = append(diffs, fmt.Sprintf("trace number %s", e.traceNumber))
+	}
+	if !xfer.Created.IsZero() && !effectiveDateInRange(e.effectiveDate, xfer.Created) {
+		diffs = append(diffs, fmt.Sprintf("effective date %s", e.effectiveDate))
+	}
+	return diffs
+}
+
+// expectedTransactionCode returns the transaction code paygate uses for a push (credit) or pull (debit)
+// of a Checking or Savings depository.
+func expectedTransactionCode(depositoryType string, transferType string) int {
+	pull := strings.EqualFold(transferType, "pull")
+	if strings.EqualFold(depositoryType, "savings") {
+		if pull {
+			return ach.SavingsDebit
+		}
+		return ach.SavingsCredit
+	}
+	if pull {
+		return ach.CheckingDebit
+	}
+	return ach.CheckingCredit
+}
+
+// effectiveDateInRange returns true if date (YYMMDD) is between the day before created (for time zones)
+// and a few banking days after it.
+func effectiveDateInRange(date string, created time.Time) bool {
+	first := created.AddDate(0, 0, -1).Format("060102")
+	last := base.NewTime(created).AddBankingDay(3).Format("060102")
+	return date >= first && date <= last
+}
+
+// parseAmount returns the cents of a paygate amount like "USD 12.34".
+func parseAmount(amount string) (int, error) {
+	parts := strings.Fields(amount)
+	if len(parts) != 2 || parts[0] != "USD" {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	whole, frac := parts[1], "00"
+	if idx := strings.Index(whole, "."); idx >= 0 {
+		whole, frac = whole[:idx], whole[idx+1:]
+		if len(frac) == 0 || len(frac) > 2 {
+			return 0, fmt.Errorf("invalid amount %q", amount)
+		}
+		if len(frac) == 1 {
+			frac += "0"
+		}
+	}
+	dollars, err := strconv.Atoi(whole)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	cents, err := strconv.Atoi(frac)
+	if err != nil || dollars < 0 || cents < 0 {
+		return 0, fmt.Errorf("invalid amount %q", amount)
+	}
+	return dollars*100 + cents, nil
+}
+
 func parseACHFilepath(path string) (*ach.File, error) {
 	fd, err := os.Open(path)
 	if err != nil {
@@ -11,6 +11,10 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/moov-io/ach"
+	moov "github.com/moov-io/go-client/client"
 )
 
 func TestVerify_verifyDirIsEmpty(t *testing.T) {
@@ -47,3 +51,263 @@ func TestVerify_verifyDirIsEmpty(t *testing.T) {
 		t.Error("empty dir should be empty")
 	}
 }
+
+// testIteration returns an iteration whose transfers are from 121042882 to a savings account at 231380104.
+func testIteration() *iteration {
+	return &iteration{
+		originator:           moov.Originator{Identification: "123456789"},
+		originatorDepository: moov.Depository{RoutingNumber: "121042882", AccountNumber: "1234567890"},
+		receiver:             moov.Receiver{Metadata: "John Doe"},
+		receiverDepository:   moov.Depository{RoutingNumber: "231380104", AccountNumber: "4567890123", Type: "Savings"},
+	}
+}
+
+// testMergedFile returns a file of testIteration's transfers with a batch for each SEC code, which
+// has one savings credit entry of amount (in cents). Each entry's individual ID is its lowercase SEC code.
+func testMergedFile(amount int, secCodes ...string) *ach.File {
+	file := ach.NewFile()
+	file.Header.ImmediateOrigin = "121042882"
+	file.Header.ImmediateDestination = "231380104"
+	for i := range secCodes {
+		bh := ach.NewBatchHeader()
+		bh.StandardEntryClassCode = secCodes[i]
+		bh.CompanyIdentification = "123456789"
+		bh.EffectiveEntryDate = time.Now().Format("060102")
+		batch, _ := ach.NewBatch(bh)
+		ed := ach.NewEntryDetail()
+		ed.Amount = amount
+		ed.TransactionCode = ach.SavingsCredit
+		ed.SetRDFI("231380104")
+		ed.DFIAccountNumber = "4567890123"
+		ed.IndividualName = "John Doe"
+		ed.IdentificationNumber = strings.ToLower(secCodes[i])
+		ed.SetTraceNumber("12104288", i+1)
+		batch.AddEntry(ed)
+		file.AddBatch(batch)
+	}
+	return file
+}
+
+func TestVerify_matchMergedFile(t *testing.T) {
+	iter := testIteration()
+	ccd := moov.Transfer{ID: "ccd", TransferType: "Push", Amount: "USD 12.34", StandardEntryClassCode: "CCD"}
+	web := moov.Transfer{ID: "web", TransferType: "Push", Amount: "USD 12.34", StandardEntryClassCode: "WEB"}
+	pending := []mergedTransfer{{iter, ccd}, {iter, web}}
+
+	mismatches := make(map[string]string)
+	leftover, entries := matchMergedFile(testMergedFile(1234, "PPD", "CCD"), pending, mismatches)
+	if len(leftover) != 1 || leftover[0].transfer.ID != "web" {
+		t.Fatalf("unexpected leftover: %#v", leftover)
+	}
+	if mismatches["web"] == "" || mismatches["ccd"] != "" {
+		t.Errorf("unexpected SEC mismatches: %#v", mismatches)
+	}
+	if len(entries) != 2 || entries[0].transferID != "" || entries[1].transferID != "ccd" {
+		t.Errorf("unexpected entries: %v", entries)
+	}
+
+	// Different amounts and routing numbers don't match
+	if leftover, _ := matchMergedFile(testMergedFile(1000, "WEB"), leftover, mismatches); len(leftover) != 1 {
+		t.Errorf("unexpected leftover: %#v", leftover)
+	}
+	other := testMergedFile(1234, "WEB")
+	other.Header.ImmediateDestination = "987654320"
+	if leftover, _ := matchMergedFile(other, leftover, mismatches); len(leftover) != 1 {
+		t.Errorf("unexpected leftover: %#v", leftover)
+	}
+
+	if leftover, _ := matchMergedFile(testMergedFile(1234, "WEB"), leftover, mismatches); len(leftover) != 0 {
+		t.Errorf("unexpected leftover: %#v", leftover)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("unexpected SEC mismatches: %#v", mismatches)
+	}
+}
+
+func TestVerify_matchMergedFile__pull(t *testing.T) {
+	iter := testIteration()
+	pull := moov.Transfer{ID: "ppd", TransferType: "Pull", Amount: "USD 12.34", StandardEntryClassCode: "PPD"}
+	pending := []mergedTransfer{{iter, pull}}
+
+	// A credit entry doesn't match a pull transfer
+	mismatches := make(map[string]string)
+	if leftover, _ := matchMergedFile(testMergedFile(1234, "PPD"), pending, mismatches); len(leftover) != 1 {
+		t.Fatalf("unexpected leftover: %#v", leftover)
+	}
+	if v := mismatches["ppd"]; v != "found with transaction code 32" {
+		t.Errorf("unexpected mismatch: %q", v)
+	}
+
+	file := testMergedFile(1234, "PPD")
+	file.Batches[0].GetEntries()[0].TransactionCode = ach.SavingsDebit
+	if leftover, _ := matchMergedFile(file, pending, mismatches); len(leftover) != 0 {
+		t.Errorf("unexpected leftover: %#v", leftover)
+	}
+}
+
+func TestVerify_matchMergedFile__once(t *testing.T) {
+	iter := testIteration()
+	first := moov.Transfer{ID: "ppd", TransferType: "Push", Amount: "USD 12.34", StandardEntryClassCode: "PPD", Description: "first"}
+	second := first
+	second.Description = "second"
+
+	// Each entry only matches one transfer
+	mismatches := make(map[string]string)
+	leftover, entries := matchMergedFile(testMergedFile(1234, "PPD"), []mergedTransfer{{iter, first}, {iter, second}}, mismatches)
+	if len(leftover) != 1 || leftover[0].transfer.Description != "second" || entries[0].transferID != "ppd" {
+		t.Errorf("unexpected leftover: %#v", leftover)
+	}
+}
+
+func TestVerify_entryMismatches(t *testing.T) {
+	iter := testIteration()
+	xfer := moov.Transfer{ID: "ppd", TransferType: "Push", Amount: "USD 12.34", StandardEntryClassCode: "PPD", Created: time.Now()}
+	entry := mergedEntries(testMergedFile(1234, "PPD"))[0]
+	if diffs := entryMismatches(iter, xfer, entry); len(diffs) != 0 {
+		t.Fatalf("unexpected mismatches: %v", diffs)
+	}
+
+	entry.accountNumber = "999"
+	entry.name = "Jane Doe"
+	entry.individualID = "other"
+	entry.companyID = "987654321"
+	entry.traceNumber = "231380100000001"
+	entry.routingNumber = "121042882"
+	entry.effectiveDate = time.Now().AddDate(0, 0, -7).Format("060102")
+	expected := []string{
+		`routing number 121042882`,
+		`account number 999`,
+		`name "Jane Doe"`,
+		`individual ID "other"`,
+		`originator ID "987654321"`,
+		`trace number 231380100000001`,
+	}
+	diffs := entryMismatches(iter, xfer, entry)
+	if len(diffs) != len(expected)+1 {
+		t.Fatalf("unexpected mismatches: %v", diffs)
+	}
+	for i := range expected {
+		if diffs[i] != expected[i] {
+			t.Errorf("got %q, expected %q", diffs[i], expected[i])
+		}
+	}
+	if !strings.HasPrefix(diffs[len(expected)], "effective date") {
+		t.Errorf("unexpected mismatch: %q", diffs[len(expected)])
+	}
+}
+
+func TestVerify_verifyTransfersWereMerged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "verifyTransfersWereMerged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := testMergedFile(1234, "PPD", "WEB")
+	file.Header.ImmediateOriginName, file.Header.ImmediateDestinationName = "Origin", "Destination"
+	file.Header.FileCreationDate, file.Header.FileCreationTime = time.Now().Format("060102"), "1504"
+	for _, b := range file.Batches {
+		bh := b.GetHeader()
+		bh.ServiceClassCode, bh.CompanyName, bh.CompanyEntryDescription, bh.ODFIIdentification = ach.CreditsOnly, "Jane Doe", "test", "12104288"
+		b.GetEntries()[0].DiscretionaryData = "S"
+		if err := b.Create(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := file.Create(); err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := ach.NewWriter(&buf).Write(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "merged.ach"), []byte(buf.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	iter := testIteration()
+	iter.transfer = moov.Transfer{ID: "ppd", TransferType: "Push", Amount: "USD 12.34", StandardEntryClassCode: "PPD"}
+	extra, err := verifyTransfersWereMerged(dir, []*iteration{iter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extra) != 1 || !strings.Contains(extra[0], `ID: "web"`) {
+		t.Errorf("unexpected extra entries: %v", extra)
+	}
+	if err := checkExtraEntries(extra); err == nil || !strings.HasPrefix(err.Error(), "1 entries didn't match a transfer") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// an unmatched transfer fails
+	iter.transfer.ID = "other"
+	if _, err := verifyTransfersWereMerged(dir, []*iteration{iter}); err == nil || !strings.Contains(err.Error(), "individual ID") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestVerify_matchEntry__IAT(t *testing.T) {
+	iter := testIteration()
+	xfer := moov.Transfer{ID: "iat", TransferType: "Push", Amount: "USD 12.34", StandardEntryClassCode: "IAT"}
+	xfer.IATDetail.ReceiverName = "John Doe"
+
+	mismatches := make(map[string]string)
+	file := ach.NewFile()
+	if matchEntry(file, iter, xfer, mismatches) != nil {
+		t.Error("found IAT transfer in an empty file")
+	}
+
+	bh := ach.NewIATBatchHeader()
+	bh.StandardEntryClassCode = ach.IAT
+	bh.OriginatorIdentification = "123456789"
+	batch := ach.NewIATBatch(bh)
+	ed := ach.NewIATEntryDetail()
+	ed.TransactionCode = ach.SavingsCredit
+	ed.SetRDFI("231380104")
+	ed.DFIAccountNumber = "4567890123"
+	ed.Amount = 1234
+	ed.SetTraceNumber("12104288", 1)
+	ed.Addenda10 = ach.NewAddenda10()
+	ed.Addenda10.Name = "John Doe"
+	batch.AddEntry(ed)
+	file.AddIATBatch(batch)
+	e := matchEntry(file, iter, xfer, mismatches)
+	if e == nil || e.entry != nil || e.transferID != "iat" {
+		t.Errorf("IAT transfer not found: %#v", mismatches)
+	}
+
+	xfer.TransferType = "Pull"
+	if matchEntry(file, iter, xfer, mismatches) != nil {
+		t.Error("pull transfer matched a credit entry")
+	}
+}
+
+func TestVerify_parseAmount(t *testing.T) {
+	cases := map[string]int{
+		"USD 12.34": 1234,
+		"USD 0.01":  1,
+		"USD 1.5":   150,
+		"USD 20":    2000,
+		"USD 24.51": 2451,
+	}
+	for amount, expected := range cases {
+		if cents, err := parseAmount(amount); err != nil || cents != expected {
+			t.Errorf("%s: got %d (error: %v), expected %d", amount, cents, err, expected)
+		}
+	}
+	for _, amount := range []string{"", "12.34", "EUR 12.34", "USD 12.345", "USD 1.", "USD -1.00", "USD abc"} {
+		if _, err := parseAmount(amount); err == nil {
+			t.Errorf("%q: expected error", amount)
+		}
+	}
+}
+
+func TestVerify_pendingTransfers(t *testing.T) {
+	iterations := []*iteration{
+		{transfer: moov.Transfer{ID: "a"}},
+		{transfer: moov.Transfer{ID: "b"}, transfers: []moov.Transfer{{ID: "b"}, {ID: "c"}}},
+	}
+	pending := pendingTransfers(iterations)
+	if len(pending) != 3 || pending[0].transfer.ID != "a" || pending[2].transfer.ID != "c" || pending[2].iter != iterations[1] {
+		t.Errorf("unexpected pending transfers: %#v", pending)
+	}
+}
@@ -0,0 +1,337 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moov-io/base/http/bind"
+	moov "github.com/moov-io/go-client/client"
+)
+
+var (
+	flagWatchmanWatches        = flag.Bool("watchman.watches", false, "Watch customers and companies in Watchman, by ID and name, and check their webhooks are called after a refresh and stop once the watches are removed")
+	flagWatchmanAdminAddress   = flag.String("watchman.admin-address", fmt.Sprintf("http://localhost%s", bind.Admin("watchman")), "HTTP address for Watchman's admin server, used to refresh OFAC data")
+	flagWatchmanWebhookAddr    = flag.String("watchman.webhook-addr", "127.0.0.1:0", "Listen address of the webhook receiver -watchman.watches runs")
+	flagWatchmanWebhookURL     = flag.String("watchman.webhook-url", "", "Webhook URL registered for watches, defaults to the receiver's address. Watchman only calls HTTPS webhooks, so outside of -mock set this to an HTTPS address forwarding to -watchman.webhook-addr")
+	flagWatchmanWebhookTimeout = flag.Duration("watchman.webhook-timeout", 30*time.Second, "How long to wait for webhooks after a refresh")
+	flagWatchmanWebhookQuiet   = flag.Duration("watchman.webhook-quiet", 5*time.Second, "How long to wait after a refresh for webhooks of removed watches, which shouldn't arrive")
+)
+
+// watchmanWatch is a customer or company watch, either of an SDN's entity ID or of a name.
+type watchmanWatch struct {
+	kind     string // customer or company
+	entityID string
+	name     string // set for name watches, otherwise the watch is of entityID
+
+	watchID   string
+	authToken string
+}
+
+func (w *watchmanWatch) String() string {
+	if w.name != "" {
+		return fmt.Sprintf("%s name %s", w.kind, w.name)
+	}
+	return fmt.Sprintf("%s %s", w.kind, w.entityID)
+}
+
+// newWatchmanWatches returns an ID and a name watch of each of watchmanSDNs. Individuals are
+// watched as customers and every other SDN as a company.
+func newWatchmanWatches() []*watchmanWatch {
+	var watches []*watchmanWatch
+	for _, sdn := range watchmanSDNs {
+		kind := "company"
+		if strings.EqualFold(sdn.sdnType, "individual") {
+			kind = "customer"
+		}
+		watches = append(watches,
+			&watchmanWatch{kind: kind, entityID: sdn.entityID, authToken: generateID()},
+			&watchmanWatch{kind: kind, entityID: sdn.entityID, name: sdn.variants[0], authToken: generateID()},
+		)
+	}
+	return watches
+}
+
+// checkWatchmanWatches adds watches of watchmanSDNs with webhooks to a receiver apitest runs, refreshes
+// Watchman and waits for each webhook to be called with its auth token and the watched SDN. Once the
+// watches are removed another refresh can't call any of them. Each check is a step of the
+// "watchmanWatches" suite.
+func checkWatchmanWatches(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+
+	suite := report.newSuite("watchmanWatches")
+	conf.HTTPClient.Transport = suite.wrap(conf.HTTPClient.Transport)
+	api := moov.NewAPIClient(conf)
+
+	receiver, err := startWebhookReceiver(*flagWatchmanWebhookAddr)
+	if err != nil {
+		return fmt.Errorf("webhook receiver: %v", err)
+	}
+	defer receiver.Close()
+	webhookURL := *flagWatchmanWebhookURL
+	if webhookURL == "" {
+		webhookURL = receiver.URL
+	}
+
+	watches := newWatchmanWatches()
+	defer func() {
+		// Don't leave watches calling our receiver after a failure
+		for _, w := range watches {
+			if w.watchID != "" {
+				if err := removeWatchmanWatch(ctx, api, w); err != nil {
+					log.Printf("ERROR: removing Watchman %s watch %s: %v", w, w.watchID, err)
+				}
+			}
+		}
+	}()
+
+	for _, w := range watches {
+		w := w
+		err := suite.step("add "+w.String(), func() error {
+			return addWatchmanWatch(ctx, api, w, webhookURL)
+		})
+		if err != nil {
+			return fmt.Errorf("add %s watch: %v", w, err)
+		}
+	}
+
+	if err := suite.step("refresh", refreshWatchman); err != nil {
+		return fmt.Errorf("refresh: %v", err)
+	}
+	err = suite.step("webhooks", func() error {
+		return poll(ctx, *flagWatchmanWebhookTimeout, 250*time.Millisecond, func() ([]string, error) {
+			var waiting []string
+			for _, w := range watches {
+				if len(receiver.Received(w.authToken)) == 0 {
+					waiting = append(waiting, fmt.Sprintf("no webhook for %s watch %s", w, w.watchID))
+				}
+			}
+			return waiting, nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("webhooks: %v", err)
+	}
+	for _, w := range watches {
+		w := w
+		err := suite.step("webhook "+w.String(), func() error {
+			for _, body := range receiver.Received(w.authToken) {
+				if err := checkWatchmanWebhook(w, body); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s webhook: %v", w, err)
+		}
+	}
+
+	for _, w := range watches {
+		w := w
+		err := suite.step("remove "+w.String(), func() error {
+			if err := removeWatchmanWatch(ctx, api, w); err != nil {
+				return err
+			}
+			w.watchID = ""
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("remove %s watch: %v", w, err)
+		}
+	}
+
+	// Nothing we removed can be called after the next refresh
+	received := make(map[string]int)
+	for _, w := range watches {
+		received[w.authToken] = len(receiver.Received(w.authToken))
+	}
+	if err := suite.step("refresh after remove", refreshWatchman); err != nil {
+		return fmt.Errorf("refresh after remove: %v", err)
+	}
+	err = suite.step("no webhooks after remove", func() error {
+		time.Sleep(*flagWatchmanWebhookQuiet)
+		var called []string
+		for _, w := range watches {
+			if n := len(receiver.Received(w.authToken)) - received[w.authToken]; n > 0 {
+				called = append(called, fmt.Sprintf("%s called %d times", w, n))
+			}
+		}
+		if len(called) > 0 {
+			return errors.New(strings.Join(called, ", "))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("removed watches: %v", err)
+	}
+
+	log.Printf("SUCCESS: Watchman called and stopped calling webhooks of %d watches", len(watches))
+	return nil
+}
+
+func addWatchmanWatch(ctx context.Context, api *moov.APIClient, w *watchmanWatch, webhookURL string) error {
+	req := moov.OfacWatchRequest{AuthToken: w.authToken, Webhook: webhookURL}
+	var (
+		watch moov.OfacWatch
+		resp  *http.Response
+		err   error
+	)
+	switch {
+	case w.kind == "customer" && w.name != "":
+		watch, resp, err = api.WatchmanApi.AddOfacCustomerNameWatch(ctx, w.name, req, nil)
+	case w.kind == "customer":
+		watch, resp, err = api.WatchmanApi.AddOfacCustomerWatch(ctx, w.entityID, req, nil)
+	case w.name != "":
+		watch, resp, err = api.WatchmanApi.AddOfacCompanyNameWatch(ctx, w.name, req, nil)
+	default:
+		watch, resp, err = api.WatchmanApi.AddOfacCompanyWatch(ctx, w.entityID, req, nil)
+	}
+	if err := checkAPIResponse(resp, err); err != nil {
+		return err
+	}
+	if watch.WatchID == "" {
+		return errors.New("missing watchID")
+	}
+	w.watchID = watch.WatchID
+	return nil
+}
+
+func removeWatchmanWatch(ctx context.Context, api *moov.APIClient, w *watchmanWatch) error {
+	var (
+		resp *http.Response
+		err  error
+	)
+	switch {
+	case w.kind == "customer" && w.name != "":
+		resp, err = api.WatchmanApi.RemoveOfacCustomerNameWatch(ctx, w.watchID, w.name, nil)
+	case w.kind == "customer":
+		resp, err = api.WatchmanApi.RemoveOfacCustomerWatch(ctx, w.entityID, w.watchID, nil)
+	case w.name != "":
+		resp, err = api.WatchmanApi.RemoveOfacCompanyNameWatch(ctx, w.watchID, w.name, nil)
+	default:
+		resp, err = api.WatchmanApi.RemoveOfacCompanyWatch(ctx, w.entityID, w.watchID, nil)
+	}
+	return checkAPIResponse(resp, err)
+}
+
+// refreshWatchman has Watchman download the OFAC data again, which calls the webhook of every watch.
+func refreshWatchman() error {
+	u, err := url.Parse(*flagWatchmanAdminAddress)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", *flagWatchmanAdminAddress, err)
+	}
+	u.Path += "/data/refresh"
+	resp, err := adminHTTPClient.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode > 299 {
+		bs, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("problem refreshing Watchman status=%v: %v", resp.Status, string(bs))
+	}
+	return nil
+}
+
+// checkWatchmanWebhook returns an error if body isn't about the watched SDN. Watches of an ID are
+// sent the OfacCustomer or OfacCompany and watches of a name are sent Search results.
+func checkWatchmanWebhook(w *watchmanWatch, body []byte) error {
+	if w.name != "" {
+		var res moov.Search
+		if err := json.Unmarshal(body, &res); err != nil {
+			return fmt.Errorf("problem reading search results: %v", err)
+		}
+		_, err := findSDN(res.SDNs, w.entityID, *flagWatchmanMinMatch)
+		return err
+	}
+
+	// OfacCustomer and OfacCompany only differ in their status type, which we don't check
+	var entity moov.OfacCustomer
+	if err := json.Unmarshal(body, &entity); err != nil {
+		return fmt.Errorf("problem reading %s: %v", w.kind, err)
+	}
+	if entity.ID != w.entityID || entity.Sdn.EntityID != w.entityID {
+		return fmt.Errorf("got %s %q with SDN %q, expected %s", w.kind, entity.ID, entity.Sdn.EntityID, w.entityID)
+	}
+	return nil
+}
+
+// webhookReceiver is an HTTP server collecting the bodies of webhooks by the auth token they're sent with.
+type webhookReceiver struct {
+	URL string
+
+	srv *http.Server
+
+	mu       sync.Mutex
+	received map[string][][]byte
+}
+
+// startWebhookReceiver listens on addr and serves webhooks until Close is called.
+func startWebhookReceiver(addr string) (*webhookReceiver, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r := &webhookReceiver{
+		URL:      fmt.Sprintf("http://%s/webhook", ln.Addr().String()),
+		received: make(map[string][][]byte),
+	}
+	r.srv = &http.Server{Handler: r}
+	go func() {
+		if err := r.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("ERROR: webhook receiver: %v", err)
+		}
+	}()
+	return r, nil
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if req.Method != "POST" || token == "" {
+		http.Error(w, "expected a POST with an Authorization header", http.StatusBadRequest)
+		return
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if *flagDebug {
+		log.Printf("DEBUG: webhook for %s: %s", token, string(body))
+	}
+
+	r.mu.Lock()
+	r.received[token] = append(r.received[token], body)
+	r.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// Received returns the bodies of every webhook sent with authToken.
+func (r *webhookReceiver) Received(authToken string) [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([][]byte(nil), r.received[authToken]...)
+}
+
+func (r *webhookReceiver) Close() error {
+	return r.srv.Close()
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWatches__newWatchmanWatches(t *testing.T) {
+	var got []string
+	for _, w := range newWatchmanWatches() {
+		if w.authToken == "" {
+			t.Errorf("%s watch has no auth token", w)
+		}
+		got = append(got, w.String())
+	}
+	expected := "company 306, company name Banco Nacional de Cuba, customer 22790, customer name Nicolas Maduro Moros"
+	if strings.Join(got, ", ") != expected {
+		t.Errorf("unexpected watches: %v", got)
+	}
+}
+
+func TestWatches__checkWatchmanWebhook(t *testing.T) {
+	w := &watchmanWatch{kind: "customer", entityID: "22790"}
+	if err := checkWatchmanWebhook(w, []byte(`{"ID": "22790", "sdn": {"entityID": "22790"}}`)); err != nil {
+		t.Error(err)
+	}
+	if err := checkWatchmanWebhook(w, []byte(`{"ID": "306", "sdn": {"entityID": "306"}}`)); err == nil {
+		t.Error("expected error")
+	}
+
+	w.name = "Nicolas Maduro Moros"
+	if err := checkWatchmanWebhook(w, []byte(`{"SDNs": [{"entityID": "22790", "match": 1}]}`)); err != nil {
+		t.Error(err)
+	}
+	if err := checkWatchmanWebhook(w, []byte(`{"SDNs": [{"entityID": "22790", "match": 0.5}]}`)); err == nil {
+		t.Error("expected error")
+	}
+	if err := checkWatchmanWebhook(w, []byte(`[]`)); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestWatches__webhookReceiver(t *testing.T) {
+	r, err := startWebhookReceiver("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	send := func(auth, body string) int {
+		req, _ := http.NewRequest("POST", r.URL, strings.NewReader(body))
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := send("secret", `{"ID": "1"}`); code != http.StatusOK {
+		t.Errorf("bogus HTTP status: %d", code)
+	}
+	if code := send("Bearer secret", `{"ID": "2"}`); code != http.StatusOK {
+		t.Errorf("bogus HTTP status: %d", code)
+	}
+	if code := send("", `{"ID": "3"}`); code != http.StatusBadRequest {
+		t.Errorf("bogus HTTP status: %d", code)
+	}
+
+	received := r.Received("secret")
+	if len(received) != 2 || string(received[0]) != `{"ID": "1"}` || string(received[1]) != `{"ID": "2"}` {
+		t.Errorf("unexpected webhooks: %q", received)
+	}
+	if n := len(r.Received("other")); n != 0 {
+		t.Errorf("got %d webhooks", n)
+	}
+}
@@ -0,0 +1,335 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+
+	"github.com/antihax/optional"
+)
+
+var (
+	flagWatchman         = flag.Bool("watchman", false, "Search Watchman for known SDNs and fuzzy variants of their names, and check SDN details and the latest OFAC download")
+	flagWatchmanMinMatch = flag.Float64("watchman.min-match", 0.90, "Lowest match score -watchman accepts for fuzzy variants of SDN names, unrelated names need to score below it")
+	flagWatchmanMaxAge   = flag.Duration("watchman.max-age", 24*time.Hour, "How old Watchman's latest OFAC download can be")
+)
+
+// exactMatch is the lowest score an SDN's own name needs when searched for.
+const exactMatch = 0.99
+
+// watchmanSDN is an entry of OFAC's SDN list that -watchman searches for.
+type watchmanSDN struct {
+	entityID string
+	name     string
+	sdnType  string
+	program  string
+
+	// variants are misspelled, reordered or partial forms of name which need to match it
+	variants []string
+
+	// altName and address are one of the SDN's alternate names and addresses, when it has any
+	altName string
+	address string
+}
+
+var watchmanSDNs = []watchmanSDN{
+	{
+		entityID: "306",
+		name:     "BANCO NACIONAL DE CUBA",
+		program:  "CUBA",
+		variants: []string{"Banco Nacional de Cuba", "Banco Nacional de Kuba", "banco nacional cuba"},
+		altName:  "NATIONAL BANK OF CUBA",
+		address:  "Zweierstrasse 35",
+	},
+	{
+		entityID: "22790",
+		name:     "MADURO MOROS, Nicolas",
+		sdnType:  "individual",
+		program:  "VENEZUELA",
+		variants: []string{"Nicolas Maduro Moros", "Nicholas Maduro Moros", "Nicolas Madura Moros", "nicolas maduro"},
+	},
+}
+
+// unrelatedNames shouldn't match any SDN.
+var unrelatedNames = []string{"Jane Moovington", "Acme Widget Supply Co"}
+
+// checkWatchman makes sure OFAC screening works before transfers go out. Watchman's latest download
+// needs to be recent, each of watchmanSDNs needs to be found by its name, fuzzy variants, alt name and
+// address, and its details need to match. Names which aren't sanctioned need to score below
+// -watchman.min-match. Each check is a step of the "watchman" suite.
+func checkWatchman(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+
+	suite := report.newSuite("watchman")
+	conf.HTTPClient.Transport = suite.wrap(conf.HTTPClient.Transport)
+	api := moov.NewAPIClient(conf)
+
+	err := suite.step("downloads", func() error {
+		return checkWatchmanDownloads(ctx, api, time.Now())
+	})
+	if err != nil {
+		return fmt.Errorf("downloads: %v", err)
+	}
+
+	for _, sdn := range watchmanSDNs {
+		if err := checkWatchmanSDN(ctx, api, suite, sdn); err != nil {
+			return fmt.Errorf("SDN %s: %v", sdn.entityID, err)
+		}
+	}
+
+	for _, name := range unrelatedNames {
+		name := name
+		err := suite.step("unrelated "+name, func() error {
+			res, err := searchWatchman(ctx, api, &moov.SearchOpts{Name: optional.NewString(name), Limit: optional.NewInt32(1)})
+			if err != nil {
+				return err
+			}
+			if len(res.SDNs) > 0 && float64(res.SDNs[0].Match) >= *flagWatchmanMinMatch {
+				return fmt.Errorf("matched SDN %s (%s) with score %.3f", res.SDNs[0].EntityID, res.SDNs[0].SdnName, res.SDNs[0].Match)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("unrelated name: %v", err)
+		}
+	}
+
+	err = suite.step("missing sdn", func() error {
+		_, resp, err := api.WatchmanApi.GetSDN(ctx, "0", nil)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if resp == nil || resp.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("expected a 404: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("missing sdn: %v", err)
+	}
+
+	log.Printf("SUCCESS: Watchman found %d SDNs and their fuzzy variants", len(watchmanSDNs))
+	return nil
+}
+
+// checkWatchmanDownloads needs Watchman's latest download to have SDNs and be newer than -watchman.max-age.
+func checkWatchmanDownloads(ctx context.Context, api *moov.APIClient, now time.Time) error {
+	downloads, resp, err := api.WatchmanApi.GetLatestDownloads(ctx, &moov.GetLatestDownloadsOpts{Limit: optional.NewInt32(1)})
+	if err := checkAPIResponse(resp, err); err != nil {
+		return err
+	}
+	if len(downloads) == 0 {
+		return errors.New("no downloads")
+	}
+	latest := downloads[0]
+	for _, d := range downloads[1:] {
+		if d.Timestamp.After(latest.Timestamp) {
+			latest = d
+		}
+	}
+	if latest.SDNs == 0 {
+		return fmt.Errorf("download at %v has no SDNs", latest.Timestamp)
+	}
+	if age := now.Sub(latest.Timestamp); age > *flagWatchmanMaxAge {
+		return fmt.Errorf("latest download was %v ago (at %v)", age.Round(time.Minute), latest.Timestamp)
+	}
+	log.Printf("INFO: Watchman last downloaded %d SDNs, %d alt names and %d addresses at %v", latest.SDNs, latest.AltNames, latest.Addresses, latest.Timestamp)
+	return nil
+}
+
+func checkWatchmanSDN(ctx context.Context, api *moov.APIClient, suite *suiteResult, sdn watchmanSDN) error {
+	step := func(name string, f func() error) error {
+		return suite.step(fmt.Sprintf("%s %s", sdn.entityID, name), f)
+	}
+
+	var exact float32
+	err := step("search", func() error {
+		res, err := searchWatchman(ctx, api, &moov.SearchOpts{Q: optional.NewString(sdn.name)})
+		if err != nil {
+			return err
+		}
+		if exact, err = findSDN(res.SDNs, sdn.entityID, exactMatch); err != nil {
+			return err
+		}
+		if len(res.SDNs) > 0 && res.SDNs[0].EntityID != sdn.entityID && res.SDNs[0].Match > exact {
+			return fmt.Errorf("SDN %s (%s) scored higher than %s", res.SDNs[0].EntityID, res.SDNs[0].SdnName, sdn.name)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("search: %v", err)
+	}
+
+	for _, variant := range sdn.variants {
+		variant := variant
+		err := step("variant "+variant, func() error {
+			res, err := searchWatchman(ctx, api, &moov.SearchOpts{Name: optional.NewString(variant)})
+			if err != nil {
+				return err
+			}
+			match, err := findSDN(res.SDNs, sdn.entityID, *flagWatchmanMinMatch)
+			if err != nil {
+				return err
+			}
+			if match > exact {
+				return fmt.Errorf("scored %.3f, higher than %.3f for the SDN's own name", match, exact)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("variant %q: %v", variant, err)
+		}
+	}
+
+	err = step("sdn", func() error {
+		got, resp, err := api.WatchmanApi.GetSDN(ctx, sdn.entityID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		return compareWatchmanSDN(sdn, got)
+	})
+	if err != nil {
+		return fmt.Errorf("sdn: %v", err)
+	}
+
+	err = step("alts", func() error {
+		alts, resp, err := api.WatchmanApi.GetSDNAltNames(ctx, sdn.entityID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		found := sdn.altName == ""
+		for _, alt := range alts {
+			if alt.EntityID != sdn.entityID {
+				return fmt.Errorf("alt name %s is for SDN %s", alt.AlternateID, alt.EntityID)
+			}
+			found = found || strings.EqualFold(alt.AlternateName, sdn.altName)
+		}
+		if !found {
+			return fmt.Errorf("alt name %q not found in %d alt names", sdn.altName, len(alts))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("alts: %v", err)
+	}
+
+	err = step("addresses", func() error {
+		addresses, resp, err := api.WatchmanApi.GetSDNAddresses(ctx, sdn.entityID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		found := sdn.address == ""
+		for _, addr := range addresses {
+			if addr.EntityID != sdn.entityID {
+				return fmt.Errorf("address %s is for SDN %s", addr.AddressID, addr.EntityID)
+			}
+			found = found || strings.EqualFold(addr.Address, sdn.address)
+		}
+		if !found {
+			return fmt.Errorf("address %q not found in %d addresses", sdn.address, len(addresses))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("addresses: %v", err)
+	}
+
+	if sdn.altName != "" {
+		err := step("search alt name", func() error {
+			res, err := searchWatchman(ctx, api, &moov.SearchOpts{AltName: optional.NewString(sdn.altName)})
+			if err != nil {
+				return err
+			}
+			for _, alt := range res.AltNames {
+				if alt.EntityID == sdn.entityID && float64(alt.Match) >= exactMatch {
+					return nil
+				}
+			}
+			return fmt.Errorf("alt name %q wasn't matched", sdn.altName)
+		})
+		if err != nil {
+			return fmt.Errorf("search alt name: %v", err)
+		}
+	}
+
+	if sdn.address != "" {
+		err := step("search address", func() error {
+			res, err := searchWatchman(ctx, api, &moov.SearchOpts{Address: optional.NewString(sdn.address)})
+			if err != nil {
+				return err
+			}
+			for _, addr := range res.Addresses {
+				if addr.EntityID == sdn.entityID && float64(addr.Match) >= exactMatch {
+					return nil
+				}
+			}
+			return fmt.Errorf("address %q wasn't matched", sdn.address)
+		})
+		if err != nil {
+			return fmt.Errorf("search address: %v", err)
+		}
+	}
+	return nil
+}
+
+func searchWatchman(ctx context.Context, api *moov.APIClient, opts *moov.SearchOpts) (moov.Search, error) {
+	res, resp, err := api.WatchmanApi.Search(ctx, opts)
+	return res, checkAPIResponse(resp, err)
+}
+
+// findSDN returns the match score of entityID in sdns, or an error if it's missing or scored below min.
+func findSDN(sdns []moov.OfacSdn, entityID string, min float64) (float32, error) {
+	for _, sdn := range sdns {
+		if sdn.EntityID != entityID {
+			continue
+		}
+		if float64(sdn.Match) < min {
+			return sdn.Match, fmt.Errorf("SDN %s scored %.3f, expected at least %.3f", entityID, sdn.Match, min)
+		}
+		return sdn.Match, nil
+	}
+	var top []string
+	for i := 0; i < len(sdns) && i < 3; i++ {
+		top = append(top, fmt.Sprintf("%s (%s, %.3f)", sdns[i].EntityID, sdns[i].SdnName, sdns[i].Match))
+	}
+	return 0, fmt.Errorf("SDN %s not found, top results: %s", entityID, strings.Join(top, ", "))
+}
+
+// compareWatchmanSDN returns an error listing the fields of got which don't match expected.
+func compareWatchmanSDN(expected watchmanSDN, got moov.OfacSdn) error {
+	var diffs []string
+	if got.EntityID != expected.entityID {
+		diffs = append(diffs, fmt.Sprintf("entityID is %q, expected %q", got.EntityID, expected.entityID))
+	}
+	if !strings.EqualFold(got.SdnName, expected.name) {
+		diffs = append(diffs, fmt.Sprintf("sdnName is %q, expected %q", got.SdnName, expected.name))
+	}
+	if !strings.EqualFold(got.SdnType, expected.sdnType) {
+		diffs = append(diffs, fmt.Sprintf("sdnType is %q, expected %q", got.SdnType, expected.sdnType))
+	}
+	found := false
+	for _, p := range got.Programs {
+		found = found || strings.EqualFold(p, expected.program)
+	}
+	if !found {
+		diffs = append(diffs, fmt.Sprintf("programs %v are missing %s", got.Programs, expected.program))
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
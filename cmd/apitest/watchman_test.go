@@ -0,0 +1,49 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+func TestWatchman__findSDN(t *testing.T) {
+	sdns := []moov.OfacSdn{
+		{EntityID: "22790", SdnName: "MADURO MOROS, Nicolas", Match: 0.95},
+		{EntityID: "306", SdnName: "BANCO NACIONAL DE CUBA", Match: 0.62},
+	}
+	if match, err := findSDN(sdns, "22790", 0.90); err != nil || match != 0.95 {
+		t.Errorf("match=%.3f error=%v", match, err)
+	}
+	if _, err := findSDN(sdns, "306", 0.90); err == nil || !strings.Contains(err.Error(), "scored 0.620") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := findSDN(sdns, "2681", 0.90); err == nil || !strings.Contains(err.Error(), "22790 (MADURO MOROS, Nicolas, 0.950)") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWatchman__compareWatchmanSDN(t *testing.T) {
+	expected := watchmanSDNs[1]
+	sdn := moov.OfacSdn{EntityID: "22790", SdnName: "MADURO MOROS, Nicolas", SdnType: "Individual", Programs: []string{"VENEZUELA", "VENEZUELA-EO13850"}}
+	if err := compareWatchmanSDN(expected, sdn); err != nil {
+		t.Error(err)
+	}
+
+	sdn.SdnName = "MADURO, Nicolas"
+	sdn.SdnType = ""
+	sdn.Programs = []string{"CUBA"}
+	err := compareWatchmanSDN(expected, sdn)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, field := range []string{"sdnName", "sdnType", "programs"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("%s isn't in %v", field, err)
+		}
+	}
+}
@@ -0,0 +1,395 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	moov "github.com/moov-io/go-client/client"
+)
+
+var (
+	flagWire = flag.Bool("wire", false, "Create Fedwire files for CTR, CTP and DRC messages in /v1/wire/files, check their contents and that invalid messages are rejected")
+)
+
+// wireBusinessFunctionCodes are the business function codes of the messages -wire sends: customer
+// transfers (CTR), customer transfer plus (CTP) and customer or corporate drawdown requests (DRC).
+var wireBusinessFunctionCodes = []string{"CTR", "CTP", "DRC"}
+
+// checkWire runs a Fedwire file through the wire API for each of wireBusinessFunctionCodes, then
+// sends messages which need to be rejected. Each call is a step of the "wire" suite.
+func checkWire(ctx context.Context, iter *iteration) error {
+	conf := makeConfiguration()
+	conf.AddDefaultHeader("X-Request-ID", iter.requestID)
+	conf.AddDefaultHeader("Origin", "https://moov.io")
+	setMoovAuthCookie(conf, iter.user)
+
+	suite := report.newSuite("wire")
+	conf.HTTPClient.Transport = suite.wrap(conf.HTTPClient.Transport)
+	api := moov.NewAPIClient(conf)
+
+	now := time.Now()
+	for _, bfc := range wireBusinessFunctionCodes {
+		if err := checkWireFile(ctx, api, suite, newFEDWireMessage(bfc, now)); err != nil {
+			return fmt.Errorf("%s: %v", bfc, err)
+		}
+	}
+	for _, c := range invalidFEDWireMessages(now) {
+		err := suite.step("invalid "+c.name, func() error {
+			return checkInvalidWireFile(ctx, api, c)
+		})
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", c.name, err)
+		}
+	}
+	log.Printf("SUCCESS: Fedwire files handled %s messages and rejected invalid ones", strings.Join(wireBusinessFunctionCodes, ", "))
+	return nil
+}
+
+// checkWireFile creates a file with fwm, reads it back, lists, validates and downloads it. Then
+// the file's message is replaced through /FEDWireMessage with a new amount before it's deleted.
+func checkWireFile(ctx context.Context, api *moov.APIClient, suite *suiteResult, fwm moov.FedWireMessage) error {
+	bfc := fwm.BusinessFunctionCode.BusinessFunctionCode
+	step := func(name string, f func() error) error {
+		return suite.step(fmt.Sprintf("%s %s", bfc, name), f)
+	}
+
+	var fileID string
+	err := step("create", func() error {
+		file, resp, err := api.WireFilesApi.CreateWireFile(ctx, moov.CreateWireFile{FedWireMessage: []moov.FedWireMessage{fwm}}, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		if fileID = file.ID; fileID == "" {
+			return errors.New("no file ID returned")
+		}
+		return compareWireFile(fwm, file)
+	})
+	if err != nil {
+		return fmt.Errorf("create: %v", err)
+	}
+
+	err = step("get", func() error {
+		file, resp, err := api.WireFilesApi.GetWireFileByID(ctx, fileID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		return compareWireFile(fwm, file)
+	})
+	if err != nil {
+		return fmt.Errorf("get: %v", err)
+	}
+
+	err = step("list", func() error {
+		files, resp, err := api.WireFilesApi.GetWireFiles(ctx, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		for i := range files {
+			if files[i].ID == fileID {
+				return nil
+			}
+		}
+		return fmt.Errorf("file %s not listed", fileID)
+	})
+	if err != nil {
+		return fmt.Errorf("list: %v", err)
+	}
+
+	err = step("validate", func() error {
+		_, resp, err := api.WireFilesApi.ValidateWireFile(ctx, fileID, nil)
+		return checkAPIResponse(resp, err)
+	})
+	if err != nil {
+		return fmt.Errorf("validate: %v", err)
+	}
+
+	err = step("contents", func() error {
+		return checkWireContents(ctx, api, fileID, fwm)
+	})
+	if err != nil {
+		return fmt.Errorf("contents: %v", err)
+	}
+
+	updated := fwm
+	updated.Amount.Amount = "000000005678"
+	err = step("FEDWireMessage", func() error {
+		resp, err := api.WireFilesApi.AddFEDWireMessageToFile(ctx, fileID, updated, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		file, resp, err := api.WireFilesApi.GetWireFileByID(ctx, fileID, nil)
+		if err := checkAPIResponse(resp, err); err != nil {
+			return err
+		}
+		if err := compareWireFile(updated, file); err != nil {
+			return err
+		}
+		return checkWireContents(ctx, api, fileID, updated)
+	})
+	if err != nil {
+		return fmt.Errorf("FEDWireMessage: %v", err)
+	}
+
+	err = step("delete", func() error {
+		return deleteWireFile(ctx, api, fileID)
+	})
+	if err != nil {
+		return fmt.Errorf("delete: %v", err)
+	}
+	return nil
+}
+
+func deleteWireFile(ctx context.Context, api *moov.APIClient, fileID string) error {
+	resp, err := api.WireFilesApi.DeleteWireFileByID(ctx, fileID, nil)
+	if err := checkAPIResponse(resp, err); err != nil {
+		return err
+	}
+	_, resp, err = api.WireFilesApi.GetWireFileByID(ctx, fileID, nil)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("file %s wasn't deleted: %v", fileID, err)
+	}
+	return nil
+}
+
+// invalidWireMessage is a message the wire service needs to reject with an error mentioning field.
+type invalidWireMessage struct {
+	name  string
+	field string
+	fwm   moov.FedWireMessage
+}
+
+func invalidFEDWireMessages(now time.Time) []invalidWireMessage {
+	var cases []invalidWireMessage
+	add := func(name, field string, bfc string, modify func(fwm *moov.FedWireMessage)) {
+		fwm := newFEDWireMessage(bfc, now)
+		modify(&fwm)
+		cases = append(cases, invalidWireMessage{name: name, field: field, fwm: fwm})
+	}
+	add("amount", "Amount", "CTR", func(fwm *moov.FedWireMessage) {
+		fwm.Amount.Amount = "12.34"
+	})
+	add("sender routing number", "SenderABANumber", "CTR", func(fwm *moov.FedWireMessage) {
+		fwm.SenderDepositoryInstitution.SenderABANumber = "12104288X"
+	})
+	add("business function code", "BusinessFunctionCode", "CTR", func(fwm *moov.FedWireMessage) {
+		fwm.BusinessFunctionCode.BusinessFunctionCode = "XYZ"
+	})
+	add("CTR beneficiary", "Beneficiary", "CTR", func(fwm *moov.FedWireMessage) {
+		fwm.Beneficiary = moov.Personal{}
+	})
+	add("CTP originator", "Originator", "CTP", func(fwm *moov.FedWireMessage) {
+		fwm.Originator = moov.Personal{}
+	})
+	add("DRC type", "TypeSubType", "DRC", func(fwm *moov.FedWireMessage) {
+		fwm.TypeSubType.SubTypeCode = "00"
+	})
+	add("DRC debit account", "AccountDebitedDrawdown", "DRC", func(fwm *moov.FedWireMessage) {
+		fwm.AccountDebitedDrawdown = moov.AccountDebitedDrawdown{}
+	})
+	return cases
+}
+
+// checkInvalidWireFile needs c to be rejected when the file is created or validated, with a 4xx
+// Error body that mentions c.field. Files which are created anyway are deleted.
+func checkInvalidWireFile(ctx context.Context, api *moov.APIClient, c invalidWireMessage) error {
+	file, resp, err := api.WireFilesApi.CreateWireFile(ctx, moov.CreateWireFile{FedWireMessage: []moov.FedWireMessage{c.fwm}}, nil)
+	if err == nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		defer deleteWireFile(ctx, api, file.ID)
+		_, resp, err = api.WireFilesApi.ValidateWireFile(ctx, file.ID, nil)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if err == nil {
+		return errors.New("message was accepted")
+	}
+	if resp == nil || resp.StatusCode < 400 || resp.StatusCode >= 500 {
+		return fmt.Errorf("expected a 4xx response: %v", err)
+	}
+	e, ok := err.(moov.GenericOpenAPIError)
+	if !ok {
+		return err
+	}
+	if err := checkErrorBody(resp.Header, e.Body()); err != nil {
+		return err
+	}
+	if body := string(e.Body()); !strings.Contains(strings.ToLower(body), strings.ToLower(c.field)) {
+		return fmt.Errorf("error %s doesn't mention %s", strings.TrimSpace(body), c.field)
+	}
+	return nil
+}
+
+// newFEDWireMessage returns a test message of the business function code bfc for USD 12.34 from
+// defaultRoutingNumber to the same receiving bank as -ach.files.
+func newFEDWireMessage(bfc string, now time.Time) moov.FedWireMessage {
+	fwm := moov.FedWireMessage{
+		SenderSupplied: moov.SenderSupplied{
+			FormatVersion:          "30",
+			UserRequestCorrelation: "apitest",
+			TestProductionCode:     "T",
+			MessageDuplicationCode: " ",
+		},
+		TypeSubType: moov.TypeSubType{TypeCode: "10", SubTypeCode: "00"},
+		InputMessageAccountabilityData: moov.InputMessageAccountabilityData{
+			InputCycleDate:      now.Format("20060102"),
+			InputSource:         "Source08",
+			InputSequenceNumber: "000001",
+		},
+		Amount:                        moov.WireAmount{Amount: "000000001234"},
+		SenderDepositoryInstitution:   moov.SenderDepositoryInstitution{SenderABANumber: defaultRoutingNumber, SenderShortName: "Wells Fargo NA"},
+		ReceiverDepositoryInstitution: moov.ReceiverDepositoryInstitution{ReceiverABANumber: "231380104", ReceiverShortName: "Citadel"},
+		BusinessFunctionCode:          moov.BusinessFunctionCode{BusinessFunctionCode: bfc},
+		SenderReference:               moov.SenderReference{SenderReference: "apitest"},
+		Beneficiary: moov.Personal{
+			IdentificationCode: "D",
+			Identifier:         "1234567890",
+			Name:               "Jane Doe",
+			Address:            moov.WireAddress{AddressLineOne: "123 Main St", AddressLineTwo: "Anytown, CA 90210"},
+		},
+	}
+	switch bfc {
+	case "CTR", "CTP":
+		fwm.Originator = moov.Personal{
+			IdentificationCode: "D",
+			Identifier:         "9876543210",
+			Name:               "John Doe",
+			Address:            moov.WireAddress{AddressLineOne: "456 Elm St", AddressLineTwo: "Anytown, CA 90210"},
+		}
+		fwm.OriginatorToBeneficiary = moov.OriginatorToBeneficiary{LineOne: "Invoice 1234"}
+		if bfc == "CTP" {
+			fwm.LocalInstrument = moov.LocalInstrument{LocalInstrumentCode: "PROP", ProprietaryCode: "Moov"}
+		}
+	case "DRC":
+		fwm.TypeSubType.SubTypeCode = "31"
+		fwm.AccountDebitedDrawdown = moov.AccountDebitedDrawdown{
+			IdentificationCode: "D",
+			Identifier:         "9876543210",
+			Name:               "John Doe",
+			AddressLineOne:     "456 Elm St",
+		}
+		fwm.AccountCreditedDrawdown = moov.AccountCreditedDrawdown{DrawdownCreditAccountNumber: "123456789"}
+	}
+	return fwm
+}
+
+// compareWireFile returns an error listing the fields of got's message which don't match expected.
+func compareWireFile(expected moov.FedWireMessage, got moov.WireFile) error {
+	if len(got.FedWireMessage) != 1 {
+		return fmt.Errorf("got %d messages, expected 1", len(got.FedWireMessage))
+	}
+	fwm := got.FedWireMessage[0]
+
+	var diffs []string
+	check := func(field string, expected, actual string) {
+		if strings.TrimSpace(expected) != strings.TrimSpace(actual) {
+			diffs = append(diffs, fmt.Sprintf("%s is %q, expected %q", field, actual, expected))
+		}
+	}
+	check("typeSubType", expected.TypeSubType.TypeCode+expected.TypeSubType.SubTypeCode, fwm.TypeSubType.TypeCode+fwm.TypeSubType.SubTypeCode)
+	check("amount", expected.Amount.Amount, fwm.Amount.Amount)
+	check("senderABANumber", expected.SenderDepositoryInstitution.SenderABANumber, fwm.SenderDepositoryInstitution.SenderABANumber)
+	check("receiverABANumber", expected.ReceiverDepositoryInstitution.ReceiverABANumber, fwm.ReceiverDepositoryInstitution.ReceiverABANumber)
+	check("businessFunctionCode", expected.BusinessFunctionCode.BusinessFunctionCode, fwm.BusinessFunctionCode.BusinessFunctionCode)
+	check("localInstrumentCode", expected.LocalInstrument.LocalInstrumentCode, fwm.LocalInstrument.LocalInstrumentCode)
+	check("beneficiary identifier", expected.Beneficiary.Identifier, fwm.Beneficiary.Identifier)
+	check("beneficiary name", expected.Beneficiary.Name, fwm.Beneficiary.Name)
+	check("originator identifier", expected.Originator.Identifier, fwm.Originator.Identifier)
+	check("originator name", expected.Originator.Name, fwm.Originator.Name)
+	check("accountDebitedDrawdown identifier", expected.AccountDebitedDrawdown.Identifier, fwm.AccountDebitedDrawdown.Identifier)
+	check("drawdownCreditAccountNumber", expected.AccountCreditedDrawdown.DrawdownCreditAccountNumber, fwm.AccountCreditedDrawdown.DrawdownCreditAccountNumber)
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// checkWireContents downloads the contents of fileID and compares its tags with fwm.
+func checkWireContents(ctx context.Context, api *moov.APIClient, fileID string, fwm moov.FedWireMessage) error {
+	contents, resp, err := api.WireFilesApi.GetWireFileContents(ctx, fileID, nil)
+	if err := checkAPIResponse(resp, err); err != nil {
+		return err
+	}
+	return compareFEDWireTags(fwm, readFEDWireTags(contents))
+}
+
+var fedWireTagPattern = regexp.MustCompile(`\{(\d{4})\}`)
+
+// readFEDWireTags returns the values of each {nnnn} tag in contents, with trailing whitespace removed.
+// Tags can be on one line or each on their own.
+func readFEDWireTags(contents string) map[string]string {
+	tags := make(map[string]string)
+	matches := fedWireTagPattern.FindAllStringSubmatchIndex(contents, -1)
+	for i, m := range matches {
+		end := len(contents)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		tags[contents[m[2]:m[3]]] = strings.TrimRight(contents[m[1]:end], " \r\n*")
+	}
+	return tags
+}
+
+// compareFEDWireTags checks the tags of a message's contents start with the fields of fwm we sent.
+// Party tags ({4200} beneficiary, {4400} account debited in drawdown and {5000} originator) need to
+// start with the identification code and identifier and contain the name.
+func compareFEDWireTags(fwm moov.FedWireMessage, tags map[string]string) error {
+	var diffs []string
+	prefix := func(tag string, expected ...string) {
+		v, ok := tags[tag]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("{%s} is missing", tag))
+			return
+		}
+		for _, e := range expected {
+			if !strings.HasPrefix(v, e) {
+				diffs = append(diffs, fmt.Sprintf("{%s} is %q, expected %q", tag, v, strings.Join(expected, "")))
+				return
+			}
+			v = strings.TrimLeft(v[len(e):], " *")
+		}
+	}
+	party := func(tag, idCode, identifier, name string) {
+		if identifier == "" {
+			return
+		}
+		prefix(tag, idCode, identifier)
+		if v := tags[tag]; !strings.Contains(v, name) {
+			diffs = append(diffs, fmt.Sprintf("{%s} %q doesn't contain %q", tag, v, name))
+		}
+	}
+	prefix("1510", fwm.TypeSubType.TypeCode+fwm.TypeSubType.SubTypeCode)
+	prefix("2000", fwm.Amount.Amount)
+	prefix("3100", fwm.SenderDepositoryInstitution.SenderABANumber)
+	prefix("3400", fwm.ReceiverDepositoryInstitution.ReceiverABANumber)
+	prefix("3600", fwm.BusinessFunctionCode.BusinessFunctionCode)
+	if v := fwm.LocalInstrument.LocalInstrumentCode; v != "" {
+		prefix("3610", v)
+	}
+	party("4200", fwm.Beneficiary.IdentificationCode, fwm.Beneficiary.Identifier, fwm.Beneficiary.Name)
+	party("4400", fwm.AccountDebitedDrawdown.IdentificationCode, fwm.AccountDebitedDrawdown.Identifier, fwm.AccountDebitedDrawdown.Name)
+	party("5000", fwm.Originator.IdentificationCode, fwm.Originator.Identifier, fwm.Originator.Name)
+	if v := fwm.AccountCreditedDrawdown.DrawdownCreditAccountNumber; v != "" {
+		prefix("5400", v)
+	}
+	if len(diffs) > 0 {
+		return errors.New(strings.Join(diffs, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 The Moov Authors
+// Use of this source code is governed by an Apache License
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWire__readFEDWireTags(t *testing.T) {
+	contents := "{1500}30apitest T \n{1510}1000\n{2000}000000001234\n{3100}121042882Wells Fargo NA    \n{3600}CTR\n{4200}D1234567890                        Jane Doe                           *\n"
+	tags := readFEDWireTags(contents)
+	if len(tags) != 6 || tags["2000"] != "000000001234" || tags["3100"] != "121042882Wells Fargo NA" || tags["3600"] != "CTR" {
+		t.Errorf("unexpected tags: %#v", tags)
+	}
+
+	// all tags on one line
+	tags = readFEDWireTags(strings.Replace(contents, "\n", "", -1))
+	if len(tags) != 6 || tags["1510"] != "1000" || !strings.HasSuffix(tags["4200"], "Jane Doe") {
+		t.Errorf("unexpected tags: %#v", tags)
+	}
+}
+
+func TestWire__compareFEDWireTags(t *testing.T) {
+	fwm := newFEDWireMessage("DRC", time.Now())
+	tags := map[string]string{
+		"1510": "1031",
+		"2000": "000000001234",
+		"3100": "121042882Wells Fargo NA",
+		"3400": "231380104Citadel",
+		"3600": "DRC",
+		"4200": "D1234567890   Jane Doe",
+		"4400": "D*9876543210*John Doe*",
+		"5400": "123456789",
+	}
+	if err := compareFEDWireTags(fwm, tags); err != nil {
+		t.Error(err)
+	}
+
+	tags["2000"] = "000000005678"
+	delete(tags, "5400")
+	tags["4200"] = "D1234567890   John Doe"
+	err := compareFEDWireTags(fwm, tags)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, tag := range []string{"{2000}", "{5400} is missing", "{4200}"} {
+		if !strings.Contains(err.Error(), tag) {
+			t.Errorf("%s isn't in %v", tag, err)
+		}
+	}
+}
+
+func TestWire__newFEDWireMessage(t *testing.T) {
+	now := time.Now()
+	for _, bfc := range wireBusinessFunctionCodes {
+		fwm := newFEDWireMessage(bfc, now)
+		if fwm.BusinessFunctionCode.BusinessFunctionCode != bfc || fwm.Beneficiary.Name == "" {
+			t.Errorf("%s: unexpected message: %#v", bfc, fwm)
+		}
+		if (bfc == "DRC") != (fwm.AccountDebitedDrawdown.Identifier != "") {
+			t.Errorf("%s: unexpected drawdown: %#v", bfc, fwm.AccountDebitedDrawdown)
+		}
+	}
+	for _, c := range invalidFEDWireMessages(now) {
+		if c.field == "" || c.fwm.SenderSupplied.FormatVersion == "" {
+			t.Errorf("%s: unexpected case: %#v", c.name, c)
+		}
+	}
+}
@@ -4,11 +4,13 @@ require (
 	github.com/antihax/optional v1.0.0
 	github.com/docker/docker v1.13.1
 	github.com/go-kit/kit v0.10.0
+	github.com/gorilla/mux v1.7.3
 	github.com/moov-io/ach v1.3.1
 	github.com/moov-io/base v0.11.1-0.20200130212608-140496be02c3
 	github.com/moov-io/go-client v0.3.1-0.20200409015039-95d1026667d1
 	github.com/prometheus/client_golang v1.5.1
 	go4.org v0.0.0-20200406031205-0882d5f8a577
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 go 1.13